@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const abortAction = "abort-incomplete"
+
+// Abort represents the plugin configuration for aborting incomplete uploads.
+type Abort struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets path to the objects of the uploads to be aborted
+	Path string
+	// sets the path prefix for the objects of the uploads to be aborted
+	Prefix string
+	// sets the age of the incomplete uploads to abort
+	Age time.Duration
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// whether to report the uploads to abort without aborting them
+	DryRun bool
+	// will hold our final namespace for the path to the objects
+	Namespace string
+}
+
+// Exec formats and runs the actions for aborting incomplete uploads in s3.
+func (a *Abort) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running abort-incomplete with provided configuration")
+
+	res.Key = a.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+
+	// end the namespace with a delimiter so the uploads
+	// of sibling namespaces are never aborted
+	uploads, err := store.ListUploads(ctx, a.Bucket, a.Namespace+"/")
+	if err != nil {
+		return fmt.Errorf("unable to list incomplete uploads in path %s: %w", a.Namespace, err)
+	}
+
+	logrus.Infof("found %d incomplete uploads in path %s", len(uploads), a.Namespace)
+
+	// determine time in the past for the abort cut off
+	cutoff := time.Now().Add(-a.Age)
+
+	errs := []error{}
+
+	for _, upload := range uploads {
+		// leave the uploads of rebuilds that may still be running
+		if upload.Initiated.After(cutoff) {
+			logrus.Debugf("keeping incomplete upload of %s initiated %s", upload.Key, upload.Initiated.Format(time.RFC3339))
+
+			continue
+		}
+
+		if a.DryRun {
+			logrus.Infof("dry run: incomplete upload of %s initiated %s would be aborted", upload.Key, upload.Initiated.Format(time.RFC3339))
+
+			res.Aborted++
+
+			continue
+		}
+
+		err = store.AbortUpload(ctx, a.Bucket, upload)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to abort incomplete upload of %s: %w", upload.Key, err))
+
+			continue
+		}
+
+		logrus.Infof("aborted incomplete upload of %s initiated %s", upload.Key, upload.Initiated.Format(time.RFC3339))
+
+		res.Aborted++
+	}
+
+	logrus.Debug("cache abort-incomplete action completed")
+
+	return errors.Join(errs...)
+}
+
+// Configure prepares the abort fields for the action to be taken.
+func (a *Abort) Configure(repo *Repo) error {
+	logrus.Trace("configuring abort-incomplete action")
+
+	// construct the object path
+	path, err := buildNamespace(repo, a.Prefix, a.Path, "")
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	// store it in the namespace
+	a.Namespace = path
+
+	return nil
+}
+
+// Validate verifies the Abort is properly configured.
+func (a *Abort) Validate() error {
+	logrus.Trace("validating abort-incomplete action configuration")
+
+	// verify bucket is provided
+	if len(a.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify timeout is provided
+	if a.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	// verify age is not negative
+	if a.Age < 0 {
+		return fmt.Errorf("age must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_Abort_Exec(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	testCases := []struct {
+		desc   string
+		dryRun bool
+		want   []string
+	}{
+		{desc: "abort", want: []string{"foo/bar/archive.tgz"}},
+		{desc: "dry run", dryRun: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := newFakeBackend()
+			store.uploads = []storage.Upload{
+				{Key: "foo/bar/archive.tgz", UploadID: "1", Initiated: now.Add(-48 * time.Hour)},
+				{Key: "foo/bar/running.tgz", UploadID: "2", Initiated: now.Add(-time.Hour)},
+				{Key: "foo/bar-other/archive.tgz", UploadID: "3", Initiated: now.Add(-48 * time.Hour)},
+			}
+
+			a := &Abort{
+				Bucket:    "bucket",
+				Age:       24 * time.Hour,
+				Timeout:   10 * time.Minute,
+				DryRun:    tC.dryRun,
+				Namespace: "foo/bar",
+			}
+
+			res := new(Result)
+
+			err := a.Exec(context.Background(), store, res)
+			if err != nil {
+				t.Fatalf("Exec returned err: %v", err)
+			}
+
+			if res.Aborted != 1 {
+				t.Errorf("Aborted is %d, want 1", res.Aborted)
+			}
+
+			if !reflect.DeepEqual(store.aborted, tC.want) {
+				t.Errorf("aborted is %v, want %v", store.aborted, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Abort_Validate(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		abort   *Abort
+		wantErr bool
+	}{
+		{
+			desc:  "valid",
+			abort: &Abort{Bucket: "bucket", Timeout: 10 * time.Minute, Age: 24 * time.Hour},
+		},
+		{
+			desc:    "no bucket",
+			abort:   &Abort{Timeout: 10 * time.Minute},
+			wantErr: true,
+		},
+		{
+			desc:    "no timeout",
+			abort:   &Abort{Bucket: "bucket"},
+			wantErr: true,
+		},
+		{
+			desc:    "negative age",
+			abort:   &Abort{Bucket: "bucket", Timeout: 10 * time.Minute, Age: -time.Hour},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.abort.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const (
+	// accelerationProbe represents the name of the object looked up
+	// to verify the accelerated endpoint serves the bucket.
+	accelerationProbe = ".vela-s3-cache-accelerate"
+
+	// accelerationProbeTimeout represents the timeout
+	// for probing the accelerated endpoint.
+	accelerationProbeTimeout = 10 * time.Second
+)
+
+// withAccelerationFallback probes the accelerated endpoint with the store
+// and creates a store using the standard endpoint instead when the probe
+// fails, so a misconfigured acceleration does not fail the whole action.
+func (c *Config) withAccelerationFallback(store storage.Backend) (storage.Backend, error) {
+	logrus.Debugf("probing accelerated endpoint %s for bucket %s", c.AcceleratedEndpoint, c.Bucket)
+
+	err := probeAcceleration(store, c.Bucket)
+	if err == nil {
+		return store, nil
+	}
+
+	logrus.Warnf("accelerated endpoint %s failed for bucket %s, falling back to the standard endpoint: %v",
+		c.AcceleratedEndpoint, c.Bucket, err)
+
+	cfg := *c
+	cfg.AcceleratedEndpoint = ""
+
+	return cfg.newBackend()
+}
+
+// probeAcceleration is a helper function to look up the probe object in
+// the bucket, returning an error unless the endpoint answered for the bucket.
+func probeAcceleration(store storage.Backend, bucket string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), accelerationProbeTimeout)
+	defer cancel()
+
+	_, err := store.Stat(ctx, bucket, accelerationProbe)
+	if err == nil {
+		return nil
+	}
+
+	// a missing object or permission still means the endpoint serves the bucket,
+	// while acceleration disabled for the bucket is refused as a bad request
+	var resp *storage.ResponseError
+	if errors.As(err, &resp) && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// statErrorBackend is a fake backend failing every stat with the error.
+type statErrorBackend struct {
+	*fakeBackend
+	err error
+}
+
+// Stat always fails with the error of the backend.
+func (b statErrorBackend) Stat(context.Context, string, string) (storage.Object, error) {
+	return storage.Object{}, b.err
+}
+
+func TestS3Cache_probeAcceleration(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		err     error
+		wantErr bool
+	}{
+		{
+			desc: "found",
+		},
+		{
+			desc: "not found",
+			err:  &storage.ResponseError{StatusCode: http.StatusNotFound, Err: errors.New("not found")},
+		},
+		{
+			desc: "forbidden",
+			err:  &storage.ResponseError{StatusCode: http.StatusForbidden, Err: errors.New("access denied")},
+		},
+		{
+			desc:    "acceleration not configured",
+			err:     &storage.ResponseError{StatusCode: http.StatusBadRequest, Err: errors.New("invalid request")},
+			wantErr: true,
+		},
+		{
+			desc:    "unreachable",
+			err:     errors.New("dial tcp: no such host"),
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := probeAcceleration(statErrorBackend{fakeBackend: newFakeBackend(), err: tC.err}, "bucket")
+			if (err != nil) != tC.wantErr {
+				t.Errorf("probeAcceleration returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
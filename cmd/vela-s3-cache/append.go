@@ -0,0 +1,459 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// tarTrailerSize represents the size of the
+// two zero blocks ending a tar stream.
+const tarTrailerSize = 2 * 512
+
+// appendMaxStale represents the share of the contents of an archive
+// superseded by appended entries above which the archive is rebuilt.
+const appendMaxStale = 0.5
+
+// gzipTrailer returns the gzip member holding the end of the tar stream,
+// which is written separately so the entries before it can be appended
+// to without decompressing and compressing the archive again.
+var gzipTrailer = sync.OnceValue(func() []byte {
+	buf := new(bytes.Buffer)
+
+	gw := gzip.NewWriter(buf)
+
+	_, _ = gw.Write(make([]byte, tarTrailerSize))
+	_ = gw.Close()
+
+	return buf.Bytes()
+})
+
+// trailerWriter is a writer holding back the last bytes
+// written to it, so the end of the tar stream can be
+// written to a separate gzip member.
+type trailerWriter struct {
+	w    io.Writer
+	held []byte
+}
+
+// Write writes all but the last bytes of the stream to the underlying writer.
+func (t *trailerWriter) Write(b []byte) (int, error) {
+	// hold back the end of b when it fills the trailer on its own
+	if len(b) >= tarTrailerSize {
+		_, err := t.w.Write(t.held)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = t.w.Write(b[:len(b)-tarTrailerSize])
+		if err != nil {
+			return 0, err
+		}
+
+		t.held = append(t.held[:0], b[len(b)-tarTrailerSize:]...)
+
+		return len(b), nil
+	}
+
+	t.held = append(t.held, b...)
+
+	if n := len(t.held) - tarTrailerSize; n > 0 {
+		_, err := t.w.Write(t.held[:n])
+		if err != nil {
+			return 0, err
+		}
+
+		t.held = append(t.held[:0], t.held[n:]...)
+	}
+
+	return len(b), nil
+}
+
+// Close reports whether the held bytes are the end of the tar
+// stream, writing them to the underlying writer when they are not.
+func (t *trailerWriter) Close() (bool, error) {
+	if len(t.held) == tarTrailerSize && bytes.Count(t.held, []byte{0}) == tarTrailerSize {
+		return true, nil
+	}
+
+	_, err := t.w.Write(t.held)
+
+	return false, err
+}
+
+// archiveEntry represents the information of an
+// entry in a previous archive to detect changes.
+type archiveEntry struct {
+	mode     os.FileMode
+	size     int64
+	modTime  time.Time
+	linkname string
+}
+
+// readEntries is a helper function to read the entries of the archive,
+// keeping the last entry for each name, along with the bytes of the
+// contents of every entry and the bytes superseded by later entries.
+func readEntries(archive string) (map[string]archiveEntry, int64, int64, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+
+	// the reader continues through every gzip member of the archive
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	entries := map[string]archiveEntry{}
+	total := int64(0)
+	stale := int64(0)
+
+	tr := tar.NewReader(gr)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, total, stale, nil
+		}
+
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+
+		if e, ok := entries[name]; ok {
+			stale += e.size
+		}
+
+		total += hdr.Size
+
+		entries[name] = archiveEntry{
+			mode:     hdr.FileInfo().Mode(),
+			size:     hdr.Size,
+			modTime:  hdr.ModTime,
+			linkname: hdr.Linkname,
+		}
+	}
+}
+
+// trailerOffset is a helper function to return the offset of the gzip
+// member ending the tar stream of the archive, reporting whether the
+// archive ends with the member and can be appended to.
+func trailerOffset(archive string) (int64, bool, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	trailer := gzipTrailer()
+
+	offset := info.Size() - int64(len(trailer))
+	if offset < 0 {
+		return 0, false, nil
+	}
+
+	b := make([]byte, len(trailer))
+
+	_, err = f.ReadAt(b, offset)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return offset, bytes.Equal(b, trailer), nil
+}
+
+// appendPrevious writes the previous archive without its trailer to out,
+// followed by a gzip member with the entries of the mounts changed since,
+// reporting whether the archive was appended to or must be rebuilt. Nothing
+// is written to out when the archive must be rebuilt.
+func (p *packer) appendPrevious(out io.Writer, mounts []string) (bool, error) {
+	offset, ok, err := trailerOffset(p.previous)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		logrus.Info("previous archive was not built to be appended to, rebuilding archive")
+
+		return false, nil
+	}
+
+	entries, total, stale, err := readEntries(p.previous)
+	if err != nil {
+		logrus.Warnf("unable to read previous archive, rebuilding archive: %v", err)
+
+		return false, nil
+	}
+
+	p.entries = entries
+
+	defer func() { p.entries, p.seen = nil, nil }()
+
+	// decide whether to append before copying or compressing anything
+	ok, err = p.appendable(mounts, total, stale)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	f, err := os.Open(p.previous)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// copy the compressed entries of the previous archive as is
+	_, err = io.Copy(out, io.NewSectionReader(f, 0, offset))
+	if err != nil {
+		return false, err
+	}
+
+	p.seen = map[string]bool{}
+	p.changed, p.added, p.replaced = 0, 0, 0
+
+	err = p.packGzip(out, func(tw *tar.Writer) error {
+		return p.walkMounts(tw, mounts)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	logrus.Infof("appended %d changed entries (%s) to the previous archive", p.changed, humanize.Bytes(uint64(p.added)))
+
+	return true, nil
+}
+
+// appendable walks the mounts without archiving them, reporting whether
+// the changed entries can be appended to the previous archive with the
+// total and stale bytes of contents instead of rebuilding it.
+func (p *packer) appendable(mounts []string, total, stale int64) (bool, error) {
+	p.seen = map[string]bool{}
+
+	// record the changed entries in a manifest instead of archiving them
+	p.manifest = []string{}
+	defer func() { p.manifest = nil }()
+
+	err := p.walkMounts(nil, mounts)
+	if err != nil {
+		return false, err
+	}
+
+	// entries can only be replaced by appending, not removed
+	removed := 0
+
+	for name := range p.entries {
+		if !p.seen[name] {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		logrus.Infof("%d entries were removed since the previous archive, rebuilding archive", removed)
+
+		return false, nil
+	}
+
+	// rebuild the archive once it is mostly superseded entries
+	total += p.added
+	stale += p.replaced
+
+	if total > 0 && float64(stale) > float64(total)*appendMaxStale {
+		logrus.Infof("%s of %s in the archive are superseded entries, rebuilding archive",
+			humanize.Bytes(uint64(stale)), humanize.Bytes(uint64(total)))
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// unchanged reports whether the entry is unchanged since the previous
+// archive, recording the bytes of the entries to append when it is not.
+func (p *packer) unchanged(fpath, name string, info os.FileInfo) (bool, error) {
+	if p.entries == nil {
+		return false, nil
+	}
+
+	name = strings.TrimSuffix(name, "/")
+	p.seen[name] = true
+
+	e, ok := p.entries[name]
+
+	same := ok && e.mode == p.mode(info)
+
+	switch {
+	case !same, info.IsDir():
+		// directories only need to exist
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(fpath)
+		if err != nil {
+			return false, fmt.Errorf("%s: readlink: %w", fpath, err)
+		}
+
+		same = filepath.ToSlash(target) == e.linkname
+	default:
+		same = e.size == info.Size() && e.modTime.Equal(info.ModTime())
+	}
+
+	if same {
+		return true, nil
+	}
+
+	p.changed++
+
+	if ok {
+		p.replaced += e.size
+	}
+
+	if info.Mode().IsRegular() {
+		p.added += info.Size()
+	}
+
+	return false, nil
+}
+
+// previousArchive returns the path of the previous archive to append
+// the changed files to, falling back to rebuilding the archive when
+// there is no usable previous archive.
+func (r *Rebuild) previousArchive(ctx context.Context, store storage.Backend) (string, error) {
+	// only the compressed archives are written to be appended to
+	if r.format != cacheFormat {
+		logrus.Infof("unable to append to %s archives, rebuilding archive", r.format)
+
+		return "", nil
+	}
+
+	path, err := r.fetchPrevious(ctx, store)
+	if err != nil {
+		// stop when the build was cancelled
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		logrus.Warnf("unable to retrieve previous archive, rebuilding archive: %v", err)
+
+		return "", nil
+	}
+
+	return path, nil
+}
+
+// fetchPrevious downloads the current cache object to append the changed
+// entries to, returning no path when there is no usable previous archive.
+func (r *Rebuild) fetchPrevious(ctx context.Context, store storage.Backend) (string, error) {
+	sCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	info, err := store.Stat(sCtx, r.Bucket, r.Namespace)
+	if err != nil {
+		logrus.Infof("no previous archive found at %s to append to: %v", r.Namespace, err)
+
+		return "", nil
+	}
+
+	if len(userMetadata(info, metaParts)) > 0 {
+		logrus.Info("previous archive is split into parts, rebuilding archive")
+
+		return "", nil
+	}
+
+	encrypted := len(userMetadata(info, metaEncryption)) > 0
+	if encrypted && len(r.EncryptionKey) == 0 {
+		logrus.Info("previous archive is encrypted, no encryption key provided to append to it")
+
+		return "", nil
+	}
+
+	logrus.Debugf("downloading previous archive %s to append to, %s", r.Namespace, humanize.Bytes(uint64(info.Size)))
+
+	// set a timeout on the transfer based on the size of the object
+	tCtx, tCancel := context.WithTimeout(ctx, transferTimeout(r.Timeout, r.TimeoutPerGB, info.Size))
+	defer tCancel()
+
+	obj, err := store.Get(tCtx, r.Bucket, r.Namespace)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	f, err := createTemp(r.TmpDir, r.Filename)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeFile(f, obj)
+	if err == nil {
+		err = r.verifyPrevious(f, info, encrypted)
+	}
+
+	if err != nil {
+		removeTemp(f)
+
+		return "", err
+	}
+
+	return f, nil
+}
+
+// verifyPrevious verifies the downloaded previous archive
+// like a restore would and decrypts it when encrypted.
+func (r *Rebuild) verifyPrevious(path string, info storage.Object, encrypted bool) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	if !verifyChecksum(info, sum) || !verifySignature(info, r.SigningKey, r.Namespace, sum) {
+		return fmt.Errorf("previous archive failed verification")
+	}
+
+	if encrypted {
+		return decryptFile(path, r.EncryptionKey)
+	}
+
+	return nil
+}
+
+// writeFile is a helper function to write the contents of the reader to the file.
+func writeFile(path string, reader io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, reader)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,312 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCacheFiles is a helper function to write the files with their
+// contents, setting the modification time to force a detected change.
+func writeCacheFiles(t *testing.T, files map[string]string, modified time.Time) {
+	t.Helper()
+
+	for name, body := range files {
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(name, []byte(body), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(name, modified, modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestS3Cache_packer_pack_Trailer(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	writeCacheFiles(t, map[string]string{"cache/one.txt": "one"}, time.Now())
+
+	err := new(packer).pack([]string{"cache"}, "archive.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	_, ok, err := trailerOffset("archive.tgz")
+	if err != nil || !ok {
+		t.Errorf("archive does not end with the trailer member: %v", err)
+	}
+}
+
+func TestS3Cache_packer_appendPrevious(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	old := time.Now().Add(-time.Hour)
+
+	writeCacheFiles(t, map[string]string{
+		"cache/one.txt": "one",
+		"cache/two.txt": "two",
+		"cache/big.txt": string(bytes.Repeat([]byte("x"), 4096)),
+	}, old)
+
+	err := new(packer).pack([]string{"cache"}, "previous.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	// change a file and add another
+	writeCacheFiles(t, map[string]string{"cache/two.txt": "2", "cache/three.txt": "three"}, time.Now())
+
+	p := &packer{previous: "previous.tgz"}
+
+	err = p.pack([]string{"cache"}, "archive.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	if p.changed != 2 {
+		t.Errorf("changed is %d, want 2", p.changed)
+	}
+
+	// verify the compressed entries of the previous archive were kept
+	offset, _, err := trailerOffset("previous.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := os.ReadFile("previous.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := os.ReadFile("archive.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(archive, previous[:offset]) {
+		t.Errorf("archive does not start with the previous archive")
+	}
+
+	// verify the appended entries replace the previous entries
+	dir := filepath.Join(t.TempDir(), "dest")
+
+	err = new(extractor).extract("archive.tgz", dir)
+	if err != nil {
+		t.Fatalf("extract returned err: %v", err)
+	}
+
+	want := map[string]string{"one.txt": "one", "two.txt": "2", "three.txt": "three"}
+
+	for name, body := range want {
+		got, err := os.ReadFile(filepath.Join(dir, "cache", name))
+		if err != nil || string(got) != body {
+			t.Errorf("%s is %q, want %q: %v", name, got, body, err)
+		}
+	}
+}
+
+func TestS3Cache_packer_appendPrevious_Rebuild(t *testing.T) {
+	// setup types
+	old := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		desc   string
+		change func(t *testing.T)
+	}{
+		{
+			desc: "removed file",
+			change: func(t *testing.T) {
+				err := os.Remove("cache/two.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			desc: "mostly superseded",
+			change: func(t *testing.T) {
+				writeCacheFiles(t, map[string]string{"cache/big.txt": "y"}, time.Now())
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			chdir(t, t.TempDir())
+
+			writeCacheFiles(t, map[string]string{
+				"cache/one.txt": "one",
+				"cache/two.txt": "two",
+				"cache/big.txt": string(bytes.Repeat([]byte("x"), 4096)),
+			}, old)
+
+			err := new(packer).pack([]string{"cache"}, "previous.tgz")
+			if err != nil {
+				t.Fatalf("pack returned err: %v", err)
+			}
+
+			tC.change(t)
+
+			// verify nothing is compressed before deciding to rebuild
+			out := new(bytes.Buffer)
+
+			ok, err := (&packer{previous: "previous.tgz"}).appendPrevious(out, []string{"cache"})
+			if err != nil || ok {
+				t.Fatalf("appendPrevious returned %t, err: %v", ok, err)
+			}
+
+			if out.Len() > 0 {
+				t.Errorf("appendPrevious wrote %d bytes, want none", out.Len())
+			}
+
+			err = (&packer{previous: "previous.tgz"}).pack([]string{"cache"}, "archive.tgz")
+			if err != nil {
+				t.Fatalf("pack returned err: %v", err)
+			}
+
+			// verify the archive was rebuilt without superseded entries
+			_, _, stale, err := readEntries("archive.tgz")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stale != 0 {
+				t.Errorf("archive has %d superseded bytes, want 0", stale)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Append(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	writeCacheFiles(t, map[string]string{
+		"cache/one.txt": "one",
+		"cache/big.txt": string(bytes.Repeat([]byte("x"), 4096)),
+	}, time.Now().Add(-time.Hour))
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:           "bucket",
+		Filename:         "archive.tgz",
+		Timeout:          10 * time.Minute,
+		Mount:            []string{"cache"},
+		Namespace:        "foo/bar/archive.tgz",
+		CompressionLevel: autoCompression,
+		Append:           true,
+		format:           cacheFormat,
+	}
+
+	// verify the first rebuild has no previous archive
+	err := r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	previous := store.objects["foo/bar/archive.tgz"].data
+
+	writeCacheFiles(t, map[string]string{"cache/two.txt": "two"}, time.Now())
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	archive := store.objects["foo/bar/archive.tgz"].data
+
+	if !bytes.HasPrefix(archive, previous[:len(previous)-len(gzipTrailer())]) {
+		t.Errorf("object was not appended to the previous archive")
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Append_Restored(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	writeCacheFiles(t, map[string]string{
+		"cache/one.txt": "one",
+		"cache/big.txt": string(bytes.Repeat([]byte("x"), 4096)),
+	}, time.Now().Add(-time.Hour))
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:           "bucket",
+		Filename:         "archive.tgz",
+		Timeout:          10 * time.Minute,
+		Mount:            []string{"cache"},
+		Namespace:        "foo/bar/archive.tgz",
+		CompressionLevel: autoCompression,
+		Append:           true,
+		format:           cacheFormat,
+	}
+
+	err := r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	previous := store.objects["foo/bar/archive.tgz"].data
+
+	// restore the cache into a fresh workspace, keeping the archived modification times
+	chdir(t, t.TempDir())
+
+	restore := &Restore{
+		Bucket:         "bucket",
+		Filename:       "archive.tgz",
+		Timeout:        10 * time.Minute,
+		Namespace:      "foo/bar/archive.tgz",
+		PreserveMtimes: true,
+	}
+
+	err = restore.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	writeCacheFiles(t, map[string]string{"cache/two.txt": "two"}, time.Now())
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	archive := store.objects["foo/bar/archive.tgz"].data
+
+	if !bytes.HasPrefix(archive, previous[:len(previous)-len(gzipTrailer())]) {
+		t.Errorf("object was not appended to the previous archive")
+	}
+
+	// verify only the new file was appended to the restored archive
+	appended := filepath.Join(t.TempDir(), "archive.tgz")
+
+	err = os.WriteFile(appended, archive, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, stale, err := readEntries(appended)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stale != 0 {
+		t.Errorf("archive has %d superseded bytes, want 0", stale)
+	}
+}
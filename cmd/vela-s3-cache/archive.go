@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/archiver/v3"
+)
+
+// entry represents a single file contained in an archive.
+type entry struct {
+	name string
+	size int64
+}
+
+// logEntries is a helper function to log the first n entries
+// and the largest n entries contained in the archive of the format.
+func logEntries(archive, format string, n int) error {
+	if n <= 0 || !logrus.IsLevelEnabled(logrus.DebugLevel) {
+		return nil
+	}
+
+	logrus.Tracef("listing entries in archive %s", archive)
+
+	first := []entry{}
+	largest := []entry{}
+	count := 0
+
+	var w archiver.Walker = archiver.NewTarGz()
+	if format == tarFormat {
+		w = archiver.NewTar()
+	}
+
+	err := w.Walk(archive, func(f archiver.File) error {
+		e := entry{name: f.Name(), size: f.Size()}
+
+		// use the full path of the entry when available
+		if hdr, ok := f.Header.(*tar.Header); ok {
+			// skip the metadata embedded in the archive
+			if hdr.Typeflag == tar.TypeXGlobalHeader {
+				return nil
+			}
+
+			e.name = hdr.Name
+		}
+
+		count++
+
+		if len(first) < n {
+			first = append(first, e)
+		}
+
+		if f.IsDir() {
+			return nil
+		}
+
+		largest = append(largest, e)
+
+		// only retain the largest n entries
+		sort.SliceStable(largest, func(i, j int) bool {
+			return largest[i].size > largest[j].size
+		})
+
+		if len(largest) > n {
+			largest = largest[:n]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("archive %s contains %d entries, first %d:", archive, count, len(first))
+
+	for _, e := range first {
+		logrus.Debugf("  - %s (%s)", e.name, humanize.Bytes(uint64(e.size)))
+	}
+
+	logrus.Debugf("archive %s largest %d entries:", archive, len(largest))
+
+	for _, e := range largest {
+		logrus.Debugf("  - %s (%s)", e.name, humanize.Bytes(uint64(e.size)))
+	}
+
+	return nil
+}
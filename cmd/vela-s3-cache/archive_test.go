@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/archiver/v3"
+)
+
+func TestS3Cache_logEntries(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), "archive.tgz")
+
+	err := archiver.NewTarGz().Archive([]string{"testdata"}, file)
+	if err != nil {
+		t.Fatalf("unable to create archive: %v", err)
+	}
+
+	level := logrus.GetLevel()
+	defer logrus.SetLevel(level)
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+	err = logEntries(file, cacheFormat, 5)
+	if err != nil {
+		t.Errorf("logEntries returned err: %v", err)
+	}
+}
+
+func TestS3Cache_logEntries_Missing(t *testing.T) {
+	// setup types
+	level := logrus.GetLevel()
+	defer logrus.SetLevel(level)
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+	err := logEntries("testdata/missing.tgz", cacheFormat, 5)
+	if err == nil {
+		t.Errorf("logEntries should have returned err")
+	}
+}
@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// Audit represents the plugin configuration for the audit log.
+type Audit struct {
+	// sets the file, or stdout or stderr, to append the audit records to
+	Path string
+
+	// will hold the opened audit log
+	w io.WriteCloser
+}
+
+// auditRecord represents the JSON line written to the
+// audit log for each operation modifying the bucket.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Org       string    `json:"org"`
+	Repo      string    `json:"repo"`
+	Build     int       `json:"build,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Event     string    `json:"event,omitempty"`
+	Link      string    `json:"link,omitempty"`
+	Action    string    `json:"action"`
+	Operation string    `json:"operation"`
+	Bucket    string    `json:"bucket"`
+	Keys      []string  `json:"keys"`
+	Bytes     int64     `json:"bytes"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Wrap opens the audit log and wraps the storage backend to write
+// an audit record for every upload and delete against the bucket.
+func (a *Audit) Wrap(store storage.Backend, repo *Repo, build *Build, action string) (storage.Backend, error) {
+	if a == nil || len(a.Path) == 0 || store == nil {
+		return store, nil
+	}
+
+	logrus.Debugf("writing audit records to %s", a.Path)
+
+	switch a.Path {
+	case "stdout":
+		a.w = nopWriteCloser{os.Stdout}
+	case "stderr":
+		a.w = nopWriteCloser{os.Stderr}
+	default:
+		err := os.MkdirAll(filepath.Dir(a.Path), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create directory for audit log %s: %w", a.Path, err)
+		}
+
+		f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit log %s: %w", a.Path, err)
+		}
+
+		a.w = f
+	}
+
+	if build == nil {
+		build = &Build{}
+	}
+
+	return &auditBackend{
+		Backend: store,
+		w:       a.w,
+		record: auditRecord{
+			Org:    repo.Owner,
+			Repo:   repo.Name,
+			Build:  build.Number,
+			Author: build.Author,
+			Event:  build.Event,
+			Link:   build.Link,
+			Action: action,
+		},
+	}, nil
+}
+
+// Close closes the audit log opened by Wrap.
+func (a *Audit) Close() error {
+	if a == nil || a.w == nil {
+		return nil
+	}
+
+	return a.w.Close()
+}
+
+// nopWriteCloser is an io.WriteCloser leaving
+// the standard streams open when closed.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error { return nil }
+
+// auditBackend is a storage.Backend writing an audit record
+// for each operation modifying the bucket, passing every
+// operation through to the wrapped backend.
+type auditBackend struct {
+	storage.Backend
+
+	mu     sync.Mutex
+	w      io.Writer
+	record auditRecord
+}
+
+// audit writes the audit record for the operation, logging a
+// warning rather than failing the operation when it can't.
+func (a *auditBackend) audit(op, bucket string, keys []string, size int64, err error) {
+	record := a.record
+
+	record.Time = time.Now().UTC()
+	record.Operation = op
+	record.Bucket = bucket
+	record.Keys = keys
+	record.Bytes = size
+	record.Success = err == nil
+
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	line, mErr := json.Marshal(record)
+	if mErr != nil {
+		logrus.Warnf("unable to create audit record for %s: %v", op, mErr)
+
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, wErr := a.w.Write(append(line, '\n'))
+	if wErr != nil {
+		logrus.Warnf("unable to write audit record for %s: %v", op, wErr)
+	}
+}
+
+// Put uploads the contents of the reader to the key in the bucket.
+func (a *auditBackend) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts storage.PutOptions) (storage.Object, error) {
+	object, err := a.Backend.Put(ctx, bucket, key, reader, size, opts)
+
+	// the size of uploads from a stream is only known afterwards
+	if err == nil {
+		size = object.Size
+	}
+
+	a.audit("put", bucket, []string{key}, max(size, 0), err)
+
+	return object, err
+}
+
+// Copy copies the source key to the destination key in the bucket.
+func (a *auditBackend) Copy(ctx context.Context, bucket, src, dst string, opts storage.PutOptions) (storage.Object, error) {
+	object, err := a.Backend.Copy(ctx, bucket, src, dst, opts)
+
+	a.audit("copy", bucket, []string{src, dst}, object.Size, err)
+
+	return object, err
+}
+
+// SetTags replaces the tags of the key in the bucket.
+func (a *auditBackend) SetTags(ctx context.Context, bucket, key string, tags map[string]string) error {
+	err := a.Backend.SetTags(ctx, bucket, key, tags)
+
+	a.audit("set_tags", bucket, []string{key}, 0, err)
+
+	return err
+}
+
+// Remove deletes the objects from the bucket, auditing the
+// removed objects and the objects that could not be removed.
+func (a *auditBackend) Remove(ctx context.Context, bucket string, objects []storage.Object) []storage.RemoveError {
+	rErrs := a.Backend.Remove(ctx, bucket, objects)
+
+	failed := make(map[string]bool, len(rErrs))
+
+	for _, rErr := range rErrs {
+		failed[rErr.Object.Key+"\x00"+rErr.Object.VersionID] = true
+
+		a.audit("delete", bucket, []string{rErr.Object.Key}, 0, rErr.Err)
+	}
+
+	keys := []string{}
+	size := int64(0)
+
+	for _, object := range objects {
+		if failed[object.Key+"\x00"+object.VersionID] {
+			continue
+		}
+
+		keys = append(keys, object.Key)
+		size += object.Size
+	}
+
+	if len(keys) > 0 {
+		a.audit("delete", bucket, keys, size, nil)
+	}
+
+	return rErrs
+}
+
+// Abort removes the parts of any incomplete uploads for the key in the bucket.
+func (a *auditBackend) Abort(ctx context.Context, bucket, key string) error {
+	err := a.Backend.Abort(ctx, bucket, key)
+
+	a.audit("abort_upload", bucket, []string{key}, 0, err)
+
+	return err
+}
+
+// AbortUpload removes the parts of the incomplete upload in the bucket.
+func (a *auditBackend) AbortUpload(ctx context.Context, bucket string, upload storage.Upload) error {
+	err := a.Backend.AbortUpload(ctx, bucket, upload)
+
+	a.audit("abort_upload", bucket, []string{upload.Key}, 0, err)
+
+	return err
+}
+
+// SetLifecycle creates or replaces the rule in the lifecycle configuration of the bucket.
+func (a *auditBackend) SetLifecycle(ctx context.Context, bucket string, rule storage.LifecycleRule) error {
+	err := a.Backend.SetLifecycle(ctx, bucket, rule)
+
+	a.audit("set_lifecycle", bucket, []string{}, 0, err)
+
+	return err
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// readAudit is a helper function to decode the records of the audit log.
+func readAudit(t *testing.T, path string) []auditRecord {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unable to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	records := []auditRecord{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := auditRecord{}
+
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			t.Fatalf("unable to decode audit record %s: %v", scanner.Text(), err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestS3Cache_Audit_Wrap(t *testing.T) {
+	// setup types
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+	a := &Audit{Path: path}
+
+	fake := newFakeBackend()
+	fake.add("foo/bar/old.tgz", []byte("old"), time.Now(), nil)
+
+	store, err := a.Wrap(fake, &Repo{Owner: "foo", Name: "bar"}, &Build{Number: 1, Author: "octocat"}, rebuildAction)
+	if err != nil {
+		t.Fatalf("Wrap returned err: %v", err)
+	}
+
+	_, err = store.Put(context.Background(), "bucket", "foo/bar/archive.tgz", strings.NewReader("hello"), -1, storage.PutOptions{})
+	if err != nil {
+		t.Errorf("Put returned err: %v", err)
+	}
+
+	// reads are not audited
+	_, err = store.Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Errorf("Stat returned err: %v", err)
+	}
+
+	rErrs := store.Remove(context.Background(), "bucket", []storage.Object{{Key: "foo/bar/old.tgz", Size: 3}})
+	if len(rErrs) > 0 {
+		t.Errorf("Remove returned errs: %v", rErrs)
+	}
+
+	err = a.Close()
+	if err != nil {
+		t.Errorf("Close returned err: %v", err)
+	}
+
+	records := readAudit(t, path)
+
+	if len(records) != 2 {
+		t.Fatalf("audit log has %d records, want 2", len(records))
+	}
+
+	put := records[0]
+
+	if put.Operation != "put" || put.Author != "octocat" || put.Build != 1 || put.Action != rebuildAction || put.Bytes != 5 || !put.Success {
+		t.Errorf("put record is %+v", put)
+	}
+
+	if put.Org != "foo" || put.Repo != "bar" || put.Bucket != "bucket" || len(put.Keys) != 1 || put.Keys[0] != "foo/bar/archive.tgz" {
+		t.Errorf("put record is %+v", put)
+	}
+
+	del := records[1]
+
+	if del.Operation != "delete" || del.Bytes != 3 || len(del.Keys) != 1 || del.Keys[0] != "foo/bar/old.tgz" || !del.Success {
+		t.Errorf("delete record is %+v", del)
+	}
+}
+
+func TestS3Cache_Audit_Wrap_Failed(t *testing.T) {
+	// setup types
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	a := &Audit{Path: path}
+
+	store, err := a.Wrap(unavailableBackend{newFakeBackend()}, &Repo{Owner: "foo", Name: "bar"}, nil, flushAction)
+	if err != nil {
+		t.Fatalf("Wrap returned err: %v", err)
+	}
+
+	rErrs := store.Remove(context.Background(), "bucket", []storage.Object{{Key: "foo/bar/archive.tgz", Size: 3}})
+	if len(rErrs) != 1 {
+		t.Errorf("Remove returned %d errs, want 1", len(rErrs))
+	}
+
+	err = a.Close()
+	if err != nil {
+		t.Errorf("Close returned err: %v", err)
+	}
+
+	records := readAudit(t, path)
+
+	if len(records) != 1 {
+		t.Fatalf("audit log has %d records, want 1", len(records))
+	}
+
+	if records[0].Success || len(records[0].Error) == 0 || records[0].Keys[0] != "foo/bar/archive.tgz" {
+		t.Errorf("delete record is %+v", records[0])
+	}
+}
+
+func TestS3Cache_Audit_Wrap_Disabled(t *testing.T) {
+	// setup types
+	fake := newFakeBackend()
+
+	for _, a := range []*Audit{nil, {}} {
+		store, err := a.Wrap(fake, &Repo{}, nil, flushAction)
+		if err != nil {
+			t.Errorf("Wrap returned err: %v", err)
+		}
+
+		if store != storage.Backend(fake) {
+			t.Errorf("Wrap wrapped the backend without an audit log")
+		}
+
+		err = a.Close()
+		if err != nil {
+			t.Errorf("Close returned err: %v", err)
+		}
+	}
+}
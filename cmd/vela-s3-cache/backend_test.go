@@ -0,0 +1,333 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// errNotFound is returned by the fake backend for missing objects.
+var errNotFound = errors.New("the specified key does not exist")
+
+// fakeBackend is an in-memory storage.Backend for testing the actions.
+type fakeBackend struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	aborted []string
+	uploads []storage.Upload
+	ranges  int
+	rules   []storage.LifecycleRule
+}
+
+// fakeObject is an object held by the fake backend.
+type fakeObject struct {
+	info storage.Object
+	data []byte
+	tags map[string]string
+}
+
+// newFakeBackend creates an empty fake backend.
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{objects: make(map[string]fakeObject)}
+}
+
+// add stores an object in the fake backend.
+func (f *fakeBackend) add(key string, data []byte, modified time.Time, metadata map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.objects[key] = fakeObject{
+		info: storage.Object{
+			Key:          key,
+			Size:         int64(len(data)),
+			LastModified: modified,
+			ETag:         fmt.Sprintf("%x", md5.Sum(data)),
+			UserMetadata: metadata,
+		},
+		data: data,
+	}
+}
+
+// tag replaces the tags of an object in the fake backend.
+func (f *fakeBackend) tag(key string, tags map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o, ok := f.objects[key]
+	if !ok {
+		return
+	}
+
+	o.tags = maps.Clone(tags)
+	f.objects[key] = o
+}
+
+// keys returns the sorted keys of the objects in the fake backend.
+func (f *fakeBackend) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Put uploads the contents of the reader to the key.
+func (f *fakeBackend) Put(ctx context.Context, _, key string, reader io.Reader, _ int64, opts storage.PutOptions) (storage.Object, error) {
+	if ctx.Err() != nil {
+		return storage.Object{}, ctx.Err()
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return storage.Object{}, err
+	}
+
+	// refuse to replace an object with a conditional upload
+	if opts.IfNoneMatch {
+		f.mu.Lock()
+		_, ok := f.objects[key]
+		f.mu.Unlock()
+
+		if ok {
+			return storage.Object{}, &storage.ResponseError{
+				StatusCode: http.StatusPreconditionFailed,
+				Code:       "PreconditionFailed",
+				Err:        errors.New("at least one of the pre-conditions you specified did not hold"),
+			}
+		}
+	}
+
+	if opts.Progress != nil {
+		_, _ = opts.Progress.Read(data)
+	}
+
+	f.add(key, data, time.Now(), opts.UserMetadata)
+	f.tag(key, opts.UserTags)
+
+	return storage.Object{Key: key, Size: int64(len(data))}, nil
+}
+
+// Copy copies the contents of the source key to the destination key.
+func (f *fakeBackend) Copy(ctx context.Context, _, src, dst string, opts storage.PutOptions) (storage.Object, error) {
+	if ctx.Err() != nil {
+		return storage.Object{}, ctx.Err()
+	}
+
+	f.mu.Lock()
+	o, ok := f.objects[src]
+	f.mu.Unlock()
+
+	if !ok {
+		return storage.Object{}, errNotFound
+	}
+
+	f.add(dst, o.data, time.Now(), opts.UserMetadata)
+	f.tag(dst, opts.UserTags)
+
+	return storage.Object{Key: dst, Size: int64(len(o.data))}, nil
+}
+
+// Get retrieves the contents of the key.
+func (f *fakeBackend) Get(_ context.Context, _, key string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	object, ok := f.objects[key]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(object.data)), nil
+}
+
+// GetRange retrieves a range of the contents of the key.
+func (f *fakeBackend) GetRange(_ context.Context, _, key string, opts storage.RangeOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	object, ok := f.objects[key]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	f.ranges++
+
+	end := min(opts.Offset+opts.Length, int64(len(object.data)))
+
+	return io.NopCloser(bytes.NewReader(object.data[opts.Offset:end])), nil
+}
+
+// Stat retrieves the information for the key.
+func (f *fakeBackend) Stat(_ context.Context, _, key string) (storage.Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	object, ok := f.objects[key]
+	if !ok {
+		return storage.Object{}, errNotFound
+	}
+
+	return object.info, nil
+}
+
+// GetTags retrieves the tags of the key.
+func (f *fakeBackend) GetTags(_ context.Context, _, key string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	object, ok := f.objects[key]
+	if !ok {
+		return nil, &storage.ResponseError{StatusCode: http.StatusNotFound, Code: "NoSuchKey", Err: errNotFound}
+	}
+
+	return maps.Clone(object.tags), nil
+}
+
+// SetTags replaces the tags of the key.
+func (f *fakeBackend) SetTags(_ context.Context, _, key string, tags map[string]string) error {
+	f.mu.Lock()
+	_, ok := f.objects[key]
+	f.mu.Unlock()
+
+	if !ok {
+		return errNotFound
+	}
+
+	f.tag(key, tags)
+
+	return nil
+}
+
+// List retrieves the objects matching the options.
+func (f *fakeBackend) List(_ context.Context, _ string, opts storage.ListOptions) ([]storage.Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects := []storage.Object{}
+	prefixes := make(map[string]bool)
+
+	for key, object := range f.objects {
+		if !strings.HasPrefix(key, opts.Prefix) || key <= opts.StartAfter {
+			continue
+		}
+
+		// group the keys at the next level into common prefixes
+		if !opts.Recursive {
+			if i := strings.Index(key[len(opts.Prefix):], "/"); i >= 0 {
+				prefix := key[:len(opts.Prefix)+i+1]
+				if !prefixes[prefix] {
+					prefixes[prefix] = true
+
+					objects = append(objects, storage.Object{Key: prefix})
+				}
+
+				continue
+			}
+		}
+
+		objects = append(objects, object.info)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// Remove deletes the objects, returning an error for missing objects.
+func (f *fakeBackend) Remove(_ context.Context, _ string, objects []storage.Object) []storage.RemoveError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	errs := []storage.RemoveError{}
+
+	for _, object := range objects {
+		if _, ok := f.objects[object.Key]; !ok {
+			errs = append(errs, storage.RemoveError{Object: object, Err: errNotFound})
+
+			continue
+		}
+
+		delete(f.objects, object.Key)
+	}
+
+	return errs
+}
+
+// Abort records the key of the incomplete upload to remove.
+func (f *fakeBackend) Abort(_ context.Context, _, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.aborted = append(f.aborted, key)
+
+	return nil
+}
+
+// ListUploads returns the incomplete uploads for the keys beginning with the prefix.
+func (f *fakeBackend) ListUploads(_ context.Context, _, prefix string) ([]storage.Upload, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	uploads := []storage.Upload{}
+
+	for _, upload := range f.uploads {
+		if strings.HasPrefix(upload.Key, prefix) {
+			uploads = append(uploads, upload)
+		}
+	}
+
+	return uploads, nil
+}
+
+// AbortUpload removes the incomplete upload, recording its key.
+func (f *fakeBackend) AbortUpload(_ context.Context, _ string, upload storage.Upload) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.uploads {
+		if f.uploads[i].UploadID == upload.UploadID {
+			f.uploads = append(f.uploads[:i], f.uploads[i+1:]...)
+			f.aborted = append(f.aborted, upload.Key)
+
+			return nil
+		}
+	}
+
+	return errNotFound
+}
+
+// SetLifecycle records the lifecycle rule set on the bucket.
+func (f *fakeBackend) SetLifecycle(_ context.Context, _ string, rule storage.LifecycleRule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append(f.rules, rule)
+
+	return nil
+}
+
+// Presign creates a fake URL recording the method and expiry.
+func (f *fakeBackend) Presign(_ context.Context, bucket, key, method string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://s3.example.com/%s/%s?method=%s&expires=%d", bucket, key, method, int(expiry.Seconds())), nil
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-vela/vela-s3-cache/version"
+)
+
+// bannerWriter is a helper function to determine where
+// to write the version banner based off the destination.
+func bannerWriter(dest string) (io.Writer, error) {
+	switch dest {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	case "none":
+		return io.Discard, nil
+	default:
+		return nil, fmt.Errorf("invalid version banner %s: must be stdout, stderr or none", dest)
+	}
+}
+
+// printVersion is a helper function to write the
+// version information as pretty JSON.
+func printVersion(w io.Writer) error {
+	// serialize the version information as pretty JSON
+	bytes, err := json.MarshalIndent(version.New(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", string(bytes))
+
+	return err
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestS3Cache_bannerWriter(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		dest    string
+		want    io.Writer
+		wantErr bool
+	}{
+		{desc: "default", dest: "", want: os.Stdout},
+		{desc: "stdout", dest: "stdout", want: os.Stdout},
+		{desc: "stderr", dest: "stderr", want: os.Stderr},
+		{desc: "none", dest: "none", want: io.Discard},
+		{desc: "invalid", dest: "file", wantErr: true},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := bannerWriter(tC.dest)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("bannerWriter returned err: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("bannerWriter is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_printVersion(t *testing.T) {
+	// setup types
+	b := new(bytes.Buffer)
+
+	err := printVersion(b)
+	if err != nil {
+		t.Errorf("printVersion returned err: %v", err)
+	}
+
+	if !json.Valid(b.Bytes()) {
+		t.Errorf("printVersion is %s, want valid JSON", b.String())
+	}
+}
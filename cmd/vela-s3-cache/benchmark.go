@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+)
+
+const benchmarkAction = "benchmark"
+
+// benchmarkFilename represents the name of the
+// staging file for the archives being measured.
+const benchmarkFilename = "benchmark.tgz"
+
+// defaultBenchmarkLevels represents the compression
+// levels measured by the benchmark action by default.
+var defaultBenchmarkLevels = []string{"1", "6", "9", autoCompression}
+
+// Benchmark represents the plugin configuration for benchmark information.
+type Benchmark struct {
+	// sets the file or directories locations to archive
+	Mount []string
+	// sets the gzip compression levels to archive the mounts with
+	Levels []string
+	// whether to preserve the relative directory structure during the tar process
+	PreservePath bool
+	// sets the directory to stage the archives in
+	TmpDir string
+
+	// will hold the measurement of each compression level
+	runs []benchmarkRun
+}
+
+// benchmarkRun represents the measurement of
+// archiving the mounts at a compression level.
+type benchmarkRun struct {
+	// compression level requested
+	level string
+	// gzip level the archive was compressed with
+	gzipLevel int
+	// size in bytes of the archive
+	size int64
+	// time spent creating the archive
+	duration time.Duration
+}
+
+// Exec formats and runs the actions for benchmarking the compression of the mounts.
+func (b *Benchmark) Exec(ctx context.Context, res *Result) error {
+	logrus.Trace("running benchmark with provided configuration")
+
+	res.Key = strings.Join(b.Mount, ",")
+
+	start := time.Now()
+
+	// calculate the size of the files being archived
+	size, err := mountSize(b.Mount)
+	if err != nil {
+		return err
+	}
+
+	res.UncompressedSize = size
+	res.WalkDuration = time.Since(start)
+
+	logPhase("walk", res.WalkDuration, size)
+
+	b.runs = nil
+
+	for _, level := range b.Levels {
+		// stop between the levels when the step is cancelled
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		run, err := b.run(level, size)
+		if err != nil {
+			return fmt.Errorf("compression level %s: %w", level, err)
+		}
+
+		b.runs = append(b.runs, run)
+		res.CompressDuration += run.duration
+
+		logrus.Infof("benchmark: level %s (gzip %d) archived %s to %s (ratio %.2f) in %s at %s/s",
+			run.level, run.gzipLevel, humanize.Bytes(uint64(size)), humanize.Bytes(uint64(run.size)),
+			float64(size)/float64(max(run.size, 1)), run.duration.Round(time.Millisecond),
+			humanize.Bytes(uint64(float64(size)/max(run.duration.Seconds(), 0.001))))
+	}
+
+	smallest, fastest := b.best()
+
+	res.Size = smallest.size
+
+	logrus.Infof("benchmark: smallest archive at level %s (%s), fastest archive at level %s (%s)",
+		smallest.level, humanize.Bytes(uint64(smallest.size)), fastest.level, fastest.duration.Round(time.Millisecond))
+
+	logrus.Debug("cache benchmark action completed")
+
+	return nil
+}
+
+// run archives the mounts at the compression level into a
+// staging file, measuring the size and duration of the archive.
+func (b *Benchmark) run(level string, size int64) (benchmarkRun, error) {
+	run := benchmarkRun{level: level}
+
+	var err error
+
+	run.gzipLevel, err = resolveCompressionLevel(level, b.Mount, size)
+	if err != nil {
+		return run, err
+	}
+
+	f, err := createTemp(b.TmpDir, benchmarkFilename)
+	if err != nil {
+		return run, err
+	}
+
+	// delete the staging file after measuring each level
+	defer removeTemp(f)
+
+	start := time.Now()
+
+	pk := &packer{preservePath: b.PreservePath, compressionLevel: run.gzipLevel, followMounts: true}
+
+	err = pk.pack(b.Mount, f)
+	if err != nil {
+		return run, err
+	}
+
+	run.duration = time.Since(start)
+
+	stat, err := os.Stat(f)
+	if err != nil {
+		return run, err
+	}
+
+	run.size = stat.Size()
+
+	return run, nil
+}
+
+// best returns the measurements with the smallest archive and the fastest archive.
+func (b *Benchmark) best() (smallest, fastest benchmarkRun) {
+	for i, run := range b.runs {
+		if i == 0 || run.size < smallest.size {
+			smallest = run
+		}
+
+		if i == 0 || run.duration < fastest.duration {
+			fastest = run
+		}
+	}
+
+	return smallest, fastest
+}
+
+// Configure prepares the benchmark fields for the action to be taken.
+func (b *Benchmark) Configure() error {
+	logrus.Trace("configuring benchmark action")
+
+	// expand the newline separated and glob pattern mounts
+	mounts, err := expandMounts(b.Mount)
+	if err != nil {
+		return err
+	}
+
+	b.Mount = mounts
+
+	// remove the mounts nested in another mount
+	if b.PreservePath {
+		b.Mount = filterRedundantPaths(b.Mount)
+	}
+
+	return nil
+}
+
+// Validate verifies the Benchmark is properly configured.
+func (b *Benchmark) Validate() error {
+	logrus.Trace("validating benchmark action configuration")
+
+	// verify mount is provided
+	if len(b.Mount) == 0 {
+		return fmt.Errorf("no mount provided")
+	}
+
+	// validate that the source exists
+	for _, mount := range b.Mount {
+		_, err := os.Lstat(mount)
+		if err != nil {
+			return fmt.Errorf("mount: %s, make sure file or directory exists", mount)
+		}
+	}
+
+	// verify the levels are provided
+	if len(b.Levels) == 0 {
+		return fmt.Errorf("no compression levels provided")
+	}
+
+	// verify the levels are valid
+	for _, level := range b.Levels {
+		if level == autoCompression {
+			continue
+		}
+
+		_, err := parseCompressionLevel(level)
+		if err != nil {
+			return err
+		}
+	}
+
+	// verify the staging directory exists
+	return validateTmpDir(b.TmpDir)
+}
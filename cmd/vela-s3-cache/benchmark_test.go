@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestS3Cache_Benchmark_Exec(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "repeated.txt"), []byte(strings.Repeat("vela s3 cache ", 10000)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Benchmark{
+		Mount:  []string{dir},
+		Levels: []string{"0", "9", autoCompression},
+		TmpDir: t.TempDir(),
+	}
+
+	res := &Result{Action: benchmarkAction}
+
+	err = b.Exec(context.Background(), res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if len(b.runs) != len(b.Levels) {
+		t.Fatalf("Exec measured %d levels, want %d", len(b.runs), len(b.Levels))
+	}
+
+	smallest, _ := b.best()
+
+	if smallest.level == "0" {
+		t.Errorf("smallest archive is at level 0, want a compressed level")
+	}
+
+	if res.Size != smallest.size {
+		t.Errorf("Size is %d, want %d", res.Size, smallest.size)
+	}
+
+	// the staging files are removed after each level
+	entries, err := os.ReadDir(b.TmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) > 0 {
+		t.Errorf("tmp dir contains %d staging files, want none", len(entries))
+	}
+}
+
+func TestS3Cache_Benchmark_Validate(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		b       *Benchmark
+		wantErr bool
+	}{
+		{
+			desc:    "valid",
+			b:       &Benchmark{Mount: []string{"testdata/hello.txt"}, Levels: defaultBenchmarkLevels},
+			wantErr: false,
+		},
+		{
+			desc:    "no mount",
+			b:       &Benchmark{Levels: defaultBenchmarkLevels},
+			wantErr: true,
+		},
+		{
+			desc:    "missing mount",
+			b:       &Benchmark{Mount: []string{"testdata/missing"}, Levels: defaultBenchmarkLevels},
+			wantErr: true,
+		},
+		{
+			desc:    "no levels",
+			b:       &Benchmark{Mount: []string{"testdata/hello.txt"}},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid level",
+			b:       &Benchmark{Mount: []string{"testdata/hello.txt"}, Levels: []string{"1", "fast"}},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.b.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, want err: %v", err, tC.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"runtime"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/version"
+)
+
+// Build represents the available settings for the build.
+type Build struct {
+	Number       int
+	Author       string
+	Commit       string
+	Event        string
+	Link         string
+	Pipeline     string
+	Distribution string
+}
+
+// Metadata creates the provenance metadata to
+// store with a cache object built by the build.
+func (b *Build) Metadata() map[string]string {
+	logrus.Trace("creating build metadata")
+
+	m := map[string]string{
+		metaVersion: version.New().Semantic(),
+	}
+
+	if b == nil {
+		return m
+	}
+
+	m[metaPlatform] = runtime.GOOS + "/" + runtime.GOARCH
+
+	if b.Number > 0 {
+		m[metaBuildNumber] = strconv.Itoa(b.Number)
+	}
+
+	if len(b.Commit) > 0 {
+		m[metaBuildCommit] = b.Commit
+	}
+
+	if len(b.Event) > 0 {
+		m[metaBuildEvent] = b.Event
+	}
+
+	if len(b.Link) > 0 {
+		m[metaBuildLink] = b.Link
+	}
+
+	if len(b.Pipeline) > 0 {
+		m[metaPipeline] = b.Pipeline
+	}
+
+	return m
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestS3Cache_Build_Metadata(t *testing.T) {
+	// setup types
+	b := &Build{
+		Number:   1234,
+		Commit:   "abc123",
+		Event:    "push",
+		Link:     "https://vela.example.com/foo/bar/1234",
+		Pipeline: "ci",
+	}
+
+	want := map[string]string{
+		metaBuildNumber: "1234",
+		metaBuildCommit: "abc123",
+		metaBuildEvent:  "push",
+		metaBuildLink:   "https://vela.example.com/foo/bar/1234",
+		metaPipeline:    "ci",
+		metaPlatform:    runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	got := b.Metadata()
+
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Metadata %s is %s, want %s", k, got[k], v)
+		}
+	}
+
+	if _, ok := got[metaVersion]; !ok {
+		t.Errorf("Metadata is missing %s", metaVersion)
+	}
+}
+
+func TestS3Cache_Build_Metadata_Nil(t *testing.T) {
+	// setup types
+	var b *Build
+
+	got := b.Metadata()
+
+	if len(got) != 1 {
+		t.Errorf("Metadata is %v, want only %s", got, metaVersion)
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cacheFormat represents the only archive format
+// currently supported for a cache definition.
+const cacheFormat = "tgz"
+
+// Cache represents a single cache definition for
+// managing several independent caches in one step.
+type Cache struct {
+	// sets the name of the bucket to store the object in
+	Bucket string `yaml:"bucket"`
+	// sets the file or directories locations to build the cache from
+	Mount []string `yaml:"mount"`
+	// sets the name of the cache object
+	Filename string `yaml:"filename"`
+	// sets the path for where to store the object
+	Path string `yaml:"path"`
+	// sets the prefix for where to store the object
+	Prefix string `yaml:"prefix"`
+	// sets the full key of the object, overriding the path and filename
+	Key string `yaml:"key"`
+	// sets the archive format of the object
+	Format string `yaml:"format"`
+	// whether to keep the modification time recorded in the archive for restored files
+	PreserveMtimes bool `yaml:"preserve_mtimes"`
+}
+
+// parseCaches is a helper function to parse the JSON
+// or YAML array of cache definitions.
+func parseCaches(caches string) ([]*Cache, error) {
+	if len(caches) == 0 {
+		return nil, nil
+	}
+
+	c := []*Cache{}
+
+	// parse the caches as yaml, which is a superset of json
+	err := yaml.Unmarshal([]byte(caches), &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// withCache creates a copy of the plugin with the
+// action settings overridden by the cache definition.
+func (p *Plugin) withCache(c *Cache) (*Plugin, error) {
+	if len(c.Format) > 0 && c.Format != cacheFormat {
+		return nil, fmt.Errorf("unsupported format %s: must be %s", c.Format, cacheFormat)
+	}
+
+	cp := *p
+	cp.Caches = nil
+
+	abort := *p.Abort
+	benchmark := *p.Benchmark
+	check := *p.Check
+	flush := *p.Flush
+	lifecycle := *p.Lifecycle
+	list := *p.List
+	pin := *p.Pin
+	presign := *p.Presign
+	rebuild := *p.Rebuild
+	restore := *p.Restore
+	stats := *p.Stats
+
+	if len(c.Bucket) > 0 {
+		abort.Bucket = c.Bucket
+		check.Bucket = c.Bucket
+		flush.Bucket = c.Bucket
+		lifecycle.Bucket = c.Bucket
+		list.Bucket = c.Bucket
+		pin.Bucket = c.Bucket
+		presign.Bucket = c.Bucket
+		rebuild.Bucket = c.Bucket
+		restore.Bucket = c.Bucket
+		stats.Bucket = c.Bucket
+	}
+
+	if len(c.Mount) > 0 {
+		benchmark.Mount = c.Mount
+		rebuild.Mount = c.Mount
+	}
+
+	if len(c.Filename) > 0 {
+		pin.Filename = c.Filename
+		presign.Filename = c.Filename
+		rebuild.Filename = c.Filename
+		restore.Filename = c.Filename
+	}
+
+	if len(c.Path) > 0 {
+		abort.Path = c.Path
+		check.Path = c.Path
+		flush.Path = c.Path
+		list.Path = c.Path
+		pin.Path = c.Path
+		presign.Path = c.Path
+		rebuild.Path = c.Path
+		restore.Path = c.Path
+		stats.Path = c.Path
+	}
+
+	if len(c.Prefix) > 0 {
+		abort.Prefix = c.Prefix
+		check.Prefix = c.Prefix
+		flush.Prefix = c.Prefix
+		lifecycle.Prefix = c.Prefix
+		list.Prefix = c.Prefix
+		pin.Prefix = c.Prefix
+		presign.Prefix = c.Prefix
+		rebuild.Prefix = c.Prefix
+		restore.Prefix = c.Prefix
+		stats.Prefix = c.Prefix
+	}
+
+	if c.PreserveMtimes {
+		restore.PreserveMtimes = true
+	}
+
+	// split the key into the path and filename of the object
+	if len(c.Key) > 0 {
+		abort.Path = c.Key
+		flush.Path = c.Key
+		list.Path = c.Key
+		stats.Path = c.Key
+
+		check.Path, _ = path.Split(c.Key)
+		pin.Path, pin.Filename = path.Split(c.Key)
+		presign.Path, presign.Filename = path.Split(c.Key)
+		rebuild.Path, rebuild.Filename = path.Split(c.Key)
+		restore.Path, restore.Filename = path.Split(c.Key)
+	}
+
+	cp.Abort = &abort
+	cp.Benchmark = &benchmark
+	cp.Check = &check
+	cp.Flush = &flush
+	cp.Lifecycle = &lifecycle
+	cp.List = &list
+	cp.Pin = &pin
+	cp.Presign = &presign
+	cp.Rebuild = &rebuild
+	cp.Restore = &restore
+	cp.Stats = &stats
+
+	return &cp, nil
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_parseCaches(t *testing.T) {
+	// setup types
+	want := []*Cache{
+		{Mount: []string{"node_modules"}, Filename: "node.tgz"},
+		{Mount: []string{".cache/pip"}, Key: "foo/bar/pip.tgz"},
+	}
+
+	testCases := []struct {
+		desc   string
+		caches string
+	}{
+		{
+			desc:   "json",
+			caches: `[{"mount": ["node_modules"], "filename": "node.tgz"}, {"mount": [".cache/pip"], "key": "foo/bar/pip.tgz"}]`,
+		},
+		{
+			desc: "yaml",
+			caches: `
+- mount: [node_modules]
+  filename: node.tgz
+- mount: [.cache/pip]
+  key: foo/bar/pip.tgz
+`,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseCaches(tC.caches)
+			if err != nil {
+				t.Errorf("parseCaches returned err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseCaches is %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Plugin_Validate_Caches(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	p := &Plugin{
+		Config: &Config{
+			Action:    "rebuild",
+			AccessKey: "123456",
+			SecretKey: "654321",
+			Server:    "https://server",
+		},
+		Repo: &Repo{
+			Owner:       "foo",
+			Name:        "bar",
+			Branch:      "main",
+			BuildBranch: "main",
+		},
+		Abort:     &Abort{},
+		Benchmark: &Benchmark{},
+		Check:     &Check{},
+		Flush:     &Flush{},
+		Lifecycle: &Lifecycle{},
+		List:      &List{},
+		Pin:       &Pin{},
+		Presign:   &Presign{},
+		Rebuild: &Rebuild{
+			Timeout:  timeout,
+			Bucket:   "bucket",
+			Filename: "archive.tgz",
+		},
+		Restore: &Restore{},
+		Stats:   &Stats{},
+		Caches: []*Cache{
+			{Mount: []string{"testdata/hello.txt"}, Filename: "hello.tgz"},
+			{Mount: []string{"testdata"}, Key: "custom/testdata.tgz", Bucket: "shared"},
+		},
+	}
+
+	err := p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+
+	want := []string{"foo/bar/hello.tgz", "custom/testdata.tgz"}
+
+	got := []string{}
+	for _, cp := range p.caches {
+		got = append(got, cp.Rebuild.Namespace)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaces are %v, want %v", got, want)
+	}
+
+	want = []string{"bucket", "shared"}
+
+	got = []string{}
+	for _, cp := range p.caches {
+		got = append(got, cp.Rebuild.Bucket)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buckets are %v, want %v", got, want)
+	}
+
+	// the base rebuild configuration should be unchanged
+	if len(p.Rebuild.Mount) > 0 {
+		t.Errorf("Mount is %v, want none", p.Rebuild.Mount)
+	}
+}
+
+func TestS3Cache_Plugin_withCache_InvalidFormat(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Flush:   &Flush{},
+		Rebuild: &Rebuild{},
+		Restore: &Restore{},
+	}
+
+	_, err := p.withCache(&Cache{Format: "zip"})
+	if err == nil {
+		t.Errorf("withCache should have returned err")
+	}
+}
+
+func TestS3Cache_Plugin_withCache_PreserveMtimes(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Abort:     &Abort{},
+		Benchmark: &Benchmark{},
+		Check:     &Check{},
+		Flush:     &Flush{},
+		Lifecycle: &Lifecycle{},
+		List:      &List{},
+		Pin:       &Pin{},
+		Presign:   &Presign{},
+		Rebuild:   &Rebuild{},
+		Restore:   &Restore{},
+		Stats:     &Stats{},
+	}
+
+	cp, err := p.withCache(&Cache{PreserveMtimes: true})
+	if err != nil {
+		t.Fatalf("withCache returned err: %v", err)
+	}
+
+	if !cp.Restore.PreserveMtimes {
+		t.Errorf("PreserveMtimes is false, want true for the cache")
+	}
+
+	// the base restore configuration should be unchanged
+	if p.Restore.PreserveMtimes {
+		t.Errorf("PreserveMtimes is true, want false for the step")
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const checkAction = "check"
+
+// checkProbe represents the name of the tiny object
+// uploaded and removed to verify the permissions.
+const checkProbe = ".vela-s3-cache-check"
+
+// Check represents the plugin configuration for check information.
+type Check struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets the path for where to store the probe object
+	Path string
+	// sets the prefix for where to store the probe object
+	Prefix string
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// skips the probe object, as the read credentials can't write it
+	ReadOnly bool
+	// will hold our final namespace for the path to the probe object
+	Namespace string
+}
+
+// Exec formats and runs the actions for checking the connectivity to s3.
+func (c *Check) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running check with provided configuration")
+
+	res.Key = c.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// verify the credentials, the bucket and the list permission
+	_, err := store.List(ctx, c.Bucket, storage.ListOptions{Prefix: c.Namespace})
+	if err != nil {
+		return fmt.Errorf("unable to list objects in bucket %s, verify the credentials and that the bucket exists: %w", c.Bucket, err)
+	}
+
+	res.Latency = time.Since(start)
+
+	logrus.Infof("check: listed objects in bucket %s in %s", c.Bucket, res.Latency.Round(time.Millisecond))
+
+	if c.ReadOnly {
+		logrus.Info("check: skipping the probe object with the read credentials")
+
+		return nil
+	}
+
+	start = time.Now()
+
+	// verify the put permission with a tiny probe object
+	probe := fmt.Sprintf("vela-s3-cache check at %s", time.Now().UTC().Format(time.RFC3339))
+
+	_, err = store.Put(ctx, c.Bucket, c.Namespace, strings.NewReader(probe), int64(len(probe)), storage.PutOptions{
+		ContentType: "text/plain",
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put probe object %s in bucket %s: %w", c.Namespace, c.Bucket, err)
+	}
+
+	logrus.Infof("check: put probe object %s in %s", c.Namespace, time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+
+	// verify the delete permission by removing the probe object
+	errs := store.Remove(ctx, c.Bucket, []storage.Object{{Key: c.Namespace}})
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to delete probe object %s in bucket %s: %w", c.Namespace, c.Bucket, errs[0])
+	}
+
+	logrus.Infof("check: deleted probe object %s in %s", c.Namespace, time.Since(start).Round(time.Millisecond))
+
+	logrus.Debug("cache check action completed")
+
+	return nil
+}
+
+// Configure prepares the check fields for the action to be taken.
+func (c *Check) Configure(repo *Repo) error {
+	logrus.Trace("configuring check action")
+
+	// construct the probe object path
+	path, err := buildNamespace(repo, c.Prefix, c.Path, checkProbe)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	// store it in the namespace
+	c.Namespace = path
+
+	return nil
+}
+
+// Validate verifies the Check is properly configured.
+func (c *Check) Validate() error {
+	logrus.Trace("validating check action configuration")
+
+	// verify bucket is provided
+	if len(c.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify timeout is provided
+	if c.Timeout == 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	return nil
+}
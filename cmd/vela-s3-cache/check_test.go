@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_Check_Validate(t *testing.T) {
+	// setup types
+	c := &Check{
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestS3Cache_Check_Validate_NoBucket(t *testing.T) {
+	// setup types
+	c := &Check{
+		Timeout: 10 * time.Minute,
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Check_Validate_NoTimeout(t *testing.T) {
+	// setup types
+	c := &Check{
+		Bucket: "bucket",
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Check_Configure(t *testing.T) {
+	// setup types
+	c := &Check{
+		Bucket: "bucket",
+		Prefix: "cache",
+	}
+
+	err := c.Configure(&Repo{Owner: "foo", Name: "bar"})
+	if err != nil {
+		t.Errorf("Configure returned err: %v", err)
+	}
+
+	want := "cache/foo/bar/.vela-s3-cache-check"
+	if c.Namespace != want {
+		t.Errorf("Namespace is %s, want %s", c.Namespace, want)
+	}
+}
+
+func TestS3Cache_Check_Exec(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("cache"), time.Now(), nil)
+
+	c := &Check{
+		Bucket:    "bucket",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/.vela-s3-cache-check",
+	}
+
+	res := new(Result)
+
+	err := c.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify the probe object was removed
+	keys := store.keys()
+	if len(keys) != 1 || keys[0] != "foo/bar/archive.tgz" {
+		t.Errorf("keys are %v, want only the existing object", keys)
+	}
+
+	if res.Key != c.Namespace {
+		t.Errorf("Key is %s, want %s", res.Key, c.Namespace)
+	}
+}
+
+// readOnlyBackend is a fake backend without the put permission.
+type readOnlyBackend struct {
+	*fakeBackend
+}
+
+// Put always fails as if access was denied.
+func (readOnlyBackend) Put(context.Context, string, string, io.Reader, int64, storage.PutOptions) (storage.Object, error) {
+	return storage.Object{}, errors.New("access denied")
+}
+
+func TestS3Cache_Check_Exec_NoPutPermission(t *testing.T) {
+	// setup types
+	c := &Check{
+		Bucket:    "bucket",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/.vela-s3-cache-check",
+	}
+
+	err := c.Exec(context.Background(), readOnlyBackend{newFakeBackend()}, new(Result))
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+}
+
+func TestS3Cache_Check_Exec_ReadOnly(t *testing.T) {
+	// setup types
+	c := &Check{
+		Bucket:    "bucket",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/.vela-s3-cache-check",
+		ReadOnly:  true,
+	}
+
+	// verify the read credentials are checked without the probe object
+	err := c.Exec(context.Background(), readOnlyBackend{newFakeBackend()}, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestS3Cache_fileSHA256(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), "hello.txt")
+
+	err := os.WriteFile(file, []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	got, err := fileSHA256(file)
+	if err != nil {
+		t.Errorf("fileSHA256 returned err: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("fileSHA256 is %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+)
+
+// autoCompression represents the compression level that selects a
+// level based on the cpus, size and compressibility of the mounts.
+const autoCompression = "auto"
+
+const (
+	// sampleSize represents the bytes of the mounts
+	// sampled to estimate their compressibility.
+	sampleSize = humanize.MiByte
+	// sampleFileSize represents the bytes sampled from each
+	// file, so the sample spans several files of the mounts.
+	sampleFileSize = 64 * humanize.KiByte
+	// incompressibleRatio represents the sampled compression ratio
+	// above which the mounts are considered already compressed.
+	incompressibleRatio = 0.9
+)
+
+// errSampled is returned to stop walking the mounts once sampled.
+var errSampled = errors.New("sample complete")
+
+// parseCompressionLevel is a helper function to convert the compression
+// level into a gzip level, returning the default level when none is provided.
+func parseCompressionLevel(level string) (int, error) {
+	if len(level) == 0 {
+		return gzip.DefaultCompression, nil
+	}
+
+	l, err := strconv.Atoi(level)
+	if err != nil || l < gzip.NoCompression || l > gzip.BestCompression {
+		return 0, fmt.Errorf("invalid compression level %s: must be %s or between %d and %d",
+			level, autoCompression, gzip.NoCompression, gzip.BestCompression)
+	}
+
+	return l, nil
+}
+
+// resolveCompressionLevel is a helper function to convert the compression
+// level into a gzip level, selecting a level from the mounts of the size
+// when the level is auto.
+func resolveCompressionLevel(level string, mounts []string, size int64) (int, error) {
+	if level != autoCompression {
+		return parseCompressionLevel(level)
+	}
+
+	ratio, err := sampleRatio(mounts)
+	if err != nil {
+		return 0, fmt.Errorf("unable to sample mounts: %w", err)
+	}
+
+	l := autoCompressionLevel(size, runtime.NumCPU(), ratio)
+
+	logrus.Infof("selected compression level %d for %s across %d cpus with a sampled compression ratio of %.2f",
+		l, humanize.Bytes(uint64(size)), runtime.NumCPU(), ratio)
+
+	return l, nil
+}
+
+// autoCompressionLevel is a helper function to select a gzip level from
+// the size of the mounts per cpu and the sampled compression ratio, so
+// small caches get the best compression while huge caches get speed.
+func autoCompressionLevel(size int64, cpus int, ratio float64) int {
+	// compressing already compressed data only costs time
+	if ratio > incompressibleRatio {
+		return gzip.BestSpeed
+	}
+
+	perCPU := size / int64(max(cpus, 1))
+
+	switch {
+	case perCPU <= 64*humanize.MByte:
+		return gzip.BestCompression
+	case perCPU <= 512*humanize.MByte:
+		return gzip.DefaultCompression
+	default:
+		return gzip.BestSpeed
+	}
+}
+
+// sampleRatio is a helper function to estimate the compression ratio of the
+// mounts by compressing a sample from the start of the first files found.
+func sampleRatio(mounts []string) (float64, error) {
+	compressed := &byteCounter{}
+
+	gw, err := gzip.NewWriterLevel(compressed, gzip.BestSpeed)
+	if err != nil {
+		return 0, err
+	}
+
+	sampled := int64(0)
+
+	for _, mount := range mounts {
+		err = filepath.WalkDir(mount, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			n, err := io.Copy(gw, io.LimitReader(f, min(sampleFileSize, sampleSize-sampled)))
+			if err != nil {
+				return err
+			}
+
+			sampled += n
+
+			if sampled >= sampleSize {
+				return errSampled
+			}
+
+			return nil
+		})
+		if errors.Is(err, errSampled) {
+			break
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+
+	err = gw.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// treat empty mounts as compressible
+	if sampled == 0 {
+		return 0, nil
+	}
+
+	return float64(compressed.n) / float64(sampled), nil
+}
+
+// byteCounter is a writer that counts the bytes written.
+type byteCounter struct {
+	n int64
+}
+
+// Write records the length of the provided buffer as written.
+func (c *byteCounter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+
+	return len(b), nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dustin/go-humanize"
+)
+
+func TestS3Cache_parseCompressionLevel(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		level   string
+		want    int
+		wantErr bool
+	}{
+		{desc: "default", level: "", want: gzip.DefaultCompression},
+		{desc: "best speed", level: "1", want: gzip.BestSpeed},
+		{desc: "best compression", level: "9", want: gzip.BestCompression},
+		{desc: "out of range", level: "10", wantErr: true},
+		{desc: "invalid", level: "fast", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseCompressionLevel(tC.level)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("parseCompressionLevel returned err: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("parseCompressionLevel is %d, want %d", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_autoCompressionLevel(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc  string
+		size  int64
+		cpus  int
+		ratio float64
+		want  int
+	}{
+		{desc: "small", size: 10 * humanize.MByte, cpus: 2, ratio: 0.3, want: gzip.BestCompression},
+		{desc: "medium", size: 2 * humanize.GByte, cpus: 8, ratio: 0.3, want: gzip.DefaultCompression},
+		{desc: "large", size: 20 * humanize.GByte, cpus: 4, ratio: 0.3, want: gzip.BestSpeed},
+		{desc: "large on many cpus", size: 20 * humanize.GByte, cpus: 64, ratio: 0.3, want: gzip.DefaultCompression},
+		{desc: "incompressible", size: 10 * humanize.MByte, cpus: 2, ratio: 0.99, want: gzip.BestSpeed},
+		{desc: "no cpus", size: 10 * humanize.MByte, cpus: 0, ratio: 0.3, want: gzip.BestCompression},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := autoCompressionLevel(tC.size, tC.cpus, tC.ratio)
+			if got != tC.want {
+				t.Errorf("autoCompressionLevel is %d, want %d", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_sampleRatio(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	text := filepath.Join(dir, "text")
+
+	err := os.WriteFile(text, []byte(strings.Repeat("hello world ", 10000)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random := filepath.Join(dir, "random")
+
+	data := make([]byte, 256*humanize.KiByte)
+	_, _ = rand.Read(data)
+
+	err = os.WriteFile(random, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ratio, err := sampleRatio([]string{text})
+	if err != nil {
+		t.Fatalf("sampleRatio returned err: %v", err)
+	}
+
+	if ratio > 0.1 {
+		t.Errorf("sampleRatio is %.2f for repetitive text, want at most 0.1", ratio)
+	}
+
+	ratio, err = sampleRatio([]string{random})
+	if err != nil {
+		t.Fatalf("sampleRatio returned err: %v", err)
+	}
+
+	if ratio <= incompressibleRatio {
+		t.Errorf("sampleRatio is %.2f for random data, want above %.2f", ratio, incompressibleRatio)
+	}
+
+	ratio, err = sampleRatio([]string{filepath.Join(dir, "missing")})
+	if err != nil || ratio != 0 {
+		t.Errorf("sampleRatio is %.2f for a missing mount, want 0: %v", ratio, err)
+	}
+}
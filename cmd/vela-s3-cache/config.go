@@ -3,12 +3,37 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const (
+	// minioDriver represents the driver using the minio client.
+	minioDriver = "minio"
+
+	// awsDriver represents the driver using the AWS SDK for Go v2.
+	awsDriver = "aws"
 )
 
 // Config represents the plugin configuration for s3 config information.
@@ -21,10 +46,102 @@ type Config struct {
 	SecretKey           string
 	SessionToken        string
 	Region              string
+	// sets the bucket to look up the region and probe the accelerated endpoint with
+	Bucket string
+	// sets the credentials for the actions only reading objects
+	ReadAccessKey    string
+	ReadSecretKey    string
+	ReadSessionToken string
+	// sets the credentials for the actions writing or removing objects
+	WriteAccessKey    string
+	WriteSecretKey    string
+	WriteSessionToken string
+	// sets whether the presign action signs an upload URL writing to the bucket
+	PresignPut bool
+	// sets the servers to fail over to in order when the server fails
+	FailoverServers []string
+	// sets the buckets and prefixes forbidden as a cache target by the platform
+	DenyList []string
+	// sets the server-side encryption to upload the objects with
+	Encryption storage.Encryption
+	// whether the platform requires server-side encryption for every upload
+	RequireSSE bool
+	// whether to restrict the cryptography to FIPS approved algorithms and endpoints
+	FIPS bool
+	// client used to communicate with the s3 instance
+	Driver string
+	// sets the s3 compatible store to adjust to (r2, b2 or gcs-interop)
+	Provider string
+	// whether to only report what the action would do
+	DryRun bool
+	// sets the timeout for establishing a connection to s3
+	ConnectTimeout time.Duration
+	// sets the minimum TLS version for the connections to s3
+	MinTLSVersion uint16
+	// sets the cipher suites allowed for the connections to s3 up to TLS 1.2
+	CipherSuites []uint16
+	// whether to log a summary of every request made to s3
+	TraceHTTP bool
+	// whether to log the request and host ids of every response from s3
+	LogRequestIDs bool
+	// whether to require IMDSv2 session tokens for IAM credentials
+	RequireIMDSv2 bool
+	// sets the endpoint of the instance metadata service
+	IMDSEndpoint string
+	// sets the role to assume with the Vela OIDC ID token
+	RoleARN string
+	// sets the role to assume with the Vela OIDC ID token for each bucket
+	BucketRoles map[string]string
+	// sets the STS endpoint to exchange the ID token with
+	STSEndpoint string
+	// sets the audiences to request the ID token for
+	IDTokenAudience []string
+	// sets the URL to request the ID token from
+	IDTokenRequestURL string
+	// sets the token to authenticate the request for the ID token with
+	IDTokenRequestToken string
 }
 
-// New creates an Minio client for managing artifacts.
-func (c *Config) New() (*minio.Client, error) {
+// New creates a storage backend using the configured driver for managing artifacts.
+func (c *Config) New() (storage.Backend, error) {
+	// assume the role of each bucket before the region is discovered
+	if len(c.BucketRoles) > 0 {
+		return c.newBucketRoles(), nil
+	}
+
+	// sign the requests for the region of the bucket
+	c.discoverRegion()
+
+	// retry the requests against the failover servers
+	if len(c.FailoverServers) > 0 {
+		return c.newFailover(append([]string{c.Server}, c.FailoverServers...))
+	}
+
+	store, err := c.newBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	// verify the accelerated endpoint, which providers ignore, works for the bucket
+	if len(c.AcceleratedEndpoint) > 0 && len(c.Provider) == 0 && len(c.Bucket) > 0 {
+		return c.withAccelerationFallback(store)
+	}
+
+	return store, nil
+}
+
+// newBackend creates a storage backend using the configured driver.
+func (c *Config) newBackend() (storage.Backend, error) {
+	switch c.Driver {
+	case awsDriver:
+		return c.newAWS()
+	default:
+		return c.newMinio()
+	}
+}
+
+// newMinio creates a storage backend using a Minio client.
+func (c *Config) newMinio() (storage.Backend, error) {
 	logrus.Trace("creating new Minio client from plugin configuration")
 
 	// default to amazon aws s3 storage
@@ -46,10 +163,36 @@ func (c *Config) New() (*minio.Client, error) {
 	}
 
 	var creds *credentials.Credentials
-	if len(c.AccessKey) > 0 && len(c.SecretKey) > 0 {
+
+	switch {
+	case len(c.AccessKey) > 0 && len(c.SecretKey) > 0:
 		creds = credentials.NewStaticV4(c.AccessKey, c.SecretKey, c.SessionToken)
-	} else {
-		creds = credentials.NewIAM("")
+	case len(c.RoleARN) > 0:
+		logrus.Debugf("assuming role %s with the Vela ID token", c.RoleARN)
+
+		// exchange the ID token for temporary credentials
+		transport, err := minio.DefaultTransport(true)
+		if err != nil {
+			return nil, err
+		}
+
+		creds = c.minioCredentials(c.transport(transport))
+
+		_, err = creds.Get()
+		if err != nil {
+			return nil, fmt.Errorf("unable to assume role %s: %w", c.RoleARN, err)
+		}
+	default:
+		// refuse the IMDSv1 fallback when IMDSv2 is required
+		transport := http.DefaultTransport
+		if c.RequireIMDSv2 {
+			transport = &imdsV2Transport{next: transport}
+		}
+
+		creds = credentials.New(&credentials.IAM{
+			Client:   &http.Client{Transport: transport},
+			Endpoint: c.IMDSEndpoint,
+		})
 
 		// See if the IAM role can be retrieved
 		_, err := creds.Get()
@@ -63,27 +206,240 @@ func (c *Config) New() (*minio.Client, error) {
 		Secure: useSSL,
 	}
 
+	// sign for the region provided, discovered or expected by the provider
+	if region := c.region(); len(region) > 0 {
+		opts.Region = region
+	}
+
+	transport, err := minio.DefaultTransport(useSSL)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Transport = c.transport(transport)
+
 	mc, err := minio.New(endpoint, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	if c.AcceleratedEndpoint != "" {
+	if c.accelerate() {
 		mc.SetS3TransferAccelerate(c.AcceleratedEndpoint)
 	}
 
-	return mc, nil
+	return storage.NewMinio(mc, c.compat(), c.Encryption), nil
+}
+
+// newAWS creates a storage backend using an AWS SDK client. Credentials
+// not provided to the plugin are resolved with the default chain, which
+// includes SSO profiles and the instance metadata service (IMDSv2).
+func (c *Config) newAWS() (storage.Backend, error) {
+	logrus.Trace("creating new AWS SDK client from plugin configuration")
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithRetryMode(aws.RetryModeAdaptive),
+	}
+
+	if region := c.region(); len(region) > 0 {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	// resolve the FIPS endpoints of s3 and sts
+	if c.FIPS {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+
+	if len(c.AccessKey) > 0 && len(c.SecretKey) > 0 {
+		opts = append(opts, config.WithCredentialsProvider(
+			awscreds.NewStaticCredentialsProvider(c.AccessKey, c.SecretKey, c.SessionToken),
+		))
+	}
+
+	// configure the instance metadata service for IAM credentials
+	if c.RequireIMDSv2 || len(c.IMDSEndpoint) > 0 {
+		opts = append(opts, config.WithEC2RoleCredentialOptions(func(o *ec2rolecreds.Options) {
+			o.Client = imds.New(imds.Options{
+				Endpoint:       c.IMDSEndpoint,
+				EnableFallback: c.imdsFallback(),
+			})
+		}))
+	}
+
+	opts = append(opts, config.WithHTTPClient(&http.Client{
+		Transport: c.transport(awshttp.NewBuildableClient().GetTransport()),
+	}))
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// exchange the Vela ID token for temporary credentials
+	if len(c.RoleARN) > 0 && len(c.AccessKey) == 0 {
+		logrus.Debugf("assuming role %s with the Vela ID token", c.RoleARN)
+
+		client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+			if len(c.STSEndpoint) > 0 {
+				o.BaseEndpoint = aws.String(c.STSEndpoint)
+			}
+		})
+
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			client, c.RoleARN, c.newIDTokenSource(), func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = idTokenSessionName
+			},
+		))
+	}
+
+	server, err := url.Parse(c.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %s: %w", c.Server, err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// only override the endpoint for s3 compatible servers
+		// to keep virtual hosted and s3 express buckets working
+		if len(server.Host) > 0 && !strings.HasSuffix(server.Host, "amazonaws.com") {
+			o.BaseEndpoint = aws.String(c.Server)
+			o.UsePathStyle = true
+		}
+
+		o.UseAccelerate = c.accelerate()
+	})
+
+	return storage.NewAWS(client, c.compat(), c.Encryption), nil
+}
+
+// imdsFallback returns whether the AWS SDK may fall back to IMDSv1.
+func (c *Config) imdsFallback() aws.Ternary {
+	if c.RequireIMDSv2 {
+		return aws.FalseTernary
+	}
+
+	return aws.UnknownTernary
+}
+
+// transport applies the connection timeouts and TLS restrictions to the
+// transport and wraps it to log every request made to s3, if enabled.
+func (c *Config) transport(t *http.Transport) http.RoundTripper {
+	c.applyTLS(t)
+
+	// bound the time spent establishing a connection separately
+	// from the time spent transferring the cache object
+	if c.ConnectTimeout > 0 {
+		t.DialContext = (&net.Dialer{
+			Timeout:   c.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		t.TLSHandshakeTimeout = c.ConnectTimeout
+	}
+
+	// log every request made to s3 with secrets redacted
+	if c.TraceHTTP {
+		return &traceTransport{next: t}
+	}
+
+	// log the identifiers needed for support tickets with s3
+	if c.LogRequestIDs {
+		return &requestIDTransport{next: t}
+	}
+
+	return t
 }
 
 // Validate verifies the Config is properly configured.
 func (c *Config) Validate() error {
 	logrus.Trace("validating config plugin configuration")
 
+	// the benchmark action archives locally without s3
+	if c.Action == benchmarkAction {
+		return nil
+	}
+
+	// use the credentials provided for the kind of action
+	err := c.resolveCredentials()
+	if err != nil {
+		return err
+	}
+
+	// verify the failover servers are HTTP URIs
+	for _, server := range c.FailoverServers {
+		if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+			return fmt.Errorf("invalid failover server %s: must be a HTTP URI", server)
+		}
+	}
+
+	// verify the provider is supported
+	err = validateProvider(c.Provider)
+	if err != nil {
+		return err
+	}
+
+	// verify only approved cryptography is used in fips mode
+	err = c.validateFIPS()
+	if err != nil {
+		return err
+	}
+
+	// verify the cipher suites apply to the minimum TLS version
+	err = c.validateTLS()
+	if err != nil {
+		return err
+	}
+
+	// verify the roles of the buckets can be assumed
+	err = c.validateBucketRoles()
+	if err != nil {
+		return err
+	}
+
+	// verify the server-side encryption is supported with its key
+	err = c.Encryption.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid server-side encryption: %w", err)
+	}
+
+	// refuse to upload plaintext when the platform requires encryption
+	if c.RequireSSE && len(c.Encryption.Mode) == 0 {
+		return fmt.Errorf("server-side encryption is required by the platform: set sse to %s, %s or %s",
+			storage.SSES3, storage.SSEKMS, storage.SSEC)
+	}
+
+	// verify driver is supported
+	switch c.Driver {
+	case "", minioDriver:
+	case awsDriver:
+		// the aws driver resolves the server and credentials itself
+		if len(c.Action) == 0 {
+			return fmt.Errorf("no config action provided")
+		}
+
+		// verify the ID token can be requested to assume the role
+		if len(c.RoleARN) > 0 && len(c.AccessKey) == 0 {
+			return c.validateIDToken()
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("invalid driver %s: must be %s or %s", c.Driver, minioDriver, awsDriver)
+	}
+
 	// verify server is provided
 	if len(c.Server) == 0 {
 		return fmt.Errorf("no cache server provided")
 	}
 
+	// verify the ID token can be requested to assume the role
+	if len(c.RoleARN) > 0 && len(c.AccessKey) == 0 {
+		return c.validateIDToken()
+	}
+
+	// every bucket of the step may be assumed with a role,
+	// which is verified against the buckets of the action
+	if len(c.BucketRoles) > 0 && len(c.AccessKey) == 0 {
+		return nil
+	}
+
 	// verify access key is provided
 	if len(c.AccessKey) == 0 {
 		return fmt.Errorf("no access key provided")
@@ -101,3 +457,67 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// validateIDToken verifies the Vela ID token can be requested
+// to exchange for the credentials of the role.
+func (c *Config) validateIDToken() error {
+	// verify action is provided
+	if len(c.Action) == 0 {
+		return fmt.Errorf("no config action provided")
+	}
+
+	// the worker only provides the request URL and token
+	// to steps that request an ID token
+	if len(c.IDTokenRequestURL) == 0 || len(c.IDTokenRequestToken) == 0 {
+		return fmt.Errorf("no ID token request URL or token provided for role %s, set id_request on the step", c.RoleARN)
+	}
+
+	return nil
+}
+
+// writes reports whether the action writes to or removes objects from the bucket.
+func (c *Config) writes() bool {
+	switch c.Action {
+	case checkAction, listAction, restoreAction, statsAction:
+		return false
+	case presignAction:
+		return c.PresignPut
+	default:
+		return true
+	}
+}
+
+// readCredentials reports whether the action uses the read credentials.
+func (c *Config) readCredentials() bool {
+	return !c.writes() && len(c.ReadAccessKey) > 0
+}
+
+// resolveCredentials replaces the access key with the read credentials
+// for the actions only reading objects, or the write credentials for
+// every other action, when they are provided, so each action only holds
+// the permissions it needs on the bucket.
+func (c *Config) resolveCredentials() error {
+	kind := "write"
+	accessKey, secretKey, sessionToken := c.WriteAccessKey, c.WriteSecretKey, c.WriteSessionToken
+
+	// use the read credentials for the actions never writing to the bucket
+	if !c.writes() {
+		kind = "read"
+		accessKey, secretKey, sessionToken = c.ReadAccessKey, c.ReadSecretKey, c.ReadSessionToken
+	}
+
+	if len(accessKey) == 0 && len(secretKey) == 0 {
+		return nil
+	}
+
+	// verify the credentials are complete
+	if len(accessKey) == 0 || len(secretKey) == 0 {
+		return fmt.Errorf("both a %s access key and %s secret key must be provided", kind, kind)
+	}
+
+	logrus.Debugf("using the %s credentials for the %s action", kind, c.Action)
+
+	c.AccessKey, c.SecretKey, c.SessionToken = accessKey, secretKey, sessionToken
+
+	return nil
+}
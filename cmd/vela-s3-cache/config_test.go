@@ -3,7 +3,11 @@
 package main
 
 import (
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 )
 
 func TestS3Cache_Config_New(_ *testing.T) {
@@ -25,6 +29,37 @@ func TestS3Cache_Config_Validate(t *testing.T) {
 	}
 }
 
+func TestS3Cache_Config_Validate_RequireSSE(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action:     "rebuild",
+		AccessKey:  "123456",
+		SecretKey:  "654321",
+		Server:     "https://server",
+		RequireSSE: true,
+	}
+
+	// verify the plugin refuses to upload without encryption
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+
+	c.Encryption = storage.Encryption{Mode: storage.SSEKMS}
+
+	err = c.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+
+	c.Encryption = storage.Encryption{Mode: storage.SSEC, CustomerKey: []byte("short")}
+
+	err = c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
 func TestS3Cache_Config_Validate_NoServer(t *testing.T) {
 	// setup types
 	c := &Config{
@@ -80,3 +115,223 @@ func TestS3Cache_Config_Validate_NoSecretKey(t *testing.T) {
 		t.Errorf("Validate should have returned err")
 	}
 }
+
+func TestS3Cache_Config_Validate_AWSDriver(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action: "flush",
+		Driver: awsDriver,
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
+
+func TestS3Cache_Config_Validate_RoleARN(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		driver  string
+		url     string
+		wantErr bool
+	}{
+		{
+			desc: "minio driver",
+			url:  "https://vela/api/v1/repos/foo/bar/builds/1/id_token",
+		},
+		{
+			desc:   "aws driver",
+			driver: awsDriver,
+			url:    "https://vela/api/v1/repos/foo/bar/builds/1/id_token",
+		},
+		{
+			desc:    "no id request",
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c := &Config{
+				Action:              "flush",
+				Driver:              tC.driver,
+				Server:              "https://server",
+				RoleARN:             "arn:aws:iam::123456789012:role/cache",
+				IDTokenRequestURL:   tC.url,
+				IDTokenRequestToken: "request-token",
+			}
+
+			err := c.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_Validate_InvalidDriver(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action:    "flush",
+		Driver:    "gcs",
+		AccessKey: "123456",
+		SecretKey: "654321",
+		Server:    "https://server",
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Config_Validate_ActionCredentials(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc      string
+		action    string
+		put       bool
+		wantKey   string
+		wantToken string
+	}{
+		{
+			desc:      "restore uses the read credentials",
+			action:    restoreAction,
+			wantKey:   "read",
+			wantToken: "read-token",
+		},
+		{
+			desc:      "check uses the read credentials",
+			action:    checkAction,
+			wantKey:   "read",
+			wantToken: "read-token",
+		},
+		{
+			desc:      "stats uses the read credentials",
+			action:    statsAction,
+			wantKey:   "read",
+			wantToken: "read-token",
+		},
+		{
+			desc:      "presign uses the read credentials",
+			action:    presignAction,
+			wantKey:   "read",
+			wantToken: "read-token",
+		},
+		{
+			desc:      "presign with put uses the write credentials",
+			action:    presignAction,
+			put:       true,
+			wantKey:   "write",
+			wantToken: "",
+		},
+		{
+			desc:      "rebuild uses the write credentials",
+			action:    rebuildAction,
+			wantKey:   "write",
+			wantToken: "",
+		},
+		{
+			desc:      "flush uses the write credentials",
+			action:    flushAction,
+			wantKey:   "write",
+			wantToken: "",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c := &Config{
+				Action:           tC.action,
+				PresignPut:       tC.put,
+				Server:           "https://server",
+				AccessKey:        "default",
+				SecretKey:        "default",
+				SessionToken:     "default-token",
+				ReadAccessKey:    "read",
+				ReadSecretKey:    "read-secret",
+				ReadSessionToken: "read-token",
+				WriteAccessKey:   "write",
+				WriteSecretKey:   "write-secret",
+			}
+
+			err := c.Validate()
+			if err != nil {
+				t.Fatalf("Validate returned err: %v", err)
+			}
+
+			if c.AccessKey != tC.wantKey {
+				t.Errorf("AccessKey is %s, want %s", c.AccessKey, tC.wantKey)
+			}
+
+			if c.SessionToken != tC.wantToken {
+				t.Errorf("SessionToken is %s, want %s", c.SessionToken, tC.wantToken)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_Validate_IncompleteActionCredentials(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action:        restoreAction,
+		Server:        "https://server",
+		ReadAccessKey: "read",
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Config_Validate_DefaultCredentials(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action:         restoreAction,
+		Server:         "https://server",
+		AccessKey:      "default",
+		SecretKey:      "default",
+		WriteAccessKey: "write",
+		WriteSecretKey: "write-secret",
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Fatalf("Validate returned err: %v", err)
+	}
+
+	// verify the restore keeps the access key without read credentials
+	if c.AccessKey != "default" {
+		t.Errorf("AccessKey is %s, want default", c.AccessKey)
+	}
+}
+
+func TestS3Cache_Config_transport(t *testing.T) {
+	// setup types
+	c := &Config{
+		ConnectTimeout: 5 * time.Second,
+		TraceHTTP:      true,
+	}
+
+	rt := c.transport(&http.Transport{})
+
+	trace, ok := rt.(*traceTransport)
+	if !ok {
+		t.Fatalf("transport is %T, want *traceTransport", rt)
+	}
+
+	transport, ok := trace.next.(*http.Transport)
+	if !ok {
+		t.Fatalf("next is %T, want *http.Transport", trace.next)
+	}
+
+	if transport.TLSHandshakeTimeout != c.ConnectTimeout {
+		t.Errorf("TLSHandshakeTimeout is %s, want %s", transport.TLSHandshakeTimeout, c.ConnectTimeout)
+	}
+
+	if transport.DialContext == nil {
+		t.Errorf("DialContext should have been set")
+	}
+}
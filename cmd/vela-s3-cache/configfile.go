@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles represents the files searched for in the working
+// directory for the cache when no config file is explicitly provided.
+var configFiles = []string{
+	".vela-s3-cache.yml",
+	".vela-s3-cache.yaml",
+	".vela-s3-cache.json",
+}
+
+// loadConfigFile is a helper function to apply the parameters from the
+// config file to the flags that were not set from the environment.
+func loadConfigFile(c *cli.Context) error {
+	file := c.String("config_file")
+
+	// search the working directory for the cache for a config file
+	if len(file) == 0 {
+		for _, f := range configFiles {
+			f = filepath.Join(c.String("workdir"), f)
+
+			if _, err := os.Stat(f); err == nil {
+				file = f
+
+				break
+			}
+		}
+	}
+
+	if len(file) == 0 {
+		return nil
+	}
+
+	logrus.Debugf("loading parameters from config file %s", file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read config file %s: %w", file, err)
+	}
+
+	// parse the file as yaml, which is a superset of json
+	params := make(map[string]interface{})
+
+	err = yaml.Unmarshal(data, &params)
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %w", file, err)
+	}
+
+	names := parameterNames(c.App.Flags)
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name, ok := names[key]
+		if !ok {
+			return fmt.Errorf("unknown parameter %s in config file %s", key, file)
+		}
+
+		// parameters from the environment take precedence
+		if c.IsSet(name) {
+			logrus.Debugf("parameter %s in config file %s overridden by environment", key, file)
+
+			continue
+		}
+
+		values, err := configValues(params[key])
+
+		// structured parameters are passed through as yaml
+		if name == "caches" {
+			var out []byte
+
+			out, err = yaml.Marshal(params[key])
+			values = []string{string(out)}
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid parameter %s in config file %s: %w", key, file, err)
+		}
+
+		for _, value := range values {
+			err = c.Set(name, value)
+			if err != nil {
+				return fmt.Errorf("invalid parameter %s in config file %s: %w", key, file, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parameterNames is a helper function to map the name of each
+// parameter to the name of the flag it configures.
+func parameterNames(flags []cli.Flag) map[string]string {
+	names := make(map[string]string)
+
+	for _, flag := range flags {
+		f, ok := flag.(interface{ GetEnvVars() []string })
+		if !ok {
+			continue
+		}
+
+		// the parameter name is derived from the first environment variable
+		for _, env := range f.GetEnvVars() {
+			if strings.HasPrefix(env, "PARAMETER_") {
+				names[strings.ToLower(strings.TrimPrefix(env, "PARAMETER_"))] = flag.Names()[0]
+			}
+
+			break
+		}
+	}
+
+	return names
+}
+
+// configValues is a helper function to convert a
+// value from the config file into flag values.
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("lists may only contain values")
+			}
+
+			values = append(values, fmt.Sprint(item))
+		}
+
+		return values, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("nested objects are not supported")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
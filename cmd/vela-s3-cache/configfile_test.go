@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestS3Cache_loadConfigFile(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), ".vela-s3-cache.yml")
+
+	data := []byte(`
+filename: deps.tgz
+mount:
+  - node_modules
+  - .cache
+ttl: 72h
+`)
+
+	err := os.WriteFile(file, data, 0600)
+	if err != nil {
+		t.Fatalf("unable to write config file: %v", err)
+	}
+
+	t.Setenv("PARAMETER_CONFIG_FILE", file)
+	t.Setenv("PARAMETER_FILENAME", "archive.tgz")
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_CONFIG_FILE"}, Name: "config_file"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_FILENAME"}, Name: "filename"},
+			&cli.StringSliceFlag{EnvVars: []string{"PARAMETER_MOUNT"}, Name: "rebuild.mount"},
+			&cli.DurationFlag{EnvVars: []string{"PARAMETER_TTL"}, Name: "rebuild.ttl"},
+		},
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	for _, f := range app.Flags {
+		err = f.Apply(set)
+		if err != nil {
+			t.Fatalf("unable to apply flag: %v", err)
+		}
+	}
+
+	c := cli.NewContext(app, set, nil)
+
+	err = loadConfigFile(c)
+	if err != nil {
+		t.Errorf("loadConfigFile returned err: %v", err)
+	}
+
+	// the environment takes precedence over the config file
+	if got := c.String("filename"); got != "archive.tgz" {
+		t.Errorf("filename is %s, want archive.tgz", got)
+	}
+
+	if got := c.StringSlice("rebuild.mount"); !reflect.DeepEqual(got, []string{"node_modules", ".cache"}) {
+		t.Errorf("mount is %v, want [node_modules .cache]", got)
+	}
+
+	if got := c.Duration("rebuild.ttl").String(); got != "72h0m0s" {
+		t.Errorf("ttl is %s, want 72h0m0s", got)
+	}
+}
+
+func TestS3Cache_loadConfigFile_Workdir(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, ".vela-s3-cache.yml"), []byte("filename: deps.tgz\n"), 0600)
+	if err != nil {
+		t.Fatalf("unable to write config file: %v", err)
+	}
+
+	t.Setenv("PARAMETER_WORKDIR", dir)
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_CONFIG_FILE"}, Name: "config_file"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_FILENAME"}, Name: "filename"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_WORKDIR"}, Name: "workdir"},
+		},
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	for _, f := range app.Flags {
+		err = f.Apply(set)
+		if err != nil {
+			t.Fatalf("unable to apply flag: %v", err)
+		}
+	}
+
+	c := cli.NewContext(app, set, nil)
+
+	err = loadConfigFile(c)
+	if err != nil {
+		t.Errorf("loadConfigFile returned err: %v", err)
+	}
+
+	// the config file is found in the working directory for the cache
+	if got := c.String("filename"); got != "deps.tgz" {
+		t.Errorf("filename is %s, want deps.tgz", got)
+	}
+}
+
+func TestS3Cache_configValues(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		value   interface{}
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:  "scalar",
+			value: true,
+			want:  []string{"true"},
+		},
+		{
+			desc:  "list",
+			value: []interface{}{"a", 1},
+			want:  []string{"a", "1"},
+		},
+		{
+			desc:    "nested",
+			value:   map[string]interface{}{"a": "b"},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := configValues(tC.value)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("configValues returned err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("configValues is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
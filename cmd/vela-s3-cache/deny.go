@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// target is a helper function to return the bucket and the key the
+// action is performed against, and whether the action works on every
+// key beginning with the key rather than the key itself.
+func (p *Plugin) target() (string, string, bool) {
+	switch p.Config.Action {
+	case abortAction:
+		return p.Abort.Bucket, p.Abort.Namespace, true
+	case checkAction:
+		return p.Check.Bucket, p.Check.Namespace, false
+	case flushAction:
+		return p.Flush.Bucket, p.Flush.Namespace, true
+	case lifecycleAction:
+		return p.Lifecycle.Bucket, p.Lifecycle.Namespace, true
+	case listAction:
+		return p.List.Bucket, p.List.Namespace, true
+	case pinAction:
+		return p.Pin.Bucket, p.Pin.Namespace, false
+	case presignAction:
+		return p.Presign.Bucket, p.Presign.Namespace, false
+	case rebuildAction:
+		return p.Rebuild.Bucket, p.Rebuild.Namespace, false
+	case restoreAction:
+		return p.Restore.Bucket, p.Restore.Namespace, false
+	case statsAction:
+		return p.Stats.Bucket, p.Stats.Namespace, true
+	}
+
+	return "", "", false
+}
+
+// validateDenyList verifies the action is not performed against a
+// bucket or prefix forbidden by the deny list of the platform admins.
+func (p *Plugin) validateDenyList() error {
+	bucket, key, recursive := p.target()
+	if len(bucket) == 0 {
+		return nil
+	}
+
+	logrus.Trace("validating target against deny list")
+
+	for _, entry := range p.Config.DenyList {
+		if deniedTarget(entry, bucket, key, recursive) {
+			return fmt.Errorf("bucket %s with key %s is denied as a cache target by the platform (%s)", bucket, key, entry)
+		}
+	}
+
+	return nil
+}
+
+// deniedTarget is a helper function to determine whether the entry of the
+// deny list, a bucket optionally followed by a key prefix (i.e.
+// artifacts/releases/), forbids the key in the bucket. The entry forbids
+// recursive actions above its prefix as they reach the keys below it.
+func deniedTarget(entry, bucket, key string, recursive bool) bool {
+	deniedBucket, prefix, _ := strings.Cut(strings.TrimSpace(entry), "/")
+
+	if deniedBucket != bucket {
+		return false
+	}
+
+	if strings.HasPrefix(key, prefix) {
+		return true
+	}
+
+	return recursive && strings.HasPrefix(prefix, key)
+}
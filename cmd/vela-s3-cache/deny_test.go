@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestS3Cache_deniedTarget(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc      string
+		entry     string
+		bucket    string
+		key       string
+		recursive bool
+		want      bool
+	}{
+		{
+			desc:   "bucket",
+			entry:  "artifacts",
+			bucket: "artifacts",
+			key:    "foo/bar/archive.tgz",
+			want:   true,
+		},
+		{
+			desc:   "other bucket",
+			entry:  "artifacts",
+			bucket: "cache",
+			key:    "foo/bar/archive.tgz",
+		},
+		{
+			desc:   "prefix",
+			entry:  "cache/releases/",
+			bucket: "cache",
+			key:    "releases/foo/bar/archive.tgz",
+			want:   true,
+		},
+		{
+			desc:   "outside prefix",
+			entry:  "cache/releases/",
+			bucket: "cache",
+			key:    "foo/bar/archive.tgz",
+		},
+		{
+			desc:      "recursive above prefix",
+			entry:     "cache/releases/",
+			bucket:    "cache",
+			key:       "",
+			recursive: true,
+			want:      true,
+		},
+		{
+			desc:   "key above prefix",
+			entry:  "cache/releases/",
+			bucket: "cache",
+			key:    "rel",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := deniedTarget(tC.entry, tC.bucket, tC.key, tC.recursive)
+			if got != tC.want {
+				t.Errorf("deniedTarget is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Plugin_Validate_DenyList(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Config: &Config{
+			Action:    "restore",
+			AccessKey: "123456",
+			SecretKey: "654321",
+			Server:    "https://server",
+			DenyList:  []string{"cache/foo/"},
+		},
+		Repo: &Repo{
+			Owner:       "foo",
+			Name:        "bar",
+			Branch:      "main",
+			BuildBranch: "main",
+		},
+		Restore: &Restore{
+			Timeout:  10 * time.Minute,
+			Bucket:   "cache",
+			Filename: "archive.tgz",
+		},
+	}
+
+	err := p.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+
+	p.Restore.Bucket = "other"
+
+	err = p.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
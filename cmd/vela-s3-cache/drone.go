@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// droneFilename represents the default name of
+// the cache objects written by drone-s3-cache.
+const droneFilename = "archive.tar"
+
+// tarFormat represents the uncompressed archive
+// format written by drone-s3-cache by default.
+const tarFormat = "tar"
+
+// droneNamespace is a helper function to create the namespace
+// drone-s3-cache uses for the branch, which stores the objects
+// per branch of the repo rather than per repo.
+func droneNamespace(r *Repo, prefix, fpath, branch, filename string) (string, error) {
+	// Path was supplied and will override default
+	if len(fpath) == 0 {
+		fpath = path.Join(prefix, r.Owner, r.Name, branch)
+	}
+
+	return buildNamespace(r, "", fpath, filename)
+}
+
+// droneBranch is a helper function to return the branch of the build,
+// falling back to the default branch of the repo when unknown.
+func droneBranch(r *Repo) string {
+	if len(r.BuildBranch) > 0 {
+		return r.BuildBranch
+	}
+
+	return r.Branch
+}
+
+// droneFormat is a helper function to select the archive format of a
+// drone-s3-cache object from its filename, as drone-s3-cache writes
+// plain tarballs unless gzip compression was configured.
+func droneFormat(filename string) string {
+	if strings.HasSuffix(filename, ".tgz") || strings.HasSuffix(filename, ".tar.gz") {
+		return cacheFormat
+	}
+
+	return tarFormat
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_droneNamespace(t *testing.T) {
+	// setup types
+	r := &Repo{Owner: "foo", Name: "bar", Branch: "main", BuildBranch: "feature/x"}
+
+	testCases := []struct {
+		desc    string
+		prefix  string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{desc: "default", want: "foo/bar/feature/x/archive.tar"},
+		{desc: "prefix", prefix: "drone", want: "drone/foo/bar/feature/x/archive.tar"},
+		{desc: "path", path: "custom", want: "custom/archive.tar"},
+		{desc: "traversal", path: "../other", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := droneNamespace(r, tC.prefix, tC.path, droneBranch(r), droneFilename)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("droneNamespace returned err: %v, want err: %v", err, tC.wantErr)
+			}
+
+			if got != tC.want {
+				t.Errorf("droneNamespace is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_droneFormat(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "archive.tar", want: tarFormat},
+		{filename: "archive.tgz", want: cacheFormat},
+		{filename: "archive.tar.gz", want: cacheFormat},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.filename, func(t *testing.T) {
+			if got := droneFormat(tC.filename); got != tC.want {
+				t.Errorf("droneFormat is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_DroneCompat(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:      "bucket",
+		Filename:    droneFilename,
+		Timeout:     10 * time.Minute,
+		Mount:       []string{"testdata/hello.txt"},
+		DroneCompat: true,
+	}
+
+	err := r.Configure(&Repo{Owner: "foo", Name: "bar", Branch: "main", BuildBranch: "feature"}, &Build{})
+	if err != nil {
+		t.Fatalf("Configure returned err: %v", err)
+	}
+
+	err = r.Validate()
+	if err != nil {
+		t.Fatalf("Validate returned err: %v", err)
+	}
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	obj, ok := store.objects["foo/bar/feature/archive.tar"]
+	if !ok {
+		t.Fatalf("object is missing, keys are %v", store.keys())
+	}
+
+	// the object is a plain tarball with the relative paths of the mounts
+	hdr, err := tar.NewReader(bytes.NewReader(obj.data)).Next()
+	if err != nil {
+		t.Fatalf("object is not a tarball: %v", err)
+	}
+
+	if hdr.Name != "testdata/hello.txt" {
+		t.Errorf("entry name is %s, want testdata/hello.txt", hdr.Name)
+	}
+}
+
+func TestS3Cache_Restore_Exec_DroneCompat(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	// write a tarball like drone-s3-cache for the default branch
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	err := tw.WriteHeader(&tar.Header{Name: "cache/hello.txt", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tw.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.add("foo/bar/main/archive.tar", buf.Bytes(), time.Now(), nil)
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	r := &Restore{
+		Bucket:      "bucket",
+		Filename:    droneFilename,
+		Timeout:     10 * time.Minute,
+		DroneCompat: true,
+	}
+
+	err = r.Configure(&Repo{Owner: "foo", Name: "bar", Branch: "main", BuildBranch: "feature"})
+	if err != nil {
+		t.Fatalf("Configure returned err: %v", err)
+	}
+
+	if r.Namespace != "foo/bar/feature/archive.tar" {
+		t.Errorf("Namespace is %s, want foo/bar/feature/archive.tar", r.Namespace)
+	}
+
+	res := new(Result)
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !res.Hit || res.Key != "foo/bar/main/archive.tar" {
+		t.Errorf("Hit is %v for %s, want the default branch cache restored", res.Hit, res.Key)
+	}
+
+	data, err := os.ReadFile("cache/hello.txt")
+	if err != nil {
+		t.Fatalf("restored file is missing: %v", err)
+	}
+
+	if string(data) != "hello" {
+		t.Errorf("restored file is %s, want hello", data)
+	}
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// verifyAccess is a helper function to verify the bucket is
+// reachable and the prefix can be listed with the credentials.
+func verifyAccess(ctx context.Context, store storage.Backend, bucket, prefix string) error {
+	logrus.Tracef("verifying access to bucket %s at %s", bucket, prefix)
+
+	_, err := store.List(ctx, bucket, storage.ListOptions{Prefix: prefix})
+	if err != nil {
+		return fmt.Errorf("unable to access bucket %s: %w", bucket, err)
+	}
+
+	logrus.Infof("dry run: verified access to bucket %s", bucket)
+
+	return nil
+}
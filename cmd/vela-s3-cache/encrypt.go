@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// encryptionAlgorithm is the algorithm recorded in
+	// the metadata of an encrypted cache object.
+	encryptionAlgorithm = "aes-256-gcm"
+
+	// encryptionMagic is the header identifying an encrypted archive.
+	encryptionMagic = "VELAENC1"
+
+	// encryptionChunk is the size of the plaintext chunks
+	// sealed separately to stream large archives.
+	encryptionChunk = 1 << 20
+
+	// encryptionFinal is the flag set in the length
+	// of the last chunk to detect a truncated archive.
+	encryptionFinal = 1 << 31
+)
+
+// parseEncryptionKey is a helper function to decode the
+// base64 encoded 256-bit key for encrypting archives.
+func parseEncryptionKey(key string) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64 encoded: %w", err)
+	}
+
+	if len(b) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(b))
+	}
+
+	return b, nil
+}
+
+// encryptFile is a helper function to replace the archive with its contents
+// encrypted in chunks with AES-GCM using the key.
+func encryptFile(path string, key []byte) error {
+	return transformFile(path, func(dst io.Writer, src io.Reader) error {
+		return encrypt(dst, src, key)
+	})
+}
+
+// decryptFile is a helper function to replace the
+// encrypted archive with its decrypted contents.
+func decryptFile(path string, key []byte) error {
+	return transformFile(path, func(dst io.Writer, src io.Reader) error {
+		return decrypt(dst, src, key)
+	})
+}
+
+// transformFile is a helper function to replace the
+// file with the output of the transform on its contents.
+func transformFile(path string, transform func(io.Writer, io.Reader) error) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	err = transform(dst, src)
+	if err != nil {
+		return err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(dst.Name(), path)
+}
+
+// encrypt writes the contents of the reader to the writer sealed in
+// chunks, each prefixed with its length and a random nonce.
+func encrypt(dst io.Writer, src io.Reader, key []byte) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(dst, encryptionMagic)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, encryptionChunk)
+	nonce := make([]byte, gcm.NonceSize())
+
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(src, buf)
+
+		final := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !final {
+			return err
+		}
+
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return err
+		}
+
+		sealed := gcm.Seal(nil, nonce, buf[:n], chunkData(index, final))
+
+		// record the length of the chunk with the final flag
+		length := uint32(len(sealed))
+		if final {
+			length |= encryptionFinal
+		}
+
+		err = binary.Write(dst, binary.BigEndian, length)
+		if err != nil {
+			return err
+		}
+
+		_, err = dst.Write(nonce)
+		if err != nil {
+			return err
+		}
+
+		_, err = dst.Write(sealed)
+		if err != nil {
+			return err
+		}
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// decrypt writes the contents of the chunks sealed by encrypt to the
+// writer, failing when a chunk was modified, reordered or removed.
+func decrypt(dst io.Writer, src io.Reader, key []byte) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	magic := make([]byte, len(encryptionMagic))
+
+	_, err = io.ReadFull(src, magic)
+	if err != nil || !bytes.Equal(magic, []byte(encryptionMagic)) {
+		return fmt.Errorf("archive is not encrypted")
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	for index := uint64(0); ; index++ {
+		var length uint32
+
+		err = binary.Read(src, binary.BigEndian, &length)
+		if err != nil {
+			return fmt.Errorf("archive is truncated: %w", err)
+		}
+
+		final := length&encryptionFinal != 0
+		length &^= encryptionFinal
+
+		if length > encryptionChunk+uint32(gcm.Overhead()) {
+			return fmt.Errorf("archive chunk %d is too large", index)
+		}
+
+		sealed := make([]byte, length)
+
+		_, err = io.ReadFull(src, nonce)
+		if err == nil {
+			_, err = io.ReadFull(src, sealed)
+		}
+
+		if err != nil {
+			return fmt.Errorf("archive is truncated: %w", err)
+		}
+
+		plain, err := gcm.Open(sealed[:0], nonce, sealed, chunkData(index, final))
+		if err != nil {
+			return fmt.Errorf("unable to decrypt archive chunk %d: %w", index, err)
+		}
+
+		_, err = dst.Write(plain)
+		if err != nil {
+			return err
+		}
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// newGCM is a helper function to create the AES-GCM cipher for the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkData is a helper function to create the additional data
+// authenticating the position of a chunk in the archive.
+func chunkData(index uint64, final bool) []byte {
+	data := binary.BigEndian.AppendUint64(nil, index)
+
+	if final {
+		return append(data, 1)
+	}
+
+	return append(data, 0)
+}
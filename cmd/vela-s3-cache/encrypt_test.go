@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestS3Cache_parseEncryptionKey(t *testing.T) {
+	// setup types
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+	testCases := []struct {
+		desc    string
+		key     string
+		wantLen int
+		wantErr bool
+	}{
+		{desc: "empty", key: "", wantLen: 0, wantErr: false},
+		{desc: "valid", key: key, wantLen: 32, wantErr: false},
+		{desc: "short", key: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{desc: "not base64", key: "not base64!", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseEncryptionKey(tC.key)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("parseEncryptionKey returned err: %v, want err: %v", err, tC.wantErr)
+			}
+
+			if len(got) != tC.wantLen {
+				t.Errorf("parseEncryptionKey is %d bytes, want %d", len(got), tC.wantLen)
+			}
+		})
+	}
+}
+
+func TestS3Cache_encrypt(t *testing.T) {
+	// setup types
+	key := bytes.Repeat([]byte{1}, 32)
+
+	plain := make([]byte, 2*encryptionChunk+100)
+
+	_, err := rand.Read(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := new(bytes.Buffer)
+
+	err = encrypt(sealed, bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatalf("encrypt returned err: %v", err)
+	}
+
+	testCases := []struct {
+		desc    string
+		data    func() []byte
+		key     []byte
+		wantErr bool
+	}{
+		{
+			desc:    "round trip",
+			data:    func() []byte { return sealed.Bytes() },
+			key:     key,
+			wantErr: false,
+		},
+		{
+			desc:    "wrong key",
+			data:    func() []byte { return sealed.Bytes() },
+			key:     bytes.Repeat([]byte{2}, 32),
+			wantErr: true,
+		},
+		{
+			desc: "modified",
+			data: func() []byte {
+				b := bytes.Clone(sealed.Bytes())
+				b[len(b)/2] ^= 1
+
+				return b
+			},
+			key:     key,
+			wantErr: true,
+		},
+		{
+			desc:    "truncated",
+			data:    func() []byte { return sealed.Bytes()[:sealed.Len()-200] },
+			key:     key,
+			wantErr: true,
+		},
+		{
+			desc:    "not encrypted",
+			data:    func() []byte { return plain },
+			key:     key,
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := new(bytes.Buffer)
+
+			err := decrypt(got, bytes.NewReader(tC.data()), tC.key)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("decrypt returned err: %v, want err: %v", err, tC.wantErr)
+			}
+
+			if !tC.wantErr && !bytes.Equal(got.Bytes(), plain) {
+				t.Errorf("decrypt did not return the original contents")
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/archiver/v3"
+)
+
+// specialBits represents the setuid, setgid and sticky mode
+// bits that are stripped from extracted entries by default.
+const specialBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// ratioMinBytes represents the bytes to extract before
+// the compression ratio of the archive is enforced.
+const ratioMinBytes = 100 * humanize.MByte
+
+// entryTypes represents the names of the tar entry
+// types that can be allowed on extraction.
+var entryTypes = map[string][]byte{
+	"file":     {tar.TypeReg, tar.TypeGNUSparse},
+	"dir":      {tar.TypeDir},
+	"symlink":  {tar.TypeSymlink},
+	"hardlink": {tar.TypeLink},
+	"char":     {tar.TypeChar},
+	"block":    {tar.TypeBlock},
+	"fifo":     {tar.TypeFifo},
+}
+
+// defaultEntryTypes represents the tar entry types allowed on
+// extraction by default, rejecting devices and FIFOs.
+var defaultEntryTypes = []string{"file", "dir", "symlink", "hardlink"}
+
+// extractor represents the configuration for
+// extracting a cache archive onto the filesystem.
+type extractor struct {
+	// whether to keep the setuid, setgid and sticky bits of the entries
+	preserveModeBits bool
+	// sets the maximum ratio of extracted to compressed bytes, 0 disables
+	maxRatio float64
+	// whether to skip the entries an unprivileged user can not extract
+	nonRoot bool
+	// sets the tar entry types to extract, nil allows every type
+	allowedTypes map[byte]bool
+	// sets the format of the archive, defaulting to tgz
+	format string
+	// sets the policy for the symlinks in the archive, defaulting to preserve
+	symlinks string
+	// sets the maximum number of links in a chain of dereferenced symlinks
+	symlinkDepth int
+	// sets the ids recorded in the archive to map to the owners of the entries
+	idMap idMap
+	// whether to keep the modification time recorded in the
+	// archive for extracted files instead of the extraction time
+	preserveMtimes bool
+
+	// will hold the number of compressed bytes read
+	compressed int64
+	// will hold the number of bytes extracted
+	extracted int64
+	// will hold the symlinks to extract as copies of their targets
+	links []deferredLink
+	// will hold the names of the entries written, which
+	// later entries appended to the archive can replace
+	written map[string]bool
+	// will hold the top level paths of the entries written
+	roots map[string]bool
+}
+
+// extract unpacks the entries of the tar.gz archive into the destination.
+func (e *extractor) extract(archive, destination string) error {
+	logrus.Tracef("extracting archive %s into %s", archive, destination)
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = os.MkdirAll(destination, 0755)
+	if err != nil {
+		return err
+	}
+
+	// write every entry through a handle rooted at the destination, so
+	// neither the entry names nor symlinks can resolve outside of it
+	root, err := os.OpenRoot(destination)
+	if err != nil {
+		return fmt.Errorf("unable to open destination %s: %w", destination, err)
+	}
+	defer root.Close()
+
+	t := newArchiveReader(e.format)
+
+	// count the compressed bytes to detect decompression bombs
+	err = t.Open(&countingReader{reader: f, n: &e.compressed}, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open archive %s: %w", archive, err)
+	}
+	defer t.Close()
+
+	for {
+		file, err := t.Read()
+		if errors.Is(err, io.EOF) {
+			return e.dereferenceLinks(root)
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read archive %s: %w", archive, err)
+		}
+
+		err = e.extractFile(root, file)
+
+		file.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes a single entry of the archive into the root.
+func (e *extractor) extractFile(root *os.Root, f archiver.File) error {
+	hdr, ok := f.Header.(*tar.Header)
+	if !ok {
+		return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
+	}
+
+	// skip entries that would be written outside of the destination
+	name, err := entryName(hdr.Name)
+	if err != nil {
+		logrus.Warn(err)
+
+		return nil
+	}
+
+	// skip entries with a type that is not allowed
+	if e.allowedTypes != nil && hdr.Typeflag != tar.TypeXGlobalHeader && !e.allowedTypes[hdr.Typeflag] {
+		logrus.Warnf("skipping %s: entry type %c is not allowed", hdr.Name, hdr.Typeflag)
+
+		return nil
+	}
+
+	// apply the policy for symlinks
+	if hdr.Typeflag == tar.TypeSymlink {
+		handled, err := e.symlink(name, filepath.FromSlash(slashPath(hdr.Linkname)))
+		if handled {
+			return err
+		}
+	}
+
+	// do not overwrite existing files
+	if hdr.Typeflag != tar.TypeDir && fileExists(root, name) {
+		if !e.written[name] {
+			return fmt.Errorf("file already exists: %s", filepath.Join(root.Name(), name))
+		}
+
+		// replace the entry with the entry appended to the archive
+		err = root.Remove(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	mode := f.Mode()
+
+	// strip the mode bits that could reintroduce a privileged binary
+	if !e.preserveModeBits && mode&specialBits != 0 {
+		logrus.Debugf("stripping setuid, setgid and sticky bits from %s", hdr.Name)
+
+		mode &^= specialBits
+	}
+
+	if e.nonRoot {
+		// device nodes can only be created by root
+		if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+			logrus.Warnf("skipping device node %s in non-root mode", hdr.Name)
+
+			return nil
+		}
+
+		// keep the directories writable to extract their contents
+		if hdr.Typeflag == tar.TypeDir {
+			mode |= 0700
+		}
+	}
+
+	err = e.writeEntry(root, f, hdr, name, mode)
+
+	// hand the entry to the owner its recorded ids are mapped to
+	if err == nil && hdr.Typeflag != tar.TypeXGlobalHeader {
+		err = e.chown(root, name, hdr)
+	}
+
+	// keep the modification time recorded in the archive when asked,
+	// so the restored files are unchanged for a later append or manifest
+	if err == nil && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeGNUSparse) {
+		err = e.chtimes(root, name, hdr.ModTime)
+	}
+
+	if err == nil && hdr.Typeflag != tar.TypeXGlobalHeader {
+		if e.roots == nil {
+			e.roots = map[string]bool{}
+		}
+
+		e.roots[strings.SplitN(filepath.ToSlash(name), "/", 2)[0]] = true
+	}
+
+	if err == nil && hdr.Typeflag != tar.TypeDir && hdr.Typeflag != tar.TypeXGlobalHeader {
+		if e.written == nil {
+			e.written = map[string]bool{}
+		}
+
+		e.written[name] = true
+	}
+
+	// degrade to skipping the entry when the user lacks the permissions
+	if e.nonRoot && errors.Is(err, fs.ErrPermission) {
+		logrus.Warnf("skipping %s in non-root mode: %v", hdr.Name, err)
+
+		return nil
+	}
+
+	return err
+}
+
+// writeEntry writes the archive entry to the name in the root based on its type.
+func (e *extractor) writeEntry(root *os.Root, f archiver.File, hdr *tar.Header, name string, mode os.FileMode) error {
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return root.MkdirAll(name, mode&(os.ModePerm|specialBits))
+	case tar.TypeReg, tar.TypeChar, tar.TypeBlock, tar.TypeFifo, tar.TypeGNUSparse:
+		return e.writeFile(root, name, &countingReader{reader: f, n: &e.extracted, check: e.checkRatio}, mode)
+	case tar.TypeSymlink:
+		// point the link at the target with the separators of the platform
+		target := filepath.FromSlash(slashPath(hdr.Linkname))
+
+		return writeLink(root, name, func() error { return root.Symlink(target, name) })
+	case tar.TypeLink:
+		target, err := entryName(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+
+		return writeLink(root, name, func() error { return root.Link(target, name) })
+	case tar.TypeXGlobalHeader:
+		// log the metadata embedded by the plugin, ignoring
+		// the pax global header from git generated archives
+		logMetadata(hdr.PAXRecords)
+
+		return nil
+	default:
+		return fmt.Errorf("%s: unknown type flag: %c", hdr.Name, hdr.Typeflag)
+	}
+}
+
+// logMetadata is a helper function to log the records
+// describing the cache embedded in the archive.
+func logMetadata(records map[string]string) {
+	keys := []string{}
+
+	for k := range records {
+		if strings.HasPrefix(k, paxPrefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		logrus.Debugf("archive metadata %s: %s", strings.TrimPrefix(k, paxPrefix), records[k])
+	}
+}
+
+// newArchiveReader is a helper function to create
+// the reader for the entries of the archive format.
+func newArchiveReader(format string) archiver.Reader {
+	if format == tarFormat {
+		return archiver.NewTar()
+	}
+
+	return archiver.NewTarGz()
+}
+
+// parseEntryTypes is a helper function to convert the names of
+// the allowed entry types into their tar type flags.
+func parseEntryTypes(names []string) (map[byte]bool, error) {
+	if len(names) == 0 {
+		names = defaultEntryTypes
+	}
+
+	allowed := make(map[byte]bool)
+
+	for _, name := range names {
+		flags, ok := entryTypes[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("invalid entry type %s: must be one of file, dir, symlink, hardlink, char, block or fifo", name)
+		}
+
+		for _, flag := range flags {
+			allowed[flag] = true
+		}
+	}
+
+	return allowed, nil
+}
+
+// checkRatio verifies the archive has not expanded beyond the maximum
+// ratio of its compressed size, independent of its absolute size.
+func (e *extractor) checkRatio() error {
+	if e.maxRatio <= 0 || e.extracted < ratioMinBytes || e.compressed == 0 {
+		return nil
+	}
+
+	ratio := float64(e.extracted) / float64(e.compressed)
+	if ratio > e.maxRatio {
+		return fmt.Errorf("archive expanded %.0f times its compressed size, exceeding the max ratio of %.0f", ratio, e.maxRatio)
+	}
+
+	return nil
+}
+
+// countingReader is a reader that counts the bytes read
+// and runs an optional check after every read.
+type countingReader struct {
+	reader io.Reader
+	n      *int64
+	check  func() error
+}
+
+// Read reads from the underlying reader and records the bytes read.
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	*r.n += int64(n)
+
+	if r.check != nil {
+		cErr := r.check()
+		if cErr != nil {
+			return n, cErr
+		}
+	}
+
+	return n, err
+}
+
+// entryName is a helper function to resolve the name of an archive
+// entry relative to the destination, rejecting entries that traverse
+// outside of it. Leading slashes and drive letters are removed like
+// tar does, and the names of archives created on Windows with
+// backslash separators are resolved like slash separated names.
+func entryName(name string) (string, error) {
+	slashed := slashPath(name)
+
+	// remove the drive letter of an absolute windows path
+	if len(slashed) >= 2 && slashed[1] == ':' && unicode.IsLetter(rune(slashed[0])) {
+		slashed = slashed[2:]
+	}
+
+	local := filepath.FromSlash(strings.TrimLeft(path.Clean(slashed), "/"))
+
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("illegal file path in archive: %s", name)
+	}
+
+	return local, nil
+}
+
+// slashPath is a helper function to convert the backslash
+// separators of a path written on Windows to slashes.
+func slashPath(name string) string {
+	return strings.ReplaceAll(name, `\`, "/")
+}
+
+// writeFile writes the contents of an archive entry
+// to a new file in the root with the mode.
+func (e *extractor) writeFile(root *os.Root, name string, r io.Reader, mode os.FileMode) error {
+	err := root.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+
+	// never write through an existing file or link
+	out, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = out.Chmod(mode)
+	if err != nil {
+		if !e.nonRoot {
+			return err
+		}
+
+		logrus.Warnf("unable to set mode %s on %s in non-root mode: %v", mode, name, err)
+	}
+
+	_, err = io.Copy(out, r)
+	if err != nil {
+		return fmt.Errorf("%s: writing file: %w", name, err)
+	}
+
+	return out.Close()
+}
+
+// chtimes sets the access and modification times of the file
+// in the root to the time recorded in the archive.
+func (e *extractor) chtimes(root *os.Root, name string, modTime time.Time) error {
+	if !e.preserveMtimes || modTime.IsZero() {
+		return nil
+	}
+
+	return root.Chtimes(name, modTime, modTime)
+}
+
+// writeLink is a helper function to replace the name in the root with a link.
+func writeLink(root *os.Root, name string, link func() error) error {
+	err := root.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+
+	// remove an existing link left by a previous restore
+	_, err = root.Lstat(name)
+	if err == nil {
+		err = root.Remove(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return link()
+}
+
+// fileExists is a helper function to check whether the name exists in the root.
+func fileExists(root *os.Root, name string) bool {
+	_, err := root.Lstat(name)
+
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,431 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// testEntry represents an entry to write to a test archive.
+type testEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+// writeArchive is a helper function to create a tar.gz archive with the entries.
+func writeArchive(t *testing.T, path string, entries []testEntry) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+
+		err = tw.WriteHeader(&hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tw.Write([]byte(e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3Cache_extractor_extract(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 04755}, body: "#!/bin/sh"},
+		{hdr: tar.Header{Name: "bin/link", Typeflag: tar.TypeSymlink, Linkname: "tool"}},
+		{hdr: tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}, body: "evil"},
+	})
+
+	testCases := []struct {
+		desc     string
+		preserve bool
+		want     os.FileMode
+	}{
+		{desc: "strip mode bits", preserve: false, want: 0755},
+		{desc: "preserve mode bits", preserve: true, want: 0755 | os.ModeSetuid},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "dest")
+
+			e := &extractor{preserveModeBits: tC.preserve}
+
+			err := e.extract(archive, dir)
+			if err != nil {
+				t.Fatalf("extract returned err: %v", err)
+			}
+
+			info, err := os.Stat(filepath.Join(dir, "bin", "tool"))
+			if err != nil {
+				t.Fatalf("extracted file is missing: %v", err)
+			}
+
+			if got := info.Mode() & (os.ModePerm | specialBits); got != tC.want {
+				t.Errorf("mode is %s, want %s", got, tC.want)
+			}
+
+			target, err := os.Readlink(filepath.Join(dir, "bin", "link"))
+			if err != nil || target != "tool" {
+				t.Errorf("link target is %s, want tool: %v", target, err)
+			}
+
+			// verify the entry outside of the destination was skipped
+			_, err = os.Stat(filepath.Join(filepath.Dir(dir), "evil"))
+			if !os.IsNotExist(err) {
+				t.Errorf("entry outside of the destination should not be extracted")
+			}
+		})
+	}
+}
+
+func TestS3Cache_extractor_extract_Exists(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "hello.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "hello"},
+	})
+
+	err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("existing"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = new(extractor).extract(archive, dir)
+	if err == nil {
+		t.Errorf("extract should have returned err")
+	}
+}
+
+func TestS3Cache_extractor_extract_SymlinkEscape(t *testing.T) {
+	// setup types
+	outside := t.TempDir()
+	dir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "/abs.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "abs"},
+		{hdr: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside}},
+		{hdr: tar.Header{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644}, body: "evil"},
+	})
+
+	err := new(extractor).extract(archive, dir)
+	if err == nil {
+		t.Errorf("extract should have returned err")
+	}
+
+	// verify the absolute entry was extracted into the destination
+	_, err = os.Stat(filepath.Join(dir, "abs.txt"))
+	if err != nil {
+		t.Errorf("extracted file is missing: %v", err)
+	}
+
+	// verify the entry was not written through the symlink
+	_, err = os.Stat(filepath.Join(outside, "evil"))
+	if !os.IsNotExist(err) {
+		t.Errorf("entry should not be written outside of the destination")
+	}
+}
+
+func TestS3Cache_extractor_extract_NonRoot(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "ro/", Typeflag: tar.TypeDir, Mode: 0555}},
+		{hdr: tar.Header{Name: "ro/hello.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "hello"},
+		{hdr: tar.Header{Name: "null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+	})
+
+	e := &extractor{nonRoot: true}
+
+	err := e.extract(archive, dir)
+	if err != nil {
+		t.Fatalf("extract returned err: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "ro"))
+	if err != nil {
+		t.Fatalf("extracted directory is missing: %v", err)
+	}
+
+	if got := info.Mode().Perm(); got != 0755 {
+		t.Errorf("mode is %s, want %s", got, os.FileMode(0755))
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "ro", "hello.txt"))
+	if err != nil {
+		t.Errorf("extracted file is missing: %v", err)
+	}
+
+	// verify the device node was skipped
+	_, err = os.Lstat(filepath.Join(dir, "null"))
+	if !os.IsNotExist(err) {
+		t.Errorf("device node should not be extracted")
+	}
+}
+
+func TestS3Cache_extractor_extract_AllowedTypes(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "hello.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "hello"},
+		{hdr: tar.Header{Name: "null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+		{hdr: tar.Header{Name: "pipe", Typeflag: tar.TypeFifo, Mode: 0644}},
+	})
+
+	testCases := []struct {
+		desc    string
+		allowed []string
+		want    []string
+	}{
+		{desc: "default", allowed: nil, want: []string{"hello.txt"}},
+		{desc: "fifo", allowed: []string{"file", "fifo"}, want: []string{"hello.txt", "pipe"}},
+		{desc: "dir only", allowed: []string{"dir"}, want: []string{}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dir := t.TempDir()
+
+			allowed, err := parseEntryTypes(tC.allowed)
+			if err != nil {
+				t.Fatalf("parseEntryTypes returned err: %v", err)
+			}
+
+			e := &extractor{allowedTypes: allowed}
+
+			err = e.extract(archive, dir)
+			if err != nil {
+				t.Fatalf("extract returned err: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("extracted entries are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_parseEntryTypes_Invalid(t *testing.T) {
+	// setup types
+	_, err := parseEntryTypes([]string{"file", "socket"})
+	if err == nil {
+		t.Errorf("parseEntryTypes should have returned err")
+	}
+}
+
+func TestS3Cache_extractor_checkRatio(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		e       *extractor
+		wantErr bool
+	}{
+		{
+			desc:    "within ratio",
+			e:       &extractor{maxRatio: 100, compressed: 10 * humanize.MByte, extracted: 500 * humanize.MByte},
+			wantErr: false,
+		},
+		{
+			desc:    "exceeds ratio",
+			e:       &extractor{maxRatio: 100, compressed: humanize.MByte, extracted: 500 * humanize.MByte},
+			wantErr: true,
+		},
+		{
+			desc:    "below minimum",
+			e:       &extractor{maxRatio: 100, compressed: 1, extracted: humanize.MByte},
+			wantErr: false,
+		},
+		{
+			desc:    "disabled",
+			e:       &extractor{compressed: humanize.MByte, extracted: 500 * humanize.MByte},
+			wantErr: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.e.checkRatio()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("checkRatio returned err: %v, want err: %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Cache_extractor_extract_Bomb(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "zeros", Typeflag: tar.TypeReg, Mode: 0644}, body: strings.Repeat("\x00", 2*ratioMinBytes)},
+	})
+
+	e := &extractor{maxRatio: 100}
+
+	err := e.extract(archive, t.TempDir())
+	if err == nil {
+		t.Errorf("extract should have returned err")
+	}
+}
+
+func TestS3Cache_entryName(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{desc: "relative", name: "cache/file.txt", want: filepath.Join("cache", "file.txt")},
+		{desc: "absolute", name: "/cache/file.txt", want: filepath.Join("cache", "file.txt")},
+		{desc: "backslashes", name: `cache\sub\file.txt`, want: filepath.Join("cache", "sub", "file.txt")},
+		{desc: "drive letter", name: `C:\cache\file.txt`, want: filepath.Join("cache", "file.txt")},
+		{desc: "traversal", name: "../evil", wantErr: true},
+		{desc: "backslash traversal", name: `cache\..\..\evil`, wantErr: true},
+		{desc: "drive letter traversal", name: `C:..\evil`, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := entryName(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("entryName returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if got != tC.want {
+				t.Errorf("entryName is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_extractor_extract_Windows(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	// write the entries like a tool on a windows runner
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: `cache\`, Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: `cache\bin\tool.exe`, Typeflag: tar.TypeReg, Mode: 0755}, body: "MZ"},
+		{hdr: tar.Header{Name: `cache\link`, Typeflag: tar.TypeSymlink, Linkname: `bin\tool.exe`}},
+	})
+
+	dir := filepath.Join(t.TempDir(), "dest")
+
+	err := new(extractor).extract(archive, dir)
+	if err != nil {
+		t.Fatalf("extract returned err: %v", err)
+	}
+
+	body, err := os.ReadFile(filepath.Join(dir, "cache", "bin", "tool.exe"))
+	if err != nil || string(body) != "MZ" {
+		t.Errorf("extracted file is %q, want MZ: %v", body, err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "cache", "link"))
+	if err != nil || target != filepath.Join("bin", "tool.exe") {
+		t.Errorf("link target is %s, want %s: %v", target, filepath.Join("bin", "tool.exe"), err)
+	}
+}
+
+func TestS3Cache_extractor_extract_ModTime(t *testing.T) {
+	// setup types
+	archived := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		desc           string
+		preserveMtimes bool
+	}{
+		{
+			desc: "extraction time",
+		},
+		{
+			desc:           "preserve mtimes",
+			preserveMtimes: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+			writeArchive(t, archive, []testEntry{
+				{hdr: tar.Header{Name: "build/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: archived}},
+				{hdr: tar.Header{Name: "build/output.o", Typeflag: tar.TypeReg, Mode: 0644, ModTime: archived}, body: "object"},
+			})
+
+			dir := filepath.Join(t.TempDir(), "dest")
+
+			// allow for the coarse timestamps of some filesystems
+			start := time.Now().Add(-time.Second)
+
+			err := (&extractor{preserveMtimes: tC.preserveMtimes}).extract(archive, dir)
+			if err != nil {
+				t.Fatalf("extract returned err: %v", err)
+			}
+
+			info, err := os.Stat(filepath.Join(dir, "build", "output.o"))
+			if err != nil {
+				t.Fatalf("output.o is missing: %v", err)
+			}
+
+			if tC.preserveMtimes {
+				if !info.ModTime().Equal(archived) {
+					t.Errorf("modification time is %s, want %s", info.ModTime(), archived)
+				}
+
+				return
+			}
+
+			// verify build tools see the restored files as new
+			if info.ModTime().Before(start) {
+				t.Errorf("modification time is %s, want the extraction time", info.ModTime())
+			}
+		})
+	}
+}
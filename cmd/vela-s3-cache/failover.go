@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// endpoint represents a storage backend for a single s3 server.
+type endpoint struct {
+	server  string
+	backend storage.Backend
+}
+
+// failoverBackend is a storage.Backend that retries each operation against
+// the next endpoint in order when an endpoint can't be reached or fails
+// with a server error, logging the endpoint that served the request.
+type failoverBackend struct {
+	endpoints []endpoint
+}
+
+// do runs fn against each endpoint in order until an
+// endpoint succeeds or fails with an error not worth
+// retrying against another endpoint.
+func (f *failoverBackend) do(ctx context.Context, op string, fn func(storage.Backend) error) error {
+	var err error
+
+	for i, e := range f.endpoints {
+		if i > 0 {
+			logrus.Warnf("%s failed against %s, failing over to %s: %v", op, f.endpoints[i-1].server, e.server, err)
+		}
+
+		err = fn(e.backend)
+		if err == nil {
+			if i > 0 {
+				logrus.Infof("%s served by failover endpoint %s", op, e.server)
+			} else {
+				logrus.Tracef("%s served by endpoint %s", op, e.server)
+			}
+
+			return nil
+		}
+
+		if ctx.Err() != nil || !failoverError(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%s failed against all %d endpoints: %w", op, len(f.endpoints), err)
+}
+
+// Put uploads the contents of the reader to the key in the bucket, failing
+// over only when the reader can be rewound to upload the contents again.
+func (f *failoverBackend) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts storage.PutOptions) (storage.Object, error) {
+	var object storage.Object
+
+	seeker, seekable := reader.(io.Seeker)
+
+	start := int64(0)
+	if seekable {
+		var err error
+
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			seekable = false
+		}
+	}
+
+	attempt := 0
+
+	err := f.do(ctx, "put "+key, func(b storage.Backend) error {
+		// rewind the contents consumed by the failed upload
+		if attempt > 0 {
+			if !seekable {
+				return fmt.Errorf("unable to rewind the contents of %s to upload to the next endpoint", key)
+			}
+
+			_, err := seeker.Seek(start, io.SeekStart)
+			if err != nil {
+				return err
+			}
+		}
+
+		attempt++
+
+		var err error
+
+		object, err = b.Put(ctx, bucket, key, reader, size, opts)
+
+		return err
+	})
+
+	return object, err
+}
+
+// Copy copies the source key to the destination key in the bucket on the
+// server, replacing the metadata, tags and retention with the options.
+func (f *failoverBackend) Copy(ctx context.Context, bucket, src, dst string, opts storage.PutOptions) (storage.Object, error) {
+	var object storage.Object
+
+	err := f.do(ctx, "copy "+src+" to "+dst, func(b storage.Backend) error {
+		var err error
+
+		object, err = b.Copy(ctx, bucket, src, dst, opts)
+
+		return err
+	})
+
+	return object, err
+}
+
+// Get retrieves the contents of the key in the bucket. The first byte is
+// read before returning, as some clients only send the request on read.
+func (f *failoverBackend) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+
+	err := f.do(ctx, "get "+key, func(b storage.Backend) error {
+		var err error
+
+		rc, err = peek(b.Get(ctx, bucket, key))
+
+		return err
+	})
+
+	return rc, err
+}
+
+// GetRange retrieves a range of the contents of the key in the bucket.
+func (f *failoverBackend) GetRange(ctx context.Context, bucket, key string, opts storage.RangeOptions) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+
+	err := f.do(ctx, "get range of "+key, func(b storage.Backend) error {
+		var err error
+
+		rc, err = peek(b.GetRange(ctx, bucket, key, opts))
+
+		return err
+	})
+
+	return rc, err
+}
+
+// Stat retrieves the information and metadata for the key in the bucket.
+func (f *failoverBackend) Stat(ctx context.Context, bucket, key string) (storage.Object, error) {
+	var object storage.Object
+
+	err := f.do(ctx, "stat "+key, func(b storage.Backend) error {
+		var err error
+
+		object, err = b.Stat(ctx, bucket, key)
+
+		return err
+	})
+
+	return object, err
+}
+
+// List retrieves the objects in the bucket matching the options.
+func (f *failoverBackend) List(ctx context.Context, bucket string, opts storage.ListOptions) ([]storage.Object, error) {
+	var objects []storage.Object
+
+	err := f.do(ctx, "list "+opts.Prefix, func(b storage.Backend) error {
+		var err error
+
+		objects, err = b.List(ctx, bucket, opts)
+
+		return err
+	})
+
+	return objects, err
+}
+
+// GetTags retrieves the tags of the key in the bucket.
+func (f *failoverBackend) GetTags(ctx context.Context, bucket, key string) (map[string]string, error) {
+	var tags map[string]string
+
+	err := f.do(ctx, "get tags "+key, func(b storage.Backend) error {
+		var err error
+
+		tags, err = b.GetTags(ctx, bucket, key)
+
+		return err
+	})
+
+	return tags, err
+}
+
+// SetTags replaces the tags of the key in the bucket.
+func (f *failoverBackend) SetTags(ctx context.Context, bucket, key string, tags map[string]string) error {
+	return f.do(ctx, "set tags "+key, func(b storage.Backend) error {
+		return b.SetTags(ctx, bucket, key, tags)
+	})
+}
+
+// Remove deletes the objects from the bucket, retrying the objects that
+// could not be removed against the next endpoint when every failure is
+// worth retrying against another endpoint.
+func (f *failoverBackend) Remove(ctx context.Context, bucket string, objects []storage.Object) []storage.RemoveError {
+	var errs []storage.RemoveError
+
+	_ = f.do(ctx, fmt.Sprintf("remove %d objects", len(objects)), func(b storage.Backend) error {
+		errs = b.Remove(ctx, bucket, objects)
+		if len(errs) == 0 {
+			return nil
+		}
+
+		failed := []storage.Object{}
+		joined := []error{}
+
+		for _, rErr := range errs {
+			failed = append(failed, rErr.Object)
+			joined = append(joined, rErr.Err)
+
+			// keep the errors for objects another endpoint won't remove
+			if !failoverError(rErr.Err) {
+				return rErr
+			}
+		}
+
+		objects = failed
+
+		return errors.Join(joined...)
+	})
+
+	return errs
+}
+
+// Abort removes the parts of any incomplete uploads for the key in the bucket.
+func (f *failoverBackend) Abort(ctx context.Context, bucket, key string) error {
+	return f.do(ctx, "abort "+key, func(b storage.Backend) error {
+		return b.Abort(ctx, bucket, key)
+	})
+}
+
+// ListUploads retrieves the incomplete multipart uploads
+// in the bucket for the keys beginning with the prefix.
+func (f *failoverBackend) ListUploads(ctx context.Context, bucket, prefix string) ([]storage.Upload, error) {
+	var uploads []storage.Upload
+
+	err := f.do(ctx, "list incomplete uploads "+prefix, func(b storage.Backend) error {
+		var err error
+
+		uploads, err = b.ListUploads(ctx, bucket, prefix)
+
+		return err
+	})
+
+	return uploads, err
+}
+
+// AbortUpload removes the parts of the incomplete upload in the bucket.
+func (f *failoverBackend) AbortUpload(ctx context.Context, bucket string, upload storage.Upload) error {
+	return f.do(ctx, "abort upload "+upload.Key, func(b storage.Backend) error {
+		return b.AbortUpload(ctx, bucket, upload)
+	})
+}
+
+// SetLifecycle creates or replaces the rule with the same id in the
+// lifecycle configuration of the bucket, keeping any other rules.
+func (f *failoverBackend) SetLifecycle(ctx context.Context, bucket string, rule storage.LifecycleRule) error {
+	return f.do(ctx, "set lifecycle rule "+rule.ID, func(b storage.Backend) error {
+		return b.SetLifecycle(ctx, bucket, rule)
+	})
+}
+
+// Presign creates a URL granting the method, GET or PUT, on
+// the key in the bucket without credentials until the expiry.
+func (f *failoverBackend) Presign(ctx context.Context, bucket, key, method string, expiry time.Duration) (string, error) {
+	var u string
+
+	err := f.do(ctx, "presign "+key, func(b storage.Backend) error {
+		var err error
+
+		u, err = b.Presign(ctx, bucket, key, method, expiry)
+
+		return err
+	})
+
+	return u, err
+}
+
+// failoverError is a helper function to determine whether the error
+// is a connection or server error worth retrying against another endpoint.
+func failoverError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// the endpoint responded, so only retry server errors
+	var resp *storage.ResponseError
+	if errors.As(err, &resp) {
+		return resp.StatusCode >= 500
+	}
+
+	// the endpoint could not be reached
+	var nErr net.Error
+
+	return errors.As(err, &nErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// peekedReader is a reader with its first bytes buffered.
+type peekedReader struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// peek is a helper function to read the first byte of the contents
+// so the errors of the request are returned before the contents.
+func peek(rc io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(rc)
+
+	_, err = br.Peek(1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		rc.Close()
+
+		return nil, err
+	}
+
+	return &peekedReader{Reader: br, Closer: rc}, nil
+}
+
+// newFailover creates a storage backend for each server that fails
+// over to the next server in order, unless only one server is provided.
+func (c *Config) newFailover(servers []string) (storage.Backend, error) {
+	endpoints := []endpoint{}
+
+	for _, server := range servers {
+		cfg := *c
+		cfg.Server = server
+		cfg.FailoverServers = nil
+
+		backend, err := cfg.New()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create client for %s: %w", server, err)
+		}
+
+		endpoints = append(endpoints, endpoint{server: server, backend: backend})
+	}
+
+	logrus.Debugf("failing over between endpoints %s", strings.Join(servers, ", "))
+
+	return &failoverBackend{endpoints: endpoints}, nil
+}
@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// errUnavailable is returned by the unavailable backend for every request.
+var errUnavailable = &storage.ResponseError{StatusCode: 503, Code: "ServiceUnavailable", Err: errors.New("service unavailable")}
+
+// unavailableBackend is a fake backend failing every request with a server error.
+type unavailableBackend struct {
+	*fakeBackend
+}
+
+// Put consumes the reader before failing as if the upload was interrupted.
+func (unavailableBackend) Put(_ context.Context, _, _ string, reader io.Reader, _ int64, _ storage.PutOptions) (storage.Object, error) {
+	_, _ = io.CopyN(io.Discard, reader, 4)
+
+	return storage.Object{}, errUnavailable
+}
+
+// Get fails on the first read, like clients that only send the request on read.
+func (unavailableBackend) Get(context.Context, string, string) (io.ReadCloser, error) {
+	return io.NopCloser(iotest.ErrReader(errUnavailable)), nil
+}
+
+// Stat always fails with a server error.
+func (unavailableBackend) Stat(context.Context, string, string) (storage.Object, error) {
+	return storage.Object{}, errUnavailable
+}
+
+// Remove fails to remove every object with a server error.
+func (unavailableBackend) Remove(_ context.Context, _ string, objects []storage.Object) []storage.RemoveError {
+	errs := []storage.RemoveError{}
+
+	for _, object := range objects {
+		errs = append(errs, storage.RemoveError{Object: object, Err: errUnavailable})
+	}
+
+	return errs
+}
+
+// newFailoverBackend is a helper function to create a failover
+// backend from an unavailable endpoint to the fake backend.
+func newFailoverBackend(store *fakeBackend) *failoverBackend {
+	return &failoverBackend{endpoints: []endpoint{
+		{server: "https://primary", backend: unavailableBackend{newFakeBackend()}},
+		{server: "https://replica", backend: store},
+	}}
+}
+
+func TestS3Cache_failoverError(t *testing.T) {
+	testCases := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "server error", err: fmt.Errorf("unable to stat: %w", errUnavailable), want: true},
+		{desc: "not found", err: &storage.ResponseError{StatusCode: 404, Err: errNotFound}},
+		{desc: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: true},
+		{desc: "canceled", err: context.Canceled},
+		{desc: "other", err: errors.New("access denied")},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := failoverError(tC.err); got != tC.want {
+				t.Errorf("failoverError is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_failoverBackend_Stat(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("hello"), time.Now(), nil)
+
+	object, err := newFailoverBackend(store).Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatalf("Stat returned err: %v", err)
+	}
+
+	if object.Size != 5 {
+		t.Errorf("Size is %d, want 5", object.Size)
+	}
+
+	// verify errors from a reachable endpoint are not retried
+	f := &failoverBackend{endpoints: []endpoint{
+		{server: "https://primary", backend: newFakeBackend()},
+		{server: "https://replica", backend: store},
+	}}
+
+	_, err = f.Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if !errors.Is(err, errNotFound) {
+		t.Errorf("Stat returned err: %v, want %v", err, errNotFound)
+	}
+}
+
+func TestS3Cache_failoverBackend_Stat_AllFailed(t *testing.T) {
+	// setup types
+	f := &failoverBackend{endpoints: []endpoint{
+		{server: "https://primary", backend: unavailableBackend{newFakeBackend()}},
+		{server: "https://replica", backend: unavailableBackend{newFakeBackend()}},
+	}}
+
+	_, err := f.Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("Stat returned err: %v, want %v", err, errUnavailable)
+	}
+}
+
+func TestS3Cache_failoverBackend_Put(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	_, err := newFailoverBackend(store).Put(context.Background(), "bucket", "foo/bar/archive.tgz", strings.NewReader("hello world"), -1, storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("Put returned err: %v", err)
+	}
+
+	// verify the contents consumed by the failed upload were rewound
+	rc, err := store.Get(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatalf("Get returned err: %v", err)
+	}
+
+	data, _ := io.ReadAll(rc)
+
+	if string(data) != "hello world" {
+		t.Errorf("contents are %q, want %q", data, "hello world")
+	}
+
+	// verify a reader that can't be rewound is not uploaded again
+	_, err = newFailoverBackend(newFakeBackend()).Put(context.Background(), "bucket", "foo/bar/archive.tgz", io.MultiReader(strings.NewReader("hello world")), -1, storage.PutOptions{})
+	if err == nil {
+		t.Errorf("Put should have returned err")
+	}
+}
+
+func TestS3Cache_failoverBackend_Get(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("hello"), time.Now(), nil)
+
+	rc, err := newFailoverBackend(store).Get(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatalf("Get returned err: %v", err)
+	}
+	defer rc.Close()
+
+	data, _ := io.ReadAll(rc)
+
+	if string(data) != "hello" {
+		t.Errorf("contents are %q, want %q", data, "hello")
+	}
+}
+
+func TestS3Cache_failoverBackend_Remove(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("hello"), time.Now(), nil)
+
+	errs := newFailoverBackend(store).Remove(context.Background(), "bucket", []storage.Object{{Key: "foo/bar/archive.tgz"}})
+	if len(errs) > 0 {
+		t.Errorf("Remove returned errs: %v", errs)
+	}
+
+	if keys := store.keys(); len(keys) > 0 {
+		t.Errorf("keys is %v, want none", keys)
+	}
+}
+
+func TestS3Cache_Config_Validate_FailoverServers(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action:          "flush",
+		AccessKey:       "123456",
+		SecretKey:       "654321",
+		Server:          "https://server",
+		FailoverServers: []string{"https://replica", "replica"},
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/fips140"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// validateFIPS verifies the configuration only relies on approved
+// cryptography and endpoints in FIPS mode, selecting the aws driver
+// when no driver is provided and requiring at least TLS 1.2 for the
+// connections.
+func (c *Config) validateFIPS() error {
+	if !c.FIPS {
+		return nil
+	}
+
+	// the minio client hashes the bodies of several requests with MD5
+	switch c.Driver {
+	case "":
+		c.Driver = awsDriver
+	case awsDriver:
+	default:
+		return fmt.Errorf("driver %s can not be used in fips mode: must be %s", c.Driver, awsDriver)
+	}
+
+	// s3 compatible stores have no FIPS endpoints
+	if len(c.Provider) > 0 {
+		return fmt.Errorf("provider %s can not be used in fips mode", c.Provider)
+	}
+
+	// the FIPS endpoints are only resolved without a custom endpoint
+	for _, server := range append([]string{c.Server}, c.FailoverServers...) {
+		if len(server) > 0 && !amazonHost(server) {
+			return fmt.Errorf("server %s can not be used in fips mode: must be an amazon s3 endpoint", server)
+		}
+	}
+
+	if len(c.STSEndpoint) > 0 {
+		return fmt.Errorf("sts endpoint %s can not be used in fips mode", c.STSEndpoint)
+	}
+
+	// the region of the bucket is only discovered with the global endpoint
+	if len(c.Region) == 0 {
+		return fmt.Errorf("no region provided: the region must be provided in fips mode")
+	}
+
+	// SSE-C sends the MD5 of the key with every request
+	if c.Encryption.Mode == storage.SSEC {
+		return fmt.Errorf("server-side encryption %s can not be used in fips mode: must be %s or %s",
+			storage.SSEC, storage.SSES3, storage.SSEKMS)
+	}
+
+	switch {
+	case c.MinTLSVersion == 0:
+		c.MinTLSVersion = tls.VersionTLS12
+	case c.MinTLSVersion < tls.VersionTLS12:
+		return fmt.Errorf("minimum TLS version must be at least 1.2 in fips mode")
+	}
+
+	// the restrictions are only enforced by the FIPS 140-3 Go cryptographic module
+	if !fips140.Enabled() {
+		logrus.Warn("fips mode is enabled without the FIPS 140-3 Go cryptographic module: set GODEBUG=fips140=on")
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_Config_validateFIPS(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc       string
+		config     Config
+		wantDriver string
+		wantTLS    uint16
+		wantErr    bool
+	}{
+		{
+			desc:       "disabled",
+			config:     Config{Driver: minioDriver, Encryption: storage.Encryption{Mode: storage.SSEC}},
+			wantDriver: minioDriver,
+		},
+		{
+			desc:       "default driver",
+			config:     Config{FIPS: true, Region: "us-east-1"},
+			wantDriver: awsDriver,
+			wantTLS:    tls.VersionTLS12,
+		},
+		{
+			desc:       "tls 1.3",
+			config:     Config{FIPS: true, Driver: awsDriver, Region: "us-east-1", MinTLSVersion: tls.VersionTLS13},
+			wantDriver: awsDriver,
+			wantTLS:    tls.VersionTLS13,
+		},
+		{
+			desc:       "amazon server",
+			config:     Config{FIPS: true, Region: "us-east-1", Server: "https://s3.amazonaws.com"},
+			wantDriver: awsDriver,
+			wantTLS:    tls.VersionTLS12,
+		},
+		{
+			desc:    "no region",
+			config:  Config{FIPS: true},
+			wantErr: true,
+		},
+		{
+			desc:    "custom server",
+			config:  Config{FIPS: true, Region: "us-east-1", Server: "https://minio.example.com"},
+			wantErr: true,
+		},
+		{
+			desc:    "sts endpoint",
+			config:  Config{FIPS: true, Region: "us-east-1", STSEndpoint: "https://sts.example.com"},
+			wantErr: true,
+		},
+		{
+			desc:    "minio driver",
+			config:  Config{FIPS: true, Driver: minioDriver},
+			wantErr: true,
+		},
+		{
+			desc:    "provider",
+			config:  Config{FIPS: true, Provider: r2Provider},
+			wantErr: true,
+		},
+		{
+			desc:    "sse-c",
+			config:  Config{FIPS: true, Encryption: storage.Encryption{Mode: storage.SSEC}},
+			wantErr: true,
+		},
+		{
+			desc:    "tls 1.1",
+			config:  Config{FIPS: true, MinTLSVersion: tls.VersionTLS11},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c := tC.config
+
+			err := c.validateFIPS()
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("validateFIPS returned err: %v", err)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if c.Driver != tC.wantDriver {
+				t.Errorf("Driver is %s, want %s", c.Driver, tC.wantDriver)
+			}
+
+			if c.MinTLSVersion != tC.wantTLS {
+				t.Errorf("MinTLSVersion is %x, want %x", c.MinTLSVersion, tC.wantTLS)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_compat_FIPS(t *testing.T) {
+	// setup types
+	c := &Config{FIPS: true, AcceleratedEndpoint: "s3-accelerate.amazonaws.com"}
+
+	if !c.compat().NoMD5 {
+		t.Errorf("compat should send checksums instead of MD5 digests in fips mode")
+	}
+
+	if c.accelerate() {
+		t.Errorf("accelerate should be disabled in fips mode")
+	}
+}
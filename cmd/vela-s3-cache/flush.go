@@ -4,12 +4,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dustin/go-humanize"
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 )
 
 const flushAction = "flush"
@@ -24,84 +32,843 @@ type Flush struct {
 	Prefix string
 	// sets the age of the objects to flush
 	Age time.Duration
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// sets the key patterns an object must match to be flushed
+	Pattern []string
+	// sets the number of most recent objects to keep per key prefix
+	Keep int
+	// sets the maximum cumulative size in bytes of the objects to keep
+	MaxTotalSize uint64
+	// sets the number of workers used to process the objects
+	Workers int
+	// sets the maximum number of keys per page when listing the objects
+	MaxKeys int
+	// sets the key to list the objects after, resuming a flush of a huge path
+	StartAfter string
+	// whether to only flush the objects directly in the namespace
+	NonRecursive bool
+	// whether to skip retrieving each object to check its recorded expiry
+	SkipExpiry bool
+	// sets the active branches whose cache namespaces are kept
+	Branches []string
+	// sets the file to read additional active branches from
+	BranchesFile string
+	// whether to remove every version of the objects in a versioned bucket
+	Versions bool
+	// sets the location of the S3 Inventory manifest to read the objects from
+	Inventory string
+	// sets the file to write the JSON report for the flush to
+	Report string
+	// whether to report the objects to remove without removing them
+	DryRun bool
 	// will hold our final namespace for the path to the objects
 	Namespace string
 }
 
 // Exec formats and runs the actions for flushing a cache in s3.
-func (f *Flush) Exec(mc *minio.Client) error {
+func (f *Flush) Exec(ctx context.Context, store storage.Backend, res *Result) error {
 	logrus.Trace("running flush with provided configuration")
 
-	// temp var for messaging to user
-	objectsExist := false
-
-	bytesFreedCounter := uint64(0)
-
 	// set a timeout on the request to the cache provider
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
 	defer cancel()
 
-	logrus.Infof("processing cached objects in path %s", f.Namespace)
+	report := &FlushReport{
+		Bucket:    f.Bucket,
+		Namespace: f.Namespace,
+		DryRun:    f.DryRun,
+	}
+
+	err := f.flush(ctx, store, report)
+
+	res.Key = f.Namespace
+	res.Removed = report.Removed
+	res.Freed = report.BytesFreed
+
+	// write the report for the flush, including any error
+	if len(f.Report) > 0 {
+		report.AddError(err)
+
+		rErr := report.Write(f.Report)
+		if rErr != nil {
+			return errors.Join(err, rErr)
+		}
 
-	opts := minio.ListObjectsOptions{
-		Prefix:    f.Namespace,
-		Recursive: true,
+		logrus.Infof("flush report written to %s", f.Report)
 	}
+
+	return err
+}
+
+// flush processes the objects in the namespace and removes
+// the objects meeting the flush criteria from the bucket.
+func (f *Flush) flush(ctx context.Context, store storage.Backend, report *FlushReport) error {
+	// compile the key patterns for the objects to flush
+	patterns, err := f.patterns()
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("processing cached objects in path %s", f.Namespace)
+
 	// lists all objects matching the path
 	// in the specified bucket
-	objectCh := mc.ListObjects(ctx, f.Bucket, opts)
-	for object := range objectCh {
-		// we got at least one object
-		objectsExist = true
+	objects, err := f.list(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	// the stats objects are removed along with their cache objects
+	objects, stats := splitStats(objects)
+
+	report.Examined = len(objects)
 
-		if object.Err != nil {
-			return fmt.Errorf("unable to retrieve object %s: %w", object.Key, object.Err)
+	// determine the most recent objects to keep
+	keep := f.keep(objects, patterns)
+
+	// evaluate which objects meet the flush criteria
+	remove, err := f.evaluate(ctx, store, objects, keep, patterns)
+	if err != nil {
+		return err
+	}
+
+	// remove the oldest remaining objects to meet the size budget
+	remove = append(remove, f.unpinned(ctx, store, f.budget(objects, remove, keep, patterns))...)
+
+	// remove every version of the objects from a versioned bucket
+	if f.Versions {
+		remove, err = f.versions(ctx, store, remove, patterns)
+		if err != nil {
+			return err
+		}
+	}
+
+	// report the objects that would be removed from the bucket
+	if f.DryRun {
+		for _, object := range remove {
+			logrus.Infof("  - %s; dry run, object would be removed", objectName(object.Key, object.VersionID))
 		}
 
-		objSize := uint64(object.Size)
-		humanSize := humanize.Bytes(objSize)
+		report.AddRemoved(remove)
 
-		logrus.Infof("  - %s; last modified: %s; size: %s", object.Key, object.LastModified.String(), humanSize)
+		logrus.Infof("dry run: %d objects would be removed, %s would be freed", report.Removed, humanize.Bytes(report.BytesFreed))
 
-		// determine time in the past for flush cut off
-		timeInPast := time.Now().Add(-f.Age)
+		return nil
+	}
 
-		// check if the object meets the flush age
-		if object.LastModified.Before(timeInPast) {
-			logrus.Infof("    ├ '%s' flush age criteria met. removing object.", f.Age)
+	// remove the objects from the bucket
+	removed, err := f.remove(ctx, store, remove)
 
-			// remove the object from the bucket
-			err := mc.RemoveObject(ctx, f.Bucket, object.Key, minio.RemoveObjectOptions{})
-			if err != nil {
-				return err
+	report.AddRemoved(removed)
+
+	f.removeStats(ctx, store, removed, stats)
+
+	if len(objects) == 0 {
+		logrus.Infof("no cache objects found at %s", f.Path)
+	}
+
+	logrus.Debug("cache flush action completed")
+
+	if report.BytesFreed > 0 {
+		logrus.Debugf("%s freed in total", humanize.Bytes(report.BytesFreed))
+	}
+
+	logrus.Debugf("%d objects examined, %d objects removed", report.Examined, report.Removed)
+
+	return err
+}
+
+// list collects all objects in the namespace of the flush.
+func (f *Flush) list(ctx context.Context, store storage.Backend) ([]storage.Object, error) {
+	logrus.Tracef("listing objects in path %s", f.Namespace)
+
+	var (
+		listed []storage.Object
+		err    error
+	)
+
+	switch {
+	// read the objects from an inventory report instead of the bucket
+	case len(f.Inventory) > 0:
+		listed, err = f.listInventory(ctx, store)
+	// list only the level of the namespace, grouping the nested keys
+	case f.NonRecursive:
+		listed, err = store.List(ctx, f.Bucket, storage.ListOptions{
+			Prefix:     strings.TrimSuffix(f.Namespace, "/") + "/",
+			MaxKeys:    f.MaxKeys,
+			StartAfter: f.StartAfter,
+		})
+	// list the namespace one level at a time so
+	// each level can be listed by separate workers
+	case f.Workers > 1:
+		listed, err = f.listConcurrent(ctx, store)
+	default:
+		listed, err = store.List(ctx, f.Bucket, storage.ListOptions{
+			Prefix:     f.Namespace,
+			Recursive:  true,
+			MaxKeys:    f.MaxKeys,
+			StartAfter: f.StartAfter,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []storage.Object{}
+
+	for _, object := range listed {
+		if f.within(object.Key) && f.selected(object.Key) {
+			objects = append(objects, object)
+		}
+	}
+
+	return objects, nil
+}
+
+// selected checks whether the key is after the key to start after
+// and, when not recursive, is stored directly in the namespace.
+// The inventory and the common prefixes of a level are filtered here.
+func (f *Flush) selected(key string) bool {
+	if key <= f.StartAfter {
+		return false
+	}
+
+	if !f.NonRecursive {
+		return true
+	}
+
+	rel := strings.TrimPrefix(key, strings.TrimSuffix(f.Namespace, "/")+"/")
+
+	return len(rel) > 0 && !strings.Contains(rel, "/")
+}
+
+// within checks whether the key is the namespace of the flush or is
+// stored below it, as listing the namespace as a prefix also matches
+// the keys of sibling namespaces (i.e. foo/bar matches foo/bar-baz).
+func (f *Flush) within(key string) bool {
+	if key == f.Namespace {
+		return true
+	}
+
+	return strings.HasPrefix(key, strings.TrimSuffix(f.Namespace, "/")+"/")
+}
+
+// listConcurrent collects all objects in the namespace of the flush
+// by listing each level of the namespace with a pool of workers.
+func (f *Flush) listConcurrent(ctx context.Context, store storage.Backend) ([]storage.Object, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		objects []storage.Object
+		errs    []error
+	)
+
+	sem := make(chan struct{}, f.Workers)
+
+	var walk func(prefix string)
+
+	walk = func(prefix string) {
+		defer wg.Done()
+
+		sem <- struct{}{}
+
+		found := []storage.Object{}
+		prefixes := []string{}
+
+		listed, err := store.List(ctx, f.Bucket, storage.ListOptions{Prefix: prefix, MaxKeys: f.MaxKeys, StartAfter: f.StartAfter})
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+
+		for _, object := range listed {
+			// common prefixes are returned with a trailing delimiter
+			if strings.HasSuffix(object.Key, "/") {
+				prefixes = append(prefixes, object.Key)
+
+				continue
 			}
 
-			// verify that the object is gone, .RemoveObject fails silently
-			// if the supplied path leads to an object that doesn't exist
-			_, err = mc.StatObject(ctx, f.Bucket, object.Key, minio.StatObjectOptions{})
+			found = append(found, object)
+		}
+
+		<-sem
+
+		mu.Lock()
+		objects = append(objects, found...)
+		mu.Unlock()
+
+		for _, p := range prefixes {
+			wg.Add(1)
+
+			go walk(p)
+		}
+	}
+
+	wg.Add(1)
+
+	go walk(f.Namespace)
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// keep a stable order for reporting
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// evaluate determines which objects meet the flush criteria, using a
+// pool of workers to collect any additional information on the objects.
+func (f *Flush) evaluate(
+	ctx context.Context,
+	store storage.Backend,
+	objects []storage.Object,
+	keep map[string]bool,
+	patterns []*regexp.Regexp,
+) ([]storage.Object, error) {
+	// determine time in the past for flush cut off
+	timeInPast := time.Now().Add(-f.Age)
+
+	reasons := make([]string, len(objects))
+	removes := make([]bool, len(objects))
+	pinned := make([]bool, len(objects))
+	errs := make([]error, len(objects))
+
+	f.parallel(len(objects), func(i int) {
+		object := objects[i]
+
+		switch {
+		// check if the object matches the flush patterns
+		case !matchAny(patterns, object.Key):
+			reasons[i] = "flush pattern criteria not met. keeping object."
+		// check if the object belongs to a branch no longer active
+		case f.stale(object.Key):
+			reasons[i] = "branch criteria met, branch no longer active. removing object."
+			removes[i] = true
+		// check if the object is one of the most recent to keep
+		case keep[object.Key]:
+			reasons[i] = fmt.Sprintf("object is within the %d most recent. keeping object.", f.Keep)
+		// check if the object meets the flush age
+		case object.LastModified.Before(timeInPast):
+			reasons[i] = fmt.Sprintf("'%s' flush age criteria met. removing object.", f.Age)
+			removes[i] = true
+		// avoid a request per object when expiries are not used
+		case f.SkipExpiry:
+			reasons[i] = fmt.Sprintf("'%s' flush age criteria not met. keeping object.", f.Age)
+		default:
+			// check if the object has its own expiry recorded
+			expired, err := f.expired(ctx, store, object)
 			if err != nil {
-				bytesFreedCounter += objSize
+				errs[i] = err
+
+				return
+			}
 
-				logrus.Infof("    ├ object successfully removed, %s freed", humanSize)
-			} else {
-				return fmt.Errorf("object %s was not removed: %w", object.Key, err)
+			if !expired {
+				reasons[i] = fmt.Sprintf("'%s' flush age criteria not met. keeping object.", f.Age)
+
+				return
 			}
-		} else {
-			logrus.Infof("    ├ '%s' flush age criteria not met. keeping object.", f.Age)
+
+			reasons[i] = "object expiry criteria met. removing object."
+			removes[i] = true
+		}
+
+		if !removes[i] {
+			return
+		}
+
+		// check if the object is exempt from the flush criteria
+		pinned[i] = f.pinned(ctx, store, object)
+		if pinned[i] {
+			reasons[i] = "object is pinned. keeping object."
+			removes[i] = false
+		}
+	})
+
+	// objects to remove from the bucket
+	remove := []storage.Object{}
+
+	for i, object := range objects {
+		logrus.Infof("  - %s; last modified: %s; size: %s", object.Key, object.LastModified.String(), humanize.Bytes(uint64(object.Size)))
+
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+
+		logrus.Infof("    ├ %s", reasons[i])
+
+		if removes[i] {
+			remove = append(remove, object)
+		}
+
+		// keep the pinned objects within the size budget as well
+		if pinned[i] {
+			keep[object.Key] = true
 		}
 	}
 
-	if !objectsExist {
-		logrus.Infof("no cache objects found at %s", f.Path)
+	return remove, nil
+}
+
+// stale checks whether the object is stored in the cache namespace
+// of a branch that is no longer in the list of active branches.
+func (f *Flush) stale(key string) bool {
+	if len(f.Branches) == 0 {
+		return false
 	}
 
-	logrus.Infof("cache flush action completed")
+	// determine the key relative to the flush namespace
+	rel := strings.TrimPrefix(strings.TrimPrefix(key, f.Namespace), "/")
 
-	if bytesFreedCounter > 0 {
-		logrus.Infof("%s freed in total", humanize.Bytes(bytesFreedCounter))
+	// objects stored directly in the namespace are not branch scoped
+	if !strings.Contains(rel, "/") {
+		return false
 	}
 
-	return nil
+	for _, branch := range f.Branches {
+		if strings.HasPrefix(rel, strings.Trim(branch, "/")+"/") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parallel runs fn for each index up to count
+// using the configured number of workers.
+func (f *Flush) parallel(count int, fn func(i int)) {
+	workers := f.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+
+	close(indexes)
+
+	wg.Wait()
+}
+
+// keep determines the most recently modified objects to keep for
+// each key prefix, regardless of whether they meet the flush criteria.
+func (f *Flush) keep(objects []storage.Object, patterns []*regexp.Regexp) map[string]bool {
+	keep := make(map[string]bool)
+
+	if f.Keep <= 0 {
+		return keep
+	}
+
+	// group the candidate objects by key prefix
+	groups := make(map[string][]storage.Object)
+
+	for _, object := range objects {
+		if !matchAny(patterns, object.Key) {
+			continue
+		}
+
+		prefix := path.Dir(object.Key)
+
+		groups[prefix] = append(groups[prefix], object)
+	}
+
+	for _, group := range groups {
+		// sort the objects from newest to oldest
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].LastModified.After(group[j].LastModified)
+		})
+
+		for i := 0; i < len(group) && i < f.Keep; i++ {
+			keep[group[i].Key] = true
+		}
+	}
+
+	return keep
+}
+
+// remove deletes the objects from the bucket in batches
+// and returns the objects successfully removed.
+func (f *Flush) remove(ctx context.Context, store storage.Backend, objects []storage.Object) ([]storage.Object, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	logrus.Infof("removing %d objects", len(objects))
+
+	// split the objects into a batch per worker
+	batches := chunk(objects, f.Workers)
+
+	failed := make([]map[string]error, len(batches))
+
+	f.parallel(len(batches), func(i int) {
+		failed[i] = f.removeBatch(ctx, store, batches[i])
+	})
+
+	removed := []storage.Object{}
+	errs := []error{}
+
+	for i, batch := range batches {
+		for _, object := range batch {
+			name := objectName(object.Key, object.VersionID)
+
+			if err, ok := failed[i][name]; ok {
+				errs = append(errs, fmt.Errorf("object %s was not removed: %w", name, err))
+
+				continue
+			}
+
+			logrus.Infof("  - %s; object successfully removed, %s freed", name, humanize.Bytes(uint64(object.Size)))
+
+			removed = append(removed, object)
+		}
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// splitStats is a helper function to separate the stats objects stored
+// next to the listed cache objects from the objects to flush. A stats
+// object without its cache object is flushed like any other object.
+func splitStats(objects []storage.Object) ([]storage.Object, map[string]storage.Object) {
+	keys := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		keys[object.Key] = true
+	}
+
+	caches := []storage.Object{}
+	stats := map[string]storage.Object{}
+
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, statsSuffix) && keys[strings.TrimSuffix(object.Key, statsSuffix)] {
+			stats[object.Key] = object
+
+			continue
+		}
+
+		caches = append(caches, object)
+	}
+
+	return caches, stats
+}
+
+// removeStats deletes the stats objects of the removed cache objects,
+// which are not counted as removed objects of the flush.
+func (f *Flush) removeStats(ctx context.Context, store storage.Backend, removed []storage.Object, stats map[string]storage.Object) {
+	orphans := []storage.Object{}
+
+	for _, object := range removed {
+		key := statsKey(object.Key)
+
+		if s, ok := stats[key]; ok {
+			orphans = append(orphans, s)
+
+			// only remove each stats object once for several versions
+			delete(stats, key)
+		}
+	}
+
+	if len(orphans) == 0 {
+		return
+	}
+
+	logrus.Debugf("removing %d stats objects of the removed objects", len(orphans))
+
+	for _, rErr := range store.Remove(ctx, f.Bucket, orphans) {
+		logrus.Warnf("unable to remove stats object %s: %v", rErr.Object.Key, rErr.Err)
+	}
+}
+
+// removeBatch deletes a batch of objects from the bucket with
+// a single bulk delete and returns the objects that failed.
+func (f *Flush) removeBatch(ctx context.Context, store storage.Backend, objects []storage.Object) map[string]error {
+	failed := make(map[string]error)
+
+	// collect the objects that could not be removed
+	for _, rErr := range store.Remove(ctx, f.Bucket, objects) {
+		name := objectName(rErr.Object.Key, rErr.Object.VersionID)
+
+		logrus.Errorf("    ├ unable to remove object %s: %v", name, rErr.Err)
+
+		failed[name] = rErr.Err
+	}
+
+	return failed
+}
+
+// objectName is a helper function to create a unique
+// name for an object including its version, if present.
+func objectName(key, versionID string) string {
+	if len(versionID) == 0 {
+		return key
+	}
+
+	return fmt.Sprintf("%s?versionId=%s", key, versionID)
+}
+
+// versions expands the objects to remove into every version of those
+// objects, including delete markers, and adds the remaining versions of
+// matching objects that were already deleted in a versioned bucket.
+func (f *Flush) versions(ctx context.Context, store storage.Backend, remove []storage.Object, patterns []*regexp.Regexp) ([]storage.Object, error) {
+	logrus.Tracef("listing object versions in path %s", f.Namespace)
+
+	removing := make(map[string]bool, len(remove))
+	for _, object := range remove {
+		removing[object.Key] = true
+	}
+
+	listed, err := store.List(ctx, f.Bucket, storage.ListOptions{
+		Prefix:       f.Namespace,
+		Recursive:    true,
+		WithVersions: true,
+		MaxKeys:      f.MaxKeys,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve object versions: %w", err)
+	}
+
+	keys := []string{}
+	versions := make(map[string][]storage.Object)
+	deleted := make(map[string]bool)
+
+	for _, version := range listed {
+		if !f.within(version.Key) {
+			continue
+		}
+
+		if _, ok := versions[version.Key]; !ok {
+			keys = append(keys, version.Key)
+		}
+
+		versions[version.Key] = append(versions[version.Key], version)
+
+		// track objects that were deleted leaving only a delete marker
+		if version.IsLatest && version.IsDeleteMarker {
+			deleted[version.Key] = true
+		}
+	}
+
+	expanded := []storage.Object{}
+
+	for _, key := range keys {
+		switch {
+		case removing[key]:
+			logrus.Infof("  - %s; removing %d versions", key, len(versions[key]))
+		case deleted[key] && matchAny(patterns, key):
+			logrus.Infof("  - %s; object already deleted. removing %d remaining versions", key, len(versions[key]))
+		default:
+			continue
+		}
+
+		expanded = append(expanded, versions[key]...)
+	}
+
+	return expanded, nil
+}
+
+// chunk is a helper function to split the objects
+// into at most n batches of roughly equal size.
+func chunk(objects []storage.Object, n int) [][]storage.Object {
+	if n < 1 {
+		n = 1
+	}
+
+	size := (len(objects) + n - 1) / n
+
+	batches := [][]storage.Object{}
+
+	for start := 0; start < len(objects); start += size {
+		end := start + size
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		batches = append(batches, objects[start:end])
+	}
+
+	return batches
+}
+
+// budget determines the oldest objects to remove, in addition to the
+// objects already being removed, so the cumulative size of the objects
+// remaining in the namespace is within the maximum total size.
+func (f *Flush) budget(objects, remove []storage.Object, keep map[string]bool, patterns []*regexp.Regexp) []storage.Object {
+	if f.MaxTotalSize == 0 {
+		return nil
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, object := range remove {
+		removed[object.Key] = true
+	}
+
+	total := uint64(0)
+	candidates := []storage.Object{}
+
+	for _, object := range objects {
+		if removed[object.Key] {
+			continue
+		}
+
+		total += uint64(object.Size)
+
+		if keep[object.Key] || !matchAny(patterns, object.Key) {
+			continue
+		}
+
+		candidates = append(candidates, object)
+	}
+
+	logrus.Infof("%s remaining in path %s with a budget of %s", humanize.Bytes(total), f.Namespace, humanize.Bytes(f.MaxTotalSize))
+
+	// sort the candidates from oldest to newest
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastModified.Before(candidates[j].LastModified)
+	})
+
+	over := []storage.Object{}
+
+	for _, object := range candidates {
+		if total <= f.MaxTotalSize {
+			break
+		}
+
+		logrus.Infof("  - %s; '%s' size budget criteria met. removing object.", object.Key, humanize.Bytes(f.MaxTotalSize))
+
+		total -= uint64(object.Size)
+
+		over = append(over, object)
+	}
+
+	if total > f.MaxTotalSize {
+		logrus.Warnf("unable to meet size budget of %s, %s remaining", humanize.Bytes(f.MaxTotalSize), humanize.Bytes(total))
+	}
+
+	return over
+}
+
+// expired checks whether the object has an expiry recorded
+// in its metadata that has already passed.
+func (f *Flush) expired(ctx context.Context, store storage.Backend, object storage.Object) (bool, error) {
+	logrus.Tracef("checking expiry for object %s", object.Key)
+
+	// the listing only includes user metadata for some
+	// servers so collect it from the object directly
+	info, err := store.Stat(ctx, f.Bucket, object.Key)
+	if err != nil {
+		return false, fmt.Errorf("unable to retrieve object %s: %w", object.Key, err)
+	}
+
+	expires, ok := expiresAt(info)
+	if !ok {
+		return false, nil
+	}
+
+	return time.Now().After(expires), nil
+}
+
+// pinned checks whether the object carries the pin
+// tag exempting it from the flush criteria.
+//
+// An object removed since it was listed is not pinned, while an object
+// with tags that can not be retrieved is kept rather than failing the flush.
+func (f *Flush) pinned(ctx context.Context, store storage.Backend, object storage.Object) bool {
+	logrus.Tracef("checking pin for object %s", object.Key)
+
+	tags, err := store.GetTags(ctx, f.Bucket, object.Key)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return false
+		}
+
+		logrus.Warnf("unable to retrieve tags of object %s, keeping object: %v", object.Key, err)
+
+		return true
+	}
+
+	return tags[tagPin] == "true"
+}
+
+// unpinned returns the objects without the pin tag,
+// checking the tags of the objects with the workers.
+func (f *Flush) unpinned(ctx context.Context, store storage.Backend, objects []storage.Object) []storage.Object {
+	pinned := make([]bool, len(objects))
+
+	f.parallel(len(objects), func(i int) {
+		pinned[i] = f.pinned(ctx, store, objects[i])
+	})
+
+	unpinned := []storage.Object{}
+
+	for i, object := range objects {
+		if pinned[i] {
+			logrus.Infof("  - %s; object is pinned. keeping object.", object.Key)
+
+			continue
+		}
+
+		unpinned = append(unpinned, object)
+	}
+
+	return unpinned
+}
+
+// patterns compiles the configured key patterns for the flush.
+func (f *Flush) patterns() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(f.Pattern))
+
+	for _, pattern := range f.Pattern {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, re)
+	}
+
+	return patterns, nil
+}
+
+// matchAny is a helper function to check whether a key matches
+// any of the provided patterns. No patterns matches every key.
+func matchAny(patterns []*regexp.Regexp, key string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, re := range patterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Configure prepares the flush fields for the action to be taken.
@@ -109,13 +876,47 @@ func (f *Flush) Configure(repo *Repo) error {
 	logrus.Trace("configuring flush action")
 
 	// construct the object path
-	path := buildNamespace(repo, f.Prefix, f.Path, "")
+	path, err := buildNamespace(repo, f.Prefix, f.Path, "")
+	if err != nil {
+		return err
+	}
 
 	logrus.Debugf("created bucket path %s", path)
 
 	// store it in the namespace
 	f.Namespace = path
 
+	// read the active branches from the file
+	if len(f.BranchesFile) > 0 {
+		logrus.Debugf("reading active branches from file %s", f.BranchesFile)
+
+		data, err := os.ReadFile(f.BranchesFile)
+		if err != nil {
+			return fmt.Errorf("unable to read branches file %s: %w", f.BranchesFile, err)
+		}
+
+		read := 0
+
+		for _, branch := range strings.Split(string(data), "\n") {
+			branch = strings.TrimSpace(branch)
+			if len(branch) > 0 {
+				f.Branches = append(f.Branches, branch)
+				read++
+			}
+		}
+
+		// an empty file, i.e. from a failed git ls-remote, would silently
+		// fall back to a flush by age instead of removing stale branches
+		if read == 0 {
+			return fmt.Errorf("no branches found in branches file %s", f.BranchesFile)
+		}
+	}
+
+	// always keep the default branch for the repository
+	if len(f.Branches) > 0 && len(repo.Branch) > 0 {
+		f.Branches = append(f.Branches, repo.Branch)
+	}
+
 	return nil
 }
 
@@ -128,5 +929,39 @@ func (f *Flush) Validate() error {
 		return fmt.Errorf("no bucket provided")
 	}
 
+	// verify timeout is provided
+	if f.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	// verify workers is not negative
+	if f.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
+	}
+
+	// verify max keys is within the limit of a page
+	if f.MaxKeys < 0 || f.MaxKeys > 1000 {
+		return fmt.Errorf("max keys must be between 0 and 1000")
+	}
+
+	// verify keep is not negative
+	if f.Keep < 0 {
+		return fmt.Errorf("keep must not be negative")
+	}
+
+	// verify patterns are valid
+	_, err := f.patterns()
+	if err != nil {
+		return err
+	}
+
+	// verify the inventory location is valid
+	if len(f.Inventory) > 0 {
+		_, _, err = parseInventoryLocation(f.Inventory, f.Bucket)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
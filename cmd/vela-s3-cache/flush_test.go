@@ -3,13 +3,23 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 )
 
 func TestS3Cache_Flush_Validate(t *testing.T) {
 	// setup types
 	f := &Flush{
-		Bucket: "bucket",
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
 	}
 
 	err := f.Validate()
@@ -27,3 +37,588 @@ func TestS3Cache_Flush_Validate_NoBucket(t *testing.T) {
 		t.Errorf("Validate should have returned err")
 	}
 }
+
+func TestS3Cache_Flush_Validate_NoTimeout(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Bucket: "bucket",
+	}
+
+	err := f.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Flush_Validate_InvalidPattern(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
+		Pattern: []string{""},
+	}
+
+	err := f.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Flush_Validate_InvalidMaxKeys(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
+		MaxKeys: 5000,
+	}
+
+	err := f.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_matchAny(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Pattern: []string{"**/pr-*/**", "**/dev/**"},
+	}
+
+	patterns, err := f.patterns()
+	if err != nil {
+		t.Fatalf("patterns returned err: %v", err)
+	}
+
+	if !matchAny(patterns, "foo/bar/pr-1/archive.tgz") {
+		t.Errorf("matchAny should have matched pr key")
+	}
+
+	if !matchAny(patterns, "foo/bar/dev/archive.tgz") {
+		t.Errorf("matchAny should have matched dev key")
+	}
+
+	if matchAny(patterns, "foo/bar/main/archive.tgz") {
+		t.Errorf("matchAny should not have matched main key")
+	}
+
+	if !matchAny(nil, "foo/bar/main/archive.tgz") {
+		t.Errorf("matchAny should have matched with no patterns")
+	}
+}
+
+func TestS3Cache_Flush_Validate_NegativeKeep(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
+		Keep:    -1,
+	}
+
+	err := f.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Flush_keep(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	f := &Flush{
+		Keep: 1,
+	}
+
+	objects := []storage.Object{
+		{Key: "foo/bar/main/archive.tgz", LastModified: now.Add(-48 * time.Hour)},
+		{Key: "foo/bar/main/other.tgz", LastModified: now.Add(-24 * time.Hour)},
+		{Key: "foo/bar/dev/archive.tgz", LastModified: now.Add(-72 * time.Hour)},
+	}
+
+	want := map[string]bool{
+		"foo/bar/main/other.tgz":  true,
+		"foo/bar/dev/archive.tgz": true,
+	}
+
+	got := f.keep(objects, nil)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keep is %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_Flush_budget(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	f := &Flush{
+		MaxTotalSize: 250,
+	}
+
+	objects := []storage.Object{
+		{Key: "foo/bar/a.tgz", Size: 100, LastModified: now.Add(-72 * time.Hour)},
+		{Key: "foo/bar/b.tgz", Size: 100, LastModified: now.Add(-48 * time.Hour)},
+		{Key: "foo/bar/c.tgz", Size: 100, LastModified: now.Add(-24 * time.Hour)},
+		{Key: "foo/bar/d.tgz", Size: 100, LastModified: now},
+	}
+
+	// a.tgz is already being removed and d.tgz is kept
+	remove := objects[:1]
+	keep := map[string]bool{"foo/bar/d.tgz": true}
+
+	got := f.budget(objects, remove, keep, nil)
+
+	if len(got) != 1 || got[0].Key != "foo/bar/b.tgz" {
+		t.Errorf("budget is %v, want only foo/bar/b.tgz", got)
+	}
+}
+
+func TestS3Cache_Flush_budget_Disabled(t *testing.T) {
+	// setup types
+	f := &Flush{}
+
+	objects := []storage.Object{
+		{Key: "foo/bar/a.tgz", Size: 100},
+	}
+
+	got := f.budget(objects, nil, nil, nil)
+
+	if len(got) != 0 {
+		t.Errorf("budget is %v, want none", got)
+	}
+}
+
+func TestS3Cache_chunk(t *testing.T) {
+	// setup types
+	objects := []storage.Object{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "d"}, {Key: "e"}}
+
+	testCases := []struct {
+		desc string
+		n    int
+		want []int
+	}{
+		{desc: "single worker", n: 1, want: []int{5}},
+		{desc: "two workers", n: 2, want: []int{3, 2}},
+		{desc: "more workers than objects", n: 10, want: []int{1, 1, 1, 1, 1}},
+		{desc: "no workers", n: 0, want: []int{5}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := chunk(objects, tC.n)
+
+			sizes := []int{}
+			for _, batch := range got {
+				sizes = append(sizes, len(batch))
+			}
+
+			if !reflect.DeepEqual(sizes, tC.want) {
+				t.Errorf("chunk sizes are %v, want %v", sizes, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Flush_parallel(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Workers: 4,
+	}
+
+	seen := make([]bool, 100)
+
+	f.parallel(len(seen), func(i int) {
+		seen[i] = true
+	})
+
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("parallel did not run index %d", i)
+		}
+	}
+}
+
+func TestS3Cache_Flush_stale(t *testing.T) {
+	// setup types
+	f := &Flush{
+		Namespace: "foo/bar",
+		Branches:  []string{"main", "feature/baz"},
+	}
+
+	testCases := []struct {
+		desc string
+		key  string
+		want bool
+	}{
+		{desc: "active branch", key: "foo/bar/main/archive.tgz", want: false},
+		{desc: "active nested branch", key: "foo/bar/feature/baz/archive.tgz", want: false},
+		{desc: "deleted branch", key: "foo/bar/feature/qux/archive.tgz", want: true},
+		{desc: "not branch scoped", key: "foo/bar/archive.tgz", want: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := f.stale(tC.key); got != tC.want {
+				t.Errorf("stale is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Flush_Configure_BranchesFile(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), "branches")
+
+	err := os.WriteFile(file, []byte("dev\n\nfeature/baz\n"), 0600)
+	if err != nil {
+		t.Fatalf("unable to write branches file: %v", err)
+	}
+
+	f := &Flush{
+		BranchesFile: file,
+	}
+
+	err = f.Configure(&Repo{Owner: "foo", Name: "bar", Branch: "main"})
+	if err != nil {
+		t.Errorf("Configure returned err: %v", err)
+	}
+
+	want := []string{"dev", "feature/baz", "main"}
+
+	if !reflect.DeepEqual(f.Branches, want) {
+		t.Errorf("Branches is %v, want %v", f.Branches, want)
+	}
+}
+
+func TestS3Cache_Flush_Configure_BranchesFile_Empty(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), "branches")
+
+	err := os.WriteFile(file, []byte("\n  \n"), 0600)
+	if err != nil {
+		t.Fatalf("unable to write branches file: %v", err)
+	}
+
+	f := &Flush{
+		Branches:     []string{"dev"},
+		BranchesFile: file,
+	}
+
+	err = f.Configure(&Repo{Owner: "foo", Name: "bar", Branch: "main"})
+	if err == nil {
+		t.Errorf("Configure should have returned err")
+	}
+}
+
+func TestS3Cache_objectName(t *testing.T) {
+	if got := objectName("foo/bar/archive.tgz", ""); got != "foo/bar/archive.tgz" {
+		t.Errorf("objectName is %s, want foo/bar/archive.tgz", got)
+	}
+
+	if got := objectName("foo/bar/archive.tgz", "abc"); got != "foo/bar/archive.tgz?versionId=abc" {
+		t.Errorf("objectName is %s, want foo/bar/archive.tgz?versionId=abc", got)
+	}
+}
+
+func TestS3Cache_Flush_Exec(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	testCases := []struct {
+		desc    string
+		workers int
+	}{
+		{
+			desc:    "sequential",
+			workers: 1,
+		},
+		{
+			desc:    "concurrent",
+			workers: 4,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := newFakeBackend()
+			store.add("foo/bar/old.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+			store.add("foo/bar/new.tgz", make([]byte, 10), now, nil)
+			store.add("foo/bar/expired.tgz", make([]byte, 10), now, map[string]string{
+				metaExpires: now.Add(-time.Hour).Format(time.RFC3339),
+			})
+			store.add("foo/baz/other.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+			store.add("foo/bar-fork/old.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+
+			res := new(Result)
+
+			f := &Flush{
+				Bucket:    "bucket",
+				Age:       24 * time.Hour,
+				Timeout:   10 * time.Minute,
+				Workers:   tC.workers,
+				Namespace: "foo/bar",
+			}
+
+			err := f.Exec(context.Background(), store, res)
+			if err != nil {
+				t.Errorf("Exec returned err: %v", err)
+			}
+
+			want := []string{"foo/bar-fork/old.tgz", "foo/bar/new.tgz", "foo/baz/other.tgz"}
+
+			if got := store.keys(); !reflect.DeepEqual(got, want) {
+				t.Errorf("keys is %v, want %v", got, want)
+			}
+
+			if res.Removed != 2 || res.Freed != 20 {
+				t.Errorf("Removed is %d and Freed is %d, want 2 and 20", res.Removed, res.Freed)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Flush_Exec_Stats(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	store := newFakeBackend()
+	store.add("foo/bar/old.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+	store.add("foo/bar/old.tgz.stats", make([]byte, 1), now, nil)
+	store.add("foo/bar/new.tgz", make([]byte, 10), now, nil)
+	store.add("foo/bar/new.tgz.stats", make([]byte, 1), now.Add(-48*time.Hour), nil)
+	store.add("foo/bar/gone.tgz.stats", make([]byte, 1), now.Add(-48*time.Hour), nil)
+
+	res := new(Result)
+
+	f := &Flush{
+		Bucket:    "bucket",
+		Age:       24 * time.Hour,
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar",
+	}
+
+	err := f.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify the stats objects follow their cache objects
+	want := []string{"foo/bar/new.tgz", "foo/bar/new.tgz.stats"}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys is %v, want %v", got, want)
+	}
+
+	if res.Removed != 2 || res.Freed != 11 {
+		t.Errorf("Removed is %d and Freed is %d, want 2 and 11", res.Removed, res.Freed)
+	}
+}
+
+func TestS3Cache_Flush_Exec_List(t *testing.T) {
+	// setup types
+	old := time.Now().Add(-48 * time.Hour)
+
+	testCases := []struct {
+		desc         string
+		startAfter   string
+		nonRecursive bool
+		workers      int
+		want         []string
+	}{
+		{
+			desc:         "non-recursive",
+			nonRecursive: true,
+			want:         []string{"foo/bar/main/a.tgz", "foo/bar/main/b.tgz"},
+		},
+		{
+			desc:         "non-recursive with workers",
+			nonRecursive: true,
+			workers:      4,
+			want:         []string{"foo/bar/main/a.tgz", "foo/bar/main/b.tgz"},
+		},
+		{
+			desc:       "start after",
+			startAfter: "foo/bar/b.tgz",
+			want:       []string{"foo/bar/a.tgz", "foo/bar/b.tgz"},
+		},
+		{
+			desc:         "non-recursive start after",
+			startAfter:   "foo/bar/a.tgz",
+			nonRecursive: true,
+			want:         []string{"foo/bar/a.tgz", "foo/bar/main/a.tgz", "foo/bar/main/b.tgz"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := newFakeBackend()
+
+			for _, key := range []string{"foo/bar/a.tgz", "foo/bar/b.tgz", "foo/bar/main/a.tgz", "foo/bar/main/b.tgz"} {
+				store.add(key, make([]byte, 10), old, nil)
+			}
+
+			f := &Flush{
+				Bucket:       "bucket",
+				Age:          24 * time.Hour,
+				Timeout:      10 * time.Minute,
+				Workers:      tC.workers,
+				StartAfter:   tC.startAfter,
+				NonRecursive: tC.nonRecursive,
+				Namespace:    "foo/bar",
+			}
+
+			err := f.Exec(context.Background(), store, new(Result))
+			if err != nil {
+				t.Errorf("Exec returned err: %v", err)
+			}
+
+			if got := store.keys(); !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("keys is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Flush_Exec_SkipExpiry(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	store := newFakeBackend()
+	store.add("foo/bar/expired.tgz", make([]byte, 10), now, map[string]string{
+		metaExpires: now.Add(-time.Hour).Format(time.RFC3339),
+	})
+
+	f := &Flush{
+		Bucket:     "bucket",
+		Age:        24 * time.Hour,
+		Timeout:    10 * time.Minute,
+		MaxKeys:    100,
+		SkipExpiry: true,
+		Namespace:  "foo/bar",
+	}
+
+	err := f.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify the expiry was not checked for the object within the age
+	want := []string{"foo/bar/expired.tgz"}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys is %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_Flush_Exec_Pinned(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	store := newFakeBackend()
+	store.add("foo/bar/old.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+	store.add("foo/bar/golden.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+	store.tag("foo/bar/golden.tgz", map[string]string{tagPin: "true"})
+	store.add("foo/bar/baseline.tgz", make([]byte, 10), now.Add(-time.Hour), nil)
+	store.tag("foo/bar/baseline.tgz", map[string]string{tagPin: "true"})
+	store.add("foo/bar/new.tgz", make([]byte, 10), now, nil)
+
+	f := &Flush{
+		Bucket:       "bucket",
+		Age:          24 * time.Hour,
+		Timeout:      10 * time.Minute,
+		MaxTotalSize: 15,
+		Namespace:    "foo/bar",
+	}
+
+	err := f.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify the pinned objects are kept by the age and size budget criteria
+	want := []string{"foo/bar/baseline.tgz", "foo/bar/golden.tgz"}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys is %v, want %v", got, want)
+	}
+}
+
+// tagErrorBackend is a fake backend failing the tag retrieval of the keys.
+type tagErrorBackend struct {
+	*fakeBackend
+	errs map[string]error
+}
+
+// GetTags fails with the error of the key, if any.
+func (b tagErrorBackend) GetTags(ctx context.Context, bucket, key string) (map[string]string, error) {
+	if err, ok := b.errs[key]; ok {
+		return nil, err
+	}
+
+	return b.fakeBackend.GetTags(ctx, bucket, key)
+}
+
+func TestS3Cache_Flush_Exec_PinnedErrors(t *testing.T) {
+	// setup types
+	old := time.Now().Add(-48 * time.Hour)
+
+	store := newFakeBackend()
+	store.add("foo/bar/removed.tgz", make([]byte, 10), old, nil)
+	store.add("foo/bar/denied.tgz", make([]byte, 10), old, nil)
+	store.add("foo/bar/old.tgz", make([]byte, 10), old, nil)
+
+	backend := tagErrorBackend{
+		fakeBackend: store,
+		errs: map[string]error{
+			"foo/bar/removed.tgz": &storage.ResponseError{StatusCode: http.StatusNotFound, Code: "NoSuchKey", Err: errNotFound},
+			"foo/bar/denied.tgz":  &storage.ResponseError{StatusCode: http.StatusForbidden, Code: "AccessDenied", Err: errors.New("access denied")},
+		},
+	}
+
+	f := &Flush{
+		Bucket:    "bucket",
+		Age:       24 * time.Hour,
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar",
+	}
+
+	err := f.Exec(context.Background(), backend, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify the object with tags that can not be retrieved is kept
+	// while the objects without tags are still flushed
+	want := []string{"foo/bar/denied.tgz"}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys is %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_Flush_Exec_DryRun(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/old.tgz", make([]byte, 10), time.Now().Add(-48*time.Hour), nil)
+
+	res := new(Result)
+
+	f := &Flush{
+		Bucket:    "bucket",
+		Age:       24 * time.Hour,
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/",
+		DryRun:    true,
+	}
+
+	err := f.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	want := []string{"foo/bar/old.tgz"}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys is %v, want %v", got, want)
+	}
+
+	if res.Removed != 1 {
+		t.Errorf("Removed is %d, want 1", res.Removed)
+	}
+}
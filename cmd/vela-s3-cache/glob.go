@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compileGlob is a helper function to convert a glob pattern into a
+// regular expression matching object keys. A "**" matches any sequence
+// of characters including the "/" delimiter, a "*" matches any sequence
+// of characters excluding the delimiter and a "?" matches exactly one
+// character excluding the delimiter.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("empty pattern provided")
+	}
+
+	var b strings.Builder
+
+	b.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+
+				// allow "**/" to also match zero directories
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+
+					b.WriteString("(?:.*/)?")
+
+					continue
+				}
+
+				b.WriteString(".*")
+
+				continue
+			}
+
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	return re, nil
+}
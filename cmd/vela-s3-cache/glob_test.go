@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "testing"
+
+func TestS3Cache_compileGlob(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		pattern string
+		key     string
+		want    bool
+	}{
+		{
+			desc:    "double star directory",
+			pattern: "**/pr-*/**",
+			key:     "foo/bar/pr-12/archive.tgz",
+			want:    true,
+		},
+		{
+			desc:    "double star directory at root",
+			pattern: "**/pr-*/**",
+			key:     "pr-12/archive.tgz",
+			want:    true,
+		},
+		{
+			desc:    "double star directory no match",
+			pattern: "**/pr-*/**",
+			key:     "foo/bar/main/archive.tgz",
+			want:    false,
+		},
+		{
+			desc:    "single star stops at delimiter",
+			pattern: "foo/*/archive.tgz",
+			key:     "foo/bar/baz/archive.tgz",
+			want:    false,
+		},
+		{
+			desc:    "single star",
+			pattern: "foo/*/archive.tgz",
+			key:     "foo/bar/archive.tgz",
+			want:    true,
+		},
+		{
+			desc:    "question mark",
+			pattern: "foo/ba?/archive.tgz",
+			key:     "foo/baz/archive.tgz",
+			want:    true,
+		},
+		{
+			desc:    "literal dot",
+			pattern: "foo/archive.tgz",
+			key:     "foo/archiveXtgz",
+			want:    false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			re, err := compileGlob(tC.pattern)
+			if err != nil {
+				t.Fatalf("compileGlob returned err: %v", err)
+			}
+
+			if got := re.MatchString(tC.key); got != tC.want {
+				t.Errorf("match %s against %s is %v, want %v", tC.pattern, tC.key, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_compileGlob_Empty(t *testing.T) {
+	_, err := compileGlob("")
+	if err == nil {
+		t.Errorf("compileGlob should have returned err")
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// idMap represents the user and group ids recorded in
+// the archive mapped to the ids to own the extracted entries.
+type idMap map[int]int
+
+// parseIDMap is a helper function to convert the mappings
+// of ids in the from:to format (i.e. 0:1001) into an idMap.
+func parseIDMap(values []string) (idMap, error) {
+	m := idMap{}
+
+	for _, value := range values {
+		from, to, ok := strings.Cut(strings.TrimSpace(value), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid id mapping %s: must be in the from:to format (i.e. 0:1001)", value)
+		}
+
+		f, err := strconv.Atoi(from)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid id mapping %s: %s is not a valid id", value, from)
+		}
+
+		t, err := strconv.Atoi(to)
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid id mapping %s: %s is not a valid id", value, to)
+		}
+
+		if _, ok := m[f]; ok {
+			return nil, fmt.Errorf("invalid id mapping %s: id %d is already mapped", value, f)
+		}
+
+		m[f] = t
+	}
+
+	return m, nil
+}
+
+// owner returns the user and group ids to own the extracted entry,
+// using -1 to leave an unmapped id to the extracting user, and
+// whether any of the ids recorded for the entry are mapped.
+func (m idMap) owner(hdr *tar.Header) (int, int, bool) {
+	uid, uok := m[hdr.Uid]
+	if !uok {
+		uid = -1
+	}
+
+	gid, gok := m[hdr.Gid]
+	if !gok {
+		gid = -1
+	}
+
+	return uid, gid, uok || gok
+}
+
+// chown changes the owner of the extracted entry to the
+// ids its recorded user and group ids are mapped to.
+func (e *extractor) chown(root *os.Root, name string, hdr *tar.Header) error {
+	uid, gid, ok := e.idMap.owner(hdr)
+	if !ok {
+		return nil
+	}
+
+	// change the owner of a symlink rather than its target
+	err := root.Lchown(name, uid, gid)
+	if err != nil {
+		if !e.nonRoot {
+			return fmt.Errorf("%s: changing owner: %w", name, err)
+		}
+
+		logrus.Warnf("unable to change owner of %s in non-root mode: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestS3Cache_parseIDMap(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		values  []string
+		want    idMap
+		wantErr bool
+	}{
+		{desc: "empty", want: idMap{}},
+		{desc: "mappings", values: []string{"0:1001", " 1000:1002 "}, want: idMap{0: 1001, 1000: 1002}},
+		{desc: "missing separator", values: []string{"1001"}, wantErr: true},
+		{desc: "invalid from", values: []string{"root:1001"}, wantErr: true},
+		{desc: "negative to", values: []string{"0:-1"}, wantErr: true},
+		{desc: "duplicate", values: []string{"0:1001", "0:1002"}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseIDMap(tC.values)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("parseIDMap returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("parseIDMap is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_idMap_owner(t *testing.T) {
+	// setup types
+	m := idMap{0: 1001}
+
+	testCases := []struct {
+		desc    string
+		hdr     tar.Header
+		uid     int
+		gid     int
+		changed bool
+	}{
+		{desc: "root", hdr: tar.Header{Uid: 0, Gid: 0}, uid: 1001, gid: 1001, changed: true},
+		{desc: "root user", hdr: tar.Header{Uid: 0, Gid: 100}, uid: 1001, gid: -1, changed: true},
+		{desc: "unmapped", hdr: tar.Header{Uid: 1000, Gid: 1000}, uid: -1, gid: -1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			uid, gid, changed := m.owner(&tC.hdr)
+
+			if uid != tC.uid || gid != tC.gid || changed != tC.changed {
+				t.Errorf("owner is %d:%d %v, want %d:%d %v", uid, gid, changed, tC.uid, tC.gid, tC.changed)
+			}
+		})
+	}
+}
+
+func TestS3Cache_extractor_extract_IDMap(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+	uid, gid := os.Getuid(), os.Getgid()
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "build/", Typeflag: tar.TypeDir, Mode: 0755, Uid: uid, Gid: gid}},
+		{hdr: tar.Header{Name: "build/output.o", Typeflag: tar.TypeReg, Mode: 0644, Uid: uid, Gid: gid}, body: "object"},
+		{hdr: tar.Header{Name: "build/latest", Typeflag: tar.TypeSymlink, Linkname: "missing.o", Uid: uid, Gid: gid}},
+	})
+
+	dir := filepath.Join(t.TempDir(), "dest")
+
+	// map the ids to themselves to change owners without privileges
+	e := &extractor{idMap: idMap{uid: uid, gid: gid}}
+
+	err := e.extract(archive, dir)
+	if err != nil {
+		t.Fatalf("extract returned err: %v", err)
+	}
+
+	// verify the owner of a dangling symlink is changed without following it
+	_, err = os.Lstat(filepath.Join(dir, "build", "latest"))
+	if err != nil {
+		t.Errorf("symlink is missing: %v", err)
+	}
+}
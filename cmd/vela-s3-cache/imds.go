@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// imdsMetadataPath represents the path of the instance metadata
+// service that requires a session token with IMDSv2.
+const imdsMetadataPath = "/latest/meta-data"
+
+// imdsV2Transport is an http.RoundTripper that refuses requests to the
+// instance metadata service made without an IMDSv2 session token.
+type imdsV2Transport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip refuses IMDSv1 requests and executes any other request.
+func (t *imdsV2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, imdsMetadataPath) && len(req.Header.Get(credentials.TokenRequestHeader)) == 0 {
+		return nil, fmt.Errorf("IMDSv1 request to %s refused: unable to retrieve an IMDSv2 session token", req.URL.Path)
+	}
+
+	return t.next.RoundTrip(req)
+}
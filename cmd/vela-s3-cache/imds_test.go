@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestS3Cache_imdsV2Transport_RoundTrip(t *testing.T) {
+	// setup types
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	c := &http.Client{Transport: &imdsV2Transport{next: http.DefaultTransport}}
+
+	testCases := []struct {
+		desc    string
+		path    string
+		token   string
+		wantErr bool
+	}{
+		{desc: "token request", path: "/latest/api/token"},
+		{desc: "IMDSv2 request", path: "/latest/meta-data/iam/security-credentials/", token: "abc"},
+		{desc: "IMDSv1 request", path: "/latest/meta-data/iam/security-credentials/", wantErr: true},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, s.URL+tC.path, nil)
+			if err != nil {
+				t.Fatalf("NewRequest returned err: %v", err)
+			}
+
+			if len(tC.token) > 0 {
+				req.Header.Set(credentials.TokenRequestHeader, tC.token)
+			}
+
+			resp, err := c.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if (err != nil) != tC.wantErr {
+				t.Errorf("RoundTrip returned err: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// inventoryFormat represents the only S3 Inventory
+// file format the objects can be read from.
+const inventoryFormat = "CSV"
+
+// inventoryManifest represents the manifest.json
+// written by S3 Inventory for each inventory report.
+type inventoryManifest struct {
+	SourceBucket      string          `json:"sourceBucket"`
+	DestinationBucket string          `json:"destinationBucket"`
+	FileFormat        string          `json:"fileFormat"`
+	FileSchema        string          `json:"fileSchema"`
+	Files             []inventoryFile `json:"files"`
+}
+
+// inventoryFile represents a data file of an S3 Inventory report.
+type inventoryFile struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// inventoryColumns represents the position of
+// the fields in the rows of an inventory file.
+type inventoryColumns struct {
+	bucket       int
+	key          int
+	size         int
+	lastModified int
+	isLatest     int
+	deleteMarker int
+}
+
+// parseInventoryLocation is a helper function to split the location of
+// an inventory manifest into its bucket and key, using the provided
+// bucket when the location is not an s3:// URL.
+func parseInventoryLocation(location, bucket string) (string, string, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return bucket, strings.TrimPrefix(location, "/"), nil
+	}
+
+	b, key, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if len(b) == 0 || len(key) == 0 {
+		return "", "", fmt.Errorf("invalid inventory location %s: must be s3://<bucket>/<key>", location)
+	}
+
+	return b, key, nil
+}
+
+// parseInventorySchema is a helper function to locate the fields
+// needed for a flush in the schema of the inventory files.
+func parseInventorySchema(schema string) (*inventoryColumns, error) {
+	cols := &inventoryColumns{bucket: -1, key: -1, size: -1, lastModified: -1, isLatest: -1, deleteMarker: -1}
+
+	for i, field := range strings.Split(schema, ",") {
+		switch strings.TrimSpace(field) {
+		case "Bucket":
+			cols.bucket = i
+		case "Key":
+			cols.key = i
+		case "Size":
+			cols.size = i
+		case "LastModifiedDate":
+			cols.lastModified = i
+		case "IsLatest":
+			cols.isLatest = i
+		case "IsDeleteMarker":
+			cols.deleteMarker = i
+		}
+	}
+
+	// the flush criteria depend on the size and age of the objects
+	for name, i := range map[string]int{"Key": cols.key, "Size": cols.size, "LastModifiedDate": cols.lastModified} {
+		if i < 0 {
+			return nil, fmt.Errorf("inventory schema %q does not include the %s field", schema, name)
+		}
+	}
+
+	return cols, nil
+}
+
+// listInventory collects all objects in the namespace of the flush
+// from the data files of an S3 Inventory report instead of listing
+// the bucket, which is much cheaper for buckets with millions of keys.
+func (f *Flush) listInventory(ctx context.Context, store storage.Backend) ([]storage.Object, error) {
+	bucket, key, err := parseInventoryLocation(f.Inventory, f.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("reading inventory manifest %s from bucket %s", key, bucket)
+
+	manifest, err := readInventoryManifest(ctx, store, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(manifest.FileFormat, inventoryFormat) {
+		return nil, fmt.Errorf("unsupported inventory format %s: only %s is supported", manifest.FileFormat, inventoryFormat)
+	}
+
+	if len(manifest.SourceBucket) > 0 && manifest.SourceBucket != f.Bucket {
+		return nil, fmt.Errorf("inventory manifest %s is for bucket %s, not %s", key, manifest.SourceBucket, f.Bucket)
+	}
+
+	cols, err := parseInventorySchema(manifest.FileSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// the data files are written to the destination bucket
+	// of the inventory, which is provided as an ARN
+	dest := bucket
+	if len(manifest.DestinationBucket) > 0 {
+		dest = manifest.DestinationBucket[strings.LastIndex(manifest.DestinationBucket, ":")+1:]
+	}
+
+	objects := []storage.Object{}
+
+	for _, file := range manifest.Files {
+		logrus.Debugf("reading inventory file %s from bucket %s", file.Key, dest)
+
+		found, err := f.readInventoryFile(ctx, store, dest, file.Key, cols)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read inventory file %s: %w", file.Key, err)
+		}
+
+		objects = append(objects, found...)
+	}
+
+	logrus.Infof("found %d objects in path %s in the inventory", len(objects), f.Namespace)
+
+	return objects, nil
+}
+
+// readInventoryManifest is a helper function to retrieve
+// and decode the manifest of an S3 Inventory report.
+func readInventoryManifest(ctx context.Context, store storage.Backend, bucket, key string) (*inventoryManifest, error) {
+	obj, err := store.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve inventory manifest %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	manifest := new(inventoryManifest)
+
+	err = json.NewDecoder(obj).Decode(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode inventory manifest %s: %w", key, err)
+	}
+
+	return manifest, nil
+}
+
+// readInventoryFile collects the current objects in the namespace of
+// the flush from a gzip compressed CSV data file of an inventory report.
+func (f *Flush) readInventoryFile(ctx context.Context, store storage.Backend, bucket, key string, cols *inventoryColumns) ([]storage.Object, error) {
+	obj, err := store.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	gr, err := gzip.NewReader(obj)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	r := csv.NewReader(gr)
+	r.FieldsPerRecord = -1
+
+	objects := []storage.Object{}
+
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		object, ok, err := f.inventoryObject(row, cols)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			objects = append(objects, object)
+		}
+	}
+
+	return objects, nil
+}
+
+// inventoryObject converts a row of an inventory file into an object,
+// reporting whether it is a current object in the namespace of the flush.
+func (f *Flush) inventoryObject(row []string, cols *inventoryColumns) (storage.Object, bool, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(row) {
+			return ""
+		}
+
+		return row[i]
+	}
+
+	// skip the rows for other buckets
+	if b := field(cols.bucket); len(b) > 0 && b != f.Bucket {
+		return storage.Object{}, false, nil
+	}
+
+	// skip noncurrent versions and delete markers
+	if field(cols.isLatest) == "false" || field(cols.deleteMarker) == "true" {
+		return storage.Object{}, false, nil
+	}
+
+	// the keys in the inventory are URL encoded
+	key, err := url.QueryUnescape(field(cols.key))
+	if err != nil {
+		return storage.Object{}, false, fmt.Errorf("invalid key %s: %w", field(cols.key), err)
+	}
+
+	if !f.within(key) {
+		return storage.Object{}, false, nil
+	}
+
+	size, err := strconv.ParseInt(field(cols.size), 10, 64)
+	if err != nil {
+		return storage.Object{}, false, fmt.Errorf("invalid size for key %s: %w", key, err)
+	}
+
+	modified, err := time.Parse(time.RFC3339Nano, field(cols.lastModified))
+	if err != nil {
+		return storage.Object{}, false, fmt.Errorf("invalid last modified date for key %s: %w", key, err)
+	}
+
+	return storage.Object{Key: key, Size: size, LastModified: modified}, true, nil
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeInventory is a helper function to add an S3 Inventory
+// report with a single CSV data file of the rows to the store.
+func writeInventory(t *testing.T, store *fakeBackend, schema, rows string) {
+	t.Helper()
+
+	b := new(bytes.Buffer)
+
+	gw := gzip.NewWriter(b)
+
+	_, err := gw.Write([]byte(rows))
+	if err != nil {
+		t.Fatalf("unable to write inventory file: %v", err)
+	}
+
+	err = gw.Close()
+	if err != nil {
+		t.Fatalf("unable to close inventory file: %v", err)
+	}
+
+	manifest := `{
+  "sourceBucket": "bucket",
+  "destinationBucket": "arn:aws:s3:::inventory",
+  "fileFormat": "CSV",
+  "fileSchema": "` + schema + `",
+  "files": [{"key": "bucket/cache/data/1.csv.gz", "size": 1}]
+}`
+
+	store.add("bucket/cache/data/1.csv.gz", b.Bytes(), time.Now(), nil)
+	store.add("bucket/cache/manifest.json", []byte(manifest), time.Now(), nil)
+}
+
+func TestS3Cache_parseInventoryLocation(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		location string
+		bucket   string
+		key      string
+		wantErr  bool
+	}{
+		{
+			desc:     "key in flush bucket",
+			location: "/inventory/manifest.json",
+			bucket:   "bucket",
+			key:      "inventory/manifest.json",
+		},
+		{
+			desc:     "s3 url",
+			location: "s3://inventory/bucket/cache/manifest.json",
+			bucket:   "inventory",
+			key:      "bucket/cache/manifest.json",
+		},
+		{
+			desc:     "s3 url without key",
+			location: "s3://inventory",
+			wantErr:  true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			bucket, key, err := parseInventoryLocation(tC.location, "bucket")
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("parseInventoryLocation returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if bucket != tC.bucket || key != tC.key {
+				t.Errorf("parseInventoryLocation is %s %s, want %s %s", bucket, key, tC.bucket, tC.key)
+			}
+		})
+	}
+}
+
+func TestS3Cache_parseInventorySchema(t *testing.T) {
+	// setup types
+	cols, err := parseInventorySchema("Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate")
+	if err != nil {
+		t.Fatalf("parseInventorySchema returned err: %v", err)
+	}
+
+	want := &inventoryColumns{bucket: 0, key: 1, size: 5, lastModified: 6, isLatest: 3, deleteMarker: 4}
+
+	if !reflect.DeepEqual(cols, want) {
+		t.Errorf("parseInventorySchema is %+v, want %+v", cols, want)
+	}
+
+	_, err = parseInventorySchema("Bucket, Key, Size")
+	if err == nil {
+		t.Errorf("parseInventorySchema should have returned err")
+	}
+}
+
+func TestS3Cache_Flush_Exec_Inventory(t *testing.T) {
+	// setup types
+	now := time.Now()
+	old := now.Add(-48 * time.Hour).UTC().Format("2006-01-02T15:04:05.000Z")
+
+	store := newFakeBackend()
+	store.add("foo/bar/old file.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+	store.add("foo/bar/new.tgz", make([]byte, 10), now, nil)
+	store.add("foo/bar/unlisted.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+	store.add("foo/baz/other.tgz", make([]byte, 10), now.Add(-48*time.Hour), nil)
+
+	writeInventory(t, store, "Bucket, Key, Size, LastModifiedDate, IsLatest",
+		`"bucket","foo/bar/old+file.tgz","10","`+old+`","true"
+"bucket","foo/bar/new.tgz","10","`+now.UTC().Format("2006-01-02T15:04:05.000Z")+`","true"
+"bucket","foo/bar/noncurrent.tgz","10","`+old+`","false"
+"bucket","foo/baz/other.tgz","10","`+old+`","true"
+"other","foo/bar/other.tgz","10","`+old+`","true"
+`)
+
+	res := new(Result)
+
+	f := &Flush{
+		Bucket:     "bucket",
+		Age:        24 * time.Hour,
+		Timeout:    10 * time.Minute,
+		SkipExpiry: true,
+		Inventory:  "s3://inventory/bucket/cache/manifest.json",
+		Namespace:  "foo/bar",
+	}
+
+	err := f.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify only the objects in the inventory were flushed
+	want := []string{
+		"bucket/cache/data/1.csv.gz",
+		"bucket/cache/manifest.json",
+		"foo/bar/new.tgz",
+		"foo/bar/unlisted.tgz",
+		"foo/baz/other.tgz",
+	}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys is %v, want %v", got, want)
+	}
+
+	if res.Removed != 1 {
+		t.Errorf("Removed is %d, want 1", res.Removed)
+	}
+}
+
+func TestS3Cache_Flush_Exec_InventoryParquet(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("manifest.json", []byte(`{"sourceBucket": "bucket", "fileFormat": "Parquet"}`), time.Now(), nil)
+
+	f := &Flush{
+		Bucket:    "bucket",
+		Age:       24 * time.Hour,
+		Timeout:   10 * time.Minute,
+		Inventory: "manifest.json",
+		Namespace: "foo/bar",
+	}
+
+	err := f.Exec(context.Background(), store, new(Result))
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+}
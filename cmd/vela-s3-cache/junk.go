@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// junkNames represents the names of the version control directories
+// and operating system metadata files skipped when archiving, which
+// are rarely meant to be cached but easily caught by a mount.
+var junkNames = []string{
+	".git",
+	".svn",
+	".hg",
+	".bzr",
+	"CVS",
+	".DS_Store",
+	"Thumbs.db",
+	"desktop.ini",
+}
+
+// junkFilter returns a filter skipping the entries named like version
+// control directories or metadata files below the mounts, archiving
+// the mounts with the names themselves as they are cached on purpose.
+func (p *packer) junkFilter(mounts []string) EntryFilter {
+	names := map[string]bool{}
+
+	for _, mount := range mounts {
+		names[p.mountName(mount)] = true
+	}
+
+	return func(hdr *tar.Header) bool {
+		name := strings.TrimSuffix(hdr.Name, "/")
+
+		if names[name] || !slices.Contains(junkNames, path.Base(name)) {
+			return true
+		}
+
+		logrus.Debugf("skipping %s: version control and metadata files are not archived", hdr.Name)
+
+		return false
+	}
+}
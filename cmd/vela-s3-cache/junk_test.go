@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestS3Cache_packer_junkFilter(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	for _, dir := range []string{"cache/.git/objects", "cache/src", "vendor/.git"} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"cache/.git/objects/pack", "cache/src/.DS_Store", "cache/src/main.go", "vendor/.git/HEAD"} {
+		err := os.WriteFile(name, []byte("file"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		desc   string
+		mounts []string
+		want   []string
+	}{
+		{
+			desc:   "below mount",
+			mounts: []string{"cache"},
+			want:   []string{"cache/", "cache/src/", "cache/src/main.go"},
+		},
+		{
+			desc:   "mount",
+			mounts: []string{"vendor/.git"},
+			want:   []string{".git/", ".git/HEAD"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := &packer{}
+			p.with(WithEntryFilter(p.junkFilter(tC.mounts)))
+
+			archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+			err := p.pack(tC.mounts, archive)
+			if err != nil {
+				t.Fatalf("pack returned err: %v", err)
+			}
+
+			if got := archiveNames(t, archive); !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("archive entries are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
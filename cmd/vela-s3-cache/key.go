@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// keyVars represents the variables of the build available to
+// the templates in the prefix, path, filename and key of a cache.
+type keyVars struct {
+	Org           string
+	Repo          string
+	Branch        string
+	DefaultBranch string
+	Event         string
+	Commit        string
+	Number        int
+	Distribution  string
+	OS            string
+	Arch          string
+}
+
+// newKeyVars is a helper function to create the key
+// template variables from the repo and the build.
+func newKeyVars(r *Repo, b *Build) keyVars {
+	vars := keyVars{
+		Org:           r.Owner,
+		Repo:          r.Name,
+		Branch:        r.BuildBranch,
+		DefaultBranch: r.Branch,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+	}
+
+	if b != nil {
+		vars.Event = b.Event
+		vars.Commit = b.Commit
+		vars.Number = b.Number
+		vars.Distribution = b.Distribution
+	}
+
+	return vars
+}
+
+// expandKey is a helper function to execute the template in the
+// fragment of a key (i.e. node_modules-{{ .OS }}-{{ .Arch }}.tgz)
+// with the variables of the build, failing on unknown variables.
+func expandKey(key string, vars keyVars) (string, error) {
+	if !strings.Contains(key, "{{") {
+		return key, nil
+	}
+
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid key template %s: %w", key, err)
+	}
+
+	b := new(strings.Builder)
+
+	err = tmpl.Execute(b, vars)
+	if err != nil {
+		return "", fmt.Errorf("invalid key template %s: %w", key, err)
+	}
+
+	return b.String(), nil
+}
+
+// expandKeys executes the templates in the prefix, path and filename
+// of every action and in the keys of every cache definition.
+func (p *Plugin) expandKeys() error {
+	vars := newKeyVars(p.Repo, p.Build)
+
+	fields := []*string{}
+
+	if p.Abort != nil {
+		fields = append(fields, &p.Abort.Prefix, &p.Abort.Path)
+	}
+
+	if p.Check != nil {
+		fields = append(fields, &p.Check.Prefix, &p.Check.Path)
+	}
+
+	if p.Flush != nil {
+		fields = append(fields, &p.Flush.Prefix, &p.Flush.Path)
+	}
+
+	if p.Lifecycle != nil {
+		fields = append(fields, &p.Lifecycle.Prefix)
+	}
+
+	if p.List != nil {
+		fields = append(fields, &p.List.Prefix, &p.List.Path)
+	}
+
+	if p.Presign != nil {
+		fields = append(fields, &p.Presign.Prefix, &p.Presign.Path, &p.Presign.Filename)
+	}
+
+	if p.Rebuild != nil {
+		fields = append(fields, &p.Rebuild.Prefix, &p.Rebuild.Path, &p.Rebuild.Filename)
+	}
+
+	if p.Restore != nil {
+		fields = append(fields, &p.Restore.Prefix, &p.Restore.Path, &p.Restore.Filename)
+	}
+
+	if p.Pin != nil {
+		fields = append(fields, &p.Pin.Prefix, &p.Pin.Path, &p.Pin.Filename)
+	}
+
+	if p.Stats != nil {
+		fields = append(fields, &p.Stats.Prefix, &p.Stats.Path)
+	}
+
+	for _, c := range p.Caches {
+		fields = append(fields, &c.Prefix, &c.Path, &c.Filename, &c.Key)
+	}
+
+	for _, field := range fields {
+		expanded, err := expandKey(*field, vars)
+		if err != nil {
+			return err
+		}
+
+		*field = expanded
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestS3Cache_expandKey(t *testing.T) {
+	// setup types
+	vars := newKeyVars(
+		&Repo{Owner: "foo", Name: "bar", Branch: "main", BuildBranch: "feature"},
+		&Build{Number: 42, Commit: "abc123", Event: "pull_request", Distribution: "linux"},
+	)
+
+	testCases := []struct {
+		desc    string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{desc: "plain", key: "archive.tgz", want: "archive.tgz"},
+		{desc: "event", key: "{{ .Event }}/{{ .Branch }}", want: "pull_request/feature"},
+		{desc: "build", key: "{{ .Org }}-{{ .Repo }}-{{ .Number }}-{{ .Commit }}", want: "foo-bar-42-abc123"},
+		{
+			desc: "platform",
+			key:  "deps-{{ .Distribution }}-{{ .OS }}-{{ .Arch }}.tgz",
+			want: "deps-linux-" + runtime.GOOS + "-" + runtime.GOARCH + ".tgz",
+		},
+		{desc: "unknown variable", key: "{{ .Missing }}", wantErr: true},
+		{desc: "invalid template", key: "{{ .Event", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := expandKey(tC.key, vars)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("expandKey returned err: %v, want err: %v", err, tC.wantErr)
+			}
+
+			if got != tC.want {
+				t.Errorf("expandKey is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Plugin_expandKeys(t *testing.T) {
+	// setup types
+	p := &Plugin{
+		Repo:    &Repo{Owner: "foo", Name: "bar", BuildBranch: "main"},
+		Build:   &Build{Event: "push"},
+		Rebuild: &Rebuild{Path: "{{ .Event }}", Filename: "{{ .Branch }}.tgz"},
+		Pin:     &Pin{Filename: "{{ .Branch }}.tgz"},
+		Caches:  []*Cache{{Key: "{{ .Repo }}/{{ .Event }}.tgz"}},
+	}
+
+	err := p.expandKeys()
+	if err != nil {
+		t.Fatalf("expandKeys returned err: %v", err)
+	}
+
+	if p.Rebuild.Path != "push" || p.Rebuild.Filename != "main.tgz" {
+		t.Errorf("Rebuild path is %s with filename %s, want push with main.tgz", p.Rebuild.Path, p.Rebuild.Filename)
+	}
+
+	if p.Pin.Filename != "main.tgz" {
+		t.Errorf("Pin filename is %s, want main.tgz", p.Pin.Filename)
+	}
+
+	if p.Caches[0].Key != "bar/push.tgz" {
+		t.Errorf("cache key is %s, want bar/push.tgz", p.Caches[0].Key)
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const lifecycleAction = "lifecycle"
+
+// lifecycleRuleID represents the id of the lifecycle rule
+// managed for the cache objects when no id is provided.
+const lifecycleRuleID = "vela-s3-cache"
+
+// Lifecycle represents the plugin configuration for lifecycle information.
+type Lifecycle struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets the path prefix for the objects the rule applies to
+	Prefix string
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// sets the number of days after creation to expire the objects
+	ExpireDays int
+	// sets the number of days after initiation to abort incomplete uploads
+	AbortIncompleteDays int
+	// sets the id of the rule in the lifecycle configuration of the bucket
+	RuleID string
+	// whether to allow a rule expiring every object in the bucket without a prefix
+	AllowBucketWide bool
+	// whether to report the rule without setting it
+	DryRun bool
+	// will hold our final namespace for the prefix of the rule
+	Namespace string
+}
+
+// Exec formats and runs the actions for managing the lifecycle rule in s3.
+func (l *Lifecycle) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running lifecycle with provided configuration")
+
+	res.Key = l.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	rule := storage.LifecycleRule{
+		ID:                  l.RuleID,
+		Prefix:              l.Namespace,
+		ExpireDays:          l.ExpireDays,
+		AbortIncompleteDays: l.AbortIncompleteDays,
+	}
+
+	logrus.Infof("lifecycle rule %s for prefix %q: expire objects after %d days, abort incomplete uploads after %d days",
+		rule.ID, rule.Prefix, rule.ExpireDays, rule.AbortIncompleteDays)
+
+	// report the rule without changing the configuration of the bucket
+	if l.DryRun {
+		logrus.Infof("dry run: lifecycle rule %s would be set on bucket %s", rule.ID, l.Bucket)
+
+		return verifyAccess(ctx, store, l.Bucket, l.Namespace)
+	}
+
+	err := store.SetLifecycle(ctx, l.Bucket, rule)
+	if err != nil {
+		return fmt.Errorf("unable to set lifecycle rule %s on bucket %s: %w", rule.ID, l.Bucket, err)
+	}
+
+	logrus.Debug("cache lifecycle action completed")
+
+	return nil
+}
+
+// Configure prepares the lifecycle fields for the action to be taken.
+func (l *Lifecycle) Configure() error {
+	logrus.Trace("configuring lifecycle action")
+
+	// verify the prefix cannot escape the namespace
+	err := validateKeyPart("prefix", l.Prefix)
+	if err != nil {
+		return err
+	}
+
+	// end the prefix with a delimiter so the rule
+	// doesn't apply to the objects of sibling prefixes
+	l.Namespace = strings.Trim(l.Prefix, "/")
+	if len(l.Namespace) > 0 {
+		l.Namespace += "/"
+	}
+
+	logrus.Debugf("created bucket prefix %s", l.Namespace)
+
+	// derive a rule id for each prefix so several prefixes can be managed
+	if len(l.RuleID) == 0 {
+		l.RuleID = lifecycleRuleID
+
+		if len(l.Namespace) > 0 {
+			l.RuleID = fmt.Sprintf("%s-%s", lifecycleRuleID, strings.ReplaceAll(strings.TrimSuffix(l.Namespace, "/"), "/", "-"))
+		}
+	}
+
+	return nil
+}
+
+// Validate verifies the Lifecycle is properly configured.
+func (l *Lifecycle) Validate() error {
+	logrus.Trace("validating lifecycle action configuration")
+
+	// verify bucket is provided
+	if len(l.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify timeout is provided
+	if l.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	// verify days are not negative
+	if l.ExpireDays < 0 || l.AbortIncompleteDays < 0 {
+		return fmt.Errorf("expire days and abort incomplete days must not be negative")
+	}
+
+	// verify the rule does something
+	if l.ExpireDays == 0 && l.AbortIncompleteDays == 0 {
+		return fmt.Errorf("expire days or abort incomplete days must be greater than 0")
+	}
+
+	// verify the rule id is within the limit of s3
+	if len(l.RuleID) > 255 {
+		return fmt.Errorf("rule id must not be longer than 255 characters")
+	}
+
+	// refuse to expire every object in the bucket, including non-cache data
+	if len(l.Namespace) == 0 && l.ExpireDays > 0 {
+		if !l.AllowBucketWide {
+			return fmt.Errorf("no prefix provided: lifecycle rule %s would expire every object in bucket %s, set allow_bucket_wide to allow it", l.RuleID, l.Bucket)
+		}
+
+		logrus.Warnf("no prefix provided, lifecycle rule %s will expire every object in bucket %s", l.RuleID, l.Bucket)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_Lifecycle_Validate(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		lifecycle *Lifecycle
+		wantErr   bool
+	}{
+		{
+			desc: "valid",
+			lifecycle: &Lifecycle{
+				Bucket:              "bucket",
+				Timeout:             10 * time.Minute,
+				ExpireDays:          14,
+				AbortIncompleteDays: 1,
+				Namespace:           "cache/",
+			},
+		},
+		{
+			desc: "no prefix",
+			lifecycle: &Lifecycle{
+				Bucket:     "bucket",
+				Timeout:    10 * time.Minute,
+				ExpireDays: 14,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "bucket wide",
+			lifecycle: &Lifecycle{
+				Bucket:          "bucket",
+				Timeout:         10 * time.Minute,
+				ExpireDays:      14,
+				AllowBucketWide: true,
+			},
+		},
+		{
+			desc: "no prefix abort only",
+			lifecycle: &Lifecycle{
+				Bucket:              "bucket",
+				Timeout:             10 * time.Minute,
+				AbortIncompleteDays: 1,
+			},
+		},
+		{
+			desc: "no bucket",
+			lifecycle: &Lifecycle{
+				Timeout:    10 * time.Minute,
+				ExpireDays: 14,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no timeout",
+			lifecycle: &Lifecycle{
+				Bucket:     "bucket",
+				ExpireDays: 14,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "negative days",
+			lifecycle: &Lifecycle{
+				Bucket:     "bucket",
+				Timeout:    10 * time.Minute,
+				ExpireDays: -1,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no days",
+			lifecycle: &Lifecycle{
+				Bucket:  "bucket",
+				Timeout: 10 * time.Minute,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.lifecycle.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Lifecycle_Configure(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		lifecycle *Lifecycle
+		namespace string
+		ruleID    string
+		wantErr   bool
+	}{
+		{
+			desc:      "no prefix",
+			lifecycle: &Lifecycle{},
+			ruleID:    "vela-s3-cache",
+		},
+		{
+			desc:      "prefix",
+			lifecycle: &Lifecycle{Prefix: "cache/vela/"},
+			namespace: "cache/vela/",
+			ruleID:    "vela-s3-cache-cache-vela",
+		},
+		{
+			desc:      "rule id",
+			lifecycle: &Lifecycle{Prefix: "cache", RuleID: "expire-cache"},
+			namespace: "cache/",
+			ruleID:    "expire-cache",
+		},
+		{
+			desc:      "escaping prefix",
+			lifecycle: &Lifecycle{Prefix: "../cache"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.lifecycle.Configure()
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Configure returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if tC.lifecycle.Namespace != tC.namespace || tC.lifecycle.RuleID != tC.ruleID {
+				t.Errorf("Configure is %s %s, want %s %s", tC.lifecycle.Namespace, tC.lifecycle.RuleID, tC.namespace, tC.ruleID)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Lifecycle_Exec(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	res := new(Result)
+
+	l := &Lifecycle{
+		Bucket:              "bucket",
+		Prefix:              "cache",
+		Timeout:             10 * time.Minute,
+		ExpireDays:          14,
+		AbortIncompleteDays: 1,
+	}
+
+	err := l.Configure()
+	if err != nil {
+		t.Fatalf("Configure returned err: %v", err)
+	}
+
+	err = l.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	want := []storage.LifecycleRule{
+		{ID: "vela-s3-cache-cache", Prefix: "cache/", ExpireDays: 14, AbortIncompleteDays: 1},
+	}
+
+	if !reflect.DeepEqual(store.rules, want) {
+		t.Errorf("rules is %v, want %v", store.rules, want)
+	}
+
+	if res.Key != "cache/" {
+		t.Errorf("Key is %s, want cache/", res.Key)
+	}
+}
+
+func TestS3Cache_Lifecycle_Exec_DryRun(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	l := &Lifecycle{
+		Bucket:     "bucket",
+		Timeout:    10 * time.Minute,
+		ExpireDays: 14,
+		RuleID:     "vela-s3-cache",
+		DryRun:     true,
+	}
+
+	err := l.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if len(store.rules) != 0 {
+		t.Errorf("rules is %v, want none", store.rules)
+	}
+}
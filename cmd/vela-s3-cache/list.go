@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const listAction = "list"
+
+const (
+	// listSortKey represents sorting the listed objects by key.
+	listSortKey = "key"
+
+	// listSortSize represents sorting the listed objects
+	// by size, starting with the largest object.
+	listSortSize = "size"
+
+	// listSortAge represents sorting the listed objects by
+	// last modified time, starting with the oldest object.
+	listSortAge = "age"
+)
+
+// listSorts represents the supported orders of the listed objects.
+var listSorts = []string{listSortKey, listSortSize, listSortAge}
+
+// List represents the plugin configuration for list information.
+type List struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets the path to the cache objects to list
+	Path string
+	// sets the path prefix for the cache objects to list
+	Prefix string
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// sets the order of the listed objects, defaulting to key
+	Sort string
+	// sets the maximum number of objects to list, 0 lists every object
+	Limit int
+	// will hold our final namespace for the path to the objects
+	Namespace string
+}
+
+// Exec formats and runs the actions for listing the cache objects in s3.
+func (l *List) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running list with provided configuration")
+
+	res.Key = l.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	objects, err := store.List(ctx, l.Bucket, storage.ListOptions{Prefix: l.Namespace, Recursive: true})
+	if err != nil {
+		return fmt.Errorf("unable to list objects in %s: %w", l.Namespace, err)
+	}
+
+	// the stats objects are listed along with their cache objects
+	objects, _ = splitStats(objects)
+
+	l.sort(objects)
+
+	total := len(objects)
+	if l.Limit > 0 && total > l.Limit {
+		objects = objects[:l.Limit]
+	}
+
+	logrus.Infof("listing %d of %d objects in %s by %s", len(objects), total, l.Namespace, l.sortOrder())
+
+	for _, object := range objects {
+		logrus.Infof("  - %s; last modified: %s; size: %s", object.Key, object.LastModified.String(), humanize.Bytes(uint64(object.Size)))
+
+		res.Listed++
+		res.Size += object.Size
+	}
+
+	return nil
+}
+
+// sortOrder returns the order of the listed objects.
+func (l *List) sortOrder() string {
+	if len(l.Sort) == 0 {
+		return listSortKey
+	}
+
+	return l.Sort
+}
+
+// sort orders the objects by the sort of the list,
+// breaking ties by key for a stable listing.
+func (l *List) sort(objects []storage.Object) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+
+		switch l.sortOrder() {
+		case listSortSize:
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case listSortAge:
+			if !a.LastModified.Equal(b.LastModified) {
+				return a.LastModified.Before(b.LastModified)
+			}
+		}
+
+		return a.Key < b.Key
+	})
+}
+
+// Configure prepares the list fields for the action to be taken.
+func (l *List) Configure(repo *Repo) error {
+	logrus.Trace("configuring list action")
+
+	// construct the object path
+	path, err := buildNamespace(repo, l.Prefix, l.Path, "")
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	// store it in the namespace
+	l.Namespace = path
+
+	return nil
+}
+
+// Validate verifies the List is properly configured.
+func (l *List) Validate() error {
+	logrus.Trace("validating list action configuration")
+
+	// verify bucket is provided
+	if len(l.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify timeout is provided
+	if l.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	// verify the order of the listed objects is supported
+	if len(l.Sort) > 0 && !slices.Contains(listSorts, l.Sort) {
+		return fmt.Errorf("invalid sort %s: must be one of %s", l.Sort, strings.Join(listSorts, ", "))
+	}
+
+	if l.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_List_Exec(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	store := newFakeBackend()
+	store.add("foo/bar/main.tgz", make([]byte, 30), now.Add(-2*time.Hour), nil)
+	store.add("foo/bar/main.tgz.stats", make([]byte, 5), now, nil)
+	store.add("foo/bar/feature.tgz", make([]byte, 20), now.Add(-3*time.Hour), nil)
+	store.add("foo/bar/release.tgz", make([]byte, 10), now.Add(-time.Hour), nil)
+	store.add("foo/baz/main.tgz", make([]byte, 40), now, nil)
+
+	testCases := []struct {
+		desc       string
+		sort       string
+		limit      int
+		wantListed int
+		wantSize   int64
+	}{
+		{
+			desc:       "every object",
+			wantListed: 3,
+			wantSize:   60,
+		},
+		{
+			desc:       "largest",
+			sort:       listSortSize,
+			limit:      2,
+			wantListed: 2,
+			wantSize:   50,
+		},
+		{
+			desc:       "oldest",
+			sort:       listSortAge,
+			limit:      1,
+			wantListed: 1,
+			wantSize:   20,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := &List{
+				Bucket:    "bucket",
+				Timeout:   10 * time.Minute,
+				Sort:      tC.sort,
+				Limit:     tC.limit,
+				Namespace: "foo/bar/",
+			}
+
+			res := new(Result)
+
+			err := l.Exec(context.Background(), store, res)
+			if err != nil {
+				t.Errorf("Exec returned err: %v", err)
+			}
+
+			// verify the stats objects and other namespaces are left out
+			if res.Listed != tC.wantListed || res.Size != tC.wantSize {
+				t.Errorf("listed %d objects with %d bytes, want %d with %d bytes", res.Listed, res.Size, tC.wantListed, tC.wantSize)
+			}
+		})
+	}
+}
+
+func TestS3Cache_List_sort(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	objects := []storage.Object{
+		{Key: "b.tgz", Size: 10, LastModified: now.Add(-time.Hour)},
+		{Key: "c.tgz", Size: 30, LastModified: now},
+		{Key: "a.tgz", Size: 10, LastModified: now.Add(-2 * time.Hour)},
+	}
+
+	testCases := []struct {
+		desc string
+		sort string
+		want []string
+	}{
+		{
+			desc: "default",
+			want: []string{"a.tgz", "b.tgz", "c.tgz"},
+		},
+		{
+			desc: "size",
+			sort: listSortSize,
+			want: []string{"c.tgz", "a.tgz", "b.tgz"},
+		},
+		{
+			desc: "age",
+			sort: listSortAge,
+			want: []string{"a.tgz", "b.tgz", "c.tgz"},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			sorted := append([]storage.Object{}, objects...)
+
+			(&List{Sort: tC.sort}).sort(sorted)
+
+			got := []string{}
+			for _, object := range sorted {
+				got = append(got, object.Key)
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("sorted keys are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_List_Validate(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		list    List
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			list: List{Bucket: "bucket", Timeout: 10 * time.Minute, Sort: listSortSize, Limit: 10},
+		},
+		{
+			desc:    "no bucket",
+			list:    List{Timeout: 10 * time.Minute},
+			wantErr: true,
+		},
+		{
+			desc:    "no timeout",
+			list:    List{Bucket: "bucket"},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid sort",
+			list:    List{Bucket: "bucket", Timeout: 10 * time.Minute, Sort: "name"},
+			wantErr: true,
+		},
+		{
+			desc:    "negative limit",
+			list:    List{Bucket: "bucket", Timeout: 10 * time.Minute, Limit: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.list.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v", err)
+			}
+		})
+	}
+}
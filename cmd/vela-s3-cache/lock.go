@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// lockPollInterval represents the interval for checking whether the lock
+// held by another rebuild was released. It is a variable to be shortened in tests.
+var lockPollInterval = 5 * time.Second
+
+// errLocked is returned when the lock is held by
+// another rebuild until the wait for it is over.
+var errLocked = errors.New("lock held")
+
+// lockKey is a helper function to create the key of
+// the lock object held while rebuilding the key.
+func lockKey(key string) string {
+	return key + ".lock"
+}
+
+// lock creates the lock object next to the namespace, unless another
+// rebuild holds it, waiting for it to be released or to expire. The lock
+// is best-effort: on a store refusing conditional uploads, the rebuild
+// continues without it. The returned function releases the lock.
+func (r *Rebuild) lock(ctx context.Context, store storage.Backend) (func(), error) {
+	key := lockKey(r.Namespace)
+	deadline := time.Now().Add(r.LockWait)
+
+	for {
+		err := r.putLock(ctx, store, key)
+		if err == nil {
+			logrus.Debugf("acquired lock %s in bucket %s", key, r.Bucket)
+
+			return func() { releaseLock(store, r.Bucket, key) }, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// rebuild without the lock on a store without conditional uploads
+		if !storage.IsPreconditionFailed(err) {
+			logrus.Warnf("unable to acquire lock %s, rebuilding without it: %v", key, err)
+
+			return func() {}, nil
+		}
+
+		holder := "another rebuild"
+
+		info, err := store.Stat(ctx, r.Bucket, key)
+		if err == nil {
+			// remove the lock left behind by an interrupted rebuild
+			expires, ok := expiresAt(info)
+			if ok && time.Now().After(expires) {
+				logrus.Warnf("removing lock %s expired at %s", key, expires.Format(time.RFC3339))
+
+				if len(store.Remove(ctx, r.Bucket, []storage.Object{{Key: key}})) == 0 {
+					continue
+				}
+			}
+
+			if number := userMetadata(info, metaBuildNumber); len(number) > 0 {
+				holder = "build #" + number
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", errLocked, holder)
+		}
+
+		logrus.Infof("waiting for lock %s held by %s", key, holder)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// putLock uploads the lock object, unless an object exists at the key,
+// recording when it expires so an abandoned lock can be taken over.
+func (r *Rebuild) putLock(ctx context.Context, store storage.Backend, key string) error {
+	opts := storage.PutOptions{
+		ContentType: "text/plain",
+		UserMetadata: map[string]string{
+			metaExpires: time.Now().Add(r.LockTTL).UTC().Format(time.RFC3339),
+		},
+		IfNoneMatch: true,
+	}
+
+	// record the build holding the lock
+	for k, v := range r.Metadata {
+		opts.UserMetadata[k] = v
+	}
+
+	_, err := store.Put(ctx, r.Bucket, key, strings.NewReader(""), 0, opts)
+
+	return err
+}
+
+// releaseLock is a helper function to remove the lock
+// object, even when the context of the rebuild is done.
+func releaseLock(store storage.Backend, bucket, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	logrus.Debugf("releasing lock %s in bucket %s", key, bucket)
+
+	for _, rErr := range store.Remove(ctx, bucket, []storage.Object{{Key: key}}) {
+		logrus.Warnf("unable to release lock %s: %v", key, rErr)
+	}
+}
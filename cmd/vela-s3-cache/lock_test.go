@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// unconditionalBackend is a fake backend refusing conditional uploads.
+type unconditionalBackend struct {
+	*fakeBackend
+}
+
+// Put fails every conditional upload as not implemented.
+func (b unconditionalBackend) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts storage.PutOptions) (storage.Object, error) {
+	if opts.IfNoneMatch {
+		return storage.Object{}, &storage.ResponseError{StatusCode: http.StatusNotImplemented, Err: errors.New("not implemented")}
+	}
+
+	return b.fakeBackend.Put(ctx, bucket, key, reader, size, opts)
+}
+
+func TestS3Cache_Rebuild_lock(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Namespace: "foo/bar/archive.tgz",
+		LockTTL:   time.Hour,
+		Metadata:  map[string]string{metaBuildNumber: "1"},
+	}
+
+	unlock, err := r.lock(context.Background(), store)
+	if err != nil {
+		t.Fatalf("lock returned err: %v", err)
+	}
+
+	info, err := store.Stat(context.Background(), "bucket", "foo/bar/archive.tgz.lock")
+	if err != nil {
+		t.Fatalf("Stat returned err: %v", err)
+	}
+
+	if expires, ok := expiresAt(info); !ok || expires.Before(time.Now()) {
+		t.Errorf("UserMetadata is %v, want expiry in the future", info.UserMetadata)
+	}
+
+	// verify a second rebuild does not acquire the lock
+	_, err = r.lock(context.Background(), store)
+	if !errors.Is(err, errLocked) {
+		t.Errorf("lock returned err: %v, want %v", err, errLocked)
+	}
+
+	unlock()
+
+	if len(store.keys()) != 0 {
+		t.Errorf("keys is %v, want the lock released", store.keys())
+	}
+}
+
+func TestS3Cache_Rebuild_lock_Expired(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz.lock", nil, time.Now().Add(-2*time.Hour), map[string]string{
+		metaExpires: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+	})
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Namespace: "foo/bar/archive.tgz",
+		LockTTL:   time.Hour,
+	}
+
+	unlock, err := r.lock(context.Background(), store)
+	if err != nil {
+		t.Fatalf("lock returned err: %v", err)
+	}
+	defer unlock()
+
+	info, err := store.Stat(context.Background(), "bucket", "foo/bar/archive.tgz.lock")
+	if err != nil {
+		t.Fatalf("Stat returned err: %v", err)
+	}
+
+	if expires, ok := expiresAt(info); !ok || expires.Before(time.Now()) {
+		t.Errorf("UserMetadata is %v, want the expired lock replaced", info.UserMetadata)
+	}
+}
+
+func TestS3Cache_Rebuild_lock_Wait(t *testing.T) {
+	// setup types
+	lockPollInterval = 10 * time.Millisecond
+
+	t.Cleanup(func() { lockPollInterval = 5 * time.Second })
+
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz.lock", nil, time.Now(), map[string]string{
+		metaExpires: time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+
+	// release the lock held by the other rebuild while waiting
+	time.AfterFunc(50*time.Millisecond, func() {
+		store.Remove(context.Background(), "bucket", []storage.Object{{Key: "foo/bar/archive.tgz.lock"}})
+	})
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Namespace: "foo/bar/archive.tgz",
+		LockTTL:   time.Hour,
+		LockWait:  time.Minute,
+	}
+
+	unlock, err := r.lock(context.Background(), store)
+	if err != nil {
+		t.Fatalf("lock returned err: %v", err)
+	}
+
+	unlock()
+}
+
+func TestS3Cache_Rebuild_lock_Unsupported(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Namespace: "foo/bar/archive.tgz",
+		LockTTL:   time.Hour,
+	}
+
+	// verify the rebuild continues without the lock
+	unlock, err := r.lock(context.Background(), unconditionalBackend{store})
+	if err != nil {
+		t.Fatalf("lock returned err: %v", err)
+	}
+
+	unlock()
+}
+
+func TestS3Cache_Rebuild_Exec_Locked(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz.lock", nil, time.Now(), map[string]string{
+		metaExpires:     time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		metaBuildNumber: "2",
+	})
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+		Lock:      true,
+		LockTTL:   time.Hour,
+	}
+
+	err := r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// verify the rebuild was skipped and the lock left to its holder
+	if got, want := store.keys(), []string{"foo/bar/archive.tgz.lock"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys are %v, want %v", got, want)
+	}
+}
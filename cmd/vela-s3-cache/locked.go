@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// lockedPrefix represents the prefix of the environment variables
+// injected by platform admins to lock the value of a parameter.
+const lockedPrefix = "S3_CACHE_LOCKED_"
+
+// applyLockedParameters is a helper function to override the flags with
+// the values locked by the platform admins, taking precedence over the
+// parameters from the pipeline and the config file.
+func applyLockedParameters(c *cli.Context) error {
+	names := parameterNames(c.App.Flags)
+
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, ok := lookupLocked(key)
+		if !ok {
+			continue
+		}
+
+		name := names[key]
+
+		// replace the values of list parameters instead of appending to them
+		if isSliceFlag(c.App.Flags, name) {
+			value = cli.NewStringSlice(splitLocked(value)...).Serialize()
+		}
+
+		err := c.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("invalid locked parameter %s: %w", key, err)
+		}
+
+		// the value is not logged as it may be a secret
+		logrus.Infof("parameter %s is locked by the platform", key)
+	}
+
+	return nil
+}
+
+// lookupLocked is a helper function to look up the
+// value of the parameter locked by the platform admins.
+func lookupLocked(key string) (string, bool) {
+	return os.LookupEnv(lockedPrefix + strings.ToUpper(key))
+}
+
+// isLocked is a helper function to determine whether
+// the parameter is locked by the platform admins.
+func isLocked(key string) bool {
+	_, ok := lookupLocked(key)
+
+	return ok
+}
+
+// isSliceFlag is a helper function to determine
+// whether the flag with the name holds a list.
+func isSliceFlag(flags []cli.Flag, name string) bool {
+	for _, flag := range flags {
+		if flag.Names()[0] != name {
+			continue
+		}
+
+		_, ok := flag.(*cli.StringSliceFlag)
+
+		return ok
+	}
+
+	return false
+}
+
+// splitLocked is a helper function to split the
+// locked value of a list parameter on commas.
+func splitLocked(value string) []string {
+	values := []string{}
+
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
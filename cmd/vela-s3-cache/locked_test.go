@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestS3Cache_applyLockedParameters(t *testing.T) {
+	// setup types
+	t.Setenv("PARAMETER_BUCKET", "attacker")
+	t.Setenv("PARAMETER_FAILOVER_SERVERS", "https://attacker.example.com")
+	t.Setenv("S3_CACHE_LOCKED_BUCKET", "cache")
+	t.Setenv("S3_CACHE_LOCKED_FAILOVER_SERVERS", "https://a.example.com, https://b.example.com")
+	t.Setenv("S3_CACHE_LOCKED_SERVER", "https://s3.example.com")
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_BUCKET"}, Name: "bucket"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_SERVER"}, Name: "config.server"},
+			&cli.StringSliceFlag{EnvVars: []string{"PARAMETER_FAILOVER_SERVERS"}, Name: "config.failover_servers"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_FILENAME"}, Name: "filename", Value: "archive.tgz"},
+		},
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	for _, f := range app.Flags {
+		err := f.Apply(set)
+		if err != nil {
+			t.Fatalf("unable to apply flag: %v", err)
+		}
+	}
+
+	c := cli.NewContext(app, set, nil)
+
+	err := applyLockedParameters(c)
+	if err != nil {
+		t.Errorf("applyLockedParameters returned err: %v", err)
+	}
+
+	// the locked values take precedence over the parameters
+	if got := c.String("bucket"); got != "cache" {
+		t.Errorf("bucket is %s, want cache", got)
+	}
+
+	if got := c.String("config.server"); got != "https://s3.example.com" {
+		t.Errorf("server is %s, want https://s3.example.com", got)
+	}
+
+	// the locked list replaces the parameter instead of appending to it
+	if got := c.StringSlice("config.failover_servers"); !reflect.DeepEqual(got, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Errorf("failover servers is %v, want [https://a.example.com https://b.example.com]", got)
+	}
+
+	if got := c.String("filename"); got != "archive.tgz" {
+		t.Errorf("filename is %s, want archive.tgz", got)
+	}
+}
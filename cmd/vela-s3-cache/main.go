@@ -3,16 +3,20 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	_ "github.com/joho/godotenv/autoload"
 
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 	"github.com/go-vela/vela-s3-cache/version"
 )
 
@@ -21,15 +25,14 @@ func main() {
 	// capture application version information
 	v := version.New()
 
-	// serialize the version information as pretty JSON
-	bytes, err := json.MarshalIndent(v, "", "  ")
-	if err != nil {
-		logrus.Fatal(err)
+	// output the version information for the --version flag
+	cli.VersionPrinter = func(_ *cli.Context) {
+		err := printVersion(os.Stdout)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 	}
 
-	// output the version information to stdout
-	fmt.Fprintf(os.Stdout, "%s\n", string(bytes))
-
 	// create new CLI application
 	app := cli.NewApp()
 
@@ -54,6 +57,25 @@ func main() {
 
 	// Plugin Flags
 	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_CACHES", "S3_CACHE_CACHES"},
+			FilePath: "/vela/parameters/s3-cache/caches,/vela/secrets/s3-cache/caches",
+			Name:     "caches",
+			Usage:    "JSON or YAML array of cache definitions (mount, filename, path, prefix, key, format) to process in order",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_CONFIG_FILE", "S3_CACHE_CONFIG_FILE"},
+			FilePath: "/vela/parameters/s3-cache/config_file,/vela/secrets/s3-cache/config_file",
+			Name:     "config_file",
+			Usage:    "file in the workspace to load parameters from (defaults to .vela-s3-cache.yml if present)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_VERSION_BANNER", "S3_CACHE_VERSION_BANNER"},
+			FilePath: "/vela/parameters/s3-cache/version_banner,/vela/secrets/s3-cache/version_banner",
+			Name:     "version_banner",
+			Usage:    "where to write the version information on startup - options: (stdout|stderr|none)",
+			Value:    "stdout",
+		},
 		&cli.StringFlag{
 			EnvVars:  []string{"PARAMETER_LOG_LEVEL", "S3_CACHE_LOG_LEVEL"},
 			FilePath: "/vela/parameters/s3-cache/log_level,/vela/secrets/s3-cache/log_level",
@@ -68,6 +90,26 @@ func main() {
 			Usage:    "action to perform against the s3 cache instance",
 		},
 
+		// Abort Flags
+
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_ABORT_AGE", "S3_CACHE_ABORT_AGE"},
+			FilePath: "/vela/parameters/s3-cache/abort_age,/vela/secrets/s3-cache/abort_age",
+			Name:     "abort.age",
+			Usage:    "abort incomplete uploads initiated longer ago than the age, leaving the uploads of running rebuilds",
+			Value:    24 * time.Hour,
+		},
+
+		// Benchmark Flags
+
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_LEVELS", "S3_CACHE_LEVELS"},
+			FilePath: "/vela/parameters/s3-cache/levels,/vela/secrets/s3-cache/levels",
+			Name:     "benchmark.levels",
+			Usage:    "gzip compression levels (0-9 or auto) to archive the mounts with when benchmarking",
+			Value:    cli.NewStringSlice(defaultBenchmarkLevels...),
+		},
+
 		// Cache Flags
 
 		&cli.StringFlag{
@@ -89,6 +131,12 @@ func main() {
 			Usage:    "Filename for the item place in the cache",
 			Value:    "archive.tgz",
 		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_DRONE_COMPAT", "S3_CACHE_DRONE_COMPAT"},
+			FilePath: "/vela/parameters/s3-cache/drone_compat,/vela/secrets/s3-cache/drone_compat",
+			Name:     "drone_compat",
+			Usage:    "whether to read and write cache objects with the layout and format of drone-s3-cache",
+		},
 		&cli.StringFlag{
 			EnvVars:  []string{"PARAMETER_PATH", "S3_CACHE_PATH"},
 			FilePath: "/vela/parameters/s3-cache/path,/vela/secrets/s3-cache/path",
@@ -102,6 +150,108 @@ func main() {
 			Usage:    "Default timeout for cache requests",
 			Value:    10 * time.Minute,
 		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_TIMEOUT_PER_GB", "S3_CACHE_TIMEOUT_PER_GB"},
+			FilePath: "/vela/parameters/s3-cache/timeout_per_gb,/vela/secrets/s3-cache/timeout_per_gb",
+			Name:     "timeout_per_gb",
+			Usage:    "additional transfer timeout per gigabyte of the cache object",
+		},
+
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_DISABLED", "S3_CACHE_DISABLED"},
+			FilePath: "/vela/parameters/s3-cache/disabled,/vela/secrets/s3-cache/disabled",
+			Name:     "disabled",
+			Usage:    "whether to skip the action entirely, exiting successfully",
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_CONNECT_TIMEOUT", "S3_CACHE_CONNECT_TIMEOUT"},
+			FilePath: "/vela/parameters/s3-cache/connect_timeout,/vela/secrets/s3-cache/connect_timeout",
+			Name:     "config.connect_timeout",
+			Usage:    "timeout for establishing a connection and TLS handshake with s3",
+			Value:    30 * time.Second,
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_FIPS", "S3_CACHE_FIPS"},
+			FilePath: "/vela/parameters/s3-cache/fips,/vela/secrets/s3-cache/fips",
+			Name:     "config.fips",
+			Usage:    "restrict the cryptography to FIPS approved algorithms and use the FIPS endpoints of s3",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_MIN_TLS_VERSION", "S3_CACHE_MIN_TLS_VERSION"},
+			FilePath: "/vela/parameters/s3-cache/min_tls_version,/vela/secrets/s3-cache/min_tls_version",
+			Name:     "config.min_tls_version",
+			Usage:    "minimum TLS version for the connections to s3 (1.2 or 1.3)",
+		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_TLS_CIPHER_SUITES", "S3_CACHE_TLS_CIPHER_SUITES"},
+			FilePath: "/vela/parameters/s3-cache/tls_cipher_suites,/vela/secrets/s3-cache/tls_cipher_suites",
+			Name:     "config.tls_cipher_suites",
+			Usage:    "cipher suites allowed for the connections to s3 up to TLS 1.2",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_DRY_RUN", "S3_CACHE_DRY_RUN"},
+			FilePath: "/vela/parameters/s3-cache/dry_run,/vela/secrets/s3-cache/dry_run",
+			Name:     "dry_run",
+			Usage:    "report what the action would do without transferring or deleting anything",
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_LIST_ENTRIES", "S3_CACHE_LIST_ENTRIES"},
+			FilePath: "/vela/parameters/s3-cache/list_entries,/vela/secrets/s3-cache/list_entries",
+			Name:     "list_entries",
+			Usage:    "number of first and largest archive entries to log at debug level",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_MAX_BANDWIDTH", "S3_CACHE_MAX_BANDWIDTH"},
+			FilePath: "/vela/parameters/s3-cache/max_bandwidth,/vela/secrets/s3-cache/max_bandwidth",
+			Name:     "max_bandwidth",
+			Usage:    "maximum bytes per second to upload or download the cache with (i.e. 50MB), unlimited by default",
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_PROGRESS_INTERVAL", "S3_CACHE_PROGRESS_INTERVAL"},
+			FilePath: "/vela/parameters/s3-cache/progress_interval,/vela/secrets/s3-cache/progress_interval",
+			Name:     "progress_interval",
+			Usage:    "interval for logging upload and download progress (0 disables)",
+			Value:    30 * time.Second,
+		},
+
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_ENCRYPTION_KEY", "S3_CACHE_ENCRYPTION_KEY"},
+			FilePath: "/vela/parameters/s3-cache/encryption_key,/vela/secrets/s3-cache/encryption_key",
+			Name:     "encryption_key",
+			Usage:    "base64 encoded 256-bit key to encrypt the cache archives with",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SIGNING_KEY", "S3_CACHE_SIGNING_KEY"},
+			FilePath: "/vela/parameters/s3-cache/signing_key,/vela/secrets/s3-cache/signing_key",
+			Name:     "signing_key",
+			Usage:    "key to sign the cache archives with, refusing to restore unsigned or invalid archives",
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_SYMLINK_DEPTH", "S3_CACHE_SYMLINK_DEPTH"},
+			FilePath: "/vela/parameters/s3-cache/symlink_depth,/vela/secrets/s3-cache/symlink_depth",
+			Name:     "symlink_depth",
+			Usage:    "maximum number of links in a chain of symlinks to dereference",
+			Value:    defaultSymlinkDepth,
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SYMLINKS", "S3_CACHE_SYMLINKS"},
+			FilePath: "/vela/parameters/s3-cache/symlinks,/vela/secrets/s3-cache/symlinks",
+			Name:     "symlinks",
+			Usage:    "policy for symlinks when archiving and extracting the cache (preserve, skip, dereference or error)",
+			Value:    symlinkPreserve,
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_TMP_DIR", "S3_CACHE_TMP_DIR"},
+			FilePath: "/vela/parameters/s3-cache/tmp_dir,/vela/secrets/s3-cache/tmp_dir",
+			Name:     "tmp_dir",
+			Usage:    "directory to stage the archive in while rebuilding or restoring",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WORKDIR", "S3_CACHE_WORKDIR"},
+			FilePath: "/vela/parameters/s3-cache/workdir,/vela/secrets/s3-cache/workdir",
+			Name:     "workdir",
+			Usage:    "directory to resolve relative mounts against and restore the cache into",
+		},
 
 		// Flush Flags
 
@@ -112,6 +262,156 @@ func main() {
 			Usage:    "flush cache files older than # days",
 			Value:    14 * 24 * time.Hour,
 		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_PATTERN", "PARAMETER_FLUSH_PATTERN", "S3_CACHE_PATTERN"},
+			FilePath: "/vela/parameters/s3-cache/pattern,/vela/secrets/s3-cache/pattern",
+			Name:     "flush.pattern",
+			Usage:    "only flush cache files with keys matching one of the glob patterns",
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_KEEP", "PARAMETER_FLUSH_KEEP", "S3_CACHE_KEEP"},
+			FilePath: "/vela/parameters/s3-cache/keep,/vela/secrets/s3-cache/keep",
+			Name:     "flush.keep",
+			Usage:    "number of most recently modified cache files to keep per key prefix regardless of age",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_MAX_TOTAL_SIZE", "PARAMETER_FLUSH_MAX_TOTAL_SIZE", "S3_CACHE_MAX_TOTAL_SIZE"},
+			FilePath: "/vela/parameters/s3-cache/max_total_size,/vela/secrets/s3-cache/max_total_size",
+			Name:     "flush.max_total_size",
+			Usage:    "flush the oldest cache files until the total size is within the budget (i.e. 5GB)",
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_WORKERS", "PARAMETER_FLUSH_WORKERS", "S3_CACHE_WORKERS"},
+			FilePath: "/vela/parameters/s3-cache/workers,/vela/secrets/s3-cache/workers",
+			Name:     "flush.workers",
+			Usage:    "number of workers used to list, evaluate and remove cache files",
+			Value:    1,
+		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_BRANCHES", "PARAMETER_FLUSH_BRANCHES", "S3_CACHE_BRANCHES"},
+			FilePath: "/vela/parameters/s3-cache/branches,/vela/secrets/s3-cache/branches",
+			Name:     "flush.branches",
+			Usage:    "list of active branches, flushing cache files for any other branch",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_BRANCHES_FILE", "PARAMETER_FLUSH_BRANCHES_FILE", "S3_CACHE_BRANCHES_FILE"},
+			FilePath: "/vela/parameters/s3-cache/branches_file,/vela/secrets/s3-cache/branches_file",
+			Name:     "flush.branches_file",
+			Usage:    "file containing a newline separated list of active branches",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_VERSIONS", "PARAMETER_FLUSH_VERSIONS", "S3_CACHE_VERSIONS"},
+			FilePath: "/vela/parameters/s3-cache/versions,/vela/secrets/s3-cache/versions",
+			Name:     "flush.versions",
+			Usage:    "whether to flush every version of the cache files in a versioned bucket",
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_MAX_KEYS", "PARAMETER_FLUSH_MAX_KEYS", "S3_CACHE_MAX_KEYS"},
+			FilePath: "/vela/parameters/s3-cache/max_keys,/vela/secrets/s3-cache/max_keys",
+			Name:     "flush.max_keys",
+			Usage:    "maximum number of keys per page when listing the cache files (1-1000), 0 uses the server default",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_START_AFTER", "PARAMETER_FLUSH_START_AFTER", "S3_CACHE_START_AFTER"},
+			FilePath: "/vela/parameters/s3-cache/start_after,/vela/secrets/s3-cache/start_after",
+			Name:     "flush.start_after",
+			Usage:    "only list the cache files with keys after the key, resuming a flush of a path with many cache files",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_RECURSIVE", "PARAMETER_FLUSH_RECURSIVE", "S3_CACHE_RECURSIVE"},
+			FilePath: "/vela/parameters/s3-cache/recursive,/vela/secrets/s3-cache/recursive",
+			Name:     "flush.recursive",
+			Usage:    "whether to flush the cache files in the nested paths, listing only the files directly in the path when false",
+			Value:    true,
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_SKIP_EXPIRY", "PARAMETER_FLUSH_SKIP_EXPIRY", "S3_CACHE_SKIP_EXPIRY"},
+			FilePath: "/vela/parameters/s3-cache/skip_expiry,/vela/secrets/s3-cache/skip_expiry",
+			Name:     "flush.skip_expiry",
+			Usage:    "whether to skip retrieving each cache file within the flush age to check its recorded expiry",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_INVENTORY", "PARAMETER_FLUSH_INVENTORY", "S3_CACHE_INVENTORY"},
+			FilePath: "/vela/parameters/s3-cache/inventory,/vela/secrets/s3-cache/inventory",
+			Name:     "flush.inventory",
+			Usage:    "location of an S3 Inventory manifest.json (i.e. s3://inventory-bucket/path/manifest.json) to read the cache files from instead of listing the bucket",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_REPORT", "PARAMETER_FLUSH_REPORT", "S3_CACHE_REPORT"},
+			FilePath: "/vela/parameters/s3-cache/report,/vela/secrets/s3-cache/report",
+			Name:     "flush.report",
+			Usage:    "file to write a JSON report of the flush to",
+		},
+
+		// Lifecycle Flags
+
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_EXPIRE_DAYS", "PARAMETER_LIFECYCLE_EXPIRE_DAYS", "S3_CACHE_EXPIRE_DAYS"},
+			FilePath: "/vela/parameters/s3-cache/expire_days,/vela/secrets/s3-cache/expire_days",
+			Name:     "lifecycle.expire_days",
+			Usage:    "number of days after creation for the lifecycle rule to expire the cache files, 0 disables expiry",
+			Value:    14,
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_ABORT_INCOMPLETE_DAYS", "PARAMETER_LIFECYCLE_ABORT_INCOMPLETE_DAYS", "S3_CACHE_ABORT_INCOMPLETE_DAYS"},
+			FilePath: "/vela/parameters/s3-cache/abort_incomplete_days,/vela/secrets/s3-cache/abort_incomplete_days",
+			Name:     "lifecycle.abort_incomplete_days",
+			Usage:    "number of days after initiation for the lifecycle rule to abort incomplete uploads, 0 disables aborting",
+			Value:    1,
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_RULE_ID", "PARAMETER_LIFECYCLE_RULE_ID", "S3_CACHE_RULE_ID"},
+			FilePath: "/vela/parameters/s3-cache/rule_id,/vela/secrets/s3-cache/rule_id",
+			Name:     "lifecycle.rule_id",
+			Usage:    "id of the lifecycle rule to create or update, derived from the prefix by default",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_ALLOW_BUCKET_WIDE", "PARAMETER_LIFECYCLE_ALLOW_BUCKET_WIDE", "S3_CACHE_ALLOW_BUCKET_WIDE"},
+			FilePath: "/vela/parameters/s3-cache/allow_bucket_wide,/vela/secrets/s3-cache/allow_bucket_wide",
+			Name:     "lifecycle.allow_bucket_wide",
+			Usage:    "allow a lifecycle rule without a prefix expiring every object in the bucket",
+		},
+
+		// List Flags
+
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SORT", "PARAMETER_LIST_SORT", "S3_CACHE_SORT"},
+			FilePath: "/vela/parameters/s3-cache/sort,/vela/secrets/s3-cache/sort",
+			Name:     "list.sort",
+			Usage:    "order to list the cache files in (key, size for the largest first or age for the oldest first)",
+			Value:    listSortKey,
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_LIMIT", "PARAMETER_LIST_LIMIT", "S3_CACHE_LIMIT"},
+			FilePath: "/vela/parameters/s3-cache/limit,/vela/secrets/s3-cache/limit",
+			Name:     "list.limit",
+			Usage:    "maximum number of cache files to list, 0 lists every file",
+		},
+
+		// Pin Flags
+
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_UNPIN", "S3_CACHE_UNPIN"},
+			FilePath: "/vela/parameters/s3-cache/unpin,/vela/secrets/s3-cache/unpin",
+			Name:     "pin.unpin",
+			Usage:    "whether to remove the pin from the cache file instead of adding it",
+		},
+
+		// Presign Flags
+
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_EXPIRY", "PARAMETER_PRESIGN_EXPIRY", "S3_CACHE_EXPIRY"},
+			FilePath: "/vela/parameters/s3-cache/expiry,/vela/secrets/s3-cache/expiry",
+			Name:     "presign.expiry",
+			Usage:    "time until the presigned URLs for the cache file expire, at most 168h",
+			Value:    time.Hour,
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_PRESIGN_PUT", "S3_CACHE_PRESIGN_PUT"},
+			FilePath: "/vela/parameters/s3-cache/presign_put,/vela/secrets/s3-cache/presign_put",
+			Name:     "presign.put",
+			Usage:    "whether to also presign a URL for uploading the cache file, written only to the outputs",
+		},
 
 		// Rebuild Flags
 
@@ -122,6 +422,93 @@ func main() {
 			Usage:    "list of files/directories to cache",
 		},
 
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_APPEND", "S3_CACHE_APPEND"},
+			FilePath: "/vela/parameters/s3-cache/append,/vela/secrets/s3-cache/append",
+			Name:     "rebuild.append",
+			Usage:    "whether to append the files changed since the previous archive to it instead of rebuilding the archive",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_NORMALIZE_MODES", "S3_CACHE_NORMALIZE_MODES"},
+			FilePath: "/vela/parameters/s3-cache/normalize_modes,/vela/secrets/s3-cache/normalize_modes",
+			Name:     "rebuild.normalize_modes",
+			Usage:    "whether to archive files with 0644, or 0755 when executable, and directories with 0755 independent of the umask",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_RETENTION_MODE", "S3_CACHE_RETENTION_MODE"},
+			FilePath: "/vela/parameters/s3-cache/retention_mode,/vela/secrets/s3-cache/retention_mode",
+			Name:     "rebuild.retention_mode",
+			Usage:    "object lock retention mode of the cache object (governance or compliance)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_RETAIN_UNTIL", "S3_CACHE_RETAIN_UNTIL"},
+			FilePath: "/vela/parameters/s3-cache/retain_until,/vela/secrets/s3-cache/retain_until",
+			Name:     "rebuild.retain_until",
+			Usage:    "date or duration from now to retain the cache object until with object lock (i.e. 2030-01-02 or 720h)",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_LEGAL_HOLD", "S3_CACHE_LEGAL_HOLD"},
+			FilePath: "/vela/parameters/s3-cache/legal_hold,/vela/secrets/s3-cache/legal_hold",
+			Name:     "rebuild.legal_hold",
+			Usage:    "whether to place an object lock legal hold on the cache object",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_SKIP_JUNK", "S3_CACHE_SKIP_JUNK"},
+			FilePath: "/vela/parameters/s3-cache/skip_junk,/vela/secrets/s3-cache/skip_junk",
+			Name:     "rebuild.skip_junk",
+			Usage:    "whether to skip version control directories (i.e. .git) and operating system metadata files (i.e. .DS_Store) below the mounts",
+			Value:    true,
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_MOUNT_SYMLINKS", "S3_CACHE_MOUNT_SYMLINKS"},
+			FilePath: "/vela/parameters/s3-cache/mount_symlinks,/vela/secrets/s3-cache/mount_symlinks",
+			Name:     "rebuild.mount_symlinks",
+			Usage:    "policy for mounts that are symlinks (follow the link to a target inside the workspace or preserve the link)",
+			Value:    mountFollow,
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_ATOMIC_PUBLISH", "S3_CACHE_ATOMIC_PUBLISH"},
+			FilePath: "/vela/parameters/s3-cache/atomic_publish,/vela/secrets/s3-cache/atomic_publish",
+			Name:     "rebuild.atomic_publish",
+			Usage:    "whether to upload the cache file to a temporary key and copy it into place on the server, for stores without atomic uploads",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_FROM_STDIN", "S3_CACHE_FROM_STDIN"},
+			FilePath: "/vela/parameters/s3-cache/from_stdin,/vela/secrets/s3-cache/from_stdin",
+			Name:     "rebuild.from_stdin",
+			Usage:    "whether to compress and upload the tar stream read from stdin instead of archiving the mounts",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_LOCK", "S3_CACHE_LOCK"},
+			FilePath: "/vela/parameters/s3-cache/lock,/vela/secrets/s3-cache/lock",
+			Name:     "rebuild.lock",
+			Usage:    "whether to hold a lock object while rebuilding, skipping the rebuild while another build holds it",
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_LOCK_TTL", "S3_CACHE_LOCK_TTL"},
+			FilePath: "/vela/parameters/s3-cache/lock_ttl,/vela/secrets/s3-cache/lock_ttl",
+			Name:     "rebuild.lock_ttl",
+			Usage:    "time after which a lock left behind by an interrupted rebuild is taken over",
+			Value:    30 * time.Minute,
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_LOCK_WAIT", "S3_CACHE_LOCK_WAIT"},
+			FilePath: "/vela/parameters/s3-cache/lock_wait,/vela/secrets/s3-cache/lock_wait",
+			Name:     "rebuild.lock_wait",
+			Usage:    "time to wait for the lock held by another build before skipping the rebuild",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_MANIFEST", "S3_CACHE_MANIFEST"},
+			FilePath: "/vela/parameters/s3-cache/manifest,/vela/secrets/s3-cache/manifest",
+			Name:     "rebuild.manifest",
+			Usage:    "whether to skip the rebuild when the path, size and modification time of every file in the mounts is unchanged",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_PIN", "S3_CACHE_PIN"},
+			FilePath: "/vela/parameters/s3-cache/pin,/vela/secrets/s3-cache/pin",
+			Name:     "rebuild.pin",
+			Usage:    "whether to tag the cache file as pinned, so the flush action keeps it regardless of age",
+		},
 		&cli.BoolFlag{
 			EnvVars:  []string{"PARAMETER_PRESERVE_PATH", "S3_PRESERVE_PATH"},
 			FilePath: "/vela/parameters/s3-cache/preserve_path,/vela/secrets/s3-cache/preserve_path",
@@ -129,6 +516,131 @@ func main() {
 			Value:    false,
 			Usage:    "whether to preserve the relative directory structure during the tar process",
 		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_TTL", "S3_CACHE_TTL"},
+			FilePath: "/vela/parameters/s3-cache/ttl,/vela/secrets/s3-cache/ttl",
+			Name:     "rebuild.ttl",
+			Usage:    "time to live recorded on the cache object for lifecycle rules and flush",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_TTL_EXPIRES_HEADER", "S3_CACHE_TTL_EXPIRES_HEADER"},
+			FilePath: "/vela/parameters/s3-cache/ttl_expires_header,/vela/secrets/s3-cache/ttl_expires_header",
+			Name:     "rebuild.ttl_expires_header",
+			Usage:    "whether to set the Expires header on the cache object when a ttl is provided",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_COMPRESSION_LEVEL", "S3_CACHE_COMPRESSION_LEVEL"},
+			FilePath: "/vela/parameters/s3-cache/compression_level,/vela/secrets/s3-cache/compression_level",
+			Name:     "rebuild.compression_level",
+			Usage:    "gzip compression level of the archive (0-9), or auto to select a level from the cpus, size and compressibility of the mounts",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_MEMORY_LIMIT", "S3_CACHE_MEMORY_LIMIT"},
+			FilePath: "/vela/parameters/s3-cache/memory_limit,/vela/secrets/s3-cache/memory_limit",
+			Name:     "rebuild.memory_limit",
+			Usage:    "soft memory limit while building the archive (i.e. 512MB)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SPLIT_SIZE", "S3_CACHE_SPLIT_SIZE"},
+			FilePath: "/vela/parameters/s3-cache/split_size,/vela/secrets/s3-cache/split_size",
+			Name:     "rebuild.split_size",
+			Usage:    "split archives larger than the size into part objects of the size with an index object (i.e. 5GB)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WARN_SIZE", "S3_CACHE_WARN_SIZE"},
+			FilePath: "/vela/parameters/s3-cache/warn_size,/vela/secrets/s3-cache/warn_size",
+			Name:     "rebuild.warn_size",
+			Usage:    "log a warning with the largest directories when the archive exceeds the size (i.e. 2GB)",
+		},
+
+		// Restore Flags
+
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_ALLOWED_TYPES", "S3_CACHE_ALLOWED_TYPES"},
+			FilePath: "/vela/parameters/s3-cache/allowed_types,/vela/secrets/s3-cache/allowed_types",
+			Name:     "restore.allowed_types",
+			Usage:    "tar entry types to extract (file, dir, symlink, hardlink, char, block or fifo), skipping any other entries",
+			Value:    cli.NewStringSlice(defaultEntryTypes...),
+		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_DOWNLOAD_CONCURRENCY", "S3_CACHE_DOWNLOAD_CONCURRENCY"},
+			FilePath: "/vela/parameters/s3-cache/download_concurrency,/vela/secrets/s3-cache/download_concurrency",
+			Name:     "restore.download_concurrency",
+			Usage:    "number of concurrent ranged requests used to download cache files above the parallel threshold",
+			Value:    4,
+		},
+		&cli.Float64Flag{
+			EnvVars:  []string{"PARAMETER_MAX_RATIO", "S3_CACHE_MAX_RATIO"},
+			FilePath: "/vela/parameters/s3-cache/max_ratio,/vela/secrets/s3-cache/max_ratio",
+			Name:     "restore.max_ratio",
+			Usage:    "maximum ratio of extracted to compressed bytes before aborting the extraction (0 disables)",
+			Value:    100,
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_NON_ROOT", "S3_CACHE_NON_ROOT"},
+			FilePath: "/vela/parameters/s3-cache/non_root,/vela/secrets/s3-cache/non_root",
+			Name:     "restore.non_root",
+			Usage:    "whether to skip device nodes and entries that can not be extracted as an unprivileged user instead of failing",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_PARALLEL_THRESHOLD", "S3_CACHE_PARALLEL_THRESHOLD"},
+			FilePath: "/vela/parameters/s3-cache/parallel_threshold,/vela/secrets/s3-cache/parallel_threshold",
+			Name:     "restore.parallel_threshold",
+			Usage:    "download cache files of at least the size with concurrent ranged requests (i.e. 1GB), 0 disables",
+			Value:    "1GB",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_PRESERVE_MODE_BITS", "S3_CACHE_PRESERVE_MODE_BITS"},
+			FilePath: "/vela/parameters/s3-cache/preserve_mode_bits,/vela/secrets/s3-cache/preserve_mode_bits",
+			Name:     "restore.preserve_mode_bits",
+			Usage:    "whether to keep the setuid, setgid and sticky bits of the extracted files",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_SKIP_UNCHANGED", "S3_CACHE_SKIP_UNCHANGED"},
+			FilePath: "/vela/parameters/s3-cache/skip_unchanged,/vela/secrets/s3-cache/skip_unchanged",
+			Name:     "restore.skip_unchanged",
+			Usage:    "whether to skip the download when the cache file is unchanged since it was last restored into the workspace",
+		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_ID_MAP", "S3_CACHE_ID_MAP"},
+			FilePath: "/vela/parameters/s3-cache/id_map,/vela/secrets/s3-cache/id_map",
+			Name:     "restore.id_map",
+			Usage:    "user and group ids recorded in the archive to map to the owners of extracted files, in the from:to format (i.e. 0:1001)",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_STDOUT", "S3_CACHE_STDOUT"},
+			FilePath: "/vela/parameters/s3-cache/stdout,/vela/secrets/s3-cache/stdout",
+			Name:     "restore.stdout",
+			Usage:    "whether to write the uncompressed tar stream of the cache file to stdout instead of extracting it",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_STDOUT_ENTRY", "S3_CACHE_STDOUT_ENTRY"},
+			FilePath: "/vela/parameters/s3-cache/stdout_entry,/vela/secrets/s3-cache/stdout_entry",
+			Name:     "restore.stdout_entry",
+			Usage:    "path of the file in the cache file to write to stdout instead of the tar stream",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_PRESERVE_MTIMES", "S3_CACHE_PRESERVE_MTIMES"},
+			FilePath: "/vela/parameters/s3-cache/preserve_mtimes,/vela/secrets/s3-cache/preserve_mtimes",
+			Name:     "restore.preserve_mtimes",
+			Usage:    "whether to keep the modification time recorded in the cache file for extracted files instead of the time of the restore",
+		},
+
+		// Stats Flags
+
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_STATS", "S3_CACHE_STATS"},
+			FilePath: "/vela/parameters/s3-cache/stats,/vela/secrets/s3-cache/stats",
+			Name:     "stats.enabled",
+			Usage:    "whether to count the restores, misses and rebuilds of the cache file in a stats object next to it",
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_UNUSED_AFTER", "S3_CACHE_UNUSED_AFTER"},
+			FilePath: "/vela/parameters/s3-cache/unused_after,/vela/secrets/s3-cache/unused_after",
+			Name:     "stats.unused_after",
+			Usage:    "time without a restore after which the stats action reports a cache file as unused",
+			Value:    30 * 24 * time.Hour,
+		},
 
 		// S3 Flags
 
@@ -138,6 +650,25 @@ func main() {
 			Name:     "config.server",
 			Usage:    "s3 server to store the cache",
 		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_FAILOVER_SERVERS", "S3_CACHE_FAILOVER_SERVERS"},
+			FilePath: "/vela/parameters/s3-cache/failover_servers,/vela/secrets/s3-cache/failover_servers",
+			Name:     "config.failover_servers",
+			Usage:    "ordered list of s3 servers to retry requests against when the server can't be reached or fails with a server error",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_DRIVER", "S3_CACHE_DRIVER"},
+			FilePath: "/vela/parameters/s3-cache/driver,/vela/secrets/s3-cache/driver",
+			Name:     "config.driver",
+			Usage:    "client used to communicate with s3 (minio or aws)",
+			Value:    minioDriver,
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_PROVIDER", "S3_CACHE_PROVIDER"},
+			FilePath: "/vela/parameters/s3-cache/provider,/vela/secrets/s3-cache/provider",
+			Name:     "config.provider",
+			Usage:    "s3 compatible store to adjust to (r2, b2 or gcs-interop)",
+		},
 		&cli.StringFlag{
 			EnvVars:  []string{"PARAMETER_ACCELERATED_ENDPOINT", "CACHE_S3_ACCELERATED_ENDPOINT", "S3_CACHE_ACCELERATED_ENDPOINT"},
 			FilePath: "/vela/parameters/s3-cache/accelerated_endpoint,/vela/secrets/s3-cache/accelerated_endpoint",
@@ -162,11 +693,219 @@ func main() {
 			Name:     "config.session_token",
 			Usage:    "s3 session token",
 		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_READ_ACCESS_KEY", "S3_CACHE_READ_ACCESS_KEY"},
+			FilePath: "/vela/parameters/s3-cache/read_access_key,/vela/secrets/s3-cache/read_access_key",
+			Name:     "config.read_access_key",
+			Usage:    "s3 access key used instead of the access key for the restore action",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_READ_SECRET_KEY", "S3_CACHE_READ_SECRET_KEY"},
+			FilePath: "/vela/parameters/s3-cache/read_secret_key,/vela/secrets/s3-cache/read_secret_key",
+			Name:     "config.read_secret_key",
+			Usage:    "s3 secret key used instead of the secret key for the restore action",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_READ_SESSION_TOKEN", "S3_CACHE_READ_SESSION_TOKEN"},
+			FilePath: "/vela/parameters/s3-cache/read_session_token,/vela/secrets/s3-cache/read_session_token",
+			Name:     "config.read_session_token",
+			Usage:    "s3 session token used instead of the session token for the restore action",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WRITE_ACCESS_KEY", "S3_CACHE_WRITE_ACCESS_KEY"},
+			FilePath: "/vela/parameters/s3-cache/write_access_key,/vela/secrets/s3-cache/write_access_key",
+			Name:     "config.write_access_key",
+			Usage:    "s3 access key used instead of the access key for the actions writing to the bucket",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WRITE_SECRET_KEY", "S3_CACHE_WRITE_SECRET_KEY"},
+			FilePath: "/vela/parameters/s3-cache/write_secret_key,/vela/secrets/s3-cache/write_secret_key",
+			Name:     "config.write_secret_key",
+			Usage:    "s3 secret key used instead of the secret key for the actions writing to the bucket",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WRITE_SESSION_TOKEN", "S3_CACHE_WRITE_SESSION_TOKEN"},
+			FilePath: "/vela/parameters/s3-cache/write_session_token,/vela/secrets/s3-cache/write_session_token",
+			Name:     "config.write_session_token",
+			Usage:    "s3 session token used instead of the session token for the actions writing to the bucket",
+		},
 		&cli.StringFlag{
 			EnvVars:  []string{"PARAMETER_REGION", "CACHE_S3_REGION", "S3_CACHE_REGION"},
 			FilePath: "/vela/parameters/s3-cache/region,/vela/secrets/s3-cache/region",
 			Name:     "config.region",
-			Usage:    "s3 region for the region of the bucket",
+			Usage:    "s3 region of the bucket, discovered from the bucket when not provided",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_TRACE_HTTP", "S3_CACHE_TRACE_HTTP"},
+			FilePath: "/vela/parameters/s3-cache/trace_http,/vela/secrets/s3-cache/trace_http",
+			Name:     "config.trace_http",
+			Usage:    "whether to log the method, url, status, request id and latency of every s3 request",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_REQUIRE_IMDSV2", "S3_CACHE_REQUIRE_IMDSV2"},
+			FilePath: "/vela/parameters/s3-cache/require_imdsv2,/vela/secrets/s3-cache/require_imdsv2",
+			Name:     "config.require_imdsv2",
+			Usage:    "whether to require IMDSv2 session tokens when retrieving IAM credentials",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_IMDS_ENDPOINT", "S3_CACHE_IMDS_ENDPOINT"},
+			FilePath: "/vela/parameters/s3-cache/imds_endpoint,/vela/secrets/s3-cache/imds_endpoint",
+			Name:     "config.imds_endpoint",
+			Usage:    "endpoint of the instance metadata service for IAM credentials",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_ROLE_ARN", "S3_CACHE_ROLE_ARN"},
+			FilePath: "/vela/parameters/s3-cache/role_arn,/vela/secrets/s3-cache/role_arn",
+			Name:     "config.role_arn",
+			Usage:    "role to assume with the Vela OIDC ID token instead of using an access key",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_BUCKET_ROLES", "S3_CACHE_BUCKET_ROLES"},
+			FilePath: "/vela/parameters/s3-cache/bucket_roles,/vela/secrets/s3-cache/bucket_roles",
+			Name:     "config.bucket_roles",
+			Usage:    "JSON or YAML map of buckets to the role to assume for them with the Vela OIDC ID token",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_STS_ENDPOINT", "S3_CACHE_STS_ENDPOINT"},
+			FilePath: "/vela/parameters/s3-cache/sts_endpoint,/vela/secrets/s3-cache/sts_endpoint",
+			Name:     "config.sts_endpoint",
+			Usage:    "STS endpoint to exchange the Vela OIDC ID token with (defaults to AWS STS)",
+		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_ID_TOKEN_AUDIENCE", "S3_CACHE_ID_TOKEN_AUDIENCE"},
+			FilePath: "/vela/parameters/s3-cache/id_token_audience,/vela/secrets/s3-cache/id_token_audience",
+			Name:     "config.id_token_audience",
+			Usage:    "audiences to request the Vela OIDC ID token for",
+			Value:    cli.NewStringSlice(defaultIDTokenAudience),
+		},
+		&cli.StringFlag{
+			EnvVars: []string{"VELA_ID_TOKEN_REQUEST_URL"},
+			Name:    "config.id_token_request_url",
+			Usage:   "URL to request the Vela OIDC ID token from, provided by the worker when id_request is set",
+		},
+		&cli.StringFlag{
+			EnvVars: []string{"VELA_ID_TOKEN_REQUEST_TOKEN"},
+			Name:    "config.id_token_request_token",
+			Usage:   "token to request the Vela OIDC ID token with, provided by the worker when id_request is set",
+		},
+		&cli.BoolFlag{
+			EnvVars:  []string{"PARAMETER_LOG_REQUEST_IDS", "S3_CACHE_LOG_REQUEST_IDS"},
+			FilePath: "/vela/parameters/s3-cache/log_request_ids,/vela/secrets/s3-cache/log_request_ids",
+			Name:     "config.log_request_ids",
+			Usage:    "whether to log the request id and host id of every s3 response",
+		},
+		&cli.StringSliceFlag{
+			EnvVars: []string{"S3_CACHE_DENY_LIST"},
+			Name:    "config.deny_list",
+			Usage:   "buckets, or buckets followed by a key prefix, forbidden as a cache target (set by the platform admins)",
+		},
+		&cli.StringFlag{
+			EnvVars: []string{"S3_CACHE_ROUTES"},
+			Name:    "config.routes",
+			Usage:   "JSON or YAML array of rules routing the caches of org/repo patterns to a bucket, server and region (set by the platform admins)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SSE", "S3_CACHE_SSE"},
+			FilePath: "/vela/parameters/s3-cache/sse,/vela/secrets/s3-cache/sse",
+			Name:     "config.sse",
+			Usage:    "server-side encryption to upload the cache objects with (sse-s3, sse-kms or sse-c)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SSE_KMS_KEY_ID", "S3_CACHE_SSE_KMS_KEY_ID"},
+			FilePath: "/vela/parameters/s3-cache/sse_kms_key_id,/vela/secrets/s3-cache/sse_kms_key_id",
+			Name:     "config.sse_kms_key_id",
+			Usage:    "id of the KMS key for sse-kms, using the default key of the account when not set",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_SSE_CUSTOMER_KEY", "S3_CACHE_SSE_CUSTOMER_KEY"},
+			FilePath: "/vela/parameters/s3-cache/sse_customer_key,/vela/secrets/s3-cache/sse_customer_key",
+			Name:     "config.sse_customer_key",
+			Usage:    "base64 encoded 256-bit key for sse-c, which is required to restore the cache objects",
+		},
+		&cli.BoolFlag{
+			EnvVars: []string{"S3_CACHE_REQUIRE_SSE"},
+			Name:    "config.require_sse",
+			Usage:   "whether to refuse to run without server-side encryption for every upload (set by the platform admins)",
+		},
+
+		// Outputs Flags
+
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_OUTPUTS", "S3_CACHE_OUTPUTS", "VELA_OUTPUTS"},
+			FilePath: "/vela/parameters/s3-cache/outputs,/vela/secrets/s3-cache/outputs",
+			Name:     "outputs.path",
+			Usage:    "file to write the summary of the action to as Vela outputs",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_MASKED_OUTPUTS", "S3_CACHE_MASKED_OUTPUTS", "VELA_MASKED_OUTPUTS"},
+			FilePath: "/vela/parameters/s3-cache/masked_outputs,/vela/secrets/s3-cache/masked_outputs",
+			Name:     "outputs.masked_path",
+			Usage:    "file to write the masked outputs to as Vela masked outputs",
+		},
+		&cli.StringSliceFlag{
+			EnvVars:  []string{"PARAMETER_MASK_OUTPUTS", "S3_CACHE_MASK_OUTPUTS"},
+			FilePath: "/vela/parameters/s3-cache/mask_outputs,/vela/secrets/s3-cache/mask_outputs",
+			Name:     "outputs.mask",
+			Usage:    "names of the outputs (i.e. S3_CACHE_KEY) to write to the masked outputs file instead",
+		},
+
+		// Metrics Flags
+
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_METRICS_STATSD_ADDRESS", "S3_CACHE_METRICS_STATSD_ADDRESS"},
+			FilePath: "/vela/parameters/s3-cache/metrics_statsd_address,/vela/secrets/s3-cache/metrics_statsd_address",
+			Name:     "metrics.statsd_address",
+			Usage:    "address of a StatsD server to emit metrics to (i.e. localhost:8125)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_METRICS_PUSHGATEWAY_URL", "S3_CACHE_METRICS_PUSHGATEWAY_URL"},
+			FilePath: "/vela/parameters/s3-cache/metrics_pushgateway_url,/vela/secrets/s3-cache/metrics_pushgateway_url",
+			Name:     "metrics.pushgateway_url",
+			Usage:    "url of a Prometheus Pushgateway to emit metrics to",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_METRICS_TEXTFILE_DIR", "S3_CACHE_METRICS_TEXTFILE_DIR"},
+			FilePath: "/vela/parameters/s3-cache/metrics_textfile_dir,/vela/secrets/s3-cache/metrics_textfile_dir",
+			Name:     "metrics.textfile_dir",
+			Usage:    "directory of the node exporter textfile collector to write metrics to",
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_METRICS_TIMEOUT", "S3_CACHE_METRICS_TIMEOUT"},
+			FilePath: "/vela/parameters/s3-cache/metrics_timeout,/vela/secrets/s3-cache/metrics_timeout",
+			Name:     "metrics.timeout",
+			Usage:    "timeout for emitting metrics",
+			Value:    10 * time.Second,
+		},
+
+		// Webhook Flags
+
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WEBHOOK_URL", "S3_CACHE_WEBHOOK_URL"},
+			FilePath: "/vela/parameters/s3-cache/webhook_url,/vela/secrets/s3-cache/webhook_url",
+			Name:     "webhook.url",
+			Usage:    "url to post the result of each action to as JSON",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_WEBHOOK_SECRET", "S3_CACHE_WEBHOOK_SECRET"},
+			FilePath: "/vela/parameters/s3-cache/webhook_secret,/vela/secrets/s3-cache/webhook_secret",
+			Name:     "webhook.secret",
+			Usage:    "secret to sign the webhook payload with as an HMAC-SHA256 signature",
+		},
+		&cli.DurationFlag{
+			EnvVars:  []string{"PARAMETER_WEBHOOK_TIMEOUT", "S3_CACHE_WEBHOOK_TIMEOUT"},
+			FilePath: "/vela/parameters/s3-cache/webhook_timeout,/vela/secrets/s3-cache/webhook_timeout",
+			Name:     "webhook.timeout",
+			Usage:    "timeout for sending the result to the webhook",
+			Value:    10 * time.Second,
+		},
+
+		// Audit Flags
+
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_AUDIT_LOG", "S3_CACHE_AUDIT_LOG"},
+			FilePath: "/vela/parameters/s3-cache/audit_log,/vela/secrets/s3-cache/audit_log",
+			Name:     "audit.path",
+			Usage:    "file, or stdout or stderr, to append a JSON record of every upload and delete to",
 		},
 
 		// Build information (for setting defaults)
@@ -196,18 +935,75 @@ func main() {
 			Usage:    "git build branch",
 			Value:    "main",
 		},
+		&cli.IntFlag{
+			EnvVars:  []string{"PARAMETER_BUILD_NUMBER", "VELA_BUILD_NUMBER"},
+			FilePath: "/vela/parameters/s3-cache/build_number,/vela/secrets/s3-cache/build_number",
+			Name:     "build.number",
+			Usage:    "build number",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_BUILD_AUTHOR", "VELA_BUILD_AUTHOR"},
+			FilePath: "/vela/parameters/s3-cache/build_author,/vela/secrets/s3-cache/build_author",
+			Name:     "build.author",
+			Usage:    "author of the build",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_BUILD_COMMIT", "VELA_BUILD_COMMIT"},
+			FilePath: "/vela/parameters/s3-cache/build_commit,/vela/secrets/s3-cache/build_commit",
+			Name:     "build.commit",
+			Usage:    "git commit sha for the build",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_BUILD_EVENT", "VELA_BUILD_EVENT"},
+			FilePath: "/vela/parameters/s3-cache/build_event,/vela/secrets/s3-cache/build_event",
+			Name:     "build.event",
+			Usage:    "event that triggered the build (i.e. push or pull_request)",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_DISTRIBUTION", "VELA_DISTRIBUTION"},
+			FilePath: "/vela/parameters/s3-cache/distribution,/vela/secrets/s3-cache/distribution",
+			Name:     "build.distribution",
+			Usage:    "distribution of the worker running the build",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_BUILD_LINK", "VELA_BUILD_LINK"},
+			FilePath: "/vela/parameters/s3-cache/build_link,/vela/secrets/s3-cache/build_link",
+			Name:     "build.link",
+			Usage:    "link to the build in the Vela UI",
+		},
+		&cli.StringFlag{
+			EnvVars:  []string{"PARAMETER_PIPELINE", "S3_CACHE_PIPELINE"},
+			FilePath: "/vela/parameters/s3-cache/pipeline,/vela/secrets/s3-cache/pipeline",
+			Name:     "build.pipeline",
+			Usage:    "name of the pipeline recorded with the cache",
+		},
 	}
 
-	err = app.Run(os.Args)
+	// cancel the action when the build is cancelled or times out
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+
+	err := app.RunContext(ctx, os.Args)
+
+	stop()
+
 	if err != nil {
 		logrus.Fatal(err)
 	}
 }
 
-// run executes the plugin based off the configuration provided.
-func run(c *cli.Context) error {
-	// set the log level for the plugin
-	switch c.String("log.level") {
+// parseSize is a helper function to parse a human
+// readable size into bytes. An empty size is zero.
+func parseSize(size string) (uint64, error) {
+	if len(size) == 0 {
+		return 0, nil
+	}
+
+	return humanize.ParseBytes(size)
+}
+
+// setLogLevel is a helper function to set the log level for the plugin.
+func setLogLevel(level string) {
+	switch level {
 	case "t", "trace", "Trace", "TRACE":
 		logrus.SetLevel(logrus.TraceLevel)
 	case "d", "debug", "Debug", "DEBUG":
@@ -225,6 +1021,60 @@ func run(c *cli.Context) error {
 	default:
 		logrus.SetLevel(logrus.InfoLevel)
 	}
+}
+
+// run executes the plugin based off the configuration provided.
+func run(c *cli.Context) error {
+	banner := c.String("version_banner")
+
+	// keep stdout for the contents of the cache
+	if c.Bool("restore.stdout") && (len(banner) == 0 || banner == "stdout") {
+		banner = "stderr"
+	}
+
+	// output the version information, unless suppressed
+	w, err := bannerWriter(banner)
+	if err != nil {
+		return err
+	}
+
+	err = printVersion(w)
+	if err != nil {
+		return err
+	}
+
+	// skip the action when caching is disabled, i.e. during an s3 incident
+	if c.Bool("disabled") {
+		logrus.Warnf("s3 cache plugin disabled, skipping %s action", c.String("config.action"))
+
+		return nil
+	}
+
+	// set the log level from the environment,
+	// so the config file is logged at debug level
+	setLogLevel(c.String("log.level"))
+
+	// load the parameters from the config file
+	err = loadConfigFile(c)
+	if err != nil {
+		return err
+	}
+
+	// route the caches of the repository as configured by the platform admins
+	route, err := applyRoutes(c)
+	if err != nil {
+		return err
+	}
+
+	// apply the parameters locked by the platform admins
+	err = applyLockedParameters(c)
+	if err != nil {
+		return err
+	}
+
+	// set the log level for the plugin, as changed by the
+	// config file, routes or locked parameters
+	setLogLevel(c.String("log.level"))
 
 	logrus.WithFields(logrus.Fields{
 		"code":     "https://github.com/go-vela/vela-s3-cache",
@@ -232,42 +1082,313 @@ func run(c *cli.Context) error {
 		"registry": "https://hub.docker.com/r/target/vela-s3-cache",
 	}).Info("Vela S3 Cache Plugin")
 
+	// change into the working directory for the cache
+	err = changeWorkdir(c.String("workdir"))
+	if err != nil {
+		return err
+	}
+
+	// parse the size budget for the flush
+	maxTotalSize, err := parseSize(c.String("flush.max_total_size"))
+	if err != nil {
+		return fmt.Errorf("invalid max total size: %w", err)
+	}
+
+	// parse the size threshold for the rebuild warning
+	warnSize, err := parseSize(c.String("rebuild.warn_size"))
+	if err != nil {
+		return fmt.Errorf("invalid warn size: %w", err)
+	}
+
+	// parse the size to split the archive at
+	splitSize, err := parseSize(c.String("rebuild.split_size"))
+	if err != nil {
+		return fmt.Errorf("invalid split size: %w", err)
+	}
+
+	// parse the bytes per second to limit transfers to
+	maxBandwidth, err := parseSize(c.String("max_bandwidth"))
+	if err != nil {
+		return fmt.Errorf("invalid max bandwidth: %w", err)
+	}
+
+	// parse the soft memory limit for the rebuild
+	memoryLimit, err := parseSize(c.String("rebuild.memory_limit"))
+	if err != nil {
+		return fmt.Errorf("invalid memory limit: %w", err)
+	}
+
+	// parse the size threshold for parallel downloads
+	parallelThreshold, err := parseSize(c.String("restore.parallel_threshold"))
+	if err != nil {
+		return fmt.Errorf("invalid parallel threshold: %w", err)
+	}
+
+	// parse the key for encrypting the archives
+	encryptionKey, err := parseEncryptionKey(c.String("encryption_key"))
+	if err != nil {
+		return fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	// parse the key for the server-side encryption with sse-c
+	sseCustomerKey, err := parseEncryptionKey(c.String("config.sse_customer_key"))
+	if err != nil {
+		return fmt.Errorf("invalid sse customer key: %w", err)
+	}
+
+	// parse the TLS restrictions for the connections to s3
+	minTLSVersion, err := parseTLSVersion(c.String("config.min_tls_version"))
+	if err != nil {
+		return fmt.Errorf("invalid min tls version: %w", err)
+	}
+
+	cipherSuites, err := parseCipherSuites(c.StringSlice("config.tls_cipher_suites"))
+	if err != nil {
+		return fmt.Errorf("invalid tls cipher suites: %w", err)
+	}
+
+	filename := c.String("filename")
+
+	// default to the filename of drone-s3-cache
+	if c.Bool("drone_compat") && !c.IsSet("filename") {
+		filename = droneFilename
+	}
+
+	// parse the cache definitions
+	caches, err := parseCaches(c.String("caches"))
+	if err != nil {
+		return fmt.Errorf("invalid caches: %w", err)
+	}
+
+	// keep the caches in the bucket locked or routed by the platform
+	for i, cache := range caches {
+		if len(cache.Bucket) == 0 {
+			continue
+		}
+
+		if isLocked("bucket") {
+			return fmt.Errorf("invalid caches: cache %d: bucket is locked by the platform", i+1)
+		}
+
+		if route != nil {
+			return fmt.Errorf("invalid caches: cache %d: bucket is routed by the platform with route %s", i+1, route.Repo)
+		}
+	}
+
+	// parse the roles to assume for the buckets
+	bucketRoles, err := parseBucketRoles(c.String("config.bucket_roles"))
+	if err != nil {
+		return fmt.Errorf("invalid bucket roles: %w", err)
+	}
+
 	// create the plugin
 	p := &Plugin{
 		// config configuration
 		Config: &Config{
 			Action:              c.String("config.action"),
+			Driver:              c.String("config.driver"),
+			Provider:            c.String("config.provider"),
 			Server:              c.String("config.server"),
+			FailoverServers:     c.StringSlice("config.failover_servers"),
+			DenyList:            c.StringSlice("config.deny_list"),
 			AcceleratedEndpoint: c.String("config.accelerated_endpoint"),
+			Bucket:              c.String("bucket"),
 			AccessKey:           c.String("config.access_key"),
 			SecretKey:           c.String("config.secret_key"),
 			SessionToken:        c.String("config.session_token"),
+			ReadAccessKey:       c.String("config.read_access_key"),
+			ReadSecretKey:       c.String("config.read_secret_key"),
+			ReadSessionToken:    c.String("config.read_session_token"),
+			WriteAccessKey:      c.String("config.write_access_key"),
+			WriteSecretKey:      c.String("config.write_secret_key"),
+			WriteSessionToken:   c.String("config.write_session_token"),
+			PresignPut:          c.Bool("presign.put"),
 			Region:              c.String("config.region"),
+			TraceHTTP:           c.Bool("config.trace_http"),
+			LogRequestIDs:       c.Bool("config.log_request_ids"),
+			RequireIMDSv2:       c.Bool("config.require_imdsv2"),
+			IMDSEndpoint:        c.String("config.imds_endpoint"),
+			RoleARN:             c.String("config.role_arn"),
+			BucketRoles:         bucketRoles,
+			STSEndpoint:         c.String("config.sts_endpoint"),
+			IDTokenAudience:     c.StringSlice("config.id_token_audience"),
+			IDTokenRequestURL:   c.String("config.id_token_request_url"),
+			IDTokenRequestToken: c.String("config.id_token_request_token"),
+			DryRun:              c.Bool("dry_run"),
+			ConnectTimeout:      c.Duration("config.connect_timeout"),
+			MinTLSVersion:       minTLSVersion,
+			CipherSuites:        cipherSuites,
+			RequireSSE:          c.Bool("config.require_sse"),
+			FIPS:                c.Bool("config.fips"),
+			Encryption: storage.Encryption{
+				Mode:        c.String("config.sse"),
+				KMSKeyID:    c.String("config.sse_kms_key_id"),
+				CustomerKey: sseCustomerKey,
+			},
+		},
+		// abort configuration
+		Abort: &Abort{
+			Bucket:  c.String("bucket"),
+			Path:    c.String("path"),
+			Prefix:  c.String("prefix"),
+			Age:     c.Duration("abort.age"),
+			Timeout: c.Duration("timeout"),
+			DryRun:  c.Bool("dry_run"),
+		},
+		// benchmark configuration
+		Benchmark: &Benchmark{
+			Mount:        c.StringSlice("rebuild.mount"),
+			Levels:       c.StringSlice("benchmark.levels"),
+			PreservePath: c.Bool("rebuild.preserve_path"),
+			TmpDir:       c.String("tmp_dir"),
+		},
+		// check configuration
+		Check: &Check{
+			Bucket:  c.String("bucket"),
+			Timeout: c.Duration("timeout"),
+			Path:    c.String("path"),
+			Prefix:  c.String("prefix"),
 		},
 		// flush configuration
 		Flush: &Flush{
-			Bucket: c.String("bucket"),
-			Age:    c.Duration("flush.age"),
-			Path:   c.String("path"),
-			Prefix: c.String("prefix"),
-		},
-		// rebuild configuration
-		Rebuild: &Rebuild{
 			Bucket:       c.String("bucket"),
-			Filename:     c.String("filename"),
+			Age:          c.Duration("flush.age"),
 			Timeout:      c.Duration("timeout"),
-			Mount:        c.StringSlice("rebuild.mount"),
+			Pattern:      c.StringSlice("flush.pattern"),
+			Keep:         c.Int("flush.keep"),
+			MaxTotalSize: maxTotalSize,
+			Workers:      c.Int("flush.workers"),
+			MaxKeys:      c.Int("flush.max_keys"),
+			StartAfter:   c.String("flush.start_after"),
+			NonRecursive: !c.Bool("flush.recursive"),
+			SkipExpiry:   c.Bool("flush.skip_expiry"),
+			Branches:     c.StringSlice("flush.branches"),
+			BranchesFile: c.String("flush.branches_file"),
+			Versions:     c.Bool("flush.versions"),
+			Inventory:    c.String("flush.inventory"),
+			Report:       c.String("flush.report"),
 			Path:         c.String("path"),
 			Prefix:       c.String("prefix"),
-			PreservePath: c.Bool("rebuild.preserve_path"),
+			DryRun:       c.Bool("dry_run"),
 		},
-		// restore configuration
-		Restore: &Restore{
+		// lifecycle configuration
+		Lifecycle: &Lifecycle{
+			Bucket:              c.String("bucket"),
+			Prefix:              c.String("prefix"),
+			Timeout:             c.Duration("timeout"),
+			ExpireDays:          c.Int("lifecycle.expire_days"),
+			AbortIncompleteDays: c.Int("lifecycle.abort_incomplete_days"),
+			RuleID:              c.String("lifecycle.rule_id"),
+			AllowBucketWide:     c.Bool("lifecycle.allow_bucket_wide"),
+			DryRun:              c.Bool("dry_run"),
+		},
+		// list configuration
+		List: &List{
+			Bucket:  c.String("bucket"),
+			Path:    c.String("path"),
+			Prefix:  c.String("prefix"),
+			Timeout: c.Duration("timeout"),
+			Sort:    c.String("list.sort"),
+			Limit:   c.Int("list.limit"),
+		},
+		// pin configuration
+		Pin: &Pin{
 			Bucket:   c.String("bucket"),
-			Filename: c.String("filename"),
+			Filename: filename,
+			Path:     c.String("path"),
+			Prefix:   c.String("prefix"),
 			Timeout:  c.Duration("timeout"),
+			Unpin:    c.Bool("pin.unpin"),
+		},
+		// presign configuration
+		Presign: &Presign{
+			Bucket:   c.String("bucket"),
+			Filename: filename,
 			Path:     c.String("path"),
 			Prefix:   c.String("prefix"),
+			Expiry:   c.Duration("presign.expiry"),
+			Put:      c.Bool("presign.put"),
+			Timeout:  c.Duration("timeout"),
+		},
+		// rebuild configuration
+		Rebuild: &Rebuild{
+			Bucket:           c.String("bucket"),
+			Filename:         filename,
+			Timeout:          c.Duration("timeout"),
+			TimeoutPerGB:     c.Duration("timeout_per_gb"),
+			Mount:            c.StringSlice("rebuild.mount"),
+			TmpDir:           c.String("tmp_dir"),
+			Path:             c.String("path"),
+			Prefix:           c.String("prefix"),
+			PreservePath:     c.Bool("rebuild.preserve_path"),
+			TTL:              c.Duration("rebuild.ttl"),
+			ListEntries:      c.Int("list_entries"),
+			ExpiresHeader:    c.Bool("rebuild.ttl_expires_header"),
+			ProgressInterval: c.Duration("progress_interval"),
+			WarnSize:         warnSize,
+			CompressionLevel: c.String("rebuild.compression_level"),
+			MemoryLimit:      memoryLimit,
+			MaxBandwidth:     maxBandwidth,
+			DroneCompat:      c.Bool("drone_compat"),
+			EncryptionKey:    encryptionKey,
+			SigningKey:       []byte(c.String("signing_key")),
+			DryRun:           c.Bool("dry_run"),
+			Append:           c.Bool("rebuild.append"),
+			SplitSize:        splitSize,
+			Symlinks:         c.String("symlinks"),
+			SymlinkDepth:     c.Int("symlink_depth"),
+			NormalizeModes:   c.Bool("rebuild.normalize_modes"),
+			RetentionMode:    c.String("rebuild.retention_mode"),
+			RetainUntil:      c.String("rebuild.retain_until"),
+			LegalHold:        c.Bool("rebuild.legal_hold"),
+			SkipJunk:         c.Bool("rebuild.skip_junk"),
+			MountSymlinks:    c.String("rebuild.mount_symlinks"),
+			AtomicPublish:    c.Bool("rebuild.atomic_publish"),
+			FromStdin:        c.Bool("rebuild.from_stdin"),
+			Lock:             c.Bool("rebuild.lock"),
+			LockTTL:          c.Duration("rebuild.lock_ttl"),
+			LockWait:         c.Duration("rebuild.lock_wait"),
+			Manifest:         c.Bool("rebuild.manifest"),
+			Pin:              c.Bool("rebuild.pin"),
+		},
+		// restore configuration
+		Restore: &Restore{
+			Bucket:            c.String("bucket"),
+			Filename:          filename,
+			Timeout:           c.Duration("timeout"),
+			TimeoutPerGB:      c.Duration("timeout_per_gb"),
+			Path:              c.String("path"),
+			Prefix:            c.String("prefix"),
+			ListEntries:       c.Int("list_entries"),
+			ProgressInterval:  c.Duration("progress_interval"),
+			TmpDir:            c.String("tmp_dir"),
+			PreserveModeBits:  c.Bool("restore.preserve_mode_bits"),
+			MaxRatio:          c.Float64("restore.max_ratio"),
+			NonRoot:           c.Bool("restore.non_root"),
+			AllowedTypes:      c.StringSlice("restore.allowed_types"),
+			ParallelThreshold: parallelThreshold,
+			Concurrency:       c.Int("restore.download_concurrency"),
+			MaxBandwidth:      maxBandwidth,
+			DroneCompat:       c.Bool("drone_compat"),
+			EncryptionKey:     encryptionKey,
+			SigningKey:        []byte(c.String("signing_key")),
+			DryRun:            c.Bool("dry_run"),
+			Symlinks:          c.String("symlinks"),
+			SymlinkDepth:      c.Int("symlink_depth"),
+			SkipUnchanged:     c.Bool("restore.skip_unchanged"),
+			IDMap:             c.StringSlice("restore.id_map"),
+			Stdout:            c.Bool("restore.stdout"),
+			StdoutEntry:       c.String("restore.stdout_entry"),
+			PreserveMtimes:    c.Bool("restore.preserve_mtimes"),
+		},
+		// stats configuration
+		Stats: &Stats{
+			Bucket:      c.String("bucket"),
+			Path:        c.String("path"),
+			Prefix:      c.String("prefix"),
+			Timeout:     c.Duration("timeout"),
+			Enabled:     c.Bool("stats.enabled"),
+			UnusedAfter: c.Duration("stats.unused_after"),
 		},
 		// repository configuration from environment
 		Repo: &Repo{
@@ -276,14 +1397,49 @@ func run(c *cli.Context) error {
 			Branch:      c.String("repo.branch"),
 			BuildBranch: c.String("repo.build.branch"),
 		},
+		// outputs configuration
+		Outputs: &Outputs{
+			Path:       c.String("outputs.path"),
+			MaskedPath: c.String("outputs.masked_path"),
+			Mask:       c.StringSlice("outputs.mask"),
+		},
+		// metrics configuration
+		Metrics: &Metrics{
+			StatsD:      c.String("metrics.statsd_address"),
+			Pushgateway: c.String("metrics.pushgateway_url"),
+			Textfile:    c.String("metrics.textfile_dir"),
+			Timeout:     c.Duration("metrics.timeout"),
+		},
+		// webhook configuration
+		Webhook: &Webhook{
+			URL:     c.String("webhook.url"),
+			Secret:  c.String("webhook.secret"),
+			Timeout: c.Duration("webhook.timeout"),
+		},
+		// audit configuration
+		Audit: &Audit{
+			Path: c.String("audit.path"),
+		},
+		// build configuration from environment
+		Build: &Build{
+			Number:       c.Int("build.number"),
+			Author:       c.String("build.author"),
+			Commit:       c.String("build.commit"),
+			Event:        c.String("build.event"),
+			Link:         c.String("build.link"),
+			Pipeline:     c.String("build.pipeline"),
+			Distribution: c.String("build.distribution"),
+		},
+		// cache definitions configuration
+		Caches: caches,
 	}
 
 	// validate the plugin
-	err := p.Validate()
+	err = p.Validate()
 	if err != nil {
 		return err
 	}
 
 	// execute the plugin
-	return p.Exec()
+	return p.Exec(c.Context)
 }
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// manifestDigest returns the digest of the manifest of the mounts, listing
+// the name, mode, size, file modification time and link target of every entry
+// the packer would archive, without reading the contents of the files.
+// The format and the encryption of the archive are part of the digest, so
+// changing either rebuilds the archive.
+func (p *packer) manifestDigest(mounts []string, encrypted bool) (string, error) {
+	p.manifest = []string{}
+	defer func() { p.manifest = nil }()
+
+	err := p.walkMounts(nil, mounts)
+	if err != nil {
+		return "", err
+	}
+
+	// the order of the entries in a directory depends on the file system
+	sort.Strings(p.manifest)
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s\t%t\n", p.format, encrypted)
+
+	for _, entry := range p.manifest {
+		_, err = io.WriteString(h, entry+"\n")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// manifestEntry is a helper function to create
+// the line of the manifest for the header.
+func manifestEntry(hdr *tar.Header) string {
+	// only the modification times of regular files are restored, while
+	// directories and symlinks get the time of the restore
+	var modTime int64
+	if hdr.Typeflag == tar.TypeReg {
+		modTime = hdr.ModTime.UnixNano()
+	}
+
+	return fmt.Sprintf("%q\t%o\t%d\t%d\t%q", hdr.Name, hdr.Mode, hdr.Size, modTime, hdr.Linkname)
+}
+
+// unchanged reports whether the archive at the namespace was built from
+// mounts with the manifest digest, so the rebuild can be skipped. With a
+// time to live, the expiry of the archive is refreshed in place, as it
+// would have been by uploading it again.
+func (r *Rebuild) unchanged(ctx context.Context, store storage.Backend, digest string) bool {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	info, err := store.Stat(ctx, r.Bucket, r.Namespace)
+	if err != nil {
+		logrus.Debugf("no previous archive found at %s to compare the manifest with: %v", r.Namespace, err)
+
+		return false
+	}
+
+	if userMetadata(info, metaManifest) != digest {
+		logrus.Debugf("manifest of the mounts changed since %s was rebuilt", r.Namespace)
+
+		return false
+	}
+
+	if r.TTL <= 0 {
+		return true
+	}
+
+	// the parts of a split archive would expire before their index
+	if len(userMetadata(info, metaParts)) > 0 {
+		logrus.Debugf("rebuilding split archive %s to refresh the expiry of its parts", r.Namespace)
+
+		return false
+	}
+
+	opts := r.putOptions(userMetadata(info, metaSHA256))
+	opts.UserMetadata[metaManifest] = digest
+
+	_, err = store.Copy(ctx, r.Bucket, r.Namespace, r.Namespace, opts)
+	if err != nil {
+		logrus.Warnf("unable to refresh the expiry of %s, rebuilding it: %v", r.Namespace, err)
+
+		return false
+	}
+
+	return true
+}
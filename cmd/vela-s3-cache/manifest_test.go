@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_packer_manifestDigest(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hello.txt")
+
+	err := os.WriteFile(file, []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &packer{format: cacheFormat}
+
+	want, err := p.manifestDigest([]string{dir}, false)
+	if err != nil {
+		t.Fatalf("manifestDigest returned err: %v", err)
+	}
+
+	// verify the digest is stable while the mounts are unchanged
+	got, err := p.manifestDigest([]string{dir}, false)
+	if err != nil {
+		t.Fatalf("manifestDigest returned err: %v", err)
+	}
+
+	if got != want {
+		t.Errorf("manifestDigest is %s, want %s", got, want)
+	}
+
+	got, err = p.manifestDigest([]string{dir}, true)
+	if err != nil {
+		t.Fatalf("manifestDigest returned err: %v", err)
+	}
+
+	if got == want {
+		t.Error("manifestDigest is unchanged, want the encryption to change it")
+	}
+
+	// verify a newer modification time changes the digest
+	err = os.Chtimes(file, time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = p.manifestDigest([]string{dir}, false)
+	if err != nil {
+		t.Fatalf("manifestDigest returned err: %v", err)
+	}
+
+	if got == want {
+		t.Error("manifestDigest is unchanged, want the modification time to change it")
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Manifest(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hello.txt")
+
+	err := os.WriteFile(file, []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{dir},
+		Namespace: "foo/bar/archive.tgz",
+		Manifest:  true,
+		format:    cacheFormat,
+	}
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	digest := userMetadata(store.objects["foo/bar/archive.tgz"].info, metaManifest)
+	if len(digest) == 0 {
+		t.Fatal("UserMetadata is missing the manifest")
+	}
+
+	// verify the rebuild is skipped while the mounts are unchanged
+	res := new(Result)
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !res.Unchanged {
+		t.Error("Unchanged is false, want the rebuild skipped")
+	}
+
+	// verify the rebuild runs once a file changed
+	err = os.WriteFile(file, []byte("hello world"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = new(Result)
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if res.Unchanged {
+		t.Error("Unchanged is true, want the archive rebuilt")
+	}
+
+	if got := userMetadata(store.objects["foo/bar/archive.tgz"].info, metaManifest); got == digest {
+		t.Errorf("manifest is %s, want it updated", got)
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Manifest_Restored(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	writeCacheFiles(t, map[string]string{
+		"cache/one.txt":        "one",
+		"cache/nested/two.txt": "two",
+	}, time.Now().Add(-time.Hour))
+
+	err := os.Symlink("one.txt", filepath.Join("cache", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"cache"},
+		Namespace: "foo/bar/archive.tgz",
+		Manifest:  true,
+		format:    cacheFormat,
+	}
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// restore the cache into a fresh workspace, keeping the archived modification times
+	chdir(t, t.TempDir())
+
+	restore := &Restore{
+		Bucket:         "bucket",
+		Filename:       "archive.tgz",
+		Timeout:        10 * time.Minute,
+		Namespace:      "foo/bar/archive.tgz",
+		PreserveMtimes: true,
+	}
+
+	err = restore.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// verify the rebuild of the restored mounts is skipped
+	res := new(Result)
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !res.Unchanged {
+		t.Error("Unchanged is false, want the rebuild of the restored mounts skipped")
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Manifest_TTL(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+		Manifest:  true,
+		TTL:       time.Hour,
+		format:    cacheFormat,
+	}
+
+	err := r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// age the expiry of the archive to verify it is refreshed
+	object := store.objects["foo/bar/archive.tgz"]
+	object.info.UserMetadata[metaExpires] = time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+
+	res := new(Result)
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !res.Unchanged {
+		t.Error("Unchanged is false, want the rebuild skipped")
+	}
+
+	info := store.objects["foo/bar/archive.tgz"].info
+
+	if expires, ok := expiresAt(info); !ok || expires.Before(time.Now().Add(30*time.Minute)) {
+		t.Errorf("UserMetadata is %v, want the expiry refreshed", info.UserMetadata)
+	}
+
+	if len(userMetadata(info, metaManifest)) == 0 || len(userMetadata(info, metaSHA256)) == 0 {
+		t.Errorf("UserMetadata is %v, want the manifest and checksum kept", info.UserMetadata)
+	}
+}
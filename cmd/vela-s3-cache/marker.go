@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// markerFile represents the file in the workspace recording
+// the entity tags of the cache objects last restored into it.
+const markerFile = ".vela-s3-cache-restored.json"
+
+// restoreMarker represents a cache object restored into the workspace.
+type restoreMarker struct {
+	// the entity tag of the object when it was restored
+	ETag string `json:"etag"`
+	// the top level paths of the entries extracted from the object
+	Roots []string `json:"roots"`
+}
+
+// readMarkers is a helper function to read the restored cache
+// objects from the marker file, keyed by bucket and object key.
+func readMarkers(path string) map[string]restoreMarker {
+	markers := map[string]restoreMarker{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logrus.Debugf("unable to read restore marker %s: %v", path, err)
+		}
+
+		return markers
+	}
+
+	// a corrupted marker only costs a download
+	err = json.Unmarshal(data, &markers)
+	if err != nil {
+		logrus.Debugf("ignoring corrupted restore marker %s: %v", path, err)
+
+		return map[string]restoreMarker{}
+	}
+
+	return markers
+}
+
+// writeMarkers is a helper function to replace the
+// marker file with the restored cache objects.
+func writeMarkers(path string, markers map[string]restoreMarker) error {
+	data, err := json.MarshalIndent(markers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// markerKey returns the key of the cache object in the marker file.
+func (r *Restore) markerKey() string {
+	return r.Bucket + "/" + r.Namespace
+}
+
+// unchanged verifies the object has the entity tag it had when it was last
+// restored into the workspace and its extracted paths still exist.
+func (r *Restore) unchanged(info storage.Object) bool {
+	if len(info.ETag) == 0 {
+		return false
+	}
+
+	m, ok := readMarkers(markerFile)[r.markerKey()]
+	if !ok || m.ETag != info.ETag {
+		return false
+	}
+
+	// restore the cache again when its files were removed
+	for _, root := range m.Roots {
+		_, err := os.Lstat(root)
+		if err != nil {
+			logrus.Debugf("restored path %s is missing, restoring cache again", root)
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// mark records the entity tag of the object and the top level
+// paths extracted from it in the marker file of the workspace.
+func (r *Restore) mark(info storage.Object, roots map[string]bool) error {
+	if len(info.ETag) == 0 {
+		return nil
+	}
+
+	markers := readMarkers(markerFile)
+
+	m := restoreMarker{ETag: info.ETag, Roots: []string{}}
+
+	for root := range roots {
+		m.Roots = append(m.Roots, root)
+	}
+
+	slices.Sort(m.Roots)
+
+	markers[r.markerKey()] = m
+
+	logrus.Debugf("recording etag %s of %s in restore marker %s", info.ETag, r.Namespace, markerFile)
+
+	return writeMarkers(markerFile, markers)
+}
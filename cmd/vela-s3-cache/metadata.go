@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const (
+	// metaExpires is the user metadata key holding the
+	// time at which a cache object should be considered expired.
+	metaExpires = "Vela-Cache-Expires"
+
+	// metaBuildNumber is the user metadata key holding
+	// the number of the build that created a cache object.
+	metaBuildNumber = "Vela-Cache-Build-Number"
+
+	// metaBuildCommit is the user metadata key holding
+	// the commit of the build that created a cache object.
+	metaBuildCommit = "Vela-Cache-Build-Commit"
+
+	// metaBuildEvent is the user metadata key holding
+	// the event of the build that created a cache object.
+	metaBuildEvent = "Vela-Cache-Build-Event"
+
+	// metaPlatform is the user metadata key holding the os
+	// and architecture of the runner that created a cache object.
+	metaPlatform = "Vela-Cache-Platform"
+
+	// metaBuildLink is the user metadata key holding
+	// the link to the build that created a cache object.
+	metaBuildLink = "Vela-Cache-Build-Link"
+
+	// metaPipeline is the user metadata key holding the
+	// name of the pipeline that created a cache object.
+	metaPipeline = "Vela-Cache-Pipeline"
+
+	// metaVersion is the user metadata key holding the
+	// version of the plugin that created a cache object.
+	metaVersion = "Vela-Cache-Plugin-Version"
+
+	// metaSHA256 is the user metadata key holding the hex
+	// encoded SHA256 checksum of the cache archive.
+	metaSHA256 = "Vela-Cache-Sha256"
+
+	// metaEncryption is the user metadata key holding the
+	// algorithm the cache archive was encrypted with.
+	metaEncryption = "Vela-Cache-Encryption"
+
+	// metaSignature is the user metadata key holding the
+	// HMAC-SHA256 signature of the cache archive.
+	metaSignature = "Vela-Cache-Signature"
+
+	// metaManifest is the user metadata key holding the hex encoded
+	// SHA256 digest of the manifest of the mounts the archive was built from.
+	metaManifest = "Vela-Cache-Manifest"
+
+	// tagTTL is the object tag holding the configured time to
+	// live for a cache object, usable in bucket lifecycle rules.
+	tagTTL = "vela-cache-ttl"
+
+	// tagPin is the object tag marking a cache object
+	// as pinned, exempting it from the flush action.
+	tagPin = "vela-cache-pin"
+)
+
+// userMetadata is a helper function to look up a user
+// metadata value from an object regardless of key casing.
+func userMetadata(info storage.Object, key string) string {
+	for k, v := range info.UserMetadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// logProvenance is a helper function to log the provenance
+// metadata recorded on an object, if present.
+func logProvenance(info storage.Object) {
+	number := userMetadata(info, metaBuildNumber)
+	commit := userMetadata(info, metaBuildCommit)
+
+	switch {
+	case len(number) > 0 && len(commit) > 0:
+		logrus.Infof("restoring cache built by build #%s from commit %s", number, commit)
+	case len(number) > 0:
+		logrus.Infof("restoring cache built by build #%s", number)
+	case len(commit) > 0:
+		logrus.Infof("restoring cache built from commit %s", commit)
+	default:
+		logrus.Info("restoring cache with no recorded provenance")
+	}
+
+	if link := userMetadata(info, metaBuildLink); len(link) > 0 {
+		logrus.Infof("cache build link: %s", link)
+	}
+
+	if pipeline := userMetadata(info, metaPipeline); len(pipeline) > 0 {
+		logrus.Infof("cache pipeline: %s", pipeline)
+	}
+
+	if v := userMetadata(info, metaVersion); len(v) > 0 {
+		logrus.Debugf("cache created with plugin version %s", v)
+	}
+}
+
+// expiresAt is a helper function to parse the expiry time
+// recorded in the metadata of an object, if present.
+func expiresAt(info storage.Object) (time.Time, bool) {
+	value := userMetadata(info, metaExpires)
+	if len(value) == 0 {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_expiresAt(t *testing.T) {
+	// setup types
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		desc string
+		info storage.Object
+		ok   bool
+	}{
+		{
+			desc: "canonical key",
+			info: storage.Object{UserMetadata: map[string]string{"Vela-Cache-Expires": want.Format(time.RFC3339)}},
+			ok:   true,
+		},
+		{
+			desc: "lowercase key",
+			info: storage.Object{UserMetadata: map[string]string{"vela-cache-expires": want.Format(time.RFC3339)}},
+			ok:   true,
+		},
+		{
+			desc: "invalid value",
+			info: storage.Object{UserMetadata: map[string]string{"Vela-Cache-Expires": "tomorrow"}},
+			ok:   false,
+		},
+		{
+			desc: "no metadata",
+			info: storage.Object{},
+			ok:   false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, ok := expiresAt(tC.info)
+
+			if ok != tC.ok {
+				t.Errorf("expiresAt ok is %v, want %v", ok, tC.ok)
+			}
+
+			if ok && !got.Equal(want) {
+				t.Errorf("expiresAt is %v, want %v", got, want)
+			}
+		})
+	}
+}
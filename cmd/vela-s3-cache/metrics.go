@@ -0,0 +1,278 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// metricsPrefix is the prefix for the name of every metric emitted.
+const metricsPrefix = "vela_s3_cache"
+
+// Metrics represents the plugin configuration for emitting metrics.
+type Metrics struct {
+	// sets the address of the StatsD server (i.e. localhost:8125)
+	StatsD string
+	// sets the URL of the Prometheus Pushgateway
+	Pushgateway string
+	// sets the directory to write node exporter textfile metrics to
+	Textfile string
+	// sets the timeout for emitting the metrics
+	Timeout time.Duration
+}
+
+// metric represents a single measurement emitted for an action.
+type metric struct {
+	name  string
+	value float64
+	// statsd type for the metric
+	kind string
+}
+
+// Enabled returns whether a metrics sink is configured.
+func (m *Metrics) Enabled() bool {
+	return m != nil && (len(m.StatsD) > 0 || len(m.Pushgateway) > 0 || len(m.Textfile) > 0)
+}
+
+// Emit sends the metrics for the result of an action to the configured sinks.
+func (m *Metrics) Emit(ctx context.Context, repo *Repo, res *Result) error {
+	if !m.Enabled() {
+		return nil
+	}
+
+	logrus.Trace("emitting metrics for action")
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	metrics := m.collect(res)
+
+	labels := map[string]string{
+		"org":    repo.Owner,
+		"repo":   repo.Name,
+		"action": res.Action,
+	}
+
+	if len(m.StatsD) > 0 {
+		err := m.statsd(ctx, metrics, labels)
+		if err != nil {
+			return fmt.Errorf("unable to emit metrics to statsd: %w", err)
+		}
+	}
+
+	if len(m.Pushgateway) > 0 {
+		err := m.push(ctx, metrics, labels)
+		if err != nil {
+			return fmt.Errorf("unable to emit metrics to pushgateway: %w", err)
+		}
+	}
+
+	if len(m.Textfile) > 0 {
+		err := m.textfile(metrics, labels)
+		if err != nil {
+			return fmt.Errorf("unable to write textfile metrics: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// collect creates the metrics for the result of an action.
+func (m *Metrics) collect(res *Result) []metric {
+	success := 0.0
+	if res.Success {
+		success = 1
+	}
+
+	metrics := []metric{
+		{name: "success", value: success, kind: "g"},
+		{name: "duration_seconds", value: res.Duration.Seconds(), kind: "g"},
+	}
+
+	switch res.Action {
+	case checkAction:
+		metrics = append(metrics,
+			metric{name: "latency_seconds", value: res.Latency.Seconds(), kind: "g"},
+		)
+	case restoreAction:
+		hit := 0.0
+		if res.Hit {
+			hit = 1
+		}
+
+		metrics = append(metrics,
+			metric{name: "cache_hit", value: hit, kind: "g"},
+			metric{name: "archive_size_bytes", value: float64(res.Size), kind: "g"},
+			metric{name: "transfer_seconds", value: res.TransferDuration.Seconds(), kind: "g"},
+			metric{name: "extract_seconds", value: res.ExtractDuration.Seconds(), kind: "g"},
+		)
+	case rebuildAction:
+		metrics = append(metrics,
+			metric{name: "archive_size_bytes", value: float64(res.Size), kind: "g"},
+			metric{name: "uncompressed_size_bytes", value: float64(res.UncompressedSize), kind: "g"},
+			metric{name: "compression_ratio", value: res.CompressionRatio(), kind: "g"},
+			metric{name: "walk_seconds", value: res.WalkDuration.Seconds(), kind: "g"},
+			metric{name: "compress_seconds", value: res.CompressDuration.Seconds(), kind: "g"},
+			metric{name: "transfer_seconds", value: res.TransferDuration.Seconds(), kind: "g"},
+		)
+	case flushAction:
+		metrics = append(metrics,
+			metric{name: "objects_removed", value: float64(res.Removed), kind: "g"},
+			metric{name: "bytes_freed", value: float64(res.Freed), kind: "g"},
+		)
+	case abortAction:
+		metrics = append(metrics,
+			metric{name: "uploads_aborted", value: float64(res.Aborted), kind: "g"},
+		)
+	}
+
+	return metrics
+}
+
+// statsd sends the metrics to a StatsD server using DogStatsD style tags.
+func (m *Metrics) statsd(ctx context.Context, metrics []metric, labels map[string]string) error {
+	d := net.Dialer{}
+
+	conn, err := d.DialContext(ctx, "udp", m.StatsD)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tags := fmt.Sprintf("|#org:%s,repo:%s,action:%s", labels["org"], labels["repo"], labels["action"])
+
+	for _, mt := range metrics {
+		line := fmt.Sprintf("%s.%s:%g|%s%s", metricsPrefix, mt.name, mt.value, mt.kind, tags)
+
+		_, err = conn.Write([]byte(line))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// push sends the metrics to a Prometheus Pushgateway
+// grouped by the repository and action.
+func (m *Metrics) push(ctx context.Context, metrics []metric, labels map[string]string) error {
+	body := new(bytes.Buffer)
+
+	for _, mt := range metrics {
+		fmt.Fprintf(body, "# TYPE %s_%s gauge\n", metricsPrefix, mt.name)
+		fmt.Fprintf(body, "%s_%s %g\n", metricsPrefix, mt.name, mt.value)
+	}
+
+	u := fmt.Sprintf(
+		"%s/metrics/job/%s/org/%s/repo/%s/action/%s",
+		strings.TrimSuffix(m.Pushgateway, "/"),
+		metricsPrefix,
+		url.PathEscape(labels["org"]),
+		url.PathEscape(labels["repo"]),
+		url.PathEscape(labels["action"]),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// labelEscaper escapes the label values of the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// textfileReplacer replaces the characters of the labels
+// not safe to use in the name of the textfile.
+var textfileReplacer = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// textfileName returns the name of the textfile for the labels, unique to
+// the repo and action so the builds of other repos on the runner don't
+// replace each other's metrics, while every build replaces the metrics
+// of the previous build of the repo.
+func textfileName(labels map[string]string) string {
+	parts := []string{metricsPrefix}
+
+	for _, label := range []string{"org", "repo", "action"} {
+		parts = append(parts, textfileReplacer.ReplaceAllString(labels[label], "_"))
+	}
+
+	return strings.Join(parts, "_") + ".prom"
+}
+
+// textfile writes the metrics with the labels to a file per repo and
+// action in the textfile directory of the node exporter. The file is replaced
+// atomically, so the exporter never reads partially written metrics.
+func (m *Metrics) textfile(metrics []metric, labels map[string]string) error {
+	body := new(bytes.Buffer)
+
+	l := fmt.Sprintf(`{org="%s",repo="%s",action="%s"}`,
+		labelEscaper.Replace(labels["org"]),
+		labelEscaper.Replace(labels["repo"]),
+		labelEscaper.Replace(labels["action"]),
+	)
+
+	for _, mt := range metrics {
+		fmt.Fprintf(body, "# TYPE %s_%s gauge\n", metricsPrefix, mt.name)
+		fmt.Fprintf(body, "%s_%s%s %g\n", metricsPrefix, mt.name, l, mt.value)
+	}
+
+	err := os.MkdirAll(m.Textfile, 0755)
+	if err != nil {
+		return err
+	}
+
+	// the node exporter ignores the files without the .prom extension
+	f, err := os.CreateTemp(m.Textfile, ".vela-s3-cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(body.Bytes())
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	// allow the node exporter to read the metrics
+	err = f.Chmod(0644)
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(m.Textfile, textfileName(labels)))
+}
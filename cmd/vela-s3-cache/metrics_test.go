@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Metrics_Emit_Disabled(t *testing.T) {
+	// setup types
+	var m *Metrics
+
+	err := m.Emit(context.Background(), &Repo{}, &Result{})
+	if err != nil {
+		t.Errorf("Emit returned err: %v", err)
+	}
+}
+
+func TestS3Cache_Metrics_Emit_Pushgateway(t *testing.T) {
+	// setup types
+	var (
+		path string
+		body string
+	)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+
+		path = r.URL.Path
+		body = string(data)
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	m := &Metrics{
+		Pushgateway: s.URL,
+		Timeout:     time.Second,
+	}
+
+	res := &Result{
+		Action: restoreAction,
+		Hit:    true,
+		Size:   1024,
+	}
+
+	err := m.Emit(context.Background(), &Repo{Owner: "foo", Name: "bar"}, res)
+	if err != nil {
+		t.Errorf("Emit returned err: %v", err)
+	}
+
+	if path != "/metrics/job/vela_s3_cache/org/foo/repo/bar/action/restore" {
+		t.Errorf("Emit path is %s", path)
+	}
+
+	if !strings.Contains(body, "vela_s3_cache_cache_hit 1\n") {
+		t.Errorf("Emit body is missing cache hit: %s", body)
+	}
+
+	if !strings.Contains(body, "vela_s3_cache_archive_size_bytes 1024\n") {
+		t.Errorf("Emit body is missing archive size: %s", body)
+	}
+}
+
+func TestS3Cache_Metrics_Emit_StatsD(t *testing.T) {
+	// setup types
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	m := &Metrics{
+		StatsD:  conn.LocalAddr().String(),
+		Timeout: time.Second,
+	}
+
+	res := &Result{
+		Action:           rebuildAction,
+		Size:             100,
+		UncompressedSize: 400,
+	}
+
+	err = m.Emit(context.Background(), &Repo{Owner: "foo", Name: "bar"}, res)
+	if err != nil {
+		t.Errorf("Emit returned err: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	lines := []string{}
+	buf := make([]byte, 1024)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+
+		lines = append(lines, string(buf[:n]))
+	}
+
+	want := "vela_s3_cache.compression_ratio:4|g|#org:foo,repo:bar,action:rebuild"
+
+	found := false
+
+	for _, line := range lines {
+		if line == want {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("Emit did not send %s, got %v", want, lines)
+	}
+}
+
+func TestS3Cache_Metrics_Emit_Textfile(t *testing.T) {
+	// setup types
+	dir := filepath.Join(t.TempDir(), "textfile")
+
+	m := &Metrics{
+		Textfile: dir,
+		Timeout:  time.Second,
+	}
+
+	res := &Result{
+		Action:   restoreAction,
+		Hit:      true,
+		Size:     1024,
+		Duration: 1500 * time.Millisecond,
+	}
+
+	err := m.Emit(context.Background(), &Repo{Owner: "foo", Name: `b"ar`}, res)
+	if err != nil {
+		t.Fatalf("Emit returned err: %v", err)
+	}
+
+	// verify the next build of the repo replaces the file
+	err = m.Emit(context.Background(), &Repo{Owner: "foo", Name: `b"ar`}, res)
+	if err != nil {
+		t.Fatalf("Emit returned err: %v", err)
+	}
+
+	// verify another repo writes its own file
+	err = m.Emit(context.Background(), &Repo{Owner: "foo", Name: "baz"}, res)
+	if err != nil {
+		t.Fatalf("Emit returned err: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "vela_s3_cache_foo_b_ar_restore.prom"))
+	if err != nil {
+		t.Fatalf("unable to read textfile metrics: %v", err)
+	}
+
+	for _, want := range []string{
+		"# TYPE vela_s3_cache_cache_hit gauge\n",
+		`vela_s3_cache_cache_hit{org="foo",repo="b\"ar",action="restore"} 1` + "\n",
+		`vela_s3_cache_archive_size_bytes{org="foo",repo="b\"ar",action="restore"} 1024` + "\n",
+		`vela_s3_cache_duration_seconds{org="foo",repo="b\"ar",action="restore"} 1.5` + "\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("textfile metrics are missing %q: %s", want, data)
+		}
+	}
+
+	// only the metrics files are left in the directory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("textfile directory contains %d files, want 2", len(entries))
+	}
+}
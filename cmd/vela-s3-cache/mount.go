@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// mountFollow represents archiving the target of a mount
+	// that is a symlink, as long as it is inside the workspace.
+	mountFollow = "follow"
+
+	// mountPreserve represents archiving a mount that is a symlink as the link.
+	mountPreserve = "preserve"
+)
+
+// mountSymlinkPolicies represents the supported policies for mounts that are symlinks.
+var mountSymlinkPolicies = []string{mountFollow, mountPreserve}
+
+// validateMountSymlinkPolicy is a helper function to verify
+// the policy for mounts that are symlinks is supported.
+func validateMountSymlinkPolicy(policy string) error {
+	if len(policy) > 0 && !slices.Contains(mountSymlinkPolicies, policy) {
+		return fmt.Errorf("invalid mount symlinks policy %s: must be one of %s", policy, strings.Join(mountSymlinkPolicies, ", "))
+	}
+
+	return nil
+}
+
+// followMount is a helper function to resolve the mount that is a
+// symlink to the information of its target, rejecting targets outside
+// of the workspace so a link committed to the repo can not pull other
+// files of the runner into the cache.
+func followMount(mount string) (os.FileInfo, error) {
+	target, err := filepath.EvalSymlinks(mount)
+	if err != nil {
+		return nil, fmt.Errorf("mount: %s, resolving symlink: %w", mount, err)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// compare the resolved paths, as the workspace may be a link itself
+	workspace, err := filepath.EvalSymlinks(pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(workspace, target)
+	if err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("mount: %s, symlink target %s is outside of the workspace %s, mount the target instead", mount, target, pwd)
+	}
+
+	return os.Stat(target)
+}
+
+// expandMounts is a helper function to split the newline separated
+// mounts and expand any glob patterns into the matching paths.
+func expandMounts(mounts []string) ([]string, error) {
+	expanded := []string{}
+	seen := make(map[string]bool)
+
+	for _, mount := range mounts {
+		for _, m := range strings.Split(mount, "\n") {
+			m = strings.TrimSpace(m)
+			if len(m) == 0 {
+				continue
+			}
+
+			matches := []string{m}
+
+			// expand the glob pattern into the matching paths
+			if strings.ContainsAny(m, "*?[") {
+				var err error
+
+				matches, err = filepath.Glob(m)
+				if err != nil {
+					return nil, fmt.Errorf("mount: %s, invalid pattern: %w", m, err)
+				}
+
+				if len(matches) == 0 {
+					return nil, fmt.Errorf("mount: %s, pattern did not match any files or directories", m)
+				}
+			}
+
+			for _, match := range matches {
+				if seen[match] {
+					continue
+				}
+
+				seen[match] = true
+
+				expanded = append(expanded, match)
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// pathTrie represents a tree of path elements
+// used to find the mounts nested in another mount.
+type pathTrie struct {
+	children map[string]*pathTrie
+	// whether a mount ends at this element
+	mount bool
+}
+
+// insert adds the path elements to the trie, returning false
+// when the path or one of its parents was already inserted.
+func (t *pathTrie) insert(elems []string) bool {
+	node := t
+
+	for _, elem := range elems {
+		if node.mount {
+			return false
+		}
+
+		if node.children == nil {
+			node.children = make(map[string]*pathTrie)
+		}
+
+		child, ok := node.children[elem]
+		if !ok {
+			child = &pathTrie{}
+			node.children[elem] = child
+		}
+
+		node = child
+	}
+
+	if node.mount {
+		return false
+	}
+
+	node.mount = true
+
+	return true
+}
+
+// pathElements is a helper function to split the cleaned path into its
+// elements, starting with the root so relative and absolute paths differ.
+func pathElements(path string) []string {
+	root := "."
+	if filepath.IsAbs(path) {
+		root = string(filepath.Separator)
+	}
+
+	elems := []string{root}
+
+	for _, elem := range strings.Split(path, string(filepath.Separator)) {
+		if len(elem) == 0 || elem == "." {
+			continue
+		}
+
+		elems = append(elems, elem)
+	}
+
+	return elems
+}
+
+// filterRedundantPaths is a helper function to remove the paths that
+// are duplicated by or nested in another path, keeping the order of the
+// remaining paths. The paths are inserted into a trie from the shallowest
+// to the deepest, so every parent is seen before the paths nested in it.
+func filterRedundantPaths(paths []string) []string {
+	elems := make([][]string, len(paths))
+	order := make([]int, len(paths))
+
+	for i, path := range paths {
+		elems[i] = pathElements(filepath.Clean(path))
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(elems[order[i]]) < len(elems[order[j]])
+	})
+
+	trie := &pathTrie{}
+	keep := make([]bool, len(paths))
+
+	for _, i := range order {
+		keep[i] = trie.insert(elems[i])
+	}
+
+	filtered := []string{}
+
+	for i, path := range paths {
+		if keep[i] {
+			filtered = append(filtered, path)
+		}
+	}
+
+	return filtered
+}
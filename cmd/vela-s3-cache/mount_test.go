@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestS3Cache_expandMounts(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	for _, pkg := range []string{"a", "b"} {
+		err := os.MkdirAll(filepath.Join(dir, "packages", pkg, "node_modules"), 0755)
+		if err != nil {
+			t.Fatalf("unable to create directory: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		mounts  []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:   "plain",
+			mounts: []string{"testdata/hello.txt"},
+			want:   []string{"testdata/hello.txt"},
+		},
+		{
+			desc:   "newline separated",
+			mounts: []string{"testdata/hello.txt\n\n  testdata \n"},
+			want:   []string{"testdata/hello.txt", "testdata"},
+		},
+		{
+			desc:   "glob",
+			mounts: []string{filepath.Join(dir, "packages", "*", "node_modules"), filepath.Join(dir, "packages", "a", "node_modules")},
+			want: []string{
+				filepath.Join(dir, "packages", "a", "node_modules"),
+				filepath.Join(dir, "packages", "b", "node_modules"),
+			},
+		},
+		{
+			desc:    "no matches",
+			mounts:  []string{filepath.Join(dir, "missing", "*")},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := expandMounts(tC.mounts)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("expandMounts returned err: %v", err)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("expandMounts is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_filterRedundantPaths(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc  string
+		paths []string
+		want  []string
+	}{
+		{
+			desc:  "distinct",
+			paths: []string{"foo", "bar"},
+			want:  []string{"foo", "bar"},
+		},
+		{
+			desc:  "nested",
+			paths: []string{"foo/bar", "baz", "foo"},
+			want:  []string{"baz", "foo"},
+		},
+		{
+			desc:  "sibling prefix",
+			paths: []string{"foo", "foo-bar", "foo.bar/baz", "foo/bar"},
+			want:  []string{"foo", "foo-bar", "foo.bar/baz"},
+		},
+		{
+			desc:  "duplicate",
+			paths: []string{"./foo", "foo/", "foo"},
+			want:  []string{"./foo"},
+		},
+		{
+			desc:  "current directory",
+			paths: []string{"foo", ".", "/foo"},
+			want:  []string{".", "/foo"},
+		},
+		{
+			desc:  "absolute",
+			paths: []string{"/foo/bar", "/foo", "foo/bar"},
+			want:  []string{"/foo", "foo/bar"},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := filterRedundantPaths(tC.paths)
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("filterRedundantPaths is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_filterRedundantPaths_Thousands(t *testing.T) {
+	// setup types
+	paths := []string{}
+	want := []string{}
+
+	for i := range 5000 {
+		pkg := fmt.Sprintf("packages/pkg-%d", i)
+
+		// nest every other package in a mount of its own
+		if i%2 == 0 {
+			paths = append(paths, pkg+"/node_modules/.cache", pkg+"/node_modules")
+			want = append(want, pkg+"/node_modules")
+
+			continue
+		}
+
+		paths = append(paths, pkg, pkg+"/dist")
+		want = append(want, pkg)
+	}
+
+	got := filterRedundantPaths(paths)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterRedundantPaths returned %d paths, want %d", len(got), len(want))
+	}
+
+	// a mount of the parent directory replaces every package
+	got = filterRedundantPaths(append(paths, "packages"))
+
+	if !reflect.DeepEqual(got, []string{"packages"}) {
+		t.Errorf("filterRedundantPaths is %v, want [packages]", got)
+	}
+}
+
+func TestS3Cache_packer_pack_MountSymlink(t *testing.T) {
+	// setup types
+	outside := t.TempDir()
+
+	chdir(t, t.TempDir())
+
+	err := os.MkdirAll("target", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join("target", "file.txt"), []byte("file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for link, target := range map[string]string{"inside": "target", "outside": outside} {
+		err = os.Symlink(target, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		mount   string
+		follow  bool
+		want    []string
+		wantErr bool
+	}{
+		{desc: "follow", mount: "inside", follow: true, want: []string{"inside/", "inside/file.txt"}},
+		{desc: "preserve", mount: "inside", want: []string{"inside"}},
+		{desc: "outside workspace", mount: "outside", follow: true, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+			err := (&packer{followMounts: tC.follow}).pack([]string{tC.mount}, archive)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("pack returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if got := archiveNames(t, archive); !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("archive entries are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
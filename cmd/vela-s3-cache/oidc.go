@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultIDTokenAudience represents the audience requested for
+	// the Vela ID token when exchanging it with AWS STS.
+	defaultIDTokenAudience = "sts.amazonaws.com"
+
+	// idTokenSessionName represents the name of the role
+	// session assumed with the Vela ID token.
+	idTokenSessionName = "vela-s3-cache"
+
+	// idTokenTimeout represents the timeout for
+	// requesting an ID token from the Vela server.
+	idTokenTimeout = 30 * time.Second
+)
+
+// idTokenResponse represents the response of the Vela
+// server to a request for an ID token for the build.
+type idTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// idTokenSource requests the OIDC ID tokens issued by the
+// Vela server for the build to exchange for s3 credentials.
+type idTokenSource struct {
+	// sets the URL to request the ID token from
+	url string
+	// sets the token to authenticate the request for the ID token with
+	token string
+	// sets the audiences of the ID token
+	audience []string
+	// sets the client used to request the ID token
+	client *http.Client
+}
+
+// newIDTokenSource creates an ID token source from the plugin configuration.
+func (c *Config) newIDTokenSource() *idTokenSource {
+	return &idTokenSource{
+		url:      c.IDTokenRequestURL,
+		token:    c.IDTokenRequestToken,
+		audience: c.IDTokenAudience,
+		client:   &http.Client{Timeout: idTokenTimeout},
+	}
+}
+
+// Fetch requests a new ID token for the build from the Vela server.
+func (s *idTokenSource) Fetch(ctx context.Context) (string, error) {
+	logrus.Trace("requesting ID token from the Vela server")
+
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return "", fmt.Errorf("invalid ID token request URL: %w", err)
+	}
+
+	// request the audiences the role trusts
+	q := u.Query()
+	for _, audience := range s.audience {
+		q.Add("audience", audience)
+	}
+
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to request ID token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return "", fmt.Errorf("unable to request ID token: %s: %s", resp.Status, body)
+	}
+
+	t := new(idTokenResponse)
+
+	err = json.NewDecoder(resp.Body).Decode(t)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode ID token: %w", err)
+	}
+
+	if len(t.Token) == 0 {
+		return "", fmt.Errorf("no ID token returned by the Vela server")
+	}
+
+	return t.Token, nil
+}
+
+// GetIdentityToken requests a new ID token for the AWS SDK web identity provider.
+func (s *idTokenSource) GetIdentityToken() ([]byte, error) {
+	token, err := s.Fetch(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(token), nil
+}
+
+// minioCredentials creates credentials for the minio client assuming
+// the role with the ID token through AssumeRoleWithWebIdentity.
+func (c *Config) minioCredentials(transport http.RoundTripper) *credentials.Credentials {
+	source := c.newIDTokenSource()
+
+	return credentials.New(&credentials.STSWebIdentity{
+		Client:      &http.Client{Transport: transport},
+		STSEndpoint: c.stsEndpoint(),
+		RoleARN:     c.RoleARN,
+		GetWebIDTokenExpiry: func() (*credentials.WebIdentityToken, error) {
+			token, err := source.Fetch(context.Background())
+			if err != nil {
+				return nil, err
+			}
+
+			return &credentials.WebIdentityToken{Token: token}, nil
+		},
+	})
+}
+
+// stsEndpoint returns the STS endpoint to exchange the ID token with,
+// defaulting to the regional AWS STS endpoint when a region is provided.
+func (c *Config) stsEndpoint() string {
+	switch {
+	case len(c.STSEndpoint) > 0:
+		return c.STSEndpoint
+	case len(c.Region) > 0:
+		return fmt.Sprintf("https://sts.%s.amazonaws.com", c.Region)
+	default:
+		return "https://sts.amazonaws.com"
+	}
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newIDTokenServer is a helper function to create a fake
+// Vela server issuing the ID token for the request token.
+func newIDTokenServer(t *testing.T, audience *[]string) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer request-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if audience != nil {
+			*audience = r.URL.Query()["audience"]
+		}
+
+		fmt.Fprint(w, `{"token": "id-token"}`)
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestS3Cache_idTokenSource_Fetch(t *testing.T) {
+	// setup types
+	audience := []string{}
+	s := newIDTokenServer(t, &audience)
+
+	testCases := []struct {
+		desc    string
+		token   string
+		wantErr bool
+	}{
+		{
+			desc:  "authorized",
+			token: "request-token",
+		},
+		{
+			desc:    "unauthorized",
+			token:   "invalid",
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			src := &idTokenSource{
+				url:      s.URL + "/api/v1/repos/foo/bar/builds/1/id_token",
+				token:    tC.token,
+				audience: []string{"sts.amazonaws.com", "vela"},
+				client:   http.DefaultClient,
+			}
+
+			got, err := src.Fetch(context.Background())
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Fetch returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if got != "id-token" {
+				t.Errorf("Fetch is %s, want id-token", got)
+			}
+
+			if !reflect.DeepEqual(audience, src.audience) {
+				t.Errorf("audience is %v, want %v", audience, src.audience)
+			}
+		})
+	}
+}
+
+func TestS3Cache_idTokenSource_Fetch_NoToken(t *testing.T) {
+	// setup types
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer s.Close()
+
+	src := &idTokenSource{url: s.URL, token: "request-token", client: http.DefaultClient}
+
+	_, err := src.Fetch(context.Background())
+	if err == nil {
+		t.Errorf("Fetch should have returned err")
+	}
+}
+
+func TestS3Cache_Config_minioCredentials(t *testing.T) {
+	// setup types
+	vela := newIDTokenServer(t, nil)
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		if r.Form.Get("WebIdentityToken") != "id-token" || r.Form.Get("RoleArn") != "arn:aws:iam::123456789012:role/cache" {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>access</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`)
+	}))
+	defer sts.Close()
+
+	c := &Config{
+		RoleARN:             "arn:aws:iam::123456789012:role/cache",
+		STSEndpoint:         sts.URL,
+		IDTokenRequestURL:   vela.URL,
+		IDTokenRequestToken: "request-token",
+	}
+
+	v, err := c.minioCredentials(http.DefaultTransport).Get()
+	if err != nil {
+		t.Fatalf("Get returned err: %v", err)
+	}
+
+	if v.AccessKeyID != "access" || v.SecretAccessKey != "secret" || v.SessionToken != "session" {
+		t.Errorf("Get is %s %s %s, want access secret session", v.AccessKeyID, v.SecretAccessKey, v.SessionToken)
+	}
+}
+
+func TestS3Cache_Config_stsEndpoint(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		config *Config
+		want   string
+	}{
+		{
+			desc:   "default",
+			config: &Config{},
+			want:   "https://sts.amazonaws.com",
+		},
+		{
+			desc:   "region",
+			config: &Config{Region: "us-west-2"},
+			want:   "https://sts.us-west-2.amazonaws.com",
+		},
+		{
+			desc:   "endpoint",
+			config: &Config{Region: "us-west-2", STSEndpoint: "https://minio:9000"},
+			want:   "https://minio:9000",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.config.stsEndpoint(); got != tC.want {
+				t.Errorf("stsEndpoint is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// secretOutputs represents the outputs granting access to the
+// cache, which are always written to the masked outputs file.
+var secretOutputs = []string{"S3_CACHE_PUT_URL"}
+
+// Outputs represents the plugin configuration for Vela outputs.
+type Outputs struct {
+	// sets the file to write the outputs to
+	Path string
+	// sets the file to write the masked outputs to
+	MaskedPath string
+	// sets the names of the outputs to write to the masked outputs file
+	Mask []string
+}
+
+// Write appends the summary of the result of an action to
+// the outputs file, in the environment file format used by Vela.
+// The masked outputs are written to the masked outputs file instead,
+// so Vela hides their values in the logs of the following steps, and
+// the secret outputs are dropped without a masked outputs file.
+func (o *Outputs) Write(res *Result) error {
+	if o == nil || (len(o.Path) == 0 && len(o.MaskedPath) == 0) {
+		return nil
+	}
+
+	outputs := [][2]string{}
+	masked := [][2]string{}
+
+	for _, kv := range res.Outputs() {
+		if o.masked(kv[0]) {
+			masked = append(masked, kv)
+
+			continue
+		}
+
+		outputs = append(outputs, kv)
+	}
+
+	err := appendOutputs(o.Path, outputs)
+	if err != nil {
+		return err
+	}
+
+	return appendOutputs(o.MaskedPath, masked)
+}
+
+// Validate verifies the Outputs are properly configured.
+func (o *Outputs) Validate() error {
+	if o == nil {
+		return nil
+	}
+
+	logrus.Trace("validating outputs configuration")
+
+	// verify the masked outputs have a file to be written to
+	if len(o.Mask) > 0 && len(o.MaskedPath) == 0 {
+		return fmt.Errorf("no masked outputs file provided for masked outputs %s", strings.Join(o.Mask, ", "))
+	}
+
+	return nil
+}
+
+// masked returns whether the output with the name is masked,
+// accepting the name with or without the S3_CACHE_ prefix.
+func (o *Outputs) masked(name string) bool {
+	if slices.Contains(secretOutputs, name) {
+		return true
+	}
+
+	for _, m := range o.Mask {
+		m = strings.ToUpper(strings.TrimSpace(m))
+
+		if m == name || "S3_CACHE_"+m == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendOutputs is a helper function to append the key value pairs to
+// the file in the environment file format, skipping an unset file.
+func appendOutputs(path string, outputs [][2]string) error {
+	if len(path) == 0 || len(outputs) == 0 {
+		return nil
+	}
+
+	logrus.Tracef("writing outputs to %s", path)
+
+	b := new(strings.Builder)
+
+	for _, kv := range outputs {
+		fmt.Fprintf(b, "%s=%s\n", kv[0], kv[1])
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create directory for outputs %s: %w", path, err)
+	}
+
+	//nolint:gosec // outputs are meant to be readable by other steps
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open outputs %s: %w", path, err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(b.String())
+	if err != nil {
+		return fmt.Errorf("unable to write outputs %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Outputs_Write(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), "outputs", ".env")
+
+	o := &Outputs{
+		Path: file,
+	}
+
+	res := &Result{
+		Action:           restoreAction,
+		Key:              "foo/bar/archive.tgz",
+		Hit:              true,
+		Size:             1024,
+		TransferDuration: 1500 * time.Millisecond,
+		Duration:         2 * time.Second,
+		Success:          true,
+	}
+
+	err := o.Write(res)
+	if err != nil {
+		t.Fatalf("Write returned err: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read outputs: %v", err)
+	}
+
+	for _, want := range []string{
+		"S3_CACHE_ACTION=restore\n",
+		"S3_CACHE_KEY=foo/bar/archive.tgz\n",
+		"S3_CACHE_HIT=true\n",
+		"S3_CACHE_BYTES=1024\n",
+		"S3_CACHE_TRANSFER_SECONDS=1.500\n",
+		"S3_CACHE_DURATION_SECONDS=2.000\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("outputs is missing %q: %s", want, data)
+		}
+	}
+}
+
+func TestS3Cache_Outputs_Write_Disabled(t *testing.T) {
+	// setup types
+	o := &Outputs{}
+
+	err := o.Write(&Result{})
+	if err != nil {
+		t.Errorf("Write returned err: %v", err)
+	}
+}
+
+func TestS3Cache_Outputs_Write_Masked(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	o := &Outputs{
+		Path:       filepath.Join(dir, ".env"),
+		MaskedPath: filepath.Join(dir, "masked.env"),
+		Mask:       []string{"S3_CACHE_KEY", "sha256"},
+	}
+
+	res := &Result{
+		Action:   rebuildAction,
+		Key:      "secret/archive.tgz",
+		Checksum: "abc123",
+		Success:  true,
+	}
+
+	err := o.Write(res)
+	if err != nil {
+		t.Fatalf("Write returned err: %v", err)
+	}
+
+	outputs, err := os.ReadFile(o.Path)
+	if err != nil {
+		t.Fatalf("unable to read outputs: %v", err)
+	}
+
+	masked, err := os.ReadFile(o.MaskedPath)
+	if err != nil {
+		t.Fatalf("unable to read masked outputs: %v", err)
+	}
+
+	for _, want := range []string{"S3_CACHE_KEY=secret/archive.tgz\n", "S3_CACHE_SHA256=abc123\n"} {
+		if !strings.Contains(string(masked), want) {
+			t.Errorf("masked outputs is missing %q: %s", want, masked)
+		}
+
+		if strings.Contains(string(outputs), want) {
+			t.Errorf("outputs contains masked %q: %s", want, outputs)
+		}
+	}
+
+	if !strings.Contains(string(outputs), "S3_CACHE_ACTION=rebuild\n") {
+		t.Errorf("outputs is missing the action: %s", outputs)
+	}
+}
+
+func TestS3Cache_Outputs_Write_Presign(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	o := &Outputs{
+		Path:       filepath.Join(dir, ".env"),
+		MaskedPath: filepath.Join(dir, "masked.env"),
+	}
+
+	res := &Result{
+		Action:  presignAction,
+		Key:     "foo/bar/archive.tgz",
+		PutURL:  "https://s3.example.com/bucket/foo/bar/archive.tgz?method=PUT",
+		Expires: time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC),
+		Success: true,
+	}
+
+	err := o.Write(res)
+	if err != nil {
+		t.Fatalf("Write returned err: %v", err)
+	}
+
+	outputs, err := os.ReadFile(o.Path)
+	if err != nil {
+		t.Fatalf("unable to read outputs: %v", err)
+	}
+
+	masked, err := os.ReadFile(o.MaskedPath)
+	if err != nil {
+		t.Fatalf("unable to read masked outputs: %v", err)
+	}
+
+	// verify the upload URL is masked without being listed
+	if !strings.Contains(string(masked), "S3_CACHE_PUT_URL="+res.PutURL+"\n") {
+		t.Errorf("masked outputs is missing the upload URL: %s", masked)
+	}
+
+	if strings.Contains(string(outputs), "_URL=") {
+		t.Errorf("outputs contains an unmasked or empty URL: %s", outputs)
+	}
+}
+
+func TestS3Cache_Outputs_Validate(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		o       *Outputs
+		wantErr bool
+	}{
+		{desc: "unset", o: nil, wantErr: false},
+		{desc: "masked", o: &Outputs{MaskedPath: "masked.env", Mask: []string{"S3_CACHE_KEY"}}, wantErr: false},
+		{desc: "no masked path", o: &Outputs{Path: ".env", Mask: []string{"S3_CACHE_KEY"}}, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.o.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, want err: %v", err, tC.wantErr)
+			}
+		})
+	}
+}
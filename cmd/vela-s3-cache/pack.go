@@ -0,0 +1,461 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// dirBatchSize represents the number of directory entry names read at
+// once, so only the names of huge directories are held in memory.
+const dirBatchSize = 1024
+
+// paxPrefix represents the vendor prefix of the pax records
+// describing the cache in the global header of the archive.
+const paxPrefix = "VELA.cache."
+
+// EntryFilter represents a rule deciding from the header of an
+// entry whether to archive it, skipping the contents of a directory
+// along with it. The header may also be modified before it is written.
+type EntryFilter func(hdr *tar.Header) bool
+
+// PackOption represents an option composing the rules of the packer.
+type PackOption func(p *packer)
+
+// WithEntryFilter returns an option adding the filter to the rules
+// entries must pass to be archived, after the filters already added.
+func WithEntryFilter(filter EntryFilter) PackOption {
+	return func(p *packer) {
+		p.filters = append(p.filters, filter)
+	}
+}
+
+// packer represents the configuration for
+// building a cache archive from the mounts.
+type packer struct {
+	// whether to preserve the relative directory structure of the mounts
+	preservePath bool
+	// sets the gzip compression level of the archive
+	compressionLevel int
+	// sets the format of the archive, defaulting to tgz
+	format string
+	// sets the pax records to embed in a global header of the archive
+	metadata map[string]string
+	// sets the previous archive to append the changed entries to
+	previous string
+	// sets the policy for the symlinks in the mounts, defaulting to preserve
+	symlinks string
+	// sets the maximum number of links in a chain of dereferenced symlinks
+	symlinkDepth int
+	// whether to archive files and directories with normalized modes
+	normalizeModes bool
+	// sets the rules entries must pass to be archived
+	filters []EntryFilter
+	// whether to archive the targets of the mounts that are symlinks
+	followMounts bool
+
+	// will hold the information of the archive being written
+	destination os.FileInfo
+	// will hold the directories being walked while dereferencing symlinks
+	parents []os.FileInfo
+	// will hold the entries of the previous archive while appending
+	entries map[string]archiveEntry
+	// will hold the names of the entries walked while appending
+	seen map[string]bool
+	// will hold the number of entries changed since the previous archive
+	changed int
+	// will hold the bytes of the changed entries
+	added int64
+	// will hold the bytes of the previous entries replaced by changed entries
+	replaced int64
+	// will hold the entries of the manifest while computing its digest
+	manifest []string
+}
+
+// pack writes the mounts into the tar.gz archive at the destination,
+// writing each entry as it is walked rather than collecting them first.
+func (p *packer) pack(mounts []string, destination string) error {
+	logrus.Tracef("archiving %d mounts into %s", len(mounts), destination)
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// record the archive to avoid writing it into itself
+	p.destination, err = out.Stat()
+	if err != nil {
+		return err
+	}
+
+	// write a plain tarball without compression
+	if p.format == tarFormat {
+		tw := tar.NewWriter(out)
+
+		err = p.writeMetadata(tw)
+		if err != nil {
+			return fmt.Errorf("unable to create archive %s: %w", destination, err)
+		}
+
+		err = p.walkMounts(tw, mounts)
+
+		return errors.Join(err, tw.Close(), out.Close())
+	}
+
+	// append the changed entries to the previous archive when possible
+	if len(p.previous) > 0 {
+		ok, err := p.appendPrevious(out, mounts)
+		if err != nil {
+			return fmt.Errorf("unable to append to archive %s: %w", destination, err)
+		}
+
+		if ok {
+			return out.Close()
+		}
+	}
+
+	err = p.packGzip(out, func(tw *tar.Writer) error {
+		return p.walkMounts(tw, mounts)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create archive %s: %w", destination, err)
+	}
+
+	return out.Close()
+}
+
+// packGzip writes the entries written by the function into a gzip
+// compressed tar stream, writing the end of the tar stream as a separate
+// gzip member so entries can be appended without compressing it again.
+func (p *packer) packGzip(out io.Writer, write func(*tar.Writer) error) error {
+	// compress the tar stream with a pooled writer
+	gw, err := getGzipWriter(out, p.compressionLevel)
+	if err != nil {
+		return err
+	}
+
+	trw := &trailerWriter{w: gw}
+	tw := tar.NewWriter(trw)
+
+	err = p.writeMetadata(tw)
+	if err == nil {
+		err = write(tw)
+	}
+
+	// close the archive to flush the compressed stream, even on failure
+	cErr := tw.Close()
+
+	trailer, tErr := trw.Close()
+
+	cErr = errors.Join(cErr, tErr, gw.Close())
+
+	putGzipWriter(gw, p.compressionLevel)
+
+	if err != nil {
+		return err
+	}
+
+	if cErr != nil {
+		return fmt.Errorf("closing: %w", cErr)
+	}
+
+	if !trailer {
+		return nil
+	}
+
+	_, err = out.Write(gzipTrailer())
+
+	return err
+}
+
+// writeMetadata writes the metadata as a pax global header at the start
+// of the tar stream, so the archive describes itself outside of s3.
+func (p *packer) writeMetadata(tw *tar.Writer) error {
+	if len(p.metadata) == 0 {
+		return nil
+	}
+
+	logrus.Tracef("embedding %d metadata records in archive", len(p.metadata))
+
+	return tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: p.metadata,
+		Format:     tar.FormatPAX,
+	})
+}
+
+// walkMounts writes the entries of every mount to the archive.
+func (p *packer) walkMounts(tw *tar.Writer, mounts []string) error {
+	for _, mount := range mounts {
+		info, err := os.Lstat(mount)
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", mount, err)
+		}
+
+		// archive the target of a mount that is a symlink
+		if p.followMounts && info.Mode()&os.ModeSymlink != 0 {
+			info, err = followMount(mount)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = p.walk(tw, mount, p.mountName(mount), info)
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", mount, err)
+		}
+	}
+
+	return nil
+}
+
+// mountName returns the name of the entry of the mount in the archive.
+func (p *packer) mountName(mount string) string {
+	name := filepath.Base(mount)
+
+	// prepend the directory of the mount to the names of its entries,
+	// without the volume name of a windows path
+	if p.preservePath {
+		dir := strings.TrimPrefix(filepath.Dir(mount), filepath.VolumeName(mount))
+
+		name = path.Join(filepath.ToSlash(dir), name)
+	}
+
+	return name
+}
+
+// walk writes the path to the archive with the name and, for
+// a directory, every entry below it in batches of entries.
+func (p *packer) walk(tw *tar.Writer, fpath, name string, info os.FileInfo) error {
+	// make sure the archive is not copied into itself
+	if os.SameFile(info, p.destination) {
+		return nil
+	}
+
+	// apply the policy for symlinks
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+
+		info, err = p.symlink(fpath, info)
+		if err != nil || info == nil {
+			return err
+		}
+	}
+
+	hdr, err := p.header(fpath, name, info)
+	if err != nil {
+		return err
+	}
+
+	// skip the entries left out by a filter
+	if !p.include(hdr) {
+		logrus.Tracef("skipping %s filtered from the archive", fpath)
+
+		return nil
+	}
+
+	// skip the entries unchanged since the previous archive
+	skip, err := p.unchanged(fpath, name, info)
+	if err == nil && !skip {
+		err = p.write(tw, fpath, hdr, info)
+	}
+
+	if err != nil || !info.IsDir() {
+		return err
+	}
+
+	leave, err := p.enterDir(fpath, info)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	names, err := readDirNames(fpath)
+	if err != nil {
+		return err
+	}
+
+	// archive the entries in a stable order regardless of the file system
+	sort.Strings(names)
+
+	for _, n := range names {
+		epath := filepath.Join(fpath, n)
+
+		eInfo, err := os.Lstat(epath)
+		if err != nil {
+			return err
+		}
+
+		err = p.walk(tw, epath, path.Join(name, n), eInfo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDirNames is a helper function to read the names of the entries in
+// the directory in batches, so only their names are held in memory.
+func readDirNames(fpath string) ([]string, error) {
+	dir, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names := []string{}
+
+	for {
+		batch, err := dir.Readdirnames(dirBatchSize)
+
+		names = append(names, batch...)
+
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading directory: %w", fpath, err)
+		}
+	}
+}
+
+// header creates the header of the entry with the name for the file.
+func (p *packer) header(fpath, name string, info fs.FileInfo) (*tar.Header, error) {
+	hdr, err := fileHeader(fpath, name, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.normalizeModes {
+		hdr.Mode = int64(p.mode(info).Perm())
+	}
+
+	return hdr, nil
+}
+
+// with applies the options to the packer.
+func (p *packer) with(opts ...PackOption) *packer {
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// include reports whether the entry with the header passes every filter.
+func (p *packer) include(hdr *tar.Header) bool {
+	for _, filter := range p.filters {
+		if !filter(hdr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// write writes a single entry with the header to the archive.
+func (p *packer) write(tw *tar.Writer, fpath string, hdr *tar.Header, info fs.FileInfo) error {
+	// record the entry in the manifest instead of archiving it
+	if p.manifest != nil {
+		p.manifest = append(p.manifest, manifestEntry(hdr))
+
+		return nil
+	}
+
+	err := tw.WriteHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("%s: writing header: %w", fpath, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("%s: opening: %w", fpath, err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	if err != nil {
+		return fmt.Errorf("%s: copying contents: %w", fpath, err)
+	}
+
+	return nil
+}
+
+// mode returns the mode to archive the file with, normalizing
+// the permissions of files and directories when enabled so the
+// archive doesn't depend on the umask of the builder.
+func (p *packer) mode(info fs.FileInfo) fs.FileMode {
+	mode := info.Mode()
+
+	if !p.normalizeModes {
+		return mode
+	}
+
+	switch {
+	case mode.IsDir():
+		return fs.ModeDir | 0755
+	case !mode.IsRegular():
+		return mode
+	case mode&0111 != 0:
+		// keep files executable, i.e. binaries in node_modules/.bin
+		return 0755
+	default:
+		return 0644
+	}
+}
+
+// fileHeader is a helper function to create the header of the entry
+// with the name for the file. The header always uses the PAX format,
+// so long names, large sizes and the precise modification time are
+// kept as PAX records instead of being truncated or rounded by the
+// USTAR and GNU formats.
+func fileHeader(fpath, name string, info fs.FileInfo) (*tar.Header, error) {
+	var link string
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: readlink: %w", fpath, err)
+		}
+
+		link = filepath.ToSlash(target)
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, fmt.Errorf("%s: making header: %w", fpath, err)
+	}
+
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	hdr.Format = tar.FormatPAX
+
+	// the access and change times only vary the archive
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+
+	return hdr, nil
+}
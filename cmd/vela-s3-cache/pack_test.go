@@ -0,0 +1,516 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// largeFileInfo is a fs.FileInfo for a regular file
+// too large for the size field of a USTAR header.
+type largeFileInfo struct{}
+
+func (largeFileInfo) Name() string       { return "large.bin" }
+func (largeFileInfo) Size() int64        { return 10 << 30 }
+func (largeFileInfo) Mode() fs.FileMode  { return 0644 }
+func (largeFileInfo) ModTime() time.Time { return time.Unix(1700000000, 123456789) }
+func (largeFileInfo) IsDir() bool        { return false }
+func (largeFileInfo) Sys() any           { return nil }
+
+// archiveNames is a helper function to list the sorted entry names of a tar.gz archive.
+func archiveNames(t *testing.T, archive string) []string {
+	t.Helper()
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	tr := tar.NewReader(gr)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestS3Cache_packer_pack(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	for _, dir := range []string{"cache/a/b", "cache/c"} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []string{"cache/a/b/one.txt", "cache/c/two.txt", "three.txt"} {
+		err := os.WriteFile(file, []byte(file), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Symlink("c/two.txt", "cache/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc     string
+		preserve bool
+		mounts   []string
+		want     []string
+	}{
+		{
+			desc:   "mounts",
+			mounts: []string{"cache", "three.txt"},
+			want: []string{
+				"cache/", "cache/a/", "cache/a/b/", "cache/a/b/one.txt",
+				"cache/c/", "cache/c/two.txt", "cache/link", "three.txt",
+			},
+		},
+		{
+			desc:     "preserve path",
+			preserve: true,
+			mounts:   []string{"cache/a/b", "cache/c/two.txt"},
+			want:     []string{"cache/a/b/", "cache/a/b/one.txt", "cache/c/two.txt"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+			p := &packer{preservePath: tC.preserve}
+
+			err := p.pack(tC.mounts, archive)
+			if err != nil {
+				t.Fatalf("pack returned err: %v", err)
+			}
+
+			if got := archiveNames(t, archive); !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("archive entries are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_packer_pack_Order(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.Mkdir("cache", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// span more than one batch of directory entries
+	for i := dirBatchSize + 100; i > 0; i-- {
+		err = os.WriteFile(filepath.Join("cache", fmt.Sprintf("%05d.txt", i)), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = new(packer).pack([]string{"cache"}, "archive.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	f, err := os.Open("archive.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	tr := tar.NewReader(gr)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+	}
+
+	// verify the entries are archived in a stable order
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("archive entries are not sorted")
+	}
+
+	if len(names) != dirBatchSize+101 {
+		t.Errorf("archive has %d entries, want %d", len(names), dirBatchSize+101)
+	}
+}
+
+func TestS3Cache_packer_pack_Destination(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.WriteFile("hello.txt", []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stage the archive inside of the mount
+	err = new(packer).pack([]string{"."}, "archive.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	want := []string{"./", "hello.txt"}
+
+	if got := archiveNames(t, "archive.tgz"); !reflect.DeepEqual(got, want) {
+		t.Errorf("archive entries are %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_packer_pack_Metadata(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.WriteFile("hello.txt", []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{paxPrefix + "repo": "go-vela/hello-world", paxPrefix + "format": cacheFormat}
+
+	p := &packer{metadata: want}
+
+	err = p.pack([]string{"hello.txt"}, "archive.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	f, err := os.Open("archive.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verify the metadata is the first entry of the archive
+	hdr, err := tar.NewReader(gr).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hdr.Typeflag != tar.TypeXGlobalHeader {
+		t.Fatalf("first entry type is %c, want %c", hdr.Typeflag, tar.TypeXGlobalHeader)
+	}
+
+	if !reflect.DeepEqual(hdr.PAXRecords, want) {
+		t.Errorf("pax records are %v, want %v", hdr.PAXRecords, want)
+	}
+
+	// verify the metadata is not extracted
+	dir := filepath.Join(t.TempDir(), "dest")
+
+	err = new(extractor).extract("archive.tgz", dir)
+	if err != nil {
+		t.Fatalf("extract returned err: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "hello.txt" {
+		t.Errorf("extracted entries are %v, want [hello.txt]: %v", entries, err)
+	}
+}
+
+func TestS3Cache_packer_pack_PAX(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	// nest packages deep enough to exceed the 255 character limit of USTAR
+	dir := "node_modules"
+	for _, pkg := range []string{"@babel/core", "@babel/helper-module-transforms", "@babel/helper-simple-access", "@babel/types", "@babel/helper-validator-identifier", "to-fast-properties"} {
+		dir = path.Join(dir, pkg, "node_modules")
+	}
+
+	name := path.Join(dir, "a-package-with-a-rather-long-name-for-good-measure", "package.json")
+	if len(name) <= 255 {
+		t.Fatalf("name is %d characters, want more than 255", len(name))
+	}
+
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(name, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := time.Unix(1700000000, 123456789)
+
+	err = os.Chtimes(name, modified, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = new(packer).pack([]string{"node_modules"}, "archive.tgz")
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	f, err := os.Open("archive.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hdr *tar.Header
+
+	tr := tar.NewReader(gr)
+
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.HasSuffix(h.Name, "package.json") {
+			hdr = h
+		}
+	}
+
+	if hdr == nil {
+		t.Fatalf("archive is missing %s", name)
+	}
+
+	if hdr.Name != name {
+		t.Errorf("Name is %s, want %s", hdr.Name, name)
+	}
+
+	if !hdr.ModTime.Equal(modified) {
+		t.Errorf("ModTime is %s, want %s", hdr.ModTime, modified)
+	}
+
+	if hdr.Format&tar.FormatPAX == 0 {
+		t.Errorf("Format is %s, want %s", hdr.Format, tar.FormatPAX)
+	}
+
+	// verify the long name is extracted in full
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	err = new(extractor).extract("archive.tgz", dest)
+	if err != nil {
+		t.Fatalf("extract returned err: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(dest, name))
+	if err != nil {
+		t.Errorf("extracted file is missing: %v", err)
+	}
+}
+
+func TestS3Cache_fileHeader_LargeSize(t *testing.T) {
+	// setup types
+	info := largeFileInfo{}
+
+	hdr, err := fileHeader("large.bin", "cache/large.bin", info)
+	if err != nil {
+		t.Fatalf("fileHeader returned err: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = tar.NewWriter(buf).WriteHeader(hdr)
+	if err != nil {
+		t.Fatalf("WriteHeader returned err: %v", err)
+	}
+
+	got, err := tar.NewReader(buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Size != info.Size() {
+		t.Errorf("Size is %d, want %d", got.Size, info.Size())
+	}
+
+	if got.Format&tar.FormatPAX == 0 {
+		t.Errorf("Format is %s, want %s", got.Format, tar.FormatPAX)
+	}
+
+	if !got.ModTime.Equal(info.ModTime()) {
+		t.Errorf("ModTime is %s, want %s", got.ModTime, info.ModTime())
+	}
+}
+
+func TestS3Cache_packer_pack_NormalizeModes(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.Mkdir("cache", 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mode := range map[string]os.FileMode{"cache/file.txt": 0600, "cache/run.sh": 0700} {
+		err = os.WriteFile(name, []byte("file"), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the umask may have dropped the permissions
+		err = os.Chmod(name, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = os.Symlink("file.txt", "cache/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc      string
+		normalize bool
+		want      map[string]int64
+	}{
+		{
+			desc:      "normalized",
+			normalize: true,
+			want:      map[string]int64{"cache/": 0755, "cache/file.txt": 0644, "cache/run.sh": 0755, "cache/link": 0777},
+		},
+		{
+			desc:      "unchanged",
+			normalize: false,
+			want:      map[string]int64{"cache/": 0700, "cache/file.txt": 0600, "cache/run.sh": 0700, "cache/link": 0777},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "archive.tar")
+
+			err := (&packer{format: tarFormat, normalizeModes: tC.normalize}).pack([]string{"cache"}, archive)
+			if err != nil {
+				t.Fatalf("pack returned err: %v", err)
+			}
+
+			f, err := os.Open(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got := map[string]int64{}
+
+			tr := tar.NewReader(f)
+
+			for {
+				hdr, err := tr.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got[hdr.Name] = hdr.Mode
+			}
+
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("modes are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_packer_pack_Filters(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.MkdirAll("cache/skip/nested", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"cache/keep.txt", "cache/debug.log", "cache/skip/nested/file.txt"} {
+		err = os.WriteFile(name, []byte("file"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := new(packer).with(
+		WithEntryFilter(func(hdr *tar.Header) bool { return hdr.Name != "cache/skip/" }),
+		WithEntryFilter(func(hdr *tar.Header) bool { return path.Ext(hdr.Name) != ".log" }),
+	)
+
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	err = p.pack([]string{"cache"}, archive)
+	if err != nil {
+		t.Fatalf("pack returned err: %v", err)
+	}
+
+	want := []string{"cache/", "cache/keep.txt"}
+
+	if got := archiveNames(t, archive); !reflect.DeepEqual(got, want) {
+		t.Errorf("archive entries are %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const pinAction = "pin"
+
+// Pin represents the plugin configuration for pinning a cache object.
+type Pin struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets the path for where the object is stored
+	Path string
+	// sets the path prefix for where the object is stored
+	Prefix string
+	// sets the name of the cache object
+	Filename string
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// whether to remove the pin instead of adding it
+	Unpin bool
+	// will hold our final namespace for the path to the object
+	Namespace string
+}
+
+// Exec formats and runs the actions for pinning a cache object in s3.
+func (p *Pin) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running pin with provided configuration")
+
+	res.Key = p.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	info, err := store.Stat(ctx, p.Bucket, p.Namespace)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve object %s: %w", p.Namespace, err)
+	}
+
+	keys := []string{p.Namespace}
+
+	// pin the parts of a split archive along with its index
+	if parts := userMetadata(info, metaParts); len(parts) > 0 {
+		count, err := strconv.Atoi(parts)
+		if err != nil {
+			return fmt.Errorf("invalid number of parts %s for %s: %w", parts, p.Namespace, err)
+		}
+
+		for i := range count {
+			keys = append(keys, partKey(p.Namespace, i))
+		}
+	}
+
+	for _, key := range keys {
+		err = p.tag(ctx, store, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	res.Pinned = !p.Unpin
+
+	if p.Unpin {
+		logrus.Infof("unpinned %s, it can be removed by the flush action again", p.Namespace)
+	} else {
+		logrus.Infof("pinned %s, it is kept by the flush action", p.Namespace)
+	}
+
+	return nil
+}
+
+// tag adds or removes the pin tag of the key, keeping its other tags.
+func (p *Pin) tag(ctx context.Context, store storage.Backend, key string) error {
+	tags, err := store.GetTags(ctx, p.Bucket, key)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve tags of %s: %w", key, err)
+	}
+
+	if tags == nil {
+		tags = map[string]string{}
+	}
+
+	if p.Unpin {
+		delete(tags, tagPin)
+	} else {
+		tags[tagPin] = "true"
+	}
+
+	logrus.Debugf("setting tags %v of %s in bucket %s", tags, key, p.Bucket)
+
+	err = store.SetTags(ctx, p.Bucket, key, tags)
+	if err != nil {
+		return fmt.Errorf("unable to set tags of %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Configure prepares the pin fields for the action to be taken.
+func (p *Pin) Configure(repo *Repo) error {
+	logrus.Trace("configuring pin action")
+
+	// construct the object path
+	path, err := buildNamespace(repo, p.Prefix, p.Path, p.Filename)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	// store it in the namespace
+	p.Namespace = path
+
+	return nil
+}
+
+// Validate verifies the Pin is properly configured.
+func (p *Pin) Validate() error {
+	logrus.Trace("validating pin action configuration")
+
+	// verify bucket is provided
+	if len(p.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify filename is provided
+	if len(p.Filename) == 0 {
+		return fmt.Errorf("no filename provided")
+	}
+
+	// verify timeout is provided
+	if p.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Pin_Exec(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("index"), time.Now(), map[string]string{metaParts: "2"})
+	store.tag("foo/bar/archive.tgz", map[string]string{tagTTL: "24h0m0s"})
+	store.add("foo/bar/archive.tgz.000", []byte("part"), time.Now(), nil)
+	store.add("foo/bar/archive.tgz.001", []byte("part"), time.Now(), nil)
+
+	p := &Pin{
+		Bucket:    "bucket",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	res := new(Result)
+
+	err := p.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !res.Pinned {
+		t.Error("Pinned is false, want true")
+	}
+
+	// verify the other tags are kept
+	want := map[string]string{tagTTL: "24h0m0s", tagPin: "true"}
+
+	if got := store.objects["foo/bar/archive.tgz"].tags; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags are %v, want %v", got, want)
+	}
+
+	// verify the parts are pinned along with the index
+	for _, key := range []string{"foo/bar/archive.tgz.000", "foo/bar/archive.tgz.001"} {
+		if store.objects[key].tags[tagPin] != "true" {
+			t.Errorf("tags of %s are %v, want pinned", key, store.objects[key].tags)
+		}
+	}
+
+	p.Unpin = true
+
+	err = p.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	want = map[string]string{tagTTL: "24h0m0s"}
+
+	if got := store.objects["foo/bar/archive.tgz"].tags; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags are %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_Pin_Exec_Missing(t *testing.T) {
+	// setup types
+	p := &Pin{
+		Bucket:    "bucket",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := p.Exec(context.Background(), newFakeBackend(), new(Result))
+	if err == nil {
+		t.Error("Exec should have returned err")
+	}
+}
+
+func TestS3Cache_Pin_Validate(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		pin     *Pin
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			pin:  &Pin{Bucket: "bucket", Filename: "archive.tgz", Timeout: 10 * time.Minute},
+		},
+		{
+			desc:    "no bucket",
+			pin:     &Pin{Filename: "archive.tgz", Timeout: 10 * time.Minute},
+			wantErr: true,
+		},
+		{
+			desc:    "no filename",
+			pin:     &Pin{Bucket: "bucket", Timeout: 10 * time.Minute},
+			wantErr: true,
+		},
+		{
+			desc:    "no timeout",
+			pin:     &Pin{Bucket: "bucket", Filename: "archive.tgz"},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.pin.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Pin(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+		Pin:       true,
+	}
+
+	err := r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if got := store.objects["foo/bar/archive.tgz"].tags; got[tagPin] != "true" {
+		t.Errorf("tags are %v, want pinned", got)
+	}
+}
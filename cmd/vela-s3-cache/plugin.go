@@ -3,11 +3,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 )
 
 // ErrInvalidAction defines the error type when the
@@ -18,51 +25,183 @@ var ErrInvalidAction = errors.New("invalid action provided")
 type Plugin struct {
 	// config arguments loaded for the plugin
 	Config *Config
+	// abort arguments loaded for the plugin
+	Abort *Abort
+	// benchmark arguments loaded for the plugin
+	Benchmark *Benchmark
+	// check arguments loaded for the plugin
+	Check *Check
 	// flush arguments loaded for the plugin
 	Flush *Flush
+	// lifecycle arguments loaded for the plugin
+	Lifecycle *Lifecycle
+	// list arguments loaded for the plugin
+	List *List
+	// pin arguments loaded for the plugin
+	Pin *Pin
+	// presign arguments loaded for the plugin
+	Presign *Presign
 	// rebuild arguments loaded for the plugin
 	Rebuild *Rebuild
 	// restore arguments loaded for the plugin
 	Restore *Restore
+	// stats arguments loaded for the plugin
+	Stats *Stats
 	// repo settings loaded for the plugin
 	Repo *Repo
+	// build settings loaded for the plugin
+	Build *Build
+	// metrics settings loaded for the plugin
+	Metrics *Metrics
+	// outputs settings loaded for the plugin
+	Outputs *Outputs
+	// webhook settings loaded for the plugin
+	Webhook *Webhook
+	// audit settings loaded for the plugin
+	Audit *Audit
+	// cache definitions loaded for the plugin
+	Caches []*Cache
+
+	// will hold a configured copy of the plugin for each cache
+	caches []*Plugin
 }
 
 // Exec runs the plugin with the settings passed from user.
-func (p *Plugin) Exec() (err error) {
+func (p *Plugin) Exec(ctx context.Context) (err error) {
 	logrus.Info("s3 cache plugin starting...")
 
-	// create a minio client
-	logrus.Info("creating an s3 client")
+	var store storage.Backend
 
-	mc, err := p.Config.New()
-	if err != nil {
-		return err
+	// create a storage backend, unless the action only archives locally
+	if p.Config.Action != benchmarkAction {
+		logrus.Debug("creating an s3 client")
+
+		store, err = p.Config.New()
+		if err != nil {
+			return err
+		}
+
+		logrus.Debug("s3 client created")
+
+		// record the operations modifying the bucket in the audit log
+		store, err = p.Audit.Wrap(store, p.Repo, p.Build, p.Config.Action)
+		if err != nil {
+			return err
+		}
+
+		defer p.Audit.Close()
+	}
+
+	// execute the action for each cache definition in order
+	if len(p.caches) > 0 {
+		errs := []error{}
+
+		for i, cp := range p.caches {
+			logrus.Infof("processing cache %d of %d", i+1, len(p.caches))
+
+			err = cp.exec(ctx, store)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cache %d: %w", i+1, err))
+			}
+		}
+
+		return errors.Join(errs...)
 	}
 
-	logrus.Info("s3 client created")
+	return p.exec(ctx, store)
+}
+
+// exec runs the configured action against the storage backend.
+func (p *Plugin) exec(ctx context.Context, store storage.Backend) (err error) {
+	res := &Result{Action: p.Config.Action, DryRun: p.Config.DryRun}
+	start := time.Now()
 
 	// execute action specific configuration
 	switch p.Config.Action {
+	case abortAction:
+		// execute abort-incomplete action
+		err = p.Abort.Exec(ctx, store, res)
+	case benchmarkAction:
+		// execute benchmark action
+		err = p.Benchmark.Exec(ctx, res)
+	case checkAction:
+		// execute check action
+		err = p.Check.Exec(ctx, store, res)
 	case flushAction:
 		// execute flush action
-		return p.Flush.Exec(mc)
+		err = p.Flush.Exec(ctx, store, res)
+	case lifecycleAction:
+		// execute lifecycle action
+		err = p.Lifecycle.Exec(ctx, store, res)
+	case listAction:
+		// execute list action
+		err = p.List.Exec(ctx, store, res)
+	case pinAction:
+		// execute pin action
+		err = p.Pin.Exec(ctx, store, res)
+	case presignAction:
+		// execute presign action
+		err = p.Presign.Exec(ctx, store, res)
 	case rebuildAction:
 		// execute rebuild action
-		return p.Rebuild.Exec(mc)
+		err = p.Rebuild.Exec(ctx, store, res)
 	case restoreAction:
 		// execute restore action
-		return p.Restore.Exec(mc)
+		err = p.Restore.Exec(ctx, store, res)
+	case statsAction:
+		// execute stats action
+		err = p.Stats.Exec(ctx, store, res)
 	default:
 		return fmt.Errorf(
-			"%w: %s (Valid actions: %s, %s, %s)",
+			"%w: %s (Valid actions: %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)",
 			ErrInvalidAction,
 			p.Config.Action,
+			abortAction,
+			benchmarkAction,
+			checkAction,
 			flushAction,
+			lifecycleAction,
+			listAction,
+			pinAction,
+			presignAction,
 			rebuildAction,
 			restoreAction,
+			statsAction,
 		)
 	}
+
+	res.Duration = time.Since(start)
+	res.Success = err == nil
+
+	logrus.Info(res.Summary())
+
+	// write the outputs for the action without failing the build
+	oErr := p.Outputs.Write(res)
+	if oErr != nil {
+		logrus.Warn(oErr)
+	}
+
+	// count the use of the cache without failing the build
+	sErr := p.Stats.Record(ctx, store, res)
+	if sErr != nil {
+		logrus.Warn(sErr)
+	}
+
+	// emit the metrics for the action without failing the build
+	if !res.DryRun {
+		mErr := p.Metrics.Emit(ctx, p.Repo, res)
+		if mErr != nil {
+			logrus.Warn(mErr)
+		}
+	}
+
+	// notify the webhook of the result without failing the build
+	wErr := p.Webhook.Send(ctx, p.Repo, res)
+	if wErr != nil {
+		logrus.Warn(wErr)
+	}
+
+	return err
 }
 
 // Validate verifies the Config is properly configured.
@@ -75,14 +214,122 @@ func (p *Plugin) Validate() error {
 		return err
 	}
 
+	// keep the probe and stats from being written with the read credentials
+	if p.Check != nil {
+		p.Check.ReadOnly = p.Config.readCredentials()
+	}
+
+	if p.Stats != nil {
+		p.Stats.ReadOnly = p.Config.readCredentials()
+	}
+
+	// send the webhook with the TLS settings of the plugin
+	if p.Webhook != nil {
+		p.Webhook.transport = p.Config.transport(http.DefaultTransport.(*http.Transport).Clone())
+	}
+
 	// validate repo configuration
 	err = p.Repo.Validate()
 	if err != nil {
 		return err
 	}
 
+	// execute the templates in the keys with the build variables
+	err = p.expandKeys()
+	if err != nil {
+		return err
+	}
+
+	// validate outputs configuration
+	err = p.Outputs.Validate()
+	if err != nil {
+		return err
+	}
+
+	// presigned uploads are sent without the server-side encryption
+	if p.Config.RequireSSE && p.Config.Action == presignAction && p.Presign != nil && p.Presign.Put {
+		return fmt.Errorf("presigned uploads can not be created when server-side encryption is required by the platform")
+	}
+
+	// keep stdout for the contents of the cache
+	if p.Audit != nil && p.Audit.Path == "stdout" && p.Restore != nil && p.Restore.Stdout {
+		return fmt.Errorf("audit log can not be written to stdout with restore stdout")
+	}
+
+	// validate each cache definition separately
+	if len(p.Caches) > 0 {
+		p.caches = nil
+
+		for i, c := range p.Caches {
+			cp, err := p.withCache(c)
+			if err != nil {
+				return fmt.Errorf("cache %d: %w", i+1, err)
+			}
+
+			err = cp.validateAction()
+			if err != nil {
+				return fmt.Errorf("cache %d: %w", i+1, err)
+			}
+
+			err = cp.validateDenyList()
+			if err != nil {
+				return fmt.Errorf("cache %d: %w", i+1, err)
+			}
+
+			err = cp.validateBucketRole()
+			if err != nil {
+				return fmt.Errorf("cache %d: %w", i+1, err)
+			}
+
+			p.caches = append(p.caches, cp)
+		}
+
+		return nil
+	}
+
+	err = p.validateAction()
+	if err != nil {
+		return err
+	}
+
+	// verify the action does not target a denied bucket or prefix
+	err = p.validateDenyList()
+	if err != nil {
+		return err
+	}
+
+	// verify the bucket of the action can be accessed with the bucket roles
+	return p.validateBucketRole()
+}
+
+// validateAction configures and verifies the action specific configuration.
+func (p *Plugin) validateAction() error {
 	// validate action specific configuration
 	switch p.Config.Action {
+	case abortAction:
+		err := p.Abort.Configure(p.Repo)
+		if err != nil {
+			return err
+		}
+
+		// validate abort-incomplete action
+		return p.Abort.Validate()
+	case benchmarkAction:
+		err := p.Benchmark.Configure()
+		if err != nil {
+			return err
+		}
+
+		// validate benchmark action
+		return p.Benchmark.Validate()
+	case checkAction:
+		err := p.Check.Configure(p.Repo)
+		if err != nil {
+			return err
+		}
+
+		// validate check action
+		return p.Check.Validate()
 	case flushAction:
 		err := p.Flush.Configure(p.Repo)
 		if err != nil {
@@ -91,8 +338,45 @@ func (p *Plugin) Validate() error {
 
 		// validate flush action
 		return p.Flush.Validate()
+	case lifecycleAction:
+		err := p.Lifecycle.Configure()
+		if err != nil {
+			return err
+		}
+
+		// validate lifecycle action
+		return p.Lifecycle.Validate()
+	case listAction:
+		err := p.List.Configure(p.Repo)
+		if err != nil {
+			return err
+		}
+
+		// validate list action
+		return p.List.Validate()
+	case pinAction:
+		err := p.Pin.Configure(p.Repo)
+		if err != nil {
+			return err
+		}
+
+		// validate pin action
+		return p.Pin.Validate()
+	case presignAction:
+		err := p.Presign.Configure(p.Repo)
+		if err != nil {
+			return err
+		}
+
+		// verify the upload URL has a masked outputs file to be written to
+		if p.Presign.Put && (p.Outputs == nil || len(p.Outputs.MaskedPath) == 0) {
+			return fmt.Errorf("no masked outputs file provided for the presigned upload URL")
+		}
+
+		// validate presign action
+		return p.Presign.Validate()
 	case rebuildAction:
-		err := p.Rebuild.Configure(p.Repo)
+		err := p.Rebuild.Configure(p.Repo, p.Build)
 		if err != nil {
 			return err
 		}
@@ -107,21 +391,57 @@ func (p *Plugin) Validate() error {
 
 		// validate restore action
 		return p.Restore.Validate()
+	case statsAction:
+		err := p.Stats.Configure(p.Repo)
+		if err != nil {
+			return err
+		}
+
+		// validate stats action
+		return p.Stats.Validate()
 	default:
 		return fmt.Errorf(
-			"%w: %s (Valid actions: %s, %s, %s)",
+			"%w: %s (Valid actions: %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)",
 			ErrInvalidAction,
 			p.Config.Action,
+			abortAction,
+			benchmarkAction,
+			checkAction,
 			flushAction,
+			lifecycleAction,
+			listAction,
+			pinAction,
+			presignAction,
 			rebuildAction,
 			restoreAction,
+			statsAction,
 		)
 	}
 }
 
 // buildNamespace is a helper function to create a namespace
 // given a Repo object and path fragment inputs.
-func buildNamespace(r *Repo, prefix, path, filename string) string {
+func buildNamespace(r *Repo, prefix, path, filename string) (string, error) {
+	// verify the fragments cannot escape the namespace
+	err := validateKeyPart("prefix", prefix)
+	if err != nil {
+		return "", err
+	}
+
+	err = validateKeyPart("path", path)
+	if err != nil {
+		return "", err
+	}
+
+	err = validateKeyPart("filename", filename)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(filename, "/") {
+		return "", fmt.Errorf("invalid filename %s: must not contain /", filename)
+	}
+
 	// set the default path for where to store the object
 	p := filepath.Join(prefix, r.Owner, r.Name, filename)
 
@@ -130,5 +450,34 @@ func buildNamespace(r *Repo, prefix, path, filename string) string {
 		p = filepath.Join(path, filename)
 	}
 
-	return filepath.Clean(p)
+	return filepath.Clean(p), nil
+}
+
+// validateKeyPart is a helper function to verify a user supplied
+// fragment of an object key cannot reference a key outside of the
+// namespace in a shared bucket.
+func validateKeyPart(name, value string) error {
+	// absolute keys bypass the prefix and repository
+	if strings.HasPrefix(value, "/") {
+		return fmt.Errorf("invalid %s %s: must not start with /", name, value)
+	}
+
+	// some clients treat a backslash as a delimiter
+	if strings.Contains(value, "\\") {
+		return fmt.Errorf("invalid %s %s: must not contain \\", name, value)
+	}
+
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("invalid %s %q: must not contain control characters", name, value)
+		}
+	}
+
+	for _, element := range strings.Split(value, "/") {
+		if element == ".." {
+			return fmt.Errorf("invalid %s %s: must not contain ..", name, value)
+		}
+	}
+
+	return nil
 }
@@ -25,7 +25,8 @@ func TestS3Cache_Plugin_Validate(t *testing.T) {
 			BuildBranch: "main",
 		},
 		Flush: &Flush{
-			Bucket: "bucket",
+			Timeout: timeout,
+			Bucket:  "bucket",
 		},
 		Rebuild: &Rebuild{
 			Timeout:  timeout,
@@ -54,6 +55,7 @@ func TestS3Cache_Plugin_buildNamespace(t *testing.T) {
 		path     string
 		filename string
 		want     string
+		wantErr  bool
 	}{
 		{
 			desc:     "basic",
@@ -103,10 +105,55 @@ func TestS3Cache_Plugin_buildNamespace(t *testing.T) {
 			filename: "",
 			want:     ".",
 		},
+		{
+			desc:    "prefix w/ parent directory",
+			repo:    &Repo{"foo", "bar", "", ""},
+			prefix:  "../other",
+			wantErr: true,
+		},
+		{
+			desc:    "path w/ leading slash",
+			repo:    &Repo{"foo", "bar", "", ""},
+			path:    "/other/repo",
+			wantErr: true,
+		},
+		{
+			desc:    "path w/ parent directory",
+			repo:    &Repo{"foo", "bar", "", ""},
+			path:    "foo/bar/../../other/repo",
+			wantErr: true,
+		},
+		{
+			desc:    "path w/ backslash",
+			repo:    &Repo{"foo", "bar", "", ""},
+			path:    "foo\\..\\other",
+			wantErr: true,
+		},
+		{
+			desc:    "prefix w/ control character",
+			repo:    &Repo{"foo", "bar", "", ""},
+			prefix:  "prefix\n",
+			wantErr: true,
+		},
+		{
+			desc:     "filename w/ slash",
+			repo:     &Repo{"foo", "bar", "", ""},
+			filename: "other/archive.tgz",
+			wantErr:  true,
+		},
+		{
+			desc:     "filename w/ parent directory",
+			repo:     &Repo{"foo", "bar", "", ""},
+			filename: "..",
+			wantErr:  true,
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
-			path := buildNamespace(tC.repo, tC.prefix, tC.path, tC.filename)
+			path, err := buildNamespace(tC.repo, tC.prefix, tC.path, tC.filename)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("test name: %s\nbuildNamespace returned err: %v", tC.desc, err)
+			}
 
 			if path != tC.want {
 				t.Errorf("test name: %s\nwant: %s, got: %s", tC.desc, tC.want, path)
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/pgzip"
+)
+
+// gzipWriters holds the pools of gzip writers per compression level, so
+// a run building several caches reuses the compressors and their buffers
+// instead of allocating them for every archive.
+var gzipWriters sync.Map
+
+// getGzipWriter is a helper function to return a gzip writer with the
+// compression level writing to w, reusing a pooled writer when available.
+func getGzipWriter(w io.Writer, level int) (*pgzip.Writer, error) {
+	pool, _ := gzipWriters.LoadOrStore(level, &sync.Pool{})
+
+	if gw, ok := pool.(*sync.Pool).Get().(*pgzip.Writer); ok {
+		gw.Reset(w)
+
+		return gw, nil
+	}
+
+	return pgzip.NewWriterLevel(w, level)
+}
+
+// putGzipWriter is a helper function to return the closed
+// gzip writer with the compression level to its pool.
+func putGzipWriter(gw *pgzip.Writer, level int) {
+	pool, _ := gzipWriters.LoadOrStore(level, &sync.Pool{})
+
+	// release the destination before the writer sits in the pool
+	gw.Reset(io.Discard)
+
+	pool.(*sync.Pool).Put(gw)
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestS3Cache_getGzipWriter(t *testing.T) {
+	// setup types
+	for _, want := range []string{"first archive", "second archive"} {
+		buf := new(bytes.Buffer)
+
+		gw, err := getGzipWriter(buf, gzip.BestSpeed)
+		if err != nil {
+			t.Fatalf("getGzipWriter returned err: %v", err)
+		}
+
+		_, err = gw.Write([]byte(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = gw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		putGzipWriter(gw, gzip.BestSpeed)
+
+		gr, err := gzip.NewReader(buf)
+		if err != nil {
+			t.Fatalf("unable to read pooled gzip stream: %v", err)
+		}
+
+		got, err := io.ReadAll(gr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != want {
+			t.Errorf("gzip stream is %s, want %s", got, want)
+		}
+	}
+}
+
+func TestS3Cache_getGzipWriter_Levels(t *testing.T) {
+	// setup types
+	gw, err := getGzipWriter(io.Discard, gzip.BestCompression)
+	if err != nil {
+		t.Fatalf("getGzipWriter returned err: %v", err)
+	}
+
+	gw.Close()
+	putGzipWriter(gw, gzip.BestCompression)
+
+	// the pooled writer is reused for the same level, unless
+	// the garbage collector cleared the pool in between
+	reused, err := getGzipWriter(io.Discard, gzip.BestCompression)
+	if err != nil {
+		t.Fatalf("getGzipWriter returned err: %v", err)
+	}
+	defer reused.Close()
+
+	other, err := getGzipWriter(io.Discard, gzip.BestSpeed)
+	if err != nil {
+		t.Fatalf("getGzipWriter returned err: %v", err)
+	}
+	defer other.Close()
+
+	if other == gw {
+		t.Errorf("getGzipWriter reused a writer across compression levels")
+	}
+
+	if reused != gw {
+		t.Logf("pooled writer was not reused")
+	}
+}
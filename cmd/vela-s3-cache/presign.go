@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const presignAction = "presign"
+
+// maxPresignExpiry represents the longest expiry
+// s3 accepts for a URL signed with signature v4.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// Presign represents the plugin configuration for presigning cache URLs.
+type Presign struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets the path for where the object is stored
+	Path string
+	// sets the path prefix for where the object is stored
+	Prefix string
+	// sets the name of the cache object
+	Filename string
+	// sets the time until the URLs expire
+	Expiry time.Duration
+	// whether to also presign a URL for uploading the object
+	Put bool
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// will hold our final namespace for the path to the object
+	Namespace string
+}
+
+// Exec formats and runs the actions for presigning cache URLs in s3.
+func (p *Presign) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running presign with provided configuration")
+
+	res.Key = p.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	// record the expiry before signing so the URLs never outlive it
+	res.Expires = time.Now().Add(p.Expiry).UTC()
+
+	u, err := store.Presign(ctx, p.Bucket, p.Namespace, http.MethodGet, p.Expiry)
+	if err != nil {
+		return fmt.Errorf("unable to presign download of %s: %w", p.Namespace, err)
+	}
+
+	res.GetURL = u
+
+	// the download URL grants access to the cache, so keep it out of the logs
+	logrus.Infof("presigned download URL for %s, expiring %s, written to the S3_CACHE_GET_URL output", p.Namespace, res.Expires.Format(time.RFC3339))
+
+	if !p.Put {
+		return nil
+	}
+
+	u, err = store.Presign(ctx, p.Bucket, p.Namespace, http.MethodPut, p.Expiry)
+	if err != nil {
+		return fmt.Errorf("unable to presign upload of %s: %w", p.Namespace, err)
+	}
+
+	res.PutURL = u
+
+	logrus.Infof("presigned upload URL for %s, expiring %s, written to the S3_CACHE_PUT_URL masked output", p.Namespace, res.Expires.Format(time.RFC3339))
+
+	return nil
+}
+
+// Configure prepares the presign fields for the action to be taken.
+func (p *Presign) Configure(repo *Repo) error {
+	logrus.Trace("configuring presign action")
+
+	// construct the object path
+	path, err := buildNamespace(repo, p.Prefix, p.Path, p.Filename)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	// store it in the namespace
+	p.Namespace = path
+
+	return nil
+}
+
+// Validate verifies the Presign is properly configured.
+func (p *Presign) Validate() error {
+	logrus.Trace("validating presign action configuration")
+
+	// verify bucket is provided
+	if len(p.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify filename is provided
+	if len(p.Filename) == 0 {
+		return fmt.Errorf("no filename provided")
+	}
+
+	// verify timeout is provided
+	if p.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	// verify expiry is within the limit of signature v4
+	if p.Expiry <= 0 || p.Expiry > maxPresignExpiry {
+		return fmt.Errorf("expiry must be greater than 0 and at most %s", maxPresignExpiry)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Presign_Exec(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		put     bool
+		wantPut string
+	}{
+		{
+			desc: "get",
+		},
+		{
+			desc:    "get and put",
+			put:     true,
+			wantPut: "https://s3.example.com/bucket/foo/bar/archive.tgz?method=PUT&expires=3600",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := &Presign{
+				Bucket:    "bucket",
+				Expiry:    time.Hour,
+				Put:       tC.put,
+				Timeout:   10 * time.Minute,
+				Namespace: "foo/bar/archive.tgz",
+			}
+
+			res := new(Result)
+
+			err := p.Exec(context.Background(), newFakeBackend(), res)
+			if err != nil {
+				t.Fatalf("Exec returned err: %v", err)
+			}
+
+			if want := "https://s3.example.com/bucket/foo/bar/archive.tgz?method=GET&expires=3600"; res.GetURL != want {
+				t.Errorf("GetURL is %s, want %s", res.GetURL, want)
+			}
+
+			if res.PutURL != tC.wantPut {
+				t.Errorf("PutURL is %s, want %s", res.PutURL, tC.wantPut)
+			}
+
+			if d := time.Until(res.Expires); d <= 0 || d > time.Hour {
+				t.Errorf("Expires is %v, want within the hour", res.Expires)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Presign_Validate(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		presign *Presign
+		wantErr bool
+	}{
+		{
+			desc:    "valid",
+			presign: &Presign{Bucket: "bucket", Filename: "archive.tgz", Timeout: 10 * time.Minute, Expiry: time.Hour},
+		},
+		{
+			desc:    "no bucket",
+			presign: &Presign{Filename: "archive.tgz", Timeout: 10 * time.Minute, Expiry: time.Hour},
+			wantErr: true,
+		},
+		{
+			desc:    "no filename",
+			presign: &Presign{Bucket: "bucket", Timeout: 10 * time.Minute, Expiry: time.Hour},
+			wantErr: true,
+		},
+		{
+			desc:    "no timeout",
+			presign: &Presign{Bucket: "bucket", Filename: "archive.tgz", Expiry: time.Hour},
+			wantErr: true,
+		},
+		{
+			desc:    "no expiry",
+			presign: &Presign{Bucket: "bucket", Filename: "archive.tgz", Timeout: 10 * time.Minute},
+			wantErr: true,
+		},
+		{
+			desc:    "expiry over a week",
+			presign: &Presign{Bucket: "bucket", Filename: "archive.tgz", Timeout: 10 * time.Minute, Expiry: 8 * 24 * time.Hour},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.presign.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+)
+
+// progress tracks the bytes transferred for a
+// cache object to periodically log a heartbeat.
+type progress struct {
+	// sets the name of the transfer being tracked
+	phase string
+	// sets the expected number of bytes to transfer
+	total int64
+	// holds the number of bytes transferred so far
+	bytes atomic.Int64
+	// holds the time the transfer started
+	start time.Time
+}
+
+// newProgress creates a progress tracker for the provided phase.
+func newProgress(phase string, total int64) *progress {
+	return &progress{
+		phase: phase,
+		total: total,
+		start: time.Now(),
+	}
+}
+
+// Read records the length of the provided buffer as transferred
+// which satisfies the minio progress hook for uploads.
+func (p *progress) Read(b []byte) (int, error) {
+	p.bytes.Add(int64(len(b)))
+
+	return len(b), nil
+}
+
+// Reader wraps the provided reader to record the bytes read.
+func (p *progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{progress: p, reader: r}
+}
+
+// Start logs the transfer progress every interval until the
+// returned function is called. A non-positive interval
+// disables the heartbeat.
+func (p *progress) Start(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				logrus.Info(p.String())
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// String formats the current transfer progress.
+func (p *progress) String() string {
+	n := p.bytes.Load()
+	elapsed := time.Since(p.start)
+
+	rate := float64(0)
+	if elapsed > 0 {
+		rate = float64(n) / elapsed.Seconds()
+	}
+
+	transferred := humanize.Bytes(uint64(n))
+	if p.total > 0 {
+		transferred = fmt.Sprintf("%s of %s (%.1f%%)", transferred, humanize.Bytes(uint64(p.total)), float64(n)/float64(p.total)*100)
+	}
+
+	return fmt.Sprintf("%s in progress: %s transferred at %s/s after %s",
+		p.phase, transferred, humanize.Bytes(uint64(rate)), elapsed.Round(time.Second))
+}
+
+// progressReader is a reader that records
+// the bytes read against a progress tracker.
+type progressReader struct {
+	progress *progress
+	reader   io.Reader
+}
+
+// Read reads from the underlying reader and records the bytes read.
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.progress.bytes.Add(int64(n))
+
+	return n, err
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestS3Cache_Progress_Read(t *testing.T) {
+	// setup types
+	p := newProgress("upload", 10)
+
+	n, err := p.Read(make([]byte, 4))
+	if err != nil {
+		t.Errorf("Read returned err: %v", err)
+	}
+
+	if n != 4 {
+		t.Errorf("Read is %d, want 4", n)
+	}
+
+	if got := p.bytes.Load(); got != 4 {
+		t.Errorf("bytes is %d, want 4", got)
+	}
+}
+
+func TestS3Cache_Progress_Reader(t *testing.T) {
+	// setup types
+	p := newProgress("download", 11)
+
+	_, err := io.Copy(io.Discard, p.Reader(strings.NewReader("hello world")))
+	if err != nil {
+		t.Errorf("Copy returned err: %v", err)
+	}
+
+	if got := p.bytes.Load(); got != 11 {
+		t.Errorf("bytes is %d, want 11", got)
+	}
+
+	if !strings.Contains(p.String(), "11 B of 11 B (100.0%)") {
+		t.Errorf("String is %s, want transferred bytes and percentage", p.String())
+	}
+}
+
+func TestS3Cache_Progress_Start(t *testing.T) {
+	// setup types
+	p := newProgress("upload", 0)
+
+	// a disabled heartbeat should still return a usable stop function
+	stop := p.Start(0)
+	stop()
+
+	if !strings.Contains(p.String(), "upload in progress: 0 B transferred") {
+		t.Errorf("String is %s, want phase and transferred bytes", p.String())
+	}
+}
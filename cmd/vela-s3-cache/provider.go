@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const (
+	// r2Provider represents Cloudflare R2.
+	r2Provider = "r2"
+
+	// b2Provider represents the s3 compatible api of Backblaze B2.
+	b2Provider = "b2"
+
+	// gcsProvider represents the XML interoperability api of Google Cloud Storage.
+	gcsProvider = "gcs-interop"
+)
+
+// providers represents the s3 compatible stores the plugin adjusts to.
+var providers = []string{r2Provider, b2Provider, gcsProvider}
+
+// validateProvider is a helper function to verify the provider is supported.
+func validateProvider(provider string) error {
+	if len(provider) == 0 {
+		return nil
+	}
+
+	for _, p := range providers {
+		if provider == p {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid provider %s: must be one of %s", provider, strings.Join(providers, ", "))
+}
+
+// compat returns the parts of the s3 api the provider does not implement.
+func (c *Config) compat() storage.Compat {
+	switch c.Provider {
+	case r2Provider:
+		// r2 rejects the checksum headers of the aws sdk
+		return storage.Compat{NoChecksums: true}
+	case b2Provider:
+		// b2 has no object tagging or checksum headers
+		return storage.Compat{NoChecksums: true, NoTags: true}
+	case gcsProvider:
+		// the interoperability api only has the original listing
+		// and no multi-object delete, tagging or checksum headers
+		return storage.Compat{ListV1: true, SingleDelete: true, NoChecksums: true, NoTags: true}
+	default:
+		// send CRC32C checksums instead of MD5 digests in fips mode
+		return storage.Compat{NoMD5: c.FIPS}
+	}
+}
+
+// region returns the region to sign the requests for, defaulting
+// to the region the provider expects when none is provided.
+func (c *Config) region() string {
+	if len(c.Region) > 0 {
+		return c.Region
+	}
+
+	switch c.Provider {
+	case r2Provider, gcsProvider:
+		return "auto"
+	case b2Provider:
+		// the endpoints of b2 are named after the region (i.e. s3.us-west-004.backblazeb2.com)
+		u, err := url.Parse(c.Server)
+		if err == nil && strings.HasPrefix(u.Host, "s3.") && strings.HasSuffix(u.Host, ".backblazeb2.com") {
+			return strings.TrimSuffix(strings.TrimPrefix(u.Host, "s3."), ".backblazeb2.com")
+		}
+	}
+
+	return ""
+}
+
+// accelerate returns whether to use transfer acceleration,
+// which only amazon s3 provides.
+func (c *Config) accelerate() bool {
+	if len(c.AcceleratedEndpoint) == 0 {
+		return false
+	}
+
+	if len(c.Provider) > 0 {
+		logrus.Warnf("ignoring accelerated endpoint %s: not supported by provider %s", c.AcceleratedEndpoint, c.Provider)
+
+		return false
+	}
+
+	if c.FIPS {
+		logrus.Warnf("ignoring accelerated endpoint %s: not supported in fips mode", c.AcceleratedEndpoint)
+
+		return false
+	}
+
+	return true
+}
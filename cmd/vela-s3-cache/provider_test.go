@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_Config_region(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc   string
+		config *Config
+		want   string
+	}{
+		{
+			desc:   "aws",
+			config: &Config{Server: "https://s3.amazonaws.com"},
+			want:   "",
+		},
+		{
+			desc:   "r2",
+			config: &Config{Provider: r2Provider, Server: "https://account.r2.cloudflarestorage.com"},
+			want:   "auto",
+		},
+		{
+			desc:   "gcs",
+			config: &Config{Provider: gcsProvider, Server: "https://storage.googleapis.com"},
+			want:   "auto",
+		},
+		{
+			desc:   "b2",
+			config: &Config{Provider: b2Provider, Server: "https://s3.us-west-004.backblazeb2.com"},
+			want:   "us-west-004",
+		},
+		{
+			desc:   "provided region",
+			config: &Config{Provider: r2Provider, Server: "https://account.r2.cloudflarestorage.com", Region: "wnam"},
+			want:   "wnam",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.config.region(); got != tC.want {
+				t.Errorf("region is %q, want %q", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_compat(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		provider string
+		want     storage.Compat
+	}{
+		{provider: "", want: storage.Compat{}},
+		{provider: r2Provider, want: storage.Compat{NoChecksums: true}},
+		{provider: b2Provider, want: storage.Compat{NoChecksums: true, NoTags: true}},
+		{provider: gcsProvider, want: storage.Compat{ListV1: true, SingleDelete: true, NoChecksums: true, NoTags: true}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.provider, func(t *testing.T) {
+			if got := (&Config{Provider: tC.provider}).compat(); got != tC.want {
+				t.Errorf("compat is %+v, want %+v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_accelerate(t *testing.T) {
+	// setup types
+	c := &Config{AcceleratedEndpoint: "s3-accelerate.amazonaws.com"}
+
+	if !c.accelerate() {
+		t.Errorf("accelerate is false, want true")
+	}
+
+	c.Provider = r2Provider
+
+	if c.accelerate() {
+		t.Errorf("accelerate is true for provider %s, want false", c.Provider)
+	}
+}
+
+func TestS3Cache_Config_Validate_InvalidProvider(t *testing.T) {
+	// setup types
+	c := &Config{
+		Action:    "rebuild",
+		Server:    "https://storage.example.com",
+		AccessKey: "123456",
+		SecretKey: "654321",
+		Provider:  "wasabi",
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+
+	c.Provider = gcsProvider
+
+	err = c.Validate()
+	if err != nil {
+		t.Errorf("Validate returned err: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// tempKey is a helper function to create a unique key next
+// to the key for uploading the object before publishing it.
+func tempKey(key string) string {
+	return fmt.Sprintf("%s.tmp.%s", key, rand.Text())
+}
+
+// publish uploads the archive to a temporary key next to the namespace
+// and copies it to the namespace on the server, so a concurrent restore
+// never reads a partially written object from a store without atomic
+// uploads. The temporary object is removed once it is copied.
+func (r *Rebuild) publish(ctx context.Context, store storage.Backend, reader io.Reader, size int64, opts storage.PutOptions) (storage.Object, error) {
+	tmp := tempKey(r.Namespace)
+
+	// the temporary object is removed right away, so only the copy is retained
+	tOpts := opts
+	tOpts.RetentionMode = ""
+	tOpts.RetainUntil = time.Time{}
+	tOpts.LegalHold = false
+
+	logrus.Debugf("putting archive in bucket %s at temporary path: %s", r.Bucket, tmp)
+
+	_, err := store.Put(ctx, r.Bucket, tmp, reader, size, tOpts)
+	if err != nil {
+		// clean up the parts of an interrupted upload
+		if ctx.Err() != nil {
+			abort(store, r.Bucket, tmp)
+		}
+
+		return storage.Object{}, err
+	}
+
+	defer removeTempObject(store, r.Bucket, tmp)
+
+	logrus.Debugf("publishing %s to %s in bucket %s", tmp, r.Namespace, r.Bucket)
+
+	// replace the object in a single request on the server
+	obj, err := store.Copy(ctx, r.Bucket, tmp, r.Namespace, opts)
+	if err != nil {
+		return storage.Object{}, fmt.Errorf("unable to publish %s: %w", r.Namespace, err)
+	}
+
+	return obj, nil
+}
+
+// removeTempObject is a helper function to remove the temporary
+// object of a publish, even when the context of the upload is done.
+func removeTempObject(store storage.Backend, bucket, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	for _, rErr := range store.Remove(ctx, bucket, []storage.Object{{Key: key}}) {
+		logrus.Warnf("unable to remove temporary object %s: %v", key, rErr)
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// failedCopyBackend is a fake backend failing every copy.
+type failedCopyBackend struct {
+	*fakeBackend
+}
+
+// Copy always fails.
+func (failedCopyBackend) Copy(context.Context, string, string, string, storage.PutOptions) (storage.Object, error) {
+	return storage.Object{}, errors.New("copy failed")
+}
+
+func TestS3Cache_tempKey(t *testing.T) {
+	// setup types
+	got := tempKey("foo/bar/archive.tgz")
+
+	if !strings.HasPrefix(got, "foo/bar/archive.tgz.tmp.") {
+		t.Errorf("tempKey is %s, want the key with a temporary suffix", got)
+	}
+
+	if got == tempKey("foo/bar/archive.tgz") {
+		t.Errorf("tempKey returned %s twice, want unique keys", got)
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_AtomicPublish(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:           "bucket",
+		Filename:         "archive.tgz",
+		Timeout:          10 * time.Minute,
+		Mount:            []string{"testdata/hello.txt"},
+		Namespace:        "foo/bar/archive.tgz",
+		Metadata:         map[string]string{metaBuildNumber: "1"},
+		CompressionLevel: autoCompression,
+		AtomicPublish:    true,
+	}
+
+	err := r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// verify only the published object is left
+	if got, want := store.keys(), []string{"foo/bar/archive.tgz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys are %v, want %v", got, want)
+	}
+
+	info, err := store.Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatalf("Stat returned err: %v", err)
+	}
+
+	if userMetadata(info, metaBuildNumber) != "1" {
+		t.Errorf("UserMetadata is %v, want build number", info.UserMetadata)
+	}
+}
+
+func TestS3Cache_Rebuild_publish_FailedCopy(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("previous"), time.Now(), nil)
+
+	r := &Rebuild{Bucket: "bucket", Namespace: "foo/bar/archive.tgz"}
+
+	_, err := r.publish(context.Background(), failedCopyBackend{store}, strings.NewReader("archive"), 7, storage.PutOptions{})
+	if err == nil {
+		t.Fatal("publish should have returned err")
+	}
+
+	// verify the previous object is intact and the temporary object removed
+	if got, want := store.keys(), []string{"foo/bar/archive.tgz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys are %v, want %v", got, want)
+	}
+
+	if string(store.objects["foo/bar/archive.tgz"].data) != "previous" {
+		t.Errorf("object is %q, want the previous object", store.objects["foo/bar/archive.tgz"].data)
+	}
+}
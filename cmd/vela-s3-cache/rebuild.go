@@ -4,20 +4,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
 
-	"github.com/go-vela/archiver/v3"
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 )
 
 const rebuildAction = "rebuild"
 
+// abortTimeout represents the timeout for aborting
+// the incomplete upload of an interrupted rebuild.
+const abortTimeout = 30 * time.Second
+
 // Rebuild represents the plugin configuration for rebuild information.
 type Rebuild struct {
 	// sets the name of the bucket
@@ -30,39 +36,273 @@ type Rebuild struct {
 	Filename string
 	// sets the timeout on the call to s3
 	Timeout time.Duration
+	// sets the additional timeout per gigabyte of the archive
+	TimeoutPerGB time.Duration
 	// sets the file or directories locations to build your cache from
 	Mount []string
+	// sets the directory to stage the archive in
+	TmpDir string
+	// sets the key to encrypt the archive with before uploading
+	EncryptionKey []byte
+	// sets the key to sign the archive with
+	SigningKey []byte
 	// will hold our final namespace for the path to the objects
 	Namespace string
 	// whether to preserve the relative directory structure during the tar process
 	PreservePath bool
+	// sets the gzip compression level of the archive, or auto
+	CompressionLevel string
+	// sets the soft memory limit in bytes while building the archive
+	MemoryLimit uint64
+	// sets the time to live for the cache object
+	TTL time.Duration
+	// whether to also set the Expires header when a time to live is provided
+	ExpiresHeader bool
+	// will hold the provenance metadata to store with the object
+	Metadata map[string]string
+	// sets the number of archive entries to log at debug level
+	ListEntries int
+	// sets the interval for logging upload progress
+	ProgressInterval time.Duration
+	// sets the bytes per second to limit the upload to
+	MaxBandwidth uint64
+	// sets the archive size to warn about the largest directories at
+	WarnSize uint64
+	// whether to read and write objects like drone-s3-cache
+	DroneCompat bool
+	// whether to report what would be uploaded without uploading it
+	DryRun bool
+	// whether to append the changed files to the previous archive instead of rebuilding it
+	Append bool
+	// sets the archive size above which to split the archive into part objects of the size
+	SplitSize uint64
+	// sets the policy for the symlinks in the mounts
+	Symlinks string
+	// sets the maximum number of links in a chain of dereferenced symlinks
+	SymlinkDepth int
+	// whether to archive files with 0644 or 0755 and directories with 0755
+	NormalizeModes bool
+	// sets the object lock retention mode of the archive, governance or compliance
+	RetentionMode string
+	// sets the date or duration from now to retain the archive until
+	RetainUntil string
+	// whether to place an object lock legal hold on the archive
+	LegalHold bool
+	// whether to skip version control directories and metadata files below the mounts
+	SkipJunk bool
+	// sets the policy for the mounts that are symlinks
+	MountSymlinks string
+	// whether to upload the archive to a temporary key and copy it into place
+	AtomicPublish bool
+	// whether to archive the tar stream read from stdin instead of the mounts
+	FromStdin bool
+	// whether to hold a lock object on the namespace while rebuilding
+	Lock bool
+	// sets the time after which a lock left by an interrupted rebuild expires
+	LockTTL time.Duration
+	// sets the time to wait for a lock held by another rebuild before skipping
+	LockWait time.Duration
+	// whether to skip the rebuild when the manifest of the mounts is unchanged
+	Manifest bool
+	// whether to pin the archive, exempting it from the flush action
+	Pin bool
+
+	// will hold the archive format of the object
+	format string
+	// will hold the full name of the repo the cache is built for
+	source string
+	// will hold the time to retain the archive until
+	retainUntil time.Time
 }
 
 // Exec formats and runs the actions for rebuilding a cache in s3.
-func (r *Rebuild) Exec(mc *minio.Client) error {
+func (r *Rebuild) Exec(ctx context.Context, store storage.Backend, res *Result) error {
 	logrus.Trace("running rebuild with provided configuration")
 
-	t := archiver.NewTarGz()
-	t.PreservePath = r.PreservePath
+	res.Key = r.Namespace
+
+	// apply the soft memory budget while building the archive
+	if r.MemoryLimit > 0 {
+		logrus.Debugf("setting soft memory limit of %s", humanize.Bytes(r.MemoryLimit))
+
+		defer debug.SetMemoryLimit(debug.SetMemoryLimit(int64(r.MemoryLimit)))
+	}
+
+	// skip the rebuild while another build rebuilds the namespace
+	if r.Lock && !r.DryRun {
+		unlock, err := r.lock(ctx, store)
+		if errors.Is(err, errLocked) {
+			logrus.Infof("skipping rebuild of %s: %v", r.Namespace, err)
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		defer unlock()
+	}
+
+	// archive the tar stream from stdin instead of the mounts
+	if r.FromStdin {
+		return r.execStdin(ctx, store, res)
+	}
+
+	pk := &packer{
+		preservePath:   r.PreservePath,
+		format:         r.format,
+		symlinks:       r.Symlinks,
+		symlinkDepth:   r.SymlinkDepth,
+		normalizeModes: r.NormalizeModes,
+		followMounts:   r.MountSymlinks != mountPreserve,
+	}
+
+	// leave the version control directories and metadata files out
+	if r.SkipJunk {
+		pk.with(WithEntryFilter(pk.junkFilter(r.Mount)))
+	}
+
+	start := time.Now()
+
+	// calculate the size of the files being archived
+	size, err := mountSize(r.Mount)
+	if err != nil {
+		return err
+	}
+
+	res.UncompressedSize = size
+	res.WalkDuration = time.Since(start)
+
+	logPhase("walk", res.WalkDuration, size)
+
+	// report what would be uploaded without archiving the mounts
+	if r.DryRun {
+		ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+
+		err = verifyAccess(ctx, store, r.Bucket, r.Namespace)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("dry run: %s from %d mounts would be archived and uploaded to bucket %s at %s",
+			humanize.Bytes(uint64(size)), len(r.Mount), r.Bucket, r.Namespace)
+
+		return nil
+	}
+
+	// skip the rebuild when the mounts are unchanged since the last rebuild
+	digest := ""
+
+	if r.Manifest {
+		digest, err = pk.manifestDigest(r.Mount, len(r.EncryptionKey) > 0)
+		if err != nil {
+			return fmt.Errorf("unable to create manifest of the mounts: %w", err)
+		}
+
+		if r.unchanged(ctx, store, digest) {
+			logrus.Infof("mounts unchanged since %s was rebuilt, skipping rebuild", r.Namespace)
+
+			res.Unchanged = true
+
+			return nil
+		}
+	}
+
+	// select the compression level for the archive
+	pk.compressionLevel, err = r.compressionLevel(size)
+	if err != nil {
+		return err
+	}
+
+	// append the changed files to the previous archive when possible
+	if r.Append {
+		pk.previous, err = r.previousArchive(ctx, store)
+		if err != nil {
+			return err
+		}
+
+		if len(pk.previous) > 0 {
+			defer removeTemp(pk.previous)
+		}
+	}
 
-	logrus.Debug("determining temp directory for archive")
+	logrus.Debug("creating staging file for archive")
 
-	f := filepath.Join(os.TempDir(), r.Filename)
+	// stage the archive in the tmp dir when provided
+	f, err := createTemp(r.TmpDir, r.Filename)
+	if err != nil {
+		return err
+	}
+
+	// delete the staging file on both success and failure
+	defer removeTemp(f)
 
 	logrus.Debugf("archiving artifact in path %s", f)
 
+	start = time.Now()
+
+	// describe the cache in the archive itself
+	pk.metadata = r.archiveMetadata(pk.compressionLevel)
+
 	// archive the objects in the mount path provided
-	err := t.Archive(r.Mount, f)
+	err = pk.pack(r.Mount, f)
 	if err != nil {
 		return err
 	}
 
+	res.CompressDuration = time.Since(start)
+
 	stat, err := os.Stat(f)
 	if err != nil {
 		return err
 	}
 
-	logrus.Infof("archive %s created, %s", f, humanize.Bytes(uint64(stat.Size())))
+	res.Size = stat.Size()
+
+	logPhase("compress", res.CompressDuration, size)
+
+	// warn about the largest directories when the archive is too big
+	err = warnSize(r.Mount, res.Size, r.WarnSize)
+	if err != nil {
+		return err
+	}
+
+	// log the contents of the archive for debugging
+	err = logEntries(f, r.format, r.ListEntries)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("archive %s created, %s", f, humanize.Bytes(uint64(stat.Size())))
+
+	// encrypt the archive before it leaves the runner
+	if len(r.EncryptionKey) > 0 {
+		logrus.Debugf("encrypting archive %s with %s", f, encryptionAlgorithm)
+
+		err = encryptFile(f, r.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("unable to encrypt archive: %w", err)
+		}
+
+		stat, err = os.Stat(f)
+		if err != nil {
+			return err
+		}
+
+		res.Size = stat.Size()
+	}
+
+	// calculate the checksum to verify the archive on restore
+	sum, err := fileSHA256(f)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("archive %s has sha256 checksum %s", f, sum)
+
+	res.Checksum = sum
 
 	logrus.Debugf("opening artifact %s for reading", f)
 
@@ -74,43 +314,201 @@ func (r *Rebuild) Exec(mc *minio.Client) error {
 	logrus.Debugf("archive %s opened for reading", f)
 
 	// set a timeout on the request to the cache provider
-	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	timeout := transferTimeout(r.Timeout, r.TimeoutPerGB, stat.Size())
+
+	logrus.Debugf("using transfer timeout of %s", timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	logrus.Debugf("putting archive %s in bucket %s in path: %s", f, r.Bucket, r.Namespace)
 
 	// create an options object for the upload
-	mObj := minio.PutObjectOptions{
-		ContentType: "application/tar",
+	mObj := r.putOptions(sum)
+
+	// record the manifest for the next rebuild to compare with
+	if len(digest) > 0 {
+		mObj.UserMetadata[metaManifest] = digest
 	}
 
-	// upload the object to the specified location in the bucket
-	n, err := mc.PutObject(ctx, r.Bucket, r.Namespace, obj, -1, mObj)
+	// track the upload progress for heartbeat logs
+	p := newProgress("upload", stat.Size())
+	mObj.Progress = p
+
+	stop := p.Start(r.ProgressInterval)
+
+	start = time.Now()
+
+	var n storage.Object
+
+	parts := 0
+
+	if r.SplitSize > 0 && uint64(stat.Size()) > r.SplitSize {
+		parts = int((uint64(stat.Size()) + r.SplitSize - 1) / r.SplitSize)
+
+		// upload the archive as part objects with an index
+		n, err = r.uploadParts(ctx, store, obj, stat.Size(), parts, mObj)
+	} else if r.AtomicPublish {
+		// upload the object next to the location and copy it into place
+		n, err = r.publish(ctx, store, newLimiter(r.MaxBandwidth).Reader(ctx, obj), stat.Size(), mObj)
+	} else {
+		// upload the object to the specified location in the bucket
+		n, err = store.Put(ctx, r.Bucket, r.Namespace, newLimiter(r.MaxBandwidth).Reader(ctx, obj), stat.Size(), mObj)
+	}
+
+	stop()
+
 	if err != nil {
+		// clean up the parts of an interrupted upload
+		if ctx.Err() != nil {
+			abort(store, r.Bucket, r.Namespace)
+		}
+
 		return err
 	}
 
+	res.TransferDuration = time.Since(start)
+
+	logPhase("upload", res.TransferDuration, n.Size)
+
+	// remove the parts left over from a previous split of the archive
+	if r.SplitSize > 0 {
+		err = r.removeParts(ctx, store, parts)
+		if err != nil {
+			logrus.Warnf("unable to remove parts of a previous split of the archive: %v", err)
+		}
+	}
+
 	u := uint64(n.Size)
-	logrus.Infof("cache rebuild action completed. %s of data rebuilt and stored", humanize.Bytes(u))
+	logrus.Debugf("cache rebuild action completed. %s of data rebuilt and stored", humanize.Bytes(u))
 
 	return nil
 }
 
+// putOptions creates the options for uploading the archive with the
+// checksum, or without a checksum when the archive is streamed.
+func (r *Rebuild) putOptions(sum string) storage.PutOptions {
+	opts := storage.PutOptions{
+		ContentType:  "application/tar",
+		UserMetadata: map[string]string{},
+	}
+
+	// record the checksum to verify the archive on restore
+	if len(sum) > 0 {
+		opts.UserMetadata[metaSHA256] = sum
+	}
+
+	// record the provenance of the object
+	for k, v := range r.Metadata {
+		opts.UserMetadata[k] = v
+	}
+
+	// record the encryption for the restore to decrypt the object
+	if len(r.EncryptionKey) > 0 {
+		opts.UserMetadata[metaEncryption] = encryptionAlgorithm
+	}
+
+	// sign the archive for the restore to verify its origin
+	if len(r.SigningKey) > 0 {
+		opts.UserMetadata[metaSignature] = sign(r.SigningKey, r.Namespace, sum)
+	}
+
+	// record the expiry for the object when a time to live is provided
+	if r.TTL > 0 {
+		expires := time.Now().Add(r.TTL).UTC()
+
+		logrus.Debugf("setting expiry of %s on archive %s", expires.Format(time.RFC3339), r.Namespace)
+
+		opts.UserMetadata[metaExpires] = expires.Format(time.RFC3339)
+
+		opts.UserTags = map[string]string{
+			tagTTL: r.TTL.String(),
+		}
+
+		if r.ExpiresHeader {
+			opts.Expires = expires
+		}
+	}
+
+	// exempt the object from the flush action
+	if r.Pin {
+		if opts.UserTags == nil {
+			opts.UserTags = map[string]string{}
+		}
+
+		opts.UserTags[tagPin] = "true"
+	}
+
+	// retain the object in a bucket with object lock
+	r.retain(&opts)
+
+	return opts
+}
+
 // Configure prepares the rebuild fields for the action to be taken.
-func (r *Rebuild) Configure(repo *Repo) error {
+func (r *Rebuild) Configure(repo *Repo, build *Build) error {
 	logrus.Trace("configuring rebuild action")
 
+	var (
+		path string
+		err  error
+	)
+
+	r.format = cacheFormat
+
 	// construct the object path
-	path := buildNamespace(repo, r.Prefix, r.Path, r.Filename)
+	switch {
+	case r.DroneCompat:
+		// lay out and archive the object like drone-s3-cache,
+		// which archives the mounts with their relative paths
+		path, err = droneNamespace(repo, r.Prefix, r.Path, droneBranch(repo), r.Filename)
+		r.PreservePath = true
+		r.format = droneFormat(r.Filename)
+	default:
+		path, err = buildNamespace(repo, r.Prefix, r.Path, r.Filename)
+	}
+
+	if err != nil {
+		return err
+	}
 
 	logrus.Debugf("created bucket path %s", path)
 
 	// store it in the namespace
 	r.Namespace = path
 
+	// store the provenance of the build
+	r.Metadata = build.Metadata()
+	r.source = fmt.Sprintf("%s/%s", repo.Owner, repo.Name)
+
 	return nil
 }
 
+// archiveMetadata creates the pax records describing the cache
+// to embed in the archive, so it can be identified outside of s3.
+func (r *Rebuild) archiveMetadata(level int) map[string]string {
+	// drone-s3-cache fails on entries of unknown types
+	if r.DroneCompat {
+		return nil
+	}
+
+	m := map[string]string{
+		paxPrefix + "created":           time.Now().UTC().Format(time.RFC3339),
+		paxPrefix + "repo":              r.source,
+		paxPrefix + "format":            r.format,
+		paxPrefix + "compression-level": strconv.Itoa(level),
+		paxPrefix + "preserve-path":     strconv.FormatBool(r.PreservePath),
+		paxPrefix + "normalize-modes":   strconv.FormatBool(r.NormalizeModes),
+	}
+
+	// include the provenance stored with the object
+	for k, v := range r.Metadata {
+		m[paxPrefix+strings.ToLower(strings.TrimPrefix(k, "Vela-Cache-"))] = v
+	}
+
+	return m
+}
+
 // Validate verifies the Rebuild is properly configured.
 func (r *Rebuild) Validate() error {
 	logrus.Trace("validating rebuild action configuration")
@@ -130,6 +528,86 @@ func (r *Rebuild) Validate() error {
 		return fmt.Errorf("timeout must be greater than 0")
 	}
 
+	// verify ttl is not negative
+	if r.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+
+	// verify a lock expires
+	if r.Lock && r.LockTTL <= 0 {
+		return fmt.Errorf("lock ttl must be greater than 0")
+	}
+
+	// verify list entries is not negative
+	if r.ListEntries < 0 {
+		return fmt.Errorf("list entries must not be negative")
+	}
+
+	// verify the parts of a split archive are not too small
+	if r.SplitSize > 0 && r.SplitSize < humanize.MiByte {
+		return fmt.Errorf("split size must be at least 1MiB")
+	}
+
+	// verify a split archive is not expected to be published atomically
+	if r.SplitSize > 0 && r.AtomicPublish {
+		return fmt.Errorf("split size can not be combined with atomic publish")
+	}
+
+	// verify the compression level is supported
+	if r.CompressionLevel != autoCompression {
+		_, err := parseCompressionLevel(r.CompressionLevel)
+		if err != nil {
+			return err
+		}
+	}
+
+	// verify the policy for symlinks is supported
+	err := validateSymlinkPolicy(r.Symlinks)
+	if err != nil {
+		return err
+	}
+
+	if r.SymlinkDepth < 0 {
+		return fmt.Errorf("symlink depth must not be negative")
+	}
+
+	// verify the object lock settings are consistent
+	err = r.validateRetention()
+	if err != nil {
+		return err
+	}
+
+	// verify the policy for the mounts that are symlinks is supported
+	err = validateMountSymlinkPolicy(r.MountSymlinks)
+	if err != nil {
+		return err
+	}
+
+	// verify the staging directory exists
+	err = validateTmpDir(r.TmpDir)
+	if err != nil {
+		return err
+	}
+
+	// verify the tar stream from stdin replaces the mounts
+	if r.FromStdin {
+		return r.validateStdin()
+	}
+
+	// expand the newline separated and glob pattern mounts
+	mounts, err := expandMounts(r.Mount)
+	if err != nil {
+		return err
+	}
+
+	r.Mount = mounts
+
+	// remove the mounts nested in another mount, as their
+	// entries would be archived twice under the same name
+	if r.PreservePath {
+		r.Mount = filterRedundantPaths(r.Mount)
+	}
+
 	// verify mount is provided
 	if len(r.Mount) == 0 {
 		return fmt.Errorf("no mount provided")
@@ -137,11 +615,39 @@ func (r *Rebuild) Validate() error {
 
 	// validate that the source exists
 	for _, mount := range r.Mount {
-		_, err := os.Lstat(mount)
+		info, err := os.Lstat(mount)
 		if err != nil {
 			return fmt.Errorf("mount: %s, make sure file or directory exists", mount)
 		}
+
+		// verify the target of a mount that is a symlink is in the workspace
+		if info.Mode()&os.ModeSymlink != 0 && r.MountSymlinks != mountPreserve {
+			_, err = followMount(mount)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
+
+// compressionLevel determines the gzip level to compress the archive with,
+// selecting a level from the mounts when the level is auto.
+func (r *Rebuild) compressionLevel(size int64) (int, error) {
+	return resolveCompressionLevel(r.CompressionLevel, r.Mount, size)
+}
+
+// abort is a helper function to remove the parts of an interrupted
+// upload using a new context, as the upload context is done.
+func abort(store storage.Backend, bucket, key string) {
+	logrus.Warnf("upload of %s interrupted, aborting incomplete upload", key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	err := store.Abort(ctx, bucket, key)
+	if err != nil {
+		logrus.Warnf("unable to abort incomplete upload of %s: %v", key, err)
+	}
+}
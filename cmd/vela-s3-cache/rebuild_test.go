@@ -3,8 +3,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/dustin/go-humanize"
 )
 
 func TestS3Cache_Rebuild_Validate(t *testing.T) {
@@ -25,6 +31,25 @@ func TestS3Cache_Rebuild_Validate(t *testing.T) {
 	}
 }
 
+func TestS3Cache_Rebuild_Validate_InvalidMountSymlinks(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	r := &Rebuild{
+		Timeout:       timeout,
+		Bucket:        "bucket",
+		Prefix:        "foo/bar",
+		Filename:      "archive.tar",
+		Mount:         []string{"testdata/hello.txt"},
+		MountSymlinks: "dereference",
+	}
+
+	err := r.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
 func TestS3Cache_Rebuild_Validate_NoBucket(t *testing.T) {
 	// setup types
 	timeout, _ := time.ParseDuration("10m")
@@ -108,3 +133,206 @@ func TestS3Cache_Rebuild_Validate_MissingMount(t *testing.T) {
 		t.Errorf("Validate should have returned err")
 	}
 }
+
+func TestS3Cache_Rebuild_Validate_NegativeTTL(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	r := &Rebuild{
+		Timeout:  timeout,
+		Bucket:   "bucket",
+		Prefix:   "foo/bar",
+		Filename: "archive.tar",
+		Mount:    []string{"testdata/hello.txt"},
+		TTL:      -time.Hour,
+	}
+
+	err := r.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Rebuild_Validate_SplitAtomicPublish(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	r := &Rebuild{
+		Timeout:       timeout,
+		Bucket:        "bucket",
+		Prefix:        "foo/bar",
+		Filename:      "archive.tar",
+		Mount:         []string{"testdata/hello.txt"},
+		SplitSize:     5 * humanize.GiByte,
+		AtomicPublish: true,
+	}
+
+	err := r.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Rebuild_Validate_NoLockTTL(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	r := &Rebuild{
+		Timeout:  timeout,
+		Bucket:   "bucket",
+		Prefix:   "foo/bar",
+		Filename: "archive.tar",
+		Mount:    []string{"testdata/hello.txt"},
+		Lock:     true,
+	}
+
+	err := r.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Rebuild_Exec(t *testing.T) {
+	// setup types
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	store := newFakeBackend()
+	res := new(Result)
+
+	r := &Rebuild{
+		Bucket:           "bucket",
+		Filename:         "archive.tgz",
+		Timeout:          10 * time.Minute,
+		Mount:            []string{"testdata/hello.txt"},
+		Namespace:        "foo/bar/archive.tgz",
+		TTL:              time.Hour,
+		Metadata:         map[string]string{metaBuildNumber: "1"},
+		CompressionLevel: autoCompression,
+	}
+
+	err := r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	info, err := store.Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatalf("Stat returned err: %v", err)
+	}
+
+	if info.Size != res.Size {
+		t.Errorf("Size is %d, want %d", info.Size, res.Size)
+	}
+
+	if userMetadata(info, metaBuildNumber) != "1" {
+		t.Errorf("UserMetadata is %v, want build number", info.UserMetadata)
+	}
+
+	if _, ok := expiresAt(info); !ok {
+		t.Errorf("UserMetadata is %v, want expiry", info.UserMetadata)
+	}
+	// verify the staging file for the archive was removed
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("tmp dir has %d entries, want 0", len(entries))
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_DryRun(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	res := new(Result)
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+		DryRun:    true,
+	}
+
+	err := r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if len(store.keys()) != 0 {
+		t.Errorf("keys is %v, want none", store.keys())
+	}
+
+	if res.UncompressedSize == 0 {
+		t.Errorf("UncompressedSize is %d, want size of mounts", res.UncompressedSize)
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_Cancelled(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	store := newFakeBackend()
+
+	r := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := r.Exec(ctx, store, new(Result))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Exec returned err: %v, want %v", err, context.Canceled)
+	}
+
+	if !reflect.DeepEqual(store.aborted, []string{"foo/bar/archive.tgz"}) {
+		t.Errorf("aborted is %v, want the incomplete upload", store.aborted)
+	}
+}
+
+func TestS3Cache_Rebuild_archiveMetadata(t *testing.T) {
+	// setup types
+	r := &Rebuild{
+		Metadata: map[string]string{metaBuildNumber: "1", metaVersion: "v0.1.0"},
+		format:   cacheFormat,
+		source:   "foo/bar",
+	}
+
+	got := r.archiveMetadata(6)
+
+	want := map[string]string{
+		paxPrefix + "build-number":      "1",
+		paxPrefix + "plugin-version":    "v0.1.0",
+		paxPrefix + "repo":              "foo/bar",
+		paxPrefix + "format":            cacheFormat,
+		paxPrefix + "compression-level": "6",
+		paxPrefix + "preserve-path":     "false",
+		paxPrefix + "normalize-modes":   "false",
+	}
+
+	_, err := time.Parse(time.RFC3339, got[paxPrefix+"created"])
+	if err != nil {
+		t.Errorf("created is %q: %v", got[paxPrefix+"created"], err)
+	}
+
+	delete(got, paxPrefix+"created")
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archiveMetadata is %v, want %v", got, want)
+	}
+
+	// verify drone-s3-cache archives are left unchanged
+	r.DroneCompat = true
+
+	if got := r.archiveMetadata(6); got != nil {
+		t.Errorf("archiveMetadata is %v, want nil", got)
+	}
+}
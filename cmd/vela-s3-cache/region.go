@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// bucketRegionHeader represents the header s3 answers every request
+	// for a bucket with, including anonymous requests and redirects.
+	bucketRegionHeader = "X-Amz-Bucket-Region"
+
+	// defaultRegionServer represents the server to look up
+	// the region of buckets in amazon s3 with.
+	defaultRegionServer = "https://s3.amazonaws.com"
+
+	// regionDiscoveryTimeout represents the timeout
+	// for looking up the region of the bucket.
+	regionDiscoveryTimeout = 10 * time.Second
+)
+
+// discoverRegion looks up the region of the bucket in amazon s3 when
+// none is provided, so the requests are signed for the region of the
+// bucket instead of failing with a signature mismatch outside of us-east-1.
+func (c *Config) discoverRegion() {
+	if len(c.region()) > 0 || len(c.Bucket) == 0 {
+		return
+	}
+
+	// s3 compatible stores may not answer with the region of the bucket
+	if c.Driver != awsDriver && !amazonHost(c.Server) {
+		return
+	}
+
+	server := c.Server
+
+	// buckets in amazon s3 are looked up with the global endpoint,
+	// as the server may be the virtual host of the bucket
+	if len(server) == 0 || amazonHost(server) {
+		server = defaultRegionServer
+	}
+
+	client := &http.Client{
+		Transport: c.transport(http.DefaultTransport.(*http.Transport).Clone()),
+		// keep the region of the redirect to the regional endpoint
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), regionDiscoveryTimeout)
+	defer cancel()
+
+	region, err := bucketRegion(ctx, client, server, c.Bucket)
+	if err != nil {
+		logrus.Debugf("unable to discover the region of bucket %s, set the region parameter if requests fail: %v", c.Bucket, err)
+
+		return
+	}
+
+	logrus.Debugf("discovered region %s for bucket %s", region, c.Bucket)
+
+	c.Region = region
+}
+
+// amazonHost is a helper function to determine
+// whether the server is an endpoint of amazon s3.
+func amazonHost(server string) bool {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(u.Hostname(), "amazonaws.com")
+}
+
+// bucketRegion is a helper function to look up the region of the bucket
+// on the server with an anonymous request, which s3 answers with the
+// region of the bucket even when it denies or redirects the request.
+func bucketRegion(ctx context.Context, client *http.Client, server, bucket string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server %s: %w", server, err)
+	}
+
+	u.Path = "/" + url.PathEscape(bucket)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	region := resp.Header.Get(bucketRegionHeader)
+	if len(region) == 0 {
+		return "", fmt.Errorf("no region returned for bucket %s (%s)", bucket, resp.Status)
+	}
+
+	return region, nil
+}
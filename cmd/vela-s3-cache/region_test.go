@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestS3Cache_Config_discoverRegion(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc   string
+		status int
+		region string
+		config Config
+		want   string
+	}{
+		{
+			desc:   "redirect",
+			status: http.StatusMovedPermanently,
+			region: "eu-west-1",
+			config: Config{Bucket: "bucket", Driver: awsDriver},
+			want:   "eu-west-1",
+		},
+		{
+			desc:   "forbidden",
+			status: http.StatusForbidden,
+			region: "us-west-2",
+			config: Config{Bucket: "bucket", Driver: awsDriver},
+			want:   "us-west-2",
+		},
+		{
+			desc:   "no region",
+			status: http.StatusNotFound,
+			config: Config{Bucket: "bucket", Driver: awsDriver},
+		},
+		{
+			desc:   "region provided",
+			status: http.StatusOK,
+			region: "us-west-2",
+			config: Config{Bucket: "bucket", Driver: awsDriver, Region: "us-east-2"},
+			want:   "us-east-2",
+		},
+		{
+			desc:   "s3 compatible",
+			status: http.StatusOK,
+			region: "us-west-2",
+			config: Config{Bucket: "bucket", Driver: minioDriver},
+		},
+		{
+			desc:   "no bucket",
+			status: http.StatusOK,
+			region: "us-west-2",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead || r.URL.Path != "/bucket" {
+					t.Errorf("request is %s %s, want HEAD /bucket", r.Method, r.URL.Path)
+				}
+
+				if len(tC.region) > 0 {
+					w.Header().Set(bucketRegionHeader, tC.region)
+				}
+
+				// redirect to the regional endpoint like s3
+				if tC.status == http.StatusMovedPermanently {
+					w.Header().Set("Location", "/redirected")
+				}
+
+				w.WriteHeader(tC.status)
+			}))
+			defer srv.Close()
+
+			c := tC.config
+			c.Server = srv.URL
+
+			c.discoverRegion()
+
+			if c.Region != tC.want {
+				t.Errorf("region is %q, want %q", c.Region, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_amazonHost(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		server string
+		want   bool
+	}{
+		{server: "https://s3.amazonaws.com", want: true},
+		{server: "mybucket.s3-us-west-2.amazonaws.com", want: true},
+		{server: "https://s3.us-gov-west-1.amazonaws.com:443", want: true},
+		{server: "https://minio.example.com"},
+		{server: "https://amazonaws.com.example.com"},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.server, func(t *testing.T) {
+			if got := amazonHost(tC.server); got != tC.want {
+				t.Errorf("amazonHost is %t, want %t", got, tC.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// FlushReport represents the machine-readable results of a flush.
+type FlushReport struct {
+	Bucket     string   `json:"bucket"`
+	Namespace  string   `json:"namespace"`
+	Examined   int      `json:"objects_examined"`
+	Removed    int      `json:"objects_removed"`
+	BytesFreed uint64   `json:"bytes_freed"`
+	Keys       []string `json:"removed_keys"`
+	Errors     []string `json:"errors"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+// AddRemoved records the objects removed by the flush.
+func (r *FlushReport) AddRemoved(objects []storage.Object) {
+	for _, object := range objects {
+		r.Removed++
+		r.BytesFreed += uint64(object.Size)
+		r.Keys = append(r.Keys, objectName(object.Key, object.VersionID))
+	}
+}
+
+// AddError records the error, if any, encountered by the flush.
+func (r *FlushReport) AddError(err error) {
+	if err == nil {
+		return
+	}
+
+	// joined errors are separated by newlines
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if len(line) > 0 {
+			r.Errors = append(r.Errors, line)
+		}
+	}
+}
+
+// Write serializes the report as JSON to the file.
+func (r *FlushReport) Write(path string) error {
+	logrus.Tracef("writing flush report to %s", path)
+
+	// ensure the lists are serialized as arrays
+	if r.Keys == nil {
+		r.Keys = []string{}
+	}
+
+	if r.Errors == nil {
+		r.Errors = []string{}
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal flush report: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create directory for flush report %s: %w", path, err)
+	}
+
+	err = os.WriteFile(path, append(data, '\n'), 0644) //nolint:gosec // report is meant to be readable by other steps
+	if err != nil {
+		return fmt.Errorf("unable to write flush report %s: %w", path, err)
+	}
+
+	return nil
+}
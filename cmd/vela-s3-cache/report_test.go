@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_FlushReport_Write(t *testing.T) {
+	// setup types
+	file := filepath.Join(t.TempDir(), "reports", "flush.json")
+
+	r := &FlushReport{
+		Bucket:    "bucket",
+		Namespace: "foo/bar",
+		Examined:  3,
+	}
+
+	r.AddRemoved([]storage.Object{
+		{Key: "foo/bar/a.tgz", Size: 100},
+		{Key: "foo/bar/b.tgz", Size: 50, VersionID: "abc"},
+	})
+
+	r.AddError(errors.Join(errors.New("first"), errors.New("second")))
+
+	err := r.Write(file)
+	if err != nil {
+		t.Fatalf("Write returned err: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read report: %v", err)
+	}
+
+	got := new(FlushReport)
+
+	err = json.Unmarshal(data, got)
+	if err != nil {
+		t.Fatalf("unable to unmarshal report: %v", err)
+	}
+
+	want := &FlushReport{
+		Bucket:     "bucket",
+		Namespace:  "foo/bar",
+		Examined:   3,
+		Removed:    2,
+		BytesFreed: 150,
+		Keys:       []string{"foo/bar/a.tgz", "foo/bar/b.tgz?versionId=abc"},
+		Errors:     []string{"first", "second"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report is %+v, want %+v", got, want)
+	}
+}
@@ -4,19 +4,27 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dustin/go-humanize"
-	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
 
-	"github.com/go-vela/archiver/v3"
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
 )
 
 const restoreAction = "restore"
 
+// partSize represents the size of each ranged
+// request of a parallel download.
+var partSize int64 = 64 * humanize.MiByte
+
 // Restore represents the plugin configuration for Restore information.
 type Restore struct {
 	// sets the name of the bucket
@@ -29,43 +37,233 @@ type Restore struct {
 	Filename string
 	// sets the timeout on the call to s3
 	Timeout time.Duration
+	// sets the additional timeout per gigabyte of the object
+	TimeoutPerGB time.Duration
 	// will hold our final namespace for the path to the objects
 	Namespace string
+	// sets the directory to stage the archive in
+	TmpDir string
+	// whether to keep the setuid, setgid and sticky bits of extracted files
+	PreserveModeBits bool
+	// sets the maximum ratio of extracted to compressed bytes
+	MaxRatio float64
+	// whether to skip the entries an unprivileged user can not extract
+	NonRoot bool
+	// sets the tar entry types to extract
+	AllowedTypes []string
+	// sets the key to decrypt encrypted archives with
+	EncryptionKey []byte
+	// sets the key to verify the signature of archives with
+	SigningKey []byte
+	// sets the number of archive entries to log at debug level
+	ListEntries int
+	// sets the interval for logging download progress
+	ProgressInterval time.Duration
+	// sets the object size to download with concurrent ranged requests at
+	ParallelThreshold uint64
+	// sets the number of concurrent ranged requests for a parallel download
+	Concurrency int
+	// sets the bytes per second to limit the download to
+	MaxBandwidth uint64
+	// whether to read and write objects like drone-s3-cache
+	DroneCompat bool
+	// will hold the namespace to restore from when the object is missing
+	FallbackNamespace string
+	// whether to report what would be restored without downloading it
+	DryRun bool
+	// sets the policy for the symlinks in the archive
+	Symlinks string
+	// sets the maximum number of links in a chain of dereferenced symlinks
+	SymlinkDepth int
+	// whether to skip restoring the object when it is unchanged since it was last restored
+	SkipUnchanged bool
+	// sets the ids recorded in the archive to map to the owners of extracted files
+	IDMap []string
+	// whether to keep the modification time recorded in the archive for extracted files
+	PreserveMtimes bool
+	// whether to write the tar stream of the archive to stdout instead of extracting it
+	Stdout bool
+	// sets the entry of the archive to write to stdout instead of the tar stream
+	StdoutEntry string
+
+	// will hold the archive format of the object
+	format string
+	// will hold the index of the parts of a split archive
+	index *splitIndex
 }
 
 // Exec formats and runs the actions for restoring a cache in s3.
-func (r *Restore) Exec(mc *minio.Client) error {
+func (r *Restore) Exec(ctx context.Context, store storage.Backend, res *Result) error {
 	logrus.Trace("running restore with provided configuration")
 
+	res.Key = r.Namespace
+
 	logrus.Debugf("getting object info on bucket %s from path: %s", r.Bucket, r.Namespace)
 
 	// set a timeout on the request to the cache provider
-	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	sCtx, cancel := context.WithTimeout(ctx, r.Timeout)
 	defer cancel()
 
 	// collect metadata on the object
-	objInfo, err := mc.StatObject(ctx, r.Bucket, r.Namespace, minio.StatObjectOptions{})
-	if objInfo.Key == "" {
+	objInfo, err := store.Stat(sCtx, r.Bucket, r.Namespace)
+
+	// restore the fallback object when the object is missing
+	if err != nil && ctx.Err() == nil && len(r.FallbackNamespace) > 0 {
+		logrus.Infof("no cache found at %s, falling back to %s", r.Namespace, r.FallbackNamespace)
+
+		objInfo, err = store.Stat(sCtx, r.Bucket, r.FallbackNamespace)
+		if err == nil {
+			r.Namespace = r.FallbackNamespace
+			res.Key = r.Namespace
+		}
+	}
+
+	if err != nil {
+		// stop when the build was cancelled
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		logrus.Error(err)
+
+		// distinguish a cache miss from a bucket that can't be accessed
+		if r.DryRun {
+			return verifyAccess(sCtx, store, r.Bucket, r.Namespace)
+		}
+
+		return nil
+	}
+
+	res.Hit = true
+
+	logProvenance(objInfo)
+
+	// skip the download when the workspace already holds the object
+	if r.SkipUnchanged && r.unchanged(objInfo) {
+		logrus.Infof("cache at %s unchanged since it was last restored (etag %s), skipping download", r.Namespace, objInfo.ETag)
+
+		res.Unchanged = true
+
+		return nil
+	}
+
+	// read the index of the parts of a split archive
+	if len(userMetadata(objInfo, metaParts)) > 0 {
+		r.index, err = readSplitIndex(sCtx, store, r.Bucket, r.Namespace)
+		if err != nil {
+			return err
+		}
+
+		logrus.Debugf("cache is split into %d parts", len(r.index.Parts))
+
+		objInfo.Size = r.index.Size
+	}
+
+	// report what would be restored without downloading the object
+	if r.DryRun {
+		res.Size = objInfo.Size
+
+		logrus.Infof("dry run: %s would be downloaded from bucket %s at %s and extracted",
+			humanize.Bytes(uint64(objInfo.Size)), r.Bucket, r.Namespace)
+
 		return nil
 	}
 
 	logrus.Debugf("getting object in bucket %s from path: %s", r.Bucket, r.Namespace)
 
-	logrus.Infof("%s to download", humanize.Bytes(uint64(objInfo.Size)))
+	logrus.Debugf("%s to download", humanize.Bytes(uint64(objInfo.Size)))
+
+	// set a timeout on the transfer based on the size of the object
+	timeout := transferTimeout(r.Timeout, r.TimeoutPerGB, objInfo.Size)
+
+	logrus.Debugf("using transfer timeout of %s", timeout)
+
+	tCtx, tCancel := context.WithTimeout(ctx, timeout)
+	defer tCancel()
+
+	start := time.Now()
+
+	// stage the archive in the tmp dir when provided, otherwise the workspace
+	dir := r.TmpDir
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	f, err := createTemp(dir, r.Filename)
+	if err != nil {
+		return err
+	}
+
+	// delete the staging file on both success and failure
+	defer removeTemp(f)
 
 	// retrieve the object in specified path of the bucket
-	err = mc.FGetObject(ctx, r.Bucket, r.Namespace, r.Filename, minio.GetObjectOptions{})
+	sum, err := r.fetch(tCtx, store, f, objInfo)
+	if err != nil {
+		return err
+	}
+
+	res.TransferDuration = time.Since(start)
+
+	stat, err := os.Stat(f)
 	if err != nil {
 		return err
 	}
 
-	stat, err := os.Stat(r.Filename)
+	res.Size = stat.Size()
+
+	logPhase("download", res.TransferDuration, res.Size)
+
+	// verify the archive before extracting it onto the filesystem
+	if !verifyChecksum(objInfo, sum) || !verifySignature(objInfo, r.SigningKey, r.Namespace, sum) {
+		res.Hit = false
+
+		return nil
+	}
+
+	res.Checksum = sum
+
+	// decrypt the archive when it was encrypted on rebuild
+	if len(userMetadata(objInfo, metaEncryption)) > 0 {
+		if len(r.EncryptionKey) == 0 {
+			return fmt.Errorf("cache object is encrypted, no encryption key provided")
+		}
+
+		logrus.Debugf("decrypting archive %s", f)
+
+		err = decryptFile(f, r.EncryptionKey)
+		if err != nil {
+			logrus.Errorf("cache corrupted or encrypted with a different key, ignoring: %v", err)
+
+			res.Hit = false
+
+			return nil
+		}
+	}
+
+	// log the contents of the archive for debugging
+	err = logEntries(f, r.format, r.ListEntries)
 	if err != nil {
 		return err
 	}
 
-	logrus.Infof("downloaded %s to %s on local filesystem", humanize.Bytes(uint64(stat.Size())), r.Filename)
+	logrus.Debugf("downloaded %s to %s on local filesystem", humanize.Bytes(uint64(stat.Size())), f)
+
+	// write the archive to stdout instead of extracting it
+	if r.Stdout {
+		start = time.Now()
+
+		err = r.stream(f, stdout)
+		if err != nil {
+			return err
+		}
+
+		res.ExtractDuration = time.Since(start)
+
+		logPhase("stream", res.ExtractDuration, res.Size)
+
+		return nil
+	}
 
 	logrus.Debug("getting current working directory")
 
@@ -75,35 +273,245 @@ func (r *Restore) Exec(mc *minio.Client) error {
 		return err
 	}
 
-	logrus.Debugf("unarchiving file %s into directory %s", r.Filename, pwd)
+	logrus.Debugf("unarchiving file %s into directory %s", f, pwd)
+
+	start = time.Now()
+
+	allowed, err := parseEntryTypes(r.AllowedTypes)
+	if err != nil {
+		return err
+	}
+
+	ids, err := parseIDMap(r.IDMap)
+	if err != nil {
+		return err
+	}
 
 	// expand the object back onto the filesystem
-	err = archiver.Unarchive(r.Filename, pwd)
+	e := &extractor{
+		preserveModeBits: r.PreserveModeBits,
+		maxRatio:         r.MaxRatio,
+		nonRoot:          r.NonRoot,
+		allowedTypes:     allowed,
+		format:           r.format,
+		symlinks:         r.Symlinks,
+		symlinkDepth:     r.SymlinkDepth,
+		idMap:            ids,
+		preserveMtimes:   r.PreserveMtimes,
+	}
+
+	err = e.extract(f, pwd)
 	if err != nil {
 		return err
 	}
 
-	logrus.Infof("successfully unpacked archive %s", r.Filename)
+	res.ExtractDuration = time.Since(start)
+
+	logPhase("extract", res.ExtractDuration, res.Size)
+
+	// record the object for skipping the next restore into the workspace
+	if r.SkipUnchanged {
+		err = r.mark(objInfo, e.roots)
+		if err != nil {
+			return fmt.Errorf("unable to write restore marker %s: %w", markerFile, err)
+		}
+	}
+
+	logrus.Debugf("successfully unpacked archive %s", f)
+
+	logrus.Debug("cache restore action completed")
+
+	return nil
+}
+
+// fetch retrieves the object from the bucket into the archive path, using
+// concurrent ranged requests when the object exceeds the parallel threshold.
+func (r *Restore) fetch(ctx context.Context, store storage.Backend, path string, info storage.Object) (string, error) {
+	// share the bandwidth limit across every request of the download
+	lim := newLimiter(r.MaxBandwidth)
+
+	// download the parts of a split archive
+	if r.index != nil {
+		return r.downloadParts(ctx, store, path, lim)
+	}
+
+	if r.ParallelThreshold == 0 || r.Concurrency < 2 || info.Size < partSize || uint64(info.Size) < r.ParallelThreshold {
+		return r.download(ctx, store, path, info.Size, lim)
+	}
+
+	logrus.Debugf("downloading %s with %d concurrent ranged requests", humanize.Bytes(uint64(info.Size)), r.Concurrency)
+
+	return r.downloadParallel(ctx, store, path, info, lim)
+}
+
+// download retrieves the object from the bucket into the archive path
+// while logging the transfer progress, returning the SHA256 checksum.
+func (r *Restore) download(ctx context.Context, store storage.Backend, path string, size int64, lim *limiter) (string, error) {
+	obj, err := store.Get(ctx, r.Bucket, r.Namespace)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// track the download progress for heartbeat logs
+	p := newProgress("download", size)
 
-	// delete the temporary archive file
-	err = os.Remove(r.Filename)
+	stop := p.Start(r.ProgressInterval)
+	defer stop()
+
+	// calculate the checksum while writing the archive
+	h := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(f, h), lim.Reader(ctx, p.Reader(obj)))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), f.Close()
+}
+
+// downloadParallel retrieves the object from the bucket into the archive
+// path with concurrent ranged requests, each written at its offset in the
+// file, returning the SHA256 checksum.
+func (r *Restore) downloadParallel(ctx context.Context, store storage.Backend, path string, info storage.Object, lim *limiter) (string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// stop the remaining parts on the first failure
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// track the download progress for heartbeat logs
+	p := newProgress("download", info.Size)
+
+	stop := p.Start(r.ProgressInterval)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	offsets := make(chan int64)
+	errs := make(chan error, r.Concurrency)
+
+	for range r.Concurrency {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for offset := range offsets {
+				err := r.downloadPart(ctx, store, f, p, lim, info, offset)
+				if err != nil {
+					errs <- err
+
+					cancel()
+
+					return
+				}
+			}
+		}()
+	}
+
+	// hand out the offsets of the parts until a part fails
+	for offset := int64(0); offset < info.Size && ctx.Err() == nil; offset += partSize {
+		select {
+		case offsets <- offset:
+		case <-ctx.Done():
+		}
+	}
+
+	close(offsets)
+	wg.Wait()
+	close(errs)
+
+	err = <-errs
+	if err != nil {
+		return "", err
+	}
+
+	// the parts were written out of order, so checksum the file
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return fileSHA256(path)
+}
+
+// downloadPart retrieves the part of the object starting at the
+// offset with a ranged request and writes it at the offset in the file.
+func (r *Restore) downloadPart(ctx context.Context, store storage.Backend, f *os.File, p *progress, lim *limiter, info storage.Object, offset int64) error {
+	length := min(partSize, info.Size-offset)
+
+	body, err := store.GetRange(ctx, r.Bucket, r.Namespace, storage.RangeOptions{
+		Offset: offset,
+		Length: length,
+		ETag:   info.ETag,
+	})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	n, err := io.Copy(io.NewOffsetWriter(f, offset), lim.Reader(ctx, p.Reader(body)))
 	if err != nil {
-		logrus.Infof("delete of archive file %s unsuccessful", r.Filename)
-	} else {
-		logrus.Infof("cache archive %s successfully deleted", r.Filename)
+		return err
 	}
 
-	logrus.Infof("cache restore action completed")
+	if n != length {
+		return fmt.Errorf("part at offset %d is %d bytes, want %d", offset, n, length)
+	}
 
 	return nil
 }
 
+// verifyChecksum is a helper function to verify the checksum of the
+// downloaded archive matches the checksum recorded on the object.
+func verifyChecksum(info storage.Object, sum string) bool {
+	want := userMetadata(info, metaSHA256)
+
+	// objects created by older versions have no checksum
+	if len(want) == 0 {
+		logrus.Debug("no sha256 checksum recorded on the cache object, skipping verification")
+
+		return true
+	}
+
+	if !strings.EqualFold(want, sum) {
+		logrus.Errorf("cache corrupted, ignoring: sha256 checksum %s does not match expected %s", sum, want)
+
+		return false
+	}
+
+	logrus.Debugf("verified sha256 checksum %s", sum)
+
+	return true
+}
+
 // Configure prepares the restore fields for the action to be taken.
 func (r *Restore) Configure(repo *Repo) error {
 	logrus.Trace("configuring restore action")
 
+	r.format = cacheFormat
+
+	// lay out and extract the object like drone-s3-cache
+	if r.DroneCompat {
+		return r.configureDrone(repo)
+	}
+
 	// construct the object path
-	path := buildNamespace(repo, r.Prefix, r.Path, r.Filename)
+	path, err := buildNamespace(repo, r.Prefix, r.Path, r.Filename)
+	if err != nil {
+		return err
+	}
 
 	logrus.Debugf("created bucket path %s", path)
 
@@ -113,6 +521,35 @@ func (r *Restore) Configure(repo *Repo) error {
 	return nil
 }
 
+// configureDrone prepares the namespaces of the drone-s3-cache
+// objects for the branch of the build and the default branch.
+func (r *Restore) configureDrone(repo *Repo) error {
+	r.format = droneFormat(r.Filename)
+
+	path, err := droneNamespace(repo, r.Prefix, r.Path, droneBranch(repo), r.Filename)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	r.Namespace = path
+
+	// drone-s3-cache restores the cache of the default branch on a miss
+	if len(r.Path) == 0 && len(repo.Branch) > 0 {
+		fallback, err := droneNamespace(repo, r.Prefix, "", repo.Branch, r.Filename)
+		if err != nil {
+			return err
+		}
+
+		if fallback != path {
+			r.FallbackNamespace = fallback
+		}
+	}
+
+	return nil
+}
+
 // Validate verifies the Restore is properly configured.
 func (r *Restore) Validate() error {
 	logrus.Trace("validating restore action configuration")
@@ -132,5 +569,53 @@ func (r *Restore) Validate() error {
 		return fmt.Errorf("timeout must be greater than 0")
 	}
 
-	return nil
+	// verify list entries is not negative
+	if r.ListEntries < 0 {
+		return fmt.Errorf("list entries must not be negative")
+	}
+
+	// verify concurrency is not negative
+	if r.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+
+	// verify max ratio is not negative
+	if r.MaxRatio < 0 {
+		return fmt.Errorf("max ratio must not be negative")
+	}
+
+	// verify the allowed entry types are supported
+	_, err := parseEntryTypes(r.AllowedTypes)
+	if err != nil {
+		return err
+	}
+
+	// verify the policy for symlinks is supported
+	err = validateSymlinkPolicy(r.Symlinks)
+	if err != nil {
+		return err
+	}
+
+	if r.SymlinkDepth < 0 {
+		return fmt.Errorf("symlink depth must not be negative")
+	}
+
+	// verify an entry is only selected when writing to stdout
+	if len(r.StdoutEntry) > 0 && !r.Stdout {
+		return fmt.Errorf("stdout entry provided without stdout")
+	}
+
+	// verify nothing is extracted to skip on the next restore
+	if r.Stdout && r.SkipUnchanged {
+		return fmt.Errorf("skip unchanged can not be used with stdout")
+	}
+
+	// verify the id mappings are valid
+	_, err = parseIDMap(r.IDMap)
+	if err != nil {
+		return err
+	}
+
+	// verify the staging directory exists
+	return validateTmpDir(r.TmpDir)
 }
@@ -3,6 +3,10 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -24,6 +28,42 @@ func TestS3Cache_Restore_Validate(t *testing.T) {
 	}
 }
 
+func TestS3Cache_Restore_Validate_InvalidIDMap(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	r := &Restore{
+		Timeout:  timeout,
+		Bucket:   "bucket",
+		Prefix:   "foo/bar",
+		Filename: "archive.tar",
+		IDMap:    []string{"root:builder"},
+	}
+
+	err := r.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
+func TestS3Cache_Restore_Validate_StdoutEntry(t *testing.T) {
+	// setup types
+	timeout, _ := time.ParseDuration("10m")
+
+	r := &Restore{
+		Timeout:     timeout,
+		Bucket:      "bucket",
+		Prefix:      "foo/bar",
+		Filename:    "archive.tar",
+		StdoutEntry: "report.txt",
+	}
+
+	err := r.Validate()
+	if err == nil {
+		t.Errorf("Validate should have returned err")
+	}
+}
+
 func TestS3Cache_Restore_Validate_NoBucket(t *testing.T) {
 	// setup types
 	timeout, _ := time.ParseDuration("10m")
@@ -69,3 +109,417 @@ func TestS3Cache_Restore_Validate_NoTimeout(t *testing.T) {
 		t.Errorf("Validate should have returned err")
 	}
 }
+
+func TestS3Cache_Restore_Exec(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	res := new(Result)
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if !res.Hit {
+		t.Errorf("Hit is %v, want true", res.Hit)
+	}
+
+	_, err = os.Stat("hello.txt")
+	if err != nil {
+		t.Errorf("restored file is missing: %v", err)
+	}
+
+	// verify the staging file for the archive was removed
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("working directory has %d entries, want only hello.txt", len(entries))
+	}
+}
+
+func TestS3Cache_Restore_Exec_TmpDir(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+		TmpDir:    t.TempDir(),
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+		TmpDir:    t.TempDir(),
+	}
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	// verify only the restored files are in the working directory
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "hello.txt" {
+		t.Errorf("working directory has %d entries, want only hello.txt", len(entries))
+	}
+}
+
+func TestS3Cache_Restore_Exec_Corrupted(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// record a checksum that does not match the archive
+	store.objects["foo/bar/archive.tgz"].info.UserMetadata[metaSHA256] = "0000"
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	res := new(Result)
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if res.Hit {
+		t.Errorf("Hit is %v, want false", res.Hit)
+	}
+
+	// verify nothing was extracted and the archive was removed
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("working directory has %d entries, want 0", len(entries))
+	}
+}
+
+func TestS3Cache_Restore_Exec_Encrypted(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	key := bytes.Repeat([]byte{1}, 32)
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:        "bucket",
+		Filename:      "archive.tgz",
+		Timeout:       10 * time.Minute,
+		Mount:         []string{"testdata/hello.txt"},
+		Namespace:     "foo/bar/archive.tgz",
+		EncryptionKey: key,
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	// verify the restore fails without the key
+	err = r.Exec(context.Background(), store, new(Result))
+	if err == nil {
+		t.Errorf("Exec should have returned err")
+	}
+
+	r.EncryptionKey = key
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	_, err = os.Stat("hello.txt")
+	if err != nil {
+		t.Errorf("restored file is missing: %v", err)
+	}
+}
+
+func TestS3Cache_Restore_Exec_Miss(t *testing.T) {
+	// setup types
+	res := new(Result)
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := r.Exec(context.Background(), newFakeBackend(), res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if res.Hit {
+		t.Errorf("Hit is %v, want false", res.Hit)
+	}
+}
+
+func TestS3Cache_Restore_Exec_Parallel(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// split the archive into several parts
+	size := partSize
+	partSize = 16
+
+	t.Cleanup(func() { partSize = size })
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	res := new(Result)
+
+	r := &Restore{
+		Bucket:            "bucket",
+		Filename:          "archive.tgz",
+		Timeout:           10 * time.Minute,
+		Namespace:         "foo/bar/archive.tgz",
+		ParallelThreshold: 1,
+		Concurrency:       3,
+	}
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if !res.Hit {
+		t.Errorf("Hit is %v, want true", res.Hit)
+	}
+
+	if store.ranges < 2 {
+		t.Errorf("ranges is %d, want the archive downloaded in several parts", store.ranges)
+	}
+
+	_, err = os.Stat("hello.txt")
+	if err != nil {
+		t.Errorf("restored file is missing: %v", err)
+	}
+}
+
+// chdir is a helper function to change the working
+// directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unable to get working directory: %v", err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatalf("unable to change working directory: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(pwd)
+	})
+}
+
+func TestS3Cache_Restore_Exec_DryRun(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", make([]byte, 10), time.Now(), nil)
+
+	res := new(Result)
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+		DryRun:    true,
+	}
+
+	err := r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Errorf("Exec returned err: %v", err)
+	}
+
+	if !res.Hit || res.Size != 10 {
+		t.Errorf("Hit is %v and Size is %d, want true and 10", res.Hit, res.Size)
+	}
+
+	_, err = os.Stat("archive.tgz")
+	if !os.IsNotExist(err) {
+		t.Errorf("archive should not have been downloaded")
+	}
+}
+
+func TestS3Cache_Restore_Exec_SkipUnchanged(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	// restore repeatedly into a long-lived working directory
+	chdir(t, t.TempDir())
+
+	restore := func() *Result {
+		t.Helper()
+
+		res := new(Result)
+
+		r := &Restore{
+			Bucket:        "bucket",
+			Filename:      "archive.tgz",
+			Timeout:       10 * time.Minute,
+			Namespace:     "foo/bar/archive.tgz",
+			SkipUnchanged: true,
+		}
+
+		err := r.Exec(context.Background(), store, res)
+		if err != nil {
+			t.Fatalf("Exec returned err: %v", err)
+		}
+
+		return res
+	}
+
+	if res := restore(); !res.Hit || res.Unchanged {
+		t.Errorf("first restore is hit %v unchanged %v, want a download", res.Hit, res.Unchanged)
+	}
+
+	want := map[string]restoreMarker{
+		"bucket/foo/bar/archive.tgz": {ETag: store.objects["foo/bar/archive.tgz"].info.ETag, Roots: []string{"hello.txt"}},
+	}
+
+	if got := readMarkers(markerFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("restore marker is %v, want %v", got, want)
+	}
+
+	if res := restore(); !res.Hit || !res.Unchanged {
+		t.Errorf("second restore is hit %v unchanged %v, want skipped", res.Hit, res.Unchanged)
+	}
+
+	// restore again when the restored files were removed
+	err = os.Remove("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := restore(); res.Unchanged {
+		t.Errorf("restore after removing the files was skipped")
+	}
+
+	_, err = os.Stat("hello.txt")
+	if err != nil {
+		t.Errorf("restored file is missing: %v", err)
+	}
+}
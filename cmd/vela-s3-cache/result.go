@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+)
+
+// Result represents the outcome of an action
+// recorded for metrics and reporting.
+type Result struct {
+	// action performed against the s3 cache
+	Action string
+	// key of the object(s) in the bucket
+	Key string
+	// whether the cache object was found
+	Hit bool
+	// whether the cache object was unchanged since it was last restored,
+	// or the mounts were unchanged since the cache object was rebuilt
+	Unchanged bool
+	// size in bytes of the archive transferred
+	Size int64
+	// size in bytes of the files in the archive
+	UncompressedSize int64
+	// sha256 checksum of the archive transferred
+	Checksum string
+	// number of objects removed
+	Removed int
+	// size in bytes of the objects removed
+	Freed uint64
+	// number of incomplete uploads aborted
+	Aborted int
+	// number of objects listed
+	Listed int
+	// number of caches with stats reported
+	Caches int
+	// number of caches reported as unused
+	Unused int
+	// presigned URL for downloading the cache object
+	GetURL string
+	// presigned URL for uploading the cache object
+	PutURL string
+	// time the presigned URLs expire
+	Expires time.Time
+	// whether the cache object is pinned
+	Pinned bool
+	// time spent walking the files to archive
+	WalkDuration time.Duration
+	// time spent creating the archive
+	CompressDuration time.Duration
+	// time spent uploading or downloading the archive
+	TransferDuration time.Duration
+	// time spent extracting the archive
+	ExtractDuration time.Duration
+	// round trip time of the first request to s3
+	Latency time.Duration
+	// total time spent on the action
+	Duration time.Duration
+	// whether the action completed successfully
+	Success bool
+	// whether the action only reported what would happen
+	DryRun bool
+}
+
+// CompressionRatio returns the ratio of the size of the
+// files in the archive to the size of the archive.
+func (r *Result) CompressionRatio() float64 {
+	if r.Size <= 0 || r.UncompressedSize <= 0 {
+		return 0
+	}
+
+	return float64(r.UncompressedSize) / float64(r.Size)
+}
+
+// Summary returns a one-line human readable summary of the result.
+func (r *Result) Summary() string {
+	b := new(strings.Builder)
+
+	// describe the changes a dry run would have made
+	done, removed, freed, set, aborted := "transferred", "removed", "freed", "set", "aborted"
+	if r.DryRun {
+		done, removed, freed, set, aborted = "would be transferred", "would be removed", "would be freed", "would be set", "would be aborted"
+
+		b.WriteString("dry run: ")
+	}
+
+	fmt.Fprintf(b, "%s of %s", r.Action, r.Key)
+
+	if !r.Success {
+		fmt.Fprintf(b, " failed after %s", r.Duration.Round(time.Millisecond))
+
+		return b.String()
+	}
+
+	switch r.Action {
+	case checkAction:
+		fmt.Fprintf(b, ": list, put and delete permitted (latency %s)", r.Latency.Round(time.Millisecond))
+	case restoreAction:
+		if !r.Hit {
+			fmt.Fprintf(b, ": cache miss in %s", r.Duration.Round(time.Millisecond))
+
+			return b.String()
+		}
+
+		if r.Unchanged {
+			fmt.Fprintf(b, ": cache hit, unchanged since last restore in %s", r.Duration.Round(time.Millisecond))
+
+			return b.String()
+		}
+
+		fmt.Fprintf(b,
+			": cache hit, %s %s (transfer %s, extract %s)",
+			humanize.Bytes(uint64(r.Size)),
+			done,
+			r.TransferDuration.Round(time.Millisecond),
+			r.ExtractDuration.Round(time.Millisecond),
+		)
+	case rebuildAction:
+		if r.Unchanged {
+			fmt.Fprintf(b, ": mounts unchanged since last rebuild in %s", r.Duration.Round(time.Millisecond))
+
+			return b.String()
+		}
+
+		fmt.Fprintf(b,
+			": %s archived to %s %s (walk %s, compress %s, transfer %s)",
+			humanize.Bytes(uint64(r.UncompressedSize)),
+			humanize.Bytes(uint64(r.Size)),
+			done,
+			r.WalkDuration.Round(time.Millisecond),
+			r.CompressDuration.Round(time.Millisecond),
+			r.TransferDuration.Round(time.Millisecond),
+		)
+	case benchmarkAction:
+		fmt.Fprintf(b,
+			": %s archived to %s at the smallest level (walk %s, compress %s)",
+			humanize.Bytes(uint64(r.UncompressedSize)),
+			humanize.Bytes(uint64(r.Size)),
+			r.WalkDuration.Round(time.Millisecond),
+			r.CompressDuration.Round(time.Millisecond),
+		)
+	case flushAction:
+		fmt.Fprintf(b, ": %d objects %s, %s %s", r.Removed, removed, humanize.Bytes(r.Freed), freed)
+	case lifecycleAction:
+		fmt.Fprintf(b, ": lifecycle rule %s", set)
+	case abortAction:
+		fmt.Fprintf(b, ": %d incomplete uploads %s", r.Aborted, aborted)
+	case presignAction:
+		urls := "download URL"
+		if len(r.PutURL) > 0 {
+			urls = "download and upload URLs"
+		}
+
+		fmt.Fprintf(b, ": %s expiring %s", urls, r.Expires.Format(time.RFC3339))
+	case listAction:
+		fmt.Fprintf(b, ": %d objects, %s", r.Listed, humanize.Bytes(uint64(r.Size)))
+	case pinAction:
+		pinned := "unpinned"
+		if r.Pinned {
+			pinned = "pinned"
+		}
+
+		fmt.Fprintf(b, ": cache object %s", pinned)
+	case statsAction:
+		fmt.Fprintf(b, ": %d caches, %d unused", r.Caches, r.Unused)
+	}
+
+	fmt.Fprintf(b, " in %s", r.Duration.Round(time.Millisecond))
+
+	return b.String()
+}
+
+// Outputs returns the ordered key value pairs
+// summarizing the result for Vela outputs.
+func (r *Result) Outputs() [][2]string {
+	outputs := [][2]string{
+		{"S3_CACHE_ACTION", r.Action},
+		{"S3_CACHE_KEY", r.Key},
+		{"S3_CACHE_SUCCESS", strconv.FormatBool(r.Success)},
+	}
+
+	switch r.Action {
+	case checkAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_LATENCY_SECONDS", formatSeconds(r.Latency)},
+		)
+	case restoreAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_HIT", strconv.FormatBool(r.Hit)},
+			[2]string{"S3_CACHE_BYTES", strconv.FormatInt(r.Size, 10)},
+			[2]string{"S3_CACHE_SHA256", r.Checksum},
+			[2]string{"S3_CACHE_TRANSFER_SECONDS", formatSeconds(r.TransferDuration)},
+			[2]string{"S3_CACHE_EXTRACT_SECONDS", formatSeconds(r.ExtractDuration)},
+		)
+	case benchmarkAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_BYTES", strconv.FormatInt(r.Size, 10)},
+			[2]string{"S3_CACHE_UNCOMPRESSED_BYTES", strconv.FormatInt(r.UncompressedSize, 10)},
+			[2]string{"S3_CACHE_WALK_SECONDS", formatSeconds(r.WalkDuration)},
+			[2]string{"S3_CACHE_COMPRESS_SECONDS", formatSeconds(r.CompressDuration)},
+		)
+	case rebuildAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_BYTES", strconv.FormatInt(r.Size, 10)},
+			[2]string{"S3_CACHE_UNCOMPRESSED_BYTES", strconv.FormatInt(r.UncompressedSize, 10)},
+			[2]string{"S3_CACHE_SHA256", r.Checksum},
+			[2]string{"S3_CACHE_WALK_SECONDS", formatSeconds(r.WalkDuration)},
+			[2]string{"S3_CACHE_COMPRESS_SECONDS", formatSeconds(r.CompressDuration)},
+			[2]string{"S3_CACHE_TRANSFER_SECONDS", formatSeconds(r.TransferDuration)},
+		)
+	case flushAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_OBJECTS_REMOVED", strconv.Itoa(r.Removed)},
+			[2]string{"S3_CACHE_BYTES_FREED", strconv.FormatUint(r.Freed, 10)},
+		)
+	case abortAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_UPLOADS_ABORTED", strconv.Itoa(r.Aborted)},
+		)
+	case presignAction:
+		// only write the URLs that were presigned
+		if len(r.GetURL) > 0 {
+			outputs = append(outputs, [2]string{"S3_CACHE_GET_URL", r.GetURL})
+		}
+
+		if len(r.PutURL) > 0 {
+			outputs = append(outputs, [2]string{"S3_CACHE_PUT_URL", r.PutURL})
+		}
+
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_URL_EXPIRES", r.Expires.Format(time.RFC3339)},
+		)
+	case listAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_OBJECTS_LISTED", strconv.Itoa(r.Listed)},
+			[2]string{"S3_CACHE_BYTES", strconv.FormatInt(r.Size, 10)},
+		)
+	case pinAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_PINNED", strconv.FormatBool(r.Pinned)},
+		)
+	case statsAction:
+		outputs = append(outputs,
+			[2]string{"S3_CACHE_CACHES_REPORTED", strconv.Itoa(r.Caches)},
+			[2]string{"S3_CACHE_CACHES_UNUSED", strconv.Itoa(r.Unused)},
+		)
+	}
+
+	return append(outputs, [2]string{"S3_CACHE_DURATION_SECONDS", formatSeconds(r.Duration)})
+}
+
+// logPhase is a helper function to log the duration
+// and throughput of a single phase of an action.
+func logPhase(phase string, d time.Duration, size int64) {
+	rate := "N/A"
+	if d > 0 {
+		rate = humanize.Bytes(uint64(float64(size)/d.Seconds())) + "/s"
+	}
+
+	logrus.Infof("%s phase completed in %s, %s at %s", phase, d.Round(time.Millisecond), humanize.Bytes(uint64(size)), rate)
+}
+
+// formatSeconds is a helper function to format
+// a duration as a number of seconds.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// mountSize is a helper function to calculate the
+// total size of the regular files in the mounts.
+func mountSize(mounts []string) (int64, error) {
+	total := int64(0)
+
+	for _, mount := range mounts {
+		// count the files of the target of a mount that is a symlink
+		root, err := filepath.EvalSymlinks(mount)
+		if err != nil {
+			root = mount
+		}
+
+		err = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			total += info.Size()
+
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
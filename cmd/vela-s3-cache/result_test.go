@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Result_CompressionRatio(t *testing.T) {
+	// setup types
+	r := &Result{
+		Size:             25,
+		UncompressedSize: 100,
+	}
+
+	if got := r.CompressionRatio(); got != 4 {
+		t.Errorf("CompressionRatio is %v, want 4", got)
+	}
+
+	r = &Result{}
+
+	if got := r.CompressionRatio(); got != 0 {
+		t.Errorf("CompressionRatio is %v, want 0", got)
+	}
+}
+
+func TestS3Cache_mountSize(t *testing.T) {
+	// setup types
+	got, err := mountSize([]string{"testdata/hello.txt"})
+	if err != nil {
+		t.Errorf("mountSize returned err: %v", err)
+	}
+
+	if got == 0 {
+		t.Errorf("mountSize is 0, want size of testdata/hello.txt")
+	}
+}
+
+func TestS3Cache_Result_Summary(t *testing.T) {
+	testCases := []struct {
+		desc string
+		res  *Result
+		want string
+	}{
+		{
+			desc: "restore hit",
+			res: &Result{
+				Action:           restoreAction,
+				Key:              "foo/bar/archive.tgz",
+				Hit:              true,
+				Size:             1000,
+				TransferDuration: time.Second,
+				ExtractDuration:  2 * time.Second,
+				Duration:         3 * time.Second,
+				Success:          true,
+			},
+			want: "restore of foo/bar/archive.tgz: cache hit, 1.0 kB transferred (transfer 1s, extract 2s) in 3s",
+		},
+		{
+			desc: "restore unchanged",
+			res: &Result{
+				Action:    restoreAction,
+				Key:       "foo/bar/archive.tgz",
+				Hit:       true,
+				Unchanged: true,
+				Duration:  time.Second,
+				Success:   true,
+			},
+			want: "restore of foo/bar/archive.tgz: cache hit, unchanged since last restore in 1s",
+		},
+		{
+			desc: "restore miss",
+			res: &Result{
+				Action:   restoreAction,
+				Key:      "foo/bar/archive.tgz",
+				Duration: time.Second,
+				Success:  true,
+			},
+			want: "restore of foo/bar/archive.tgz: cache miss in 1s",
+		},
+		{
+			desc: "flush",
+			res: &Result{
+				Action:   flushAction,
+				Key:      "foo/bar",
+				Removed:  2,
+				Freed:    2000,
+				Duration: time.Second,
+				Success:  true,
+			},
+			want: "flush of foo/bar: 2 objects removed, 2.0 kB freed in 1s",
+		},
+		{
+			desc: "flush dry run",
+			res: &Result{
+				Action:   flushAction,
+				Key:      "foo/bar",
+				Removed:  2,
+				Freed:    2000,
+				Duration: time.Second,
+				Success:  true,
+				DryRun:   true,
+			},
+			want: "dry run: flush of foo/bar: 2 objects would be removed, 2.0 kB would be freed in 1s",
+		},
+		{
+			desc: "abort-incomplete",
+			res: &Result{
+				Action:   abortAction,
+				Key:      "foo/bar",
+				Aborted:  3,
+				Duration: time.Second,
+				Success:  true,
+			},
+			want: "abort-incomplete of foo/bar: 3 incomplete uploads aborted in 1s",
+		},
+		{
+			desc: "presign",
+			res: &Result{
+				Action:   presignAction,
+				Key:      "foo/bar/archive.tgz",
+				GetURL:   "https://s3.example.com/bucket/foo/bar/archive.tgz",
+				PutURL:   "https://s3.example.com/bucket/foo/bar/archive.tgz",
+				Expires:  time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC),
+				Duration: time.Second,
+				Success:  true,
+			},
+			want: "presign of foo/bar/archive.tgz: download and upload URLs expiring 2030-01-02T15:04:05Z in 1s",
+		},
+		{
+			desc: "list",
+			res: &Result{
+				Action:   listAction,
+				Key:      "foo/bar",
+				Listed:   3,
+				Size:     1500000,
+				Duration: time.Second,
+				Success:  true,
+			},
+			want: "list of foo/bar: 3 objects, 1.5 MB in 1s",
+		},
+		{
+			desc: "stats",
+			res: &Result{
+				Action:   statsAction,
+				Key:      "foo/bar",
+				Caches:   3,
+				Unused:   1,
+				Duration: time.Second,
+				Success:  true,
+			},
+			want: "stats of foo/bar: 3 caches, 1 unused in 1s",
+		},
+		{
+			desc: "check",
+			res: &Result{
+				Action:   checkAction,
+				Key:      "foo/bar/.vela-s3-cache-check",
+				Latency:  20 * time.Millisecond,
+				Duration: 100 * time.Millisecond,
+				Success:  true,
+			},
+			want: "check of foo/bar/.vela-s3-cache-check: list, put and delete permitted (latency 20ms) in 100ms",
+		},
+		{
+			desc: "rebuild unchanged",
+			res: &Result{
+				Action:    rebuildAction,
+				Key:       "foo/bar/archive.tgz",
+				Duration:  200 * time.Millisecond,
+				Success:   true,
+				Unchanged: true,
+			},
+			want: "rebuild of foo/bar/archive.tgz: mounts unchanged since last rebuild in 200ms",
+		},
+		{
+			desc: "failure",
+			res: &Result{
+				Action:   rebuildAction,
+				Key:      "foo/bar/archive.tgz",
+				Duration: time.Second,
+			},
+			want: "rebuild of foo/bar/archive.tgz failed after 1s",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := tC.res.Summary(); got != tC.want {
+				t.Errorf("Summary is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
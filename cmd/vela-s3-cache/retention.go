@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const (
+	// retentionGovernance represents the object lock mode retaining the
+	// object unless removed with the permission to bypass governance.
+	retentionGovernance = "governance"
+
+	// retentionCompliance represents the object lock mode
+	// retaining the object for every user until the date.
+	retentionCompliance = "compliance"
+)
+
+// parseRetainUntil is a helper function to parse the date to retain
+// the objects until, as a RFC 3339 timestamp, a date or a duration
+// from now (i.e. 2030-01-02T15:04:05Z, 2030-01-02 or 720h).
+func parseRetainUntil(value string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid retain until %s: must be a RFC 3339 timestamp, date or duration", value)
+	}
+
+	return now.Add(d), nil
+}
+
+// validateRetention verifies the object lock settings of the rebuild,
+// resolving the date to retain the archive until.
+func (r *Rebuild) validateRetention() error {
+	switch strings.ToLower(r.RetentionMode) {
+	case "":
+		if len(r.RetainUntil) > 0 {
+			return fmt.Errorf("no retention mode provided for retain until %s", r.RetainUntil)
+		}
+
+		return nil
+	case retentionGovernance, retentionCompliance:
+	default:
+		return fmt.Errorf("invalid retention mode %s: must be %s or %s", r.RetentionMode, retentionGovernance, retentionCompliance)
+	}
+
+	if len(r.RetainUntil) == 0 {
+		return fmt.Errorf("no retain until provided for retention mode %s", r.RetentionMode)
+	}
+
+	now := time.Now()
+
+	until, err := parseRetainUntil(r.RetainUntil, now)
+	if err != nil {
+		return err
+	}
+
+	if !until.After(now) {
+		return fmt.Errorf("retain until %s must be in the future", until.Format(time.RFC3339))
+	}
+
+	r.retainUntil = until.UTC()
+
+	return nil
+}
+
+// retain sets the object lock retention and legal hold of the rebuild
+// on the options for the upload, applied to every object uploaded.
+func (r *Rebuild) retain(opts *storage.PutOptions) {
+	if len(r.RetentionMode) > 0 {
+		logrus.Debugf("retaining archive in %s mode until %s", strings.ToLower(r.RetentionMode), r.retainUntil.Format(time.RFC3339))
+
+		opts.RetentionMode = strings.ToUpper(r.RetentionMode)
+		opts.RetainUntil = r.retainUntil
+	}
+
+	if r.LegalHold {
+		logrus.Debug("placing legal hold on archive")
+
+		opts.LegalHold = true
+	}
+}
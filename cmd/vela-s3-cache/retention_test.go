@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestS3Cache_parseRetainUntil(t *testing.T) {
+	// setup types
+	now := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		desc    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			desc:  "timestamp",
+			value: "2031-02-03T04:05:06Z",
+			want:  time.Date(2031, 2, 3, 4, 5, 6, 0, time.UTC),
+		},
+		{
+			desc:  "date",
+			value: "2031-02-03",
+			want:  time.Date(2031, 2, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:  "duration",
+			value: "720h",
+			want:  now.Add(720 * time.Hour),
+		},
+		{
+			desc:    "invalid",
+			value:   "next year",
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseRetainUntil(tC.value, now)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("parseRetainUntil returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if !got.Equal(tC.want) {
+				t.Errorf("parseRetainUntil is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Rebuild_Validate_Retention(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		mode    string
+		until   string
+		wantErr bool
+	}{
+		{
+			desc: "none",
+		},
+		{
+			desc:  "governance",
+			mode:  "governance",
+			until: "24h",
+		},
+		{
+			desc:  "compliance",
+			mode:  "COMPLIANCE",
+			until: "2999-01-01",
+		},
+		{
+			desc:    "invalid mode",
+			mode:    "forever",
+			until:   "24h",
+			wantErr: true,
+		},
+		{
+			desc:    "no retain until",
+			mode:    "governance",
+			wantErr: true,
+		},
+		{
+			desc:    "no mode",
+			until:   "24h",
+			wantErr: true,
+		},
+		{
+			desc:    "past",
+			mode:    "governance",
+			until:   "2000-01-01",
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			r := &Rebuild{
+				Timeout:       10 * time.Minute,
+				Bucket:        "bucket",
+				Prefix:        "foo/bar",
+				Filename:      "archive.tar",
+				Mount:         []string{"testdata/hello.txt"},
+				RetentionMode: tC.mode,
+				RetainUntil:   tC.until,
+			}
+
+			err := r.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if err == nil && len(tC.mode) > 0 && !r.retainUntil.After(time.Now()) {
+				t.Errorf("retain until is %v, want a time in the future", r.retainUntil)
+			}
+		})
+	}
+}
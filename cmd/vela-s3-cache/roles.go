@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// parseBucketRoles is a helper function to parse the JSON
+// or YAML map of buckets to the role to assume for them.
+func parseBucketRoles(roles string) (map[string]string, error) {
+	if len(roles) == 0 {
+		return nil, nil
+	}
+
+	r := map[string]string{}
+
+	// parse the roles as yaml, which is a superset of json
+	err := yaml.Unmarshal([]byte(roles), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// validateBucketRoles verifies the role of each bucket
+// can be assumed with the Vela ID token.
+func (c *Config) validateBucketRoles() error {
+	if len(c.BucketRoles) == 0 {
+		return nil
+	}
+
+	for bucket, role := range c.BucketRoles {
+		if len(bucket) == 0 || len(role) == 0 {
+			return fmt.Errorf("invalid bucket roles: no bucket or role provided for %q: %q", bucket, role)
+		}
+	}
+
+	// verify action is provided
+	if len(c.Action) == 0 {
+		return fmt.Errorf("no config action provided")
+	}
+
+	// the worker only provides the request URL and token
+	// to steps that request an ID token
+	if len(c.IDTokenRequestURL) == 0 || len(c.IDTokenRequestToken) == 0 {
+		return fmt.Errorf("no ID token request URL or token provided for the bucket roles, set id_request on the step")
+	}
+
+	return nil
+}
+
+// fallbackCredentials reports whether the client for the buckets
+// without a role has credentials, which the aws driver resolves
+// from the default credential chain.
+func (c *Config) fallbackCredentials() bool {
+	return len(c.AccessKey) > 0 || len(c.RoleARN) > 0 || c.Driver == awsDriver
+}
+
+// validateBucketRole verifies the bucket the action targets has a role
+// to assume when there are no credentials for the other buckets.
+func (p *Plugin) validateBucketRole() error {
+	if len(p.Config.BucketRoles) == 0 || p.Config.fallbackCredentials() {
+		return nil
+	}
+
+	bucket, _, _ := p.target()
+	if len(bucket) == 0 {
+		return nil
+	}
+
+	if _, ok := p.Config.BucketRoles[bucket]; !ok {
+		return fmt.Errorf("no role provided for bucket %s in the bucket roles and no credentials provided for the other buckets", bucket)
+	}
+
+	return nil
+}
+
+// newBucketRoles creates a storage backend assuming the role of each
+// bucket with a role for the requests to the bucket, and using the
+// configured credentials for the requests to every other bucket.
+func (c *Config) newBucketRoles() storage.Backend {
+	b := &bucketBackend{
+		buckets: make(map[string]*lazyBackend, len(c.BucketRoles)),
+	}
+
+	// only assume the role of a bucket when it is used, so a role that
+	// can not be assumed only fails the steps using its bucket
+	for bucket, role := range c.BucketRoles {
+		b.buckets[bucket] = &lazyBackend{
+			create: func() (storage.Backend, error) {
+				cfg := *c
+				cfg.BucketRoles = nil
+				cfg.Bucket = bucket
+				cfg.RoleARN = role
+				// assume the role instead of using the access keys
+				cfg.AccessKey, cfg.SecretKey, cfg.SessionToken = "", "", ""
+
+				logrus.Debugf("assuming role %s for bucket %s", cfg.RoleARN, bucket)
+
+				backend, err := cfg.New()
+				if err != nil {
+					return nil, fmt.Errorf("unable to create client for bucket %s: %w", bucket, err)
+				}
+
+				return backend, nil
+			},
+		}
+	}
+
+	// only create the client for the other buckets when one is used,
+	// as every bucket of the step may be assumed with a role
+	b.fallback = &lazyBackend{
+		create: func() (storage.Backend, error) {
+			cfg := *c
+			cfg.BucketRoles = nil
+
+			return cfg.New()
+		},
+	}
+
+	return b
+}
+
+// lazyBackend represents a storage backend
+// created once on the first request to it.
+type lazyBackend struct {
+	create func() (storage.Backend, error)
+
+	once    sync.Once
+	backend storage.Backend
+	err     error
+}
+
+// get returns the backend, creating it on the first call.
+func (l *lazyBackend) get() (storage.Backend, error) {
+	l.once.Do(func() {
+		l.backend, l.err = l.create()
+	})
+
+	return l.backend, l.err
+}
+
+// bucketBackend is a storage.Backend that sends the
+// requests for each bucket to the backend of the bucket.
+type bucketBackend struct {
+	buckets  map[string]*lazyBackend
+	fallback *lazyBackend
+}
+
+// forBucket returns the backend to send the requests for the bucket to.
+func (b *bucketBackend) forBucket(bucket string) (storage.Backend, error) {
+	if backend, ok := b.buckets[bucket]; ok {
+		return backend.get()
+	}
+
+	return b.fallback.get()
+}
+
+// Put uploads the contents of the reader to the key in the bucket.
+// A size of -1 indicates the size of the reader is unknown.
+func (b *bucketBackend) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts storage.PutOptions) (storage.Object, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return storage.Object{}, err
+	}
+
+	return backend.Put(ctx, bucket, key, reader, size, opts)
+}
+
+// Copy copies the source key to the destination key in the bucket on the
+// server, replacing the metadata, tags and retention with the options.
+func (b *bucketBackend) Copy(ctx context.Context, bucket, src, dst string, opts storage.PutOptions) (storage.Object, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return storage.Object{}, err
+	}
+
+	return backend.Copy(ctx, bucket, src, dst, opts)
+}
+
+// Get retrieves the contents of the key in the bucket.
+func (b *bucketBackend) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.Get(ctx, bucket, key)
+}
+
+// GetRange retrieves a range of the contents of the key in the bucket.
+func (b *bucketBackend) GetRange(ctx context.Context, bucket, key string, opts storage.RangeOptions) (io.ReadCloser, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.GetRange(ctx, bucket, key, opts)
+}
+
+// Stat retrieves the information and metadata for the key in the bucket.
+func (b *bucketBackend) Stat(ctx context.Context, bucket, key string) (storage.Object, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return storage.Object{}, err
+	}
+
+	return backend.Stat(ctx, bucket, key)
+}
+
+// List retrieves the objects in the bucket matching the options.
+func (b *bucketBackend) List(ctx context.Context, bucket string, opts storage.ListOptions) ([]storage.Object, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.List(ctx, bucket, opts)
+}
+
+// GetTags retrieves the tags of the key in the bucket.
+func (b *bucketBackend) GetTags(ctx context.Context, bucket, key string) (map[string]string, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.GetTags(ctx, bucket, key)
+}
+
+// SetTags replaces the tags of the key in the bucket.
+func (b *bucketBackend) SetTags(ctx context.Context, bucket, key string, tags map[string]string) error {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	return backend.SetTags(ctx, bucket, key, tags)
+}
+
+// Remove deletes the objects from the bucket, returning
+// an error for every object that could not be removed.
+func (b *bucketBackend) Remove(ctx context.Context, bucket string, objects []storage.Object) []storage.RemoveError {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		errs := make([]storage.RemoveError, 0, len(objects))
+
+		for _, object := range objects {
+			errs = append(errs, storage.RemoveError{Object: object, Err: err})
+		}
+
+		return errs
+	}
+
+	return backend.Remove(ctx, bucket, objects)
+}
+
+// Abort removes the parts of any incomplete uploads for the key in the bucket.
+func (b *bucketBackend) Abort(ctx context.Context, bucket, key string) error {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	return backend.Abort(ctx, bucket, key)
+}
+
+// ListUploads retrieves the incomplete multipart uploads
+// in the bucket for the keys beginning with the prefix.
+func (b *bucketBackend) ListUploads(ctx context.Context, bucket, prefix string) ([]storage.Upload, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.ListUploads(ctx, bucket, prefix)
+}
+
+// AbortUpload removes the parts of the incomplete upload in the bucket.
+func (b *bucketBackend) AbortUpload(ctx context.Context, bucket string, upload storage.Upload) error {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	return backend.AbortUpload(ctx, bucket, upload)
+}
+
+// SetLifecycle creates or replaces the rule with the same id in the
+// lifecycle configuration of the bucket, keeping any other rules.
+func (b *bucketBackend) SetLifecycle(ctx context.Context, bucket string, rule storage.LifecycleRule) error {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	return backend.SetLifecycle(ctx, bucket, rule)
+}
+
+// Presign creates a URL granting the method, GET or PUT, on
+// the key in the bucket without credentials until the expiry.
+func (b *bucketBackend) Presign(ctx context.Context, bucket, key, method string, expiry time.Duration) (string, error) {
+	backend, err := b.forBucket(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	return backend.Presign(ctx, bucket, key, method, expiry)
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_parseBucketRoles(t *testing.T) {
+	// setup types
+	want := map[string]string{
+		"org-cache":  "arn:aws:iam::111111111111:role/org-cache-read",
+		"repo-cache": "arn:aws:iam::222222222222:role/repo-cache-write",
+	}
+
+	testCases := []struct {
+		desc  string
+		roles string
+	}{
+		{
+			desc:  "json",
+			roles: `{"org-cache": "arn:aws:iam::111111111111:role/org-cache-read", "repo-cache": "arn:aws:iam::222222222222:role/repo-cache-write"}`,
+		},
+		{
+			desc: "yaml",
+			roles: `
+org-cache: arn:aws:iam::111111111111:role/org-cache-read
+repo-cache: arn:aws:iam::222222222222:role/repo-cache-write
+`,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseBucketRoles(tC.roles)
+			if err != nil {
+				t.Errorf("parseBucketRoles returned err: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseBucketRoles is %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_validateBucketRoles(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			desc: "no roles",
+		},
+		{
+			desc: "roles",
+			config: Config{
+				Action:              "restore",
+				BucketRoles:         map[string]string{"org-cache": "arn:aws:iam::111111111111:role/org-cache-read"},
+				IDTokenRequestURL:   "https://vela/api/v1/repos/foo/bar/builds/1/id_token",
+				IDTokenRequestToken: "token",
+			},
+		},
+		{
+			desc: "no role",
+			config: Config{
+				Action:              "restore",
+				BucketRoles:         map[string]string{"org-cache": ""},
+				IDTokenRequestURL:   "https://vela/api/v1/repos/foo/bar/builds/1/id_token",
+				IDTokenRequestToken: "token",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "no id token",
+			config: Config{
+				Action:      "restore",
+				BucketRoles: map[string]string{"org-cache": "arn:aws:iam::111111111111:role/org-cache-read"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.config.validateBucketRoles()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("validateBucketRoles returned err: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Plugin_validateBucketRole(t *testing.T) {
+	// setup types
+	roles := map[string]string{"org-cache": "arn:aws:iam::111111111111:role/org-cache-read"}
+
+	testCases := []struct {
+		desc    string
+		config  Config
+		bucket  string
+		wantErr bool
+	}{
+		{
+			desc:   "role",
+			config: Config{Action: restoreAction, BucketRoles: roles},
+			bucket: "org-cache",
+		},
+		{
+			desc:    "no role or credentials",
+			config:  Config{Action: restoreAction, BucketRoles: roles},
+			bucket:  "repo-cache",
+			wantErr: true,
+		},
+		{
+			desc:   "access key",
+			config: Config{Action: restoreAction, BucketRoles: roles, AccessKey: "123456"},
+			bucket: "repo-cache",
+		},
+		{
+			desc:   "aws driver",
+			config: Config{Action: restoreAction, BucketRoles: roles, Driver: awsDriver},
+			bucket: "repo-cache",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			p := &Plugin{
+				Config:  &tC.config,
+				Restore: &Restore{Bucket: tC.bucket},
+			}
+
+			err := p.validateBucketRole()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("validateBucketRole returned err: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3Cache_bucketBackend(t *testing.T) {
+	// setup types
+	ctx := context.Background()
+	now := time.Now()
+
+	org := newFakeBackend()
+	org.add("org/archive.tgz", []byte("org"), now, nil)
+
+	other := newFakeBackend()
+	other.add("repo/archive.tgz", []byte("repo"), now, nil)
+
+	created := map[string]int{}
+
+	lazy := func(name string, backend storage.Backend, err error) *lazyBackend {
+		return &lazyBackend{
+			create: func() (storage.Backend, error) {
+				created[name]++
+
+				return backend, err
+			},
+		}
+	}
+
+	b := &bucketBackend{
+		buckets: map[string]*lazyBackend{
+			"org-cache":    lazy("org-cache", org, nil),
+			"shared-cache": lazy("shared-cache", nil, errors.New("unable to assume role")),
+		},
+		fallback: lazy("fallback", other, nil),
+	}
+
+	// verify the requests for the bucket with a role use its backend
+	_, err := b.Stat(ctx, "org-cache", "org/archive.tgz")
+	if err != nil {
+		t.Errorf("Stat returned err: %v", err)
+	}
+
+	if created["fallback"] > 0 {
+		t.Errorf("fallback created for the bucket with a role")
+	}
+
+	// verify the requests for other buckets use the fallback, created once
+	_, err = b.Stat(ctx, "repo-cache", "repo/archive.tgz")
+	if err != nil {
+		t.Errorf("Stat returned err: %v", err)
+	}
+
+	_, err = b.Stat(ctx, "org-cache", "org/archive.tgz")
+	if err != nil {
+		t.Errorf("Stat returned err: %v", err)
+	}
+
+	_, err = b.List(ctx, "repo-cache", storage.ListOptions{})
+	if err != nil {
+		t.Errorf("List returned err: %v", err)
+	}
+
+	if created["org-cache"] != 1 || created["fallback"] != 1 {
+		t.Errorf("backends created %v, want org-cache and fallback once", created)
+	}
+
+	// verify the role of a bucket that is never used is never assumed
+	if created["shared-cache"] > 0 {
+		t.Errorf("backend created for the unused bucket shared-cache")
+	}
+
+	// verify the error creating the backend of the bucket is returned for every object
+	errs := b.Remove(ctx, "shared-cache", []storage.Object{{Key: "foo/archive.tgz"}, {Key: "bar/archive.tgz"}})
+	if len(errs) != 2 {
+		t.Errorf("Remove returned %d errs, want 2", len(errs))
+	}
+}
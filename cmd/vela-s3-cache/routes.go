@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Route represents a routing rule of the platform admins, sending
+// the caches of the matching repositories to a bucket and server.
+type Route struct {
+	// sets the glob pattern of the org/repo names the route applies to
+	Repo string `yaml:"repo"`
+	// sets the name of the bucket to send the caches to
+	Bucket string `yaml:"bucket"`
+	// sets the s3 instance to send the caches to
+	Server string `yaml:"server"`
+	// sets the region of the bucket
+	Region string `yaml:"region"`
+	// sets the role to assume with the Vela OIDC ID token for the bucket
+	RoleARN string `yaml:"role_arn"`
+}
+
+// parseRoutes is a helper function to parse the JSON
+// or YAML array of routing rules.
+func parseRoutes(routes string) ([]*Route, error) {
+	if len(routes) == 0 {
+		return nil, nil
+	}
+
+	r := []*Route{}
+
+	// parse the routes as yaml, which is a superset of json
+	err := yaml.Unmarshal([]byte(routes), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, route := range r {
+		// verify the route matches repositories
+		if len(route.Repo) == 0 {
+			return nil, fmt.Errorf("route %d: no repo pattern provided", i+1)
+		}
+
+		// verify the route sends the caches somewhere
+		if len(route.Bucket) == 0 && len(route.Server) == 0 {
+			return nil, fmt.Errorf("route %d: no bucket or server provided", i+1)
+		}
+	}
+
+	return r, nil
+}
+
+// matchRoute is a helper function to find the first
+// route with a pattern matching the org/repo name.
+func matchRoute(routes []*Route, repo string) (*Route, error) {
+	for i, route := range routes {
+		re, err := compileGlob(route.Repo)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: invalid repo pattern %s: %w", i+1, route.Repo, err)
+		}
+
+		if re.MatchString(repo) {
+			return route, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// applyRoutes is a helper function to override the bucket, server, region
+// and role with the first routing rule of the platform admins matching
+// the repository, taking precedence over the parameters from the
+// pipeline and the config file. The matching route is returned.
+func applyRoutes(c *cli.Context) (*Route, error) {
+	routes, err := parseRoutes(c.String("config.routes"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+
+	// match the repository set by the worker, as the
+	// org and repo parameters can be set by the pipeline
+	repo := os.Getenv("VELA_REPO_ORG") + "/" + os.Getenv("VELA_REPO_NAME")
+
+	route, err := matchRoute(routes, repo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+
+	if route == nil {
+		return nil, nil
+	}
+
+	logrus.Infof("routing caches of %s with route %s", repo, route.Repo)
+
+	values := []struct {
+		name, value string
+		set         bool
+	}{
+		{"bucket", route.Bucket, len(route.Bucket) > 0},
+		{"config.server", route.Server, len(route.Server) > 0},
+		{"config.role_arn", route.RoleARN, len(route.RoleARN) > 0},
+		// discover the region of the routed bucket unless the route sets it
+		{"config.region", route.Region, true},
+	}
+
+	for _, v := range values {
+		if !v.set {
+			continue
+		}
+
+		err = c.Set(v.name, v.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", route.Repo, err)
+		}
+	}
+
+	return route, nil
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestS3Cache_parseRoutes(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		routes  string
+		want    int
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc:   "yaml",
+			routes: "- repo: octo-org/*\n  bucket: octo-cache\n- repo: '**'\n  server: https://s3.example.com\n",
+			want:   2,
+		},
+		{
+			desc:   "json",
+			routes: `[{"repo": "octo-org/*", "bucket": "octo-cache", "region": "us-west-2"}]`,
+			want:   1,
+		},
+		{
+			desc:    "no repo",
+			routes:  `[{"bucket": "octo-cache"}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "no bucket or server",
+			routes:  `[{"repo": "octo-org/*", "region": "us-west-2"}]`,
+			wantErr: true,
+		},
+		{
+			desc:    "invalid",
+			routes:  `{"repo": "octo-org/*"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseRoutes(tC.routes)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("parseRoutes returned err: %v", err)
+			}
+
+			if len(got) != tC.want {
+				t.Errorf("parseRoutes returned %d routes, want %d", len(got), tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_applyRoutes(t *testing.T) {
+	// setup types
+	t.Setenv("PARAMETER_BUCKET", "cache")
+	t.Setenv("PARAMETER_REGION", "us-east-1")
+	t.Setenv("PARAMETER_SERVER", "https://s3.example.com")
+	t.Setenv("VELA_REPO_ORG", "octo-org")
+	t.Setenv("VELA_REPO_NAME", "hello-world")
+	// the parameters of the pipeline can not select another route
+	t.Setenv("PARAMETER_ORG", "other-org")
+	t.Setenv("S3_CACHE_ROUTES", `
+- repo: other-org/*
+  bucket: other-cache
+- repo: octo-org/*
+  bucket: octo-cache
+  role_arn: arn:aws:iam::111111111111:role/octo-cache
+`)
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_BUCKET"}, Name: "bucket"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_SERVER"}, Name: "config.server"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_REGION"}, Name: "config.region"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_ROLE_ARN"}, Name: "config.role_arn"},
+			&cli.StringFlag{EnvVars: []string{"S3_CACHE_ROUTES"}, Name: "config.routes"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_ORG", "VELA_REPO_ORG"}, Name: "repo.org"},
+			&cli.StringFlag{EnvVars: []string{"PARAMETER_REPO", "VELA_REPO_NAME"}, Name: "repo.name"},
+		},
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	for _, f := range app.Flags {
+		err := f.Apply(set)
+		if err != nil {
+			t.Fatalf("unable to apply flag: %v", err)
+		}
+	}
+
+	c := cli.NewContext(app, set, nil)
+
+	route, err := applyRoutes(c)
+	if err != nil {
+		t.Errorf("applyRoutes returned err: %v", err)
+	}
+
+	if route == nil || route.Repo != "octo-org/*" {
+		t.Errorf("applyRoutes returned route %v, want octo-org/*", route)
+	}
+
+	// the first matching route takes precedence over the parameters
+	if got := c.String("bucket"); got != "octo-cache" {
+		t.Errorf("bucket is %s, want octo-cache", got)
+	}
+
+	if got := c.String("config.server"); got != "https://s3.example.com" {
+		t.Errorf("server is %s, want https://s3.example.com", got)
+	}
+
+	if got := c.String("config.role_arn"); got != "arn:aws:iam::111111111111:role/octo-cache" {
+		t.Errorf("role is %s, want arn:aws:iam::111111111111:role/octo-cache", got)
+	}
+
+	// the region of the routed bucket is discovered again
+	if got := c.String("config.region"); len(got) > 0 {
+		t.Errorf("region is %s, want it to be discovered", got)
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// sign is a helper function to create the HMAC-SHA256 signature
+// binding the checksum of the archive to the key of the object.
+func sign(key []byte, namespace, sum string) string {
+	mac := hmac.New(sha256.New, key)
+
+	mac.Write([]byte(namespace))
+	mac.Write([]byte{0})
+	mac.Write([]byte(sum))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature is a helper function to verify the signature recorded
+// on the object matches the checksum of the downloaded archive.
+func verifySignature(info storage.Object, key []byte, namespace, sum string) bool {
+	// skip the verification when no signing key is provided
+	if len(key) == 0 {
+		return true
+	}
+
+	got := userMetadata(info, metaSignature)
+	if len(got) == 0 {
+		logrus.Error("cache is not signed, ignoring")
+
+		return false
+	}
+
+	want := sign(key, namespace, sum)
+
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		logrus.Error("cache signature is invalid, ignoring")
+
+		return false
+	}
+
+	logrus.Debug("verified cache signature")
+
+	return true
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+func TestS3Cache_verifySignature(t *testing.T) {
+	// setup types
+	key := []byte("secret")
+
+	signed := storage.Object{
+		UserMetadata: map[string]string{
+			metaSignature: sign(key, "foo/bar/archive.tgz", "abc123"),
+		},
+	}
+
+	testCases := []struct {
+		desc      string
+		info      storage.Object
+		key       []byte
+		namespace string
+		sum       string
+		want      bool
+	}{
+		{desc: "no key", info: storage.Object{}, key: nil, namespace: "foo/bar/archive.tgz", sum: "abc123", want: true},
+		{desc: "unsigned", info: storage.Object{}, key: key, namespace: "foo/bar/archive.tgz", sum: "abc123", want: false},
+		{desc: "valid", info: signed, key: key, namespace: "foo/bar/archive.tgz", sum: "abc123", want: true},
+		{desc: "wrong key", info: signed, key: []byte("other"), namespace: "foo/bar/archive.tgz", sum: "abc123", want: false},
+		{desc: "other namespace", info: signed, key: key, namespace: "foo/baz/archive.tgz", sum: "abc123", want: false},
+		{desc: "modified archive", info: signed, key: key, namespace: "foo/bar/archive.tgz", sum: "def456", want: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := verifySignature(tC.info, tC.key, tC.namespace, tC.sum); got != tC.want {
+				t.Errorf("verifySignature is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+)
+
+// warnDirs represents the number of directories
+// to log for each mount when exceeding the warn size.
+const warnDirs = 10
+
+// dirSize represents the total size of the
+// regular files contained within a directory.
+type dirSize struct {
+	Path string
+	Size int64
+}
+
+// warnSize is a helper function to log a warning with the largest
+// directories in each mount when the archive exceeds the threshold.
+func warnSize(mounts []string, size int64, threshold uint64) error {
+	if threshold == 0 || uint64(size) <= threshold {
+		return nil
+	}
+
+	logrus.Warnf("cache archive is %s which exceeds the warn size of %s, consider trimming the mounts below",
+		humanize.Bytes(uint64(size)), humanize.Bytes(threshold))
+
+	for _, mount := range mounts {
+		dirs, err := largestDirs(mount, warnDirs)
+		if err != nil {
+			return err
+		}
+
+		logrus.Warnf("largest directories in mount %s:", mount)
+
+		for _, dir := range dirs {
+			logrus.Warnf("  %10s  %s", humanize.Bytes(uint64(dir.Size)), dir.Path)
+		}
+	}
+
+	return nil
+}
+
+// largestDirs is a helper function to calculate the total size
+// of every directory within the mount and return the n largest.
+func largestDirs(mount string, n int) ([]dirSize, error) {
+	root := filepath.Clean(mount)
+	sizes := make(map[string]int64)
+
+	err := filepath.WalkDir(mount, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// attribute the file size to every parent directory up to the mount
+		for dir := filepath.Dir(path); len(dir) >= len(root); dir = filepath.Dir(dir) {
+			sizes[dir] += info.Size()
+
+			if dir == root {
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	dirs := make([]dirSize, 0, len(sizes))
+	for path, size := range sizes {
+		dirs = append(dirs, dirSize{Path: path, Size: size})
+	}
+
+	// sort the directories from largest to smallest
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].Size == dirs[j].Size {
+			return dirs[i].Path < dirs[j].Path
+		}
+
+		return dirs[i].Size > dirs[j].Size
+	})
+
+	if len(dirs) > n {
+		dirs = dirs[:n]
+	}
+
+	return dirs, nil
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestS3Cache_largestDirs(t *testing.T) {
+	// setup types
+	mount := t.TempDir()
+
+	files := map[string]int{
+		"a/one.txt":     100,
+		"a/b/two.txt":   50,
+		"c/three.txt":   20,
+		"root-file.txt": 5,
+	}
+
+	for name, size := range files {
+		path := filepath.Join(mount, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("unable to create directory: %v", err)
+		}
+
+		err = os.WriteFile(path, make([]byte, size), 0600)
+		if err != nil {
+			t.Fatalf("unable to write file: %v", err)
+		}
+	}
+
+	want := []dirSize{
+		{Path: mount, Size: 175},
+		{Path: filepath.Join(mount, "a"), Size: 150},
+		{Path: filepath.Join(mount, "a", "b"), Size: 50},
+	}
+
+	got, err := largestDirs(mount, 3)
+	if err != nil {
+		t.Errorf("largestDirs returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("largestDirs is %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_warnSize(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc      string
+		mounts    []string
+		size      int64
+		threshold uint64
+	}{
+		{
+			desc:      "disabled",
+			mounts:    []string{"testdata/hello.txt"},
+			size:      1024,
+			threshold: 0,
+		},
+		{
+			desc:      "within threshold",
+			mounts:    []string{"testdata/hello.txt"},
+			size:      1024,
+			threshold: 2048,
+		},
+		{
+			desc:      "exceeds threshold",
+			mounts:    []string{"testdata/hello.txt", "testdata/missing"},
+			size:      4096,
+			threshold: 2048,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := warnSize(tC.mounts, tC.size, tC.threshold)
+			if err != nil {
+				t.Errorf("warnSize returned err: %v", err)
+			}
+		})
+	}
+}
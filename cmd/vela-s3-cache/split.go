@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// metaParts is the user metadata key holding the number of part
+// objects of a split archive, marking the object as its index.
+const metaParts = "Vela-Cache-Parts"
+
+// maxParts represents the maximum number of part objects
+// an archive can be split into, limited by their suffix.
+const maxParts = 1000
+
+// splitIndex represents the index object stored in place
+// of an archive split into several part objects.
+type splitIndex struct {
+	// sets the size of the complete archive
+	Size int64 `json:"size"`
+	// sets the part objects in the order of the archive
+	Parts []splitPart `json:"parts"`
+}
+
+// splitPart represents a part object of a split archive.
+type splitPart struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// partKeyPattern matches the suffix of the keys of the part objects.
+var partKeyPattern = regexp.MustCompile(`\.[0-9]{3}$`)
+
+// partKey is a helper function to create the key of the part
+// object at the index for the archive stored at the key.
+func partKey(key string, i int) string {
+	return fmt.Sprintf("%s.%03d", key, i)
+}
+
+// uploadParts uploads the archive as part objects of the split size
+// followed by the index of the parts at the namespace of the archive.
+func (r *Rebuild) uploadParts(ctx context.Context, store storage.Backend, f *os.File, size int64, count int, opts storage.PutOptions) (storage.Object, error) {
+	if count > maxParts {
+		return storage.Object{}, fmt.Errorf("archive of %s would be split into %d parts, more than the limit of %d",
+			humanize.Bytes(uint64(size)), count, maxParts)
+	}
+
+	logrus.Infof("splitting archive of %s into %d parts", humanize.Bytes(uint64(size)), count)
+
+	// the parts only share the expiry of the archive
+	pOpts := storage.PutOptions{
+		ContentType:  "application/octet-stream",
+		UserMetadata: map[string]string{},
+		UserTags:     opts.UserTags,
+		Expires:      opts.Expires,
+		Progress:     opts.Progress,
+	}
+
+	// the parts are retained like the index
+	r.retain(&pOpts)
+
+	if expires, ok := opts.UserMetadata[metaExpires]; ok {
+		pOpts.UserMetadata[metaExpires] = expires
+	}
+
+	lim := newLimiter(r.MaxBandwidth)
+	index := splitIndex{Size: size, Parts: []splitPart{}}
+
+	for i := range count {
+		offset := int64(i) * int64(r.SplitSize)
+		length := min(int64(r.SplitSize), size-offset)
+		key := partKey(r.Namespace, i)
+
+		logrus.Debugf("putting part %s of %s in bucket %s", key, humanize.Bytes(uint64(length)), r.Bucket)
+
+		_, err := store.Put(ctx, r.Bucket, key, lim.Reader(ctx, io.NewSectionReader(f, offset, length)), length, pOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				abort(store, r.Bucket, key)
+			}
+
+			return storage.Object{}, fmt.Errorf("unable to upload part %s: %w", key, err)
+		}
+
+		index.Parts = append(index.Parts, splitPart{Key: key, Size: length})
+	}
+
+	body, err := json.Marshal(index)
+	if err != nil {
+		return storage.Object{}, err
+	}
+
+	// upload the index last, so restores never see missing parts
+	opts.ContentType = "application/json"
+	opts.UserMetadata[metaParts] = strconv.Itoa(count)
+	opts.Progress = nil
+
+	_, err = store.Put(ctx, r.Bucket, r.Namespace, bytes.NewReader(body), int64(len(body)), opts)
+	if err != nil {
+		return storage.Object{}, fmt.Errorf("unable to upload index of parts: %w", err)
+	}
+
+	return storage.Object{Key: r.Namespace, Size: size}, nil
+}
+
+// removeParts deletes the part objects of the archive from a
+// previous split beyond the number of parts uploaded this time.
+func (r *Rebuild) removeParts(ctx context.Context, store storage.Backend, count int) error {
+	objects, err := store.List(ctx, r.Bucket, storage.ListOptions{Prefix: r.Namespace + ".", Recursive: true})
+	if err != nil {
+		return err
+	}
+
+	stale := []storage.Object{}
+
+	for _, object := range objects {
+		if len(object.Key) != len(r.Namespace)+4 || !partKeyPattern.MatchString(object.Key) {
+			continue
+		}
+
+		i, err := strconv.Atoi(object.Key[len(r.Namespace)+1:])
+		if err == nil && i >= count {
+			stale = append(stale, object)
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	logrus.Debugf("removing %d parts of a previous split of the archive", len(stale))
+
+	errs := store.Remove(ctx, r.Bucket, stale)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// readSplitIndex is a helper function to retrieve and verify
+// the index of the parts of the archive stored at the key.
+func readSplitIndex(ctx context.Context, store storage.Backend, bucket, key string) (*splitIndex, error) {
+	obj, err := store.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve index of parts %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	index := new(splitIndex)
+
+	err = json.NewDecoder(io.LimitReader(obj, humanize.MiByte)).Decode(index)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode index of parts %s: %w", key, err)
+	}
+
+	// verify the parts cover the archive and can't reference other objects
+	total := int64(0)
+
+	for i, part := range index.Parts {
+		if part.Key != partKey(key, i) {
+			return nil, fmt.Errorf("invalid index of parts %s: unexpected part %s", key, part.Key)
+		}
+
+		total += part.Size
+	}
+
+	if len(index.Parts) == 0 || total != index.Size {
+		return nil, fmt.Errorf("invalid index of parts %s: parts do not add up to %d bytes", key, index.Size)
+	}
+
+	return index, nil
+}
+
+// downloadParts retrieves the part objects of the split archive into
+// the archive path with concurrent requests, each written at its offset
+// in the file, returning the SHA256 checksum.
+func (r *Restore) downloadParts(ctx context.Context, store storage.Backend, path string, lim *limiter) (string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	logrus.Debugf("downloading %d parts with %d concurrent requests", len(r.index.Parts), max(r.Concurrency, 1))
+
+	// stop the remaining parts on the first failure
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// track the download progress for heartbeat logs
+	p := newProgress("download", r.index.Size)
+
+	stop := p.Start(r.ProgressInterval)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	parts := make(chan int)
+	errs := make(chan error, max(r.Concurrency, 1))
+
+	offsets := make([]int64, len(r.index.Parts))
+	for i := 1; i < len(offsets); i++ {
+		offsets[i] = offsets[i-1] + r.index.Parts[i-1].Size
+	}
+
+	for range max(r.Concurrency, 1) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range parts {
+				err := r.downloadSplitPart(ctx, store, f, p, lim, r.index.Parts[i], offsets[i])
+				if err != nil {
+					errs <- err
+
+					cancel()
+
+					return
+				}
+			}
+		}()
+	}
+
+	// hand out the parts until a part fails
+	for i := 0; i < len(r.index.Parts) && ctx.Err() == nil; i++ {
+		select {
+		case parts <- i:
+		case <-ctx.Done():
+		}
+	}
+
+	close(parts)
+	wg.Wait()
+	close(errs)
+
+	err = <-errs
+	if err != nil {
+		return "", err
+	}
+
+	// the parts were written out of order, so checksum the file
+	err = f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return fileSHA256(path)
+}
+
+// downloadSplitPart retrieves the part object of the
+// split archive and writes it at the offset in the file.
+func (r *Restore) downloadSplitPart(ctx context.Context, store storage.Backend, f *os.File, p *progress, lim *limiter, part splitPart, offset int64) error {
+	body, err := store.Get(ctx, r.Bucket, part.Key)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve part %s: %w", part.Key, err)
+	}
+	defer body.Close()
+
+	n, err := io.Copy(io.NewOffsetWriter(f, offset), io.LimitReader(lim.Reader(ctx, p.Reader(body)), part.Size+1))
+	if err != nil {
+		return err
+	}
+
+	if n != part.Size {
+		return fmt.Errorf("part %s is %d bytes, want %d", part.Key, n, part.Size)
+	}
+
+	return nil
+}
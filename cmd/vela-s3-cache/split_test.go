@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Rebuild_Exec_Split(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	chdir(t, t.TempDir())
+
+	// write contents that don't compress to split into several parts
+	body := make([]byte, 2048)
+
+	_, err := rand.Read(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile("random.bin", body, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeBackend()
+
+	// add a part left over from a previous split
+	store.add("foo/bar/archive.tgz.009", []byte("stale"), time.Now(), nil)
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"random.bin"},
+		Namespace: "foo/bar/archive.tgz",
+		SplitSize: 1024,
+		format:    cacheFormat,
+	}
+
+	err = rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	want := []string{"foo/bar/archive.tgz", "foo/bar/archive.tgz.000", "foo/bar/archive.tgz.001", "foo/bar/archive.tgz.002"}
+
+	if got := store.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("keys are %v, want %v", got, want)
+	}
+
+	info, err := store.Stat(context.Background(), "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := userMetadata(info, metaParts); got != "3" {
+		t.Errorf("parts are %q, want 3", got)
+	}
+
+	// restore the parts into an empty working directory
+	chdir(t, t.TempDir())
+
+	res := new(Result)
+
+	r := &Restore{
+		Bucket:      "bucket",
+		Filename:    "archive.tgz",
+		Timeout:     10 * time.Minute,
+		Namespace:   "foo/bar/archive.tgz",
+		Concurrency: 2,
+	}
+
+	err = r.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !res.Hit {
+		t.Errorf("Hit is %v, want true", res.Hit)
+	}
+
+	got, err := os.ReadFile("random.bin")
+	if err != nil || !reflect.DeepEqual(got, body) {
+		t.Errorf("restored file does not match: %v", err)
+	}
+}
+
+func TestS3Cache_readSplitIndex_Invalid(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc  string
+		index string
+	}{
+		{desc: "other object", index: `{"size":1,"parts":[{"key":"other/archive.tgz","size":1}]}`},
+		{desc: "size mismatch", index: `{"size":2,"parts":[{"key":"foo/archive.tgz.000","size":1}]}`},
+		{desc: "no parts", index: `{"size":0,"parts":[]}`},
+		{desc: "invalid json", index: `parts`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := newFakeBackend()
+			store.add("foo/archive.tgz", []byte(tC.index), time.Now(), nil)
+
+			_, err := readSplitIndex(context.Background(), store, "bucket", "foo/archive.tgz")
+			if err == nil {
+				t.Errorf("readSplitIndex should have returned err")
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+const statsAction = "stats"
+
+// statsSuffix represents the suffix of the key of the
+// stats object stored next to each cache object.
+const statsSuffix = ".stats"
+
+// statsKey is a helper function to create the key of
+// the stats object for the cache object at the key.
+func statsKey(key string) string {
+	return key + statsSuffix
+}
+
+// CacheStats represents the usage counters of a cache
+// object, stored as JSON in the stats object next to it.
+type CacheStats struct {
+	Restores    int       `json:"restores"`
+	Misses      int       `json:"misses"`
+	LastRestore time.Time `json:"last_restore,omitzero"`
+	Rebuilds    int       `json:"rebuilds"`
+	LastRebuild time.Time `json:"last_rebuild,omitzero"`
+}
+
+// HitRatio returns the share of the restores of the key that found the cache object.
+func (s *CacheStats) HitRatio() float64 {
+	if s.Restores+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Restores) / float64(s.Restores+s.Misses)
+}
+
+// Stats represents the plugin configuration for cache usage stats.
+type Stats struct {
+	// sets the name of the bucket
+	Bucket string
+	// sets the path to the cache objects to report on
+	Path string
+	// sets the path prefix for the cache objects to report on
+	Prefix string
+	// sets the timeout on the calls to s3
+	Timeout time.Duration
+	// whether the restore and rebuild actions update the stats objects
+	Enabled bool
+	// sets the time without a restore after which a cache is reported as unused
+	UnusedAfter time.Duration
+	// whether the credentials of the action can only read from the bucket
+	ReadOnly bool
+	// will hold our final namespace for the path to the objects
+	Namespace string
+}
+
+// Exec formats and runs the actions for reporting the cache usage stats in s3.
+func (s *Stats) Exec(ctx context.Context, store storage.Backend, res *Result) error {
+	logrus.Trace("running stats with provided configuration")
+
+	res.Key = s.Namespace
+
+	// set a timeout on the requests to the cache provider
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	objects, err := store.List(ctx, s.Bucket, storage.ListOptions{Prefix: s.Namespace, Recursive: true})
+	if err != nil {
+		return fmt.Errorf("unable to list stats objects in %s: %w", s.Namespace, err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	cutoff := time.Now().Add(-s.UnusedAfter)
+
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, statsSuffix) {
+			continue
+		}
+
+		key := strings.TrimSuffix(object.Key, statsSuffix)
+
+		stats, err := readStats(ctx, store, s.Bucket, key)
+		if err != nil {
+			logrus.Warnf("unable to read stats of %s: %v", key, err)
+
+			continue
+		}
+
+		res.Caches++
+
+		last := "never"
+		if !stats.LastRestore.IsZero() {
+			last = stats.LastRestore.Format(time.RFC3339)
+		}
+
+		logrus.Infof("%s: %d restores, %d misses (hit ratio %.0f%%), last restored %s, %d rebuilds",
+			key, stats.Restores, stats.Misses, stats.HitRatio()*100, last, stats.Rebuilds)
+
+		// report the caches rebuilt without being restored as dead weight
+		if stats.LastRestore.Before(cutoff) {
+			res.Unused++
+
+			logrus.Warnf("%s not restored in the last %s", key, s.UnusedAfter)
+		}
+	}
+
+	return nil
+}
+
+// Record updates the stats object of the cache object the
+// restore or rebuild with the result was performed against.
+func (s *Stats) Record(ctx context.Context, store storage.Backend, res *Result) error {
+	if s == nil || !s.Enabled || !res.Success || res.DryRun {
+		return nil
+	}
+
+	// the stats object can not be written with the read credentials
+	if s.ReadOnly {
+		logrus.Debugf("skipping stats of the %s action with the read credentials", res.Action)
+
+		return nil
+	}
+
+	var update func(*CacheStats)
+
+	switch {
+	case res.Action == restoreAction && res.Hit:
+		update = func(stats *CacheStats) {
+			stats.Restores++
+			stats.LastRestore = time.Now().UTC()
+		}
+	case res.Action == restoreAction:
+		update = func(stats *CacheStats) { stats.Misses++ }
+	case res.Action == rebuildAction && !res.Unchanged:
+		update = func(stats *CacheStats) {
+			stats.Rebuilds++
+			stats.LastRebuild = time.Now().UTC()
+		}
+	default:
+		return nil
+	}
+
+	logrus.Trace("recording stats for action")
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	err := updateStats(ctx, store, s.Bucket, res.Key, update)
+	if err != nil {
+		return fmt.Errorf("unable to update stats of %s: %w", res.Key, err)
+	}
+
+	return nil
+}
+
+// readStats is a helper function to retrieve and decode
+// the stats object of the cache object at the key.
+func readStats(ctx context.Context, store storage.Backend, bucket, key string) (*CacheStats, error) {
+	obj, err := store.Get(ctx, bucket, statsKey(key))
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	stats := new(CacheStats)
+
+	err = json.NewDecoder(obj).Decode(stats)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode stats object: %w", err)
+	}
+
+	return stats, nil
+}
+
+// updateStats is a helper function to apply the update to the stats
+// object of the cache object at the key, starting over when it is
+// missing or unreadable. Concurrent builds may overwrite each
+// other's update, so the counters are approximate.
+func updateStats(ctx context.Context, store storage.Backend, bucket, key string, update func(*CacheStats)) error {
+	stats, err := readStats(ctx, store, bucket, key)
+	if err != nil {
+		logrus.Debugf("starting new stats for %s: %v", key, err)
+
+		stats = new(CacheStats)
+	}
+
+	update(stats)
+
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("putting stats of %s in bucket %s", key, bucket)
+
+	_, err = store.Put(ctx, bucket, statsKey(key), bytes.NewReader(body), int64(len(body)), storage.PutOptions{ContentType: "application/json"})
+
+	return err
+}
+
+// Configure prepares the stats fields for the action to be taken.
+func (s *Stats) Configure(repo *Repo) error {
+	logrus.Trace("configuring stats action")
+
+	// construct the object path
+	path, err := buildNamespace(repo, s.Prefix, s.Path, "")
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("created bucket path %s", path)
+
+	// store it in the namespace
+	s.Namespace = path
+
+	return nil
+}
+
+// Validate verifies the Stats is properly configured.
+func (s *Stats) Validate() error {
+	logrus.Trace("validating stats action configuration")
+
+	// verify bucket is provided
+	if len(s.Bucket) == 0 {
+		return fmt.Errorf("no bucket provided")
+	}
+
+	// verify timeout is provided
+	if s.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+
+	// verify unused after is provided
+	if s.UnusedAfter <= 0 {
+		return fmt.Errorf("unused after must be greater than 0")
+	}
+
+	return nil
+}
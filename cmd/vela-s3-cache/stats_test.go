@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Stats_Record(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	s := &Stats{
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
+		Enabled: true,
+	}
+
+	results := []*Result{
+		{Action: rebuildAction, Key: "foo/bar/archive.tgz", Success: true},
+		{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: true, Hit: true},
+		{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: true, Hit: true},
+		{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: true},
+		{Action: rebuildAction, Key: "foo/bar/archive.tgz", Success: true, Unchanged: true},
+		{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: false},
+		{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: true, DryRun: true},
+		{Action: flushAction, Key: "foo/bar", Success: true},
+	}
+
+	for _, res := range results {
+		err := s.Record(context.Background(), store, res)
+		if err != nil {
+			t.Fatalf("Record returned err: %v", err)
+		}
+	}
+
+	stats, err := readStats(context.Background(), store, "bucket", "foo/bar/archive.tgz")
+	if err != nil {
+		t.Fatalf("readStats returned err: %v", err)
+	}
+
+	if stats.Restores != 2 || stats.Misses != 1 || stats.Rebuilds != 1 {
+		t.Errorf("stats are %+v, want 2 restores, 1 miss and 1 rebuild", stats)
+	}
+
+	if stats.LastRestore.IsZero() || stats.LastRebuild.IsZero() {
+		t.Errorf("stats are %+v, want the last restore and rebuild recorded", stats)
+	}
+
+	if got, want := stats.HitRatio(), 2.0/3.0; got != want {
+		t.Errorf("HitRatio is %v, want %v", got, want)
+	}
+}
+
+func TestS3Cache_Stats_Record_Disabled(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	s := &Stats{
+		Bucket:  "bucket",
+		Timeout: 10 * time.Minute,
+	}
+
+	err := s.Record(context.Background(), store, &Result{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: true, Hit: true})
+	if err != nil {
+		t.Fatalf("Record returned err: %v", err)
+	}
+
+	if len(store.keys()) != 0 {
+		t.Errorf("keys is %v, want none", store.keys())
+	}
+}
+
+func TestS3Cache_Stats_Record_ReadOnly(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+
+	s := &Stats{
+		Bucket:   "bucket",
+		Timeout:  10 * time.Minute,
+		Enabled:  true,
+		ReadOnly: true,
+	}
+
+	err := s.Record(context.Background(), store, &Result{Action: restoreAction, Key: "foo/bar/archive.tgz", Success: true, Hit: true})
+	if err != nil {
+		t.Fatalf("Record returned err: %v", err)
+	}
+
+	if len(store.keys()) != 0 {
+		t.Errorf("keys is %v, want none", store.keys())
+	}
+}
+
+func TestS3Cache_Stats_Exec(t *testing.T) {
+	// setup types
+	store := newFakeBackend()
+	store.add("foo/bar/archive.tgz", []byte("archive"), time.Now(), nil)
+	store.add("foo/bar/archive.tgz.stats", []byte(`{"restores":5,"misses":1,"last_restore":"`+time.Now().UTC().Format(time.RFC3339)+`","rebuilds":2}`), time.Now(), nil)
+	store.add("foo/bar/old.tgz", []byte("archive"), time.Now(), nil)
+	store.add("foo/bar/old.tgz.stats", []byte(`{"restores":0,"misses":0,"rebuilds":9}`), time.Now(), nil)
+	store.add("foo/bar/broken.tgz.stats", []byte(`not json`), time.Now(), nil)
+
+	s := &Stats{
+		Bucket:      "bucket",
+		Timeout:     10 * time.Minute,
+		UnusedAfter: 24 * time.Hour,
+		Namespace:   "foo/bar",
+	}
+
+	res := new(Result)
+
+	err := s.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if res.Caches != 2 {
+		t.Errorf("Caches is %d, want 2", res.Caches)
+	}
+
+	if res.Unused != 1 {
+		t.Errorf("Unused is %d, want 1", res.Unused)
+	}
+}
+
+func TestS3Cache_Stats_Validate(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		stats   *Stats
+		wantErr bool
+	}{
+		{
+			desc:  "valid",
+			stats: &Stats{Bucket: "bucket", Timeout: 10 * time.Minute, UnusedAfter: time.Hour},
+		},
+		{
+			desc:    "no bucket",
+			stats:   &Stats{Timeout: 10 * time.Minute, UnusedAfter: time.Hour},
+			wantErr: true,
+		},
+		{
+			desc:    "no timeout",
+			stats:   &Stats{Bucket: "bucket", UnusedAfter: time.Hour},
+			wantErr: true,
+		},
+		{
+			desc:    "no unused after",
+			stats:   &Stats{Bucket: "bucket", Timeout: 10 * time.Minute},
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.stats.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-vela/vela-s3-cache/pkg/storage"
+)
+
+// stdin represents the reader the tar stream is read from instead
+// of archiving the mounts. It is a variable to be replaced in tests.
+var stdin io.Reader = os.Stdin
+
+// execStdin compresses the tar stream read from stdin and uploads
+// the archive while it is compressed, as its size is unknown until
+// the stream ends. The upload is verified with the checksums of its
+// parts rather than a checksum of the whole archive.
+func (r *Rebuild) execStdin(ctx context.Context, store storage.Backend, res *Result) error {
+	// report what would be uploaded without reading stdin
+	if r.DryRun {
+		ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+
+		err := verifyAccess(ctx, store, r.Bucket, r.Namespace)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("dry run: tar stream from stdin would be archived and uploaded to bucket %s at %s",
+			r.Bucket, r.Namespace)
+
+		return nil
+	}
+
+	// the stream can not be sampled, so auto uses the default level
+	level := gzip.DefaultCompression
+
+	if r.CompressionLevel != autoCompression {
+		var err error
+
+		level, err = parseCompressionLevel(r.CompressionLevel)
+		if err != nil {
+			return err
+		}
+	}
+
+	pk := &packer{
+		format:           r.format,
+		compressionLevel: level,
+		metadata:         r.archiveMetadata(level),
+	}
+
+	// track the upload progress for heartbeat logs
+	p := newProgress("upload", -1)
+
+	// set a timeout on the request to the cache provider,
+	// extended by the size of the archive uploaded so far
+	ctx, cancel := streamTimeout(ctx, r.Timeout, r.TimeoutPerGB, p.bytes.Load)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+
+	// compress the stream while it is uploaded
+	go func() {
+		pw.CloseWithError(pk.packStream(pw, &countingReader{reader: stdin, n: &res.UncompressedSize}))
+	}()
+
+	opts := r.putOptions("")
+	opts.Progress = p
+
+	stop := p.Start(r.ProgressInterval)
+
+	logrus.Debugf("putting tar stream from stdin in bucket %s in path: %s", r.Bucket, r.Namespace)
+
+	start := time.Now()
+
+	var (
+		n   storage.Object
+		err error
+	)
+
+	if r.AtomicPublish {
+		// upload the object next to the location and copy it into place
+		n, err = r.publish(ctx, store, newLimiter(r.MaxBandwidth).Reader(ctx, pr), -1, opts)
+	} else {
+		// upload the object to the specified location in the bucket
+		n, err = store.Put(ctx, r.Bucket, r.Namespace, newLimiter(r.MaxBandwidth).Reader(ctx, pr), -1, opts)
+	}
+
+	stop()
+
+	// stop compressing the stream when the upload failed
+	pr.CloseWithError(err)
+
+	if err != nil {
+		// clean up the parts of an interrupted upload
+		if ctx.Err() != nil {
+			abort(store, r.Bucket, r.Namespace)
+		}
+
+		return err
+	}
+
+	res.Size = n.Size
+	res.TransferDuration = time.Since(start)
+
+	logPhase("upload", res.TransferDuration, n.Size)
+
+	logrus.Debugf("cache rebuild action completed. %s of data from stdin rebuilt and stored",
+		humanize.Bytes(uint64(res.UncompressedSize)))
+
+	return nil
+}
+
+// validateStdin verifies the rebuild from stdin is properly configured,
+// as the features needing the whole archive before the upload are not
+// available while it is streamed.
+func (r *Rebuild) validateStdin() error {
+	// verify the mounts are not silently ignored
+	if len(r.Mount) > 0 {
+		return fmt.Errorf("mount can not be used with from stdin")
+	}
+
+	// verify the features needing the whole archive are disabled
+	if len(r.EncryptionKey) > 0 {
+		return fmt.Errorf("from stdin can not be used with an encryption key")
+	}
+
+	if len(r.SigningKey) > 0 {
+		return fmt.Errorf("from stdin can not be used with a signing key")
+	}
+
+	if r.Append {
+		return fmt.Errorf("from stdin can not be used with append")
+	}
+
+	if r.SplitSize > 0 {
+		return fmt.Errorf("from stdin can not be used with a split size")
+	}
+
+	if r.Manifest {
+		return fmt.Errorf("from stdin can not be used with manifest")
+	}
+
+	return nil
+}
+
+// packStream writes the entries of the tar stream into the archive
+// written to the destination, failing when the stream is not a tar stream.
+func (p *packer) packStream(out io.Writer, in io.Reader) error {
+	read := int64(0)
+	tr := tar.NewReader(&countingReader{reader: in, n: &read})
+
+	write := func(tw *tar.Writer) error {
+		err := copyTar(tw, tr)
+		if err != nil {
+			return err
+		}
+
+		// an empty stream is no archive at all
+		if read == 0 {
+			return fmt.Errorf("no tar stream provided on stdin")
+		}
+
+		return nil
+	}
+
+	// write a plain tarball without compression
+	if p.format == tarFormat {
+		tw := tar.NewWriter(out)
+
+		err := p.writeMetadata(tw)
+		if err == nil {
+			err = write(tw)
+		}
+
+		return errors.Join(err, tw.Close())
+	}
+
+	return p.packGzip(out, write)
+}
+
+// copyTar is a helper function to write every entry of
+// the tar stream to the archive, verifying their names.
+func copyTar(tw *tar.Writer, tr *tar.Reader) error {
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read tar stream: %w", err)
+		}
+
+		// entries the restore would refuse to extract are rejected up front
+		if hdr.Typeflag != tar.TypeXGlobalHeader {
+			_, err = entryName(hdr.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		logrus.Tracef("archiving %s from tar stream", hdr.Name)
+
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("unable to write header for %s: %w", hdr.Name, err)
+		}
+
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return fmt.Errorf("unable to write %s: %w", hdr.Name, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setStdin is a helper function to read the stdin of the test from the reader.
+func setStdin(t *testing.T, r io.Reader) {
+	t.Helper()
+
+	stdin = r
+
+	t.Cleanup(func() { stdin = os.Stdin })
+}
+
+func TestS3Cache_Rebuild_Exec_FromStdin(t *testing.T) {
+	// setup types
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	err := tw.WriteHeader(&tar.Header{Name: "dist/hello.txt", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tw.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, buf)
+
+	store := newFakeBackend()
+	res := new(Result)
+
+	rebuild := &Rebuild{
+		Bucket:           "bucket",
+		Filename:         "archive.tgz",
+		Timeout:          10 * time.Minute,
+		Namespace:        "foo/bar/archive.tgz",
+		CompressionLevel: autoCompression,
+		FromStdin:        true,
+	}
+
+	err = rebuild.Exec(context.Background(), store, res)
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if res.Size != int64(len(store.objects["foo/bar/archive.tgz"].data)) {
+		t.Errorf("Size is %d, want size of the object", res.Size)
+	}
+
+	// restore the archive into an empty working directory
+	chdir(t, t.TempDir())
+
+	r := &Restore{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	got, err := os.ReadFile("dist/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "hello" {
+		t.Errorf("dist/hello.txt is %q, want %q", got, "hello")
+	}
+}
+
+func TestS3Cache_Rebuild_Exec_FromStdin_Invalid(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc  string
+		input string
+	}{
+		{
+			desc:  "empty",
+			input: "",
+		},
+		{
+			desc:  "not a tar stream",
+			input: strings.Repeat("not a tar stream ", 64),
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			setStdin(t, strings.NewReader(tC.input))
+
+			store := newFakeBackend()
+
+			r := &Rebuild{
+				Bucket:           "bucket",
+				Filename:         "archive.tgz",
+				Timeout:          10 * time.Minute,
+				Namespace:        "foo/bar/archive.tgz",
+				CompressionLevel: autoCompression,
+				FromStdin:        true,
+			}
+
+			err := r.Exec(context.Background(), store, new(Result))
+			if err == nil {
+				t.Fatal("Exec should have returned err")
+			}
+
+			if len(store.keys()) != 0 {
+				t.Errorf("keys is %v, want none", store.keys())
+			}
+		})
+	}
+}
+
+func TestS3Cache_Rebuild_Validate_FromStdin(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		rebuild Rebuild
+		wantErr bool
+	}{
+		{
+			desc:    "without mounts",
+			rebuild: Rebuild{},
+		},
+		{
+			desc:    "with mounts",
+			rebuild: Rebuild{Mount: []string{"testdata/hello.txt"}},
+			wantErr: true,
+		},
+		{
+			desc:    "with signing key",
+			rebuild: Rebuild{SigningKey: []byte("key")},
+			wantErr: true,
+		},
+		{
+			desc:    "with append",
+			rebuild: Rebuild{Append: true},
+			wantErr: true,
+		},
+		{
+			desc:    "with manifest",
+			rebuild: Rebuild{Manifest: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			r := tC.rebuild
+			r.Timeout = 10 * time.Minute
+			r.Bucket = "bucket"
+			r.Filename = "archive.tgz"
+			r.FromStdin = true
+
+			err := r.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// stdout represents the writer the archive is streamed to
+// instead of being extracted. It is a variable to be replaced in tests.
+var stdout io.Writer = os.Stdout
+
+// openTar is a helper function to open the uncompressed
+// tar stream of the archive in the format.
+func openTar(archive, format string) (io.ReadCloser, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == tarFormat {
+		return f, nil
+	}
+
+	// the reader continues through every gzip member of the archive
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+
+		return nil, fmt.Errorf("unable to open archive %s: %w", archive, err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{gr, f}, nil
+}
+
+// stream writes the uncompressed tar stream of the archive, or the
+// contents of the entry selected with StdoutEntry, to the writer.
+func (r *Restore) stream(archive string, w io.Writer) error {
+	if len(r.StdoutEntry) == 0 {
+		logrus.Debugf("writing tar stream of archive %s to stdout", archive)
+
+		t, err := openTar(archive, r.format)
+		if err != nil {
+			return err
+		}
+		defer t.Close()
+
+		_, err = io.Copy(w, t)
+		if err != nil {
+			return fmt.Errorf("unable to write archive to stdout: %w", err)
+		}
+
+		return nil
+	}
+
+	name, err := entryName(r.StdoutEntry)
+	if err != nil {
+		return err
+	}
+
+	// entries appended to the archive replace the earlier entries with
+	// the same name, so find the last match before writing its contents
+	matches := 0
+
+	err = walkTar(archive, r.format, name, func(*tar.Header, io.Reader) error {
+		matches++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if matches == 0 {
+		return fmt.Errorf("entry %s not found in archive", r.StdoutEntry)
+	}
+
+	logrus.Debugf("writing entry %s of archive %s to stdout", name, archive)
+
+	return walkTar(archive, r.format, name, func(hdr *tar.Header, tr io.Reader) error {
+		matches--
+		if matches > 0 {
+			return nil
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeGNUSparse {
+			return fmt.Errorf("entry %s is not a regular file", r.StdoutEntry)
+		}
+
+		_, err := io.Copy(w, tr)
+		if err != nil {
+			return fmt.Errorf("unable to write entry %s to stdout: %w", r.StdoutEntry, err)
+		}
+
+		return nil
+	})
+}
+
+// walkTar is a helper function to call fn with the header
+// and contents of every entry of the archive with the name.
+func walkTar(archive, format, name string, fn func(*tar.Header, io.Reader) error) error {
+	t, err := openTar(archive, format)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	tr := tar.NewReader(t)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read archive %s: %w", archive, err)
+		}
+
+		// compare the names like they are resolved on extraction
+		eName, err := entryName(hdr.Name)
+		if err != nil || eName != name {
+			continue
+		}
+
+		err = fn(hdr, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
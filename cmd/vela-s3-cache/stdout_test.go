@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Restore_stream(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "build/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "build/report.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "old"},
+		{hdr: tar.Header{Name: "build/report.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "new"},
+	})
+
+	testCases := []struct {
+		desc    string
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{desc: "last appended entry", entry: "build/report.txt", want: "new"},
+		{desc: "unclean name", entry: "./build//report.txt", want: "new"},
+		{desc: "missing entry", entry: "build/missing.txt", wantErr: true},
+		{desc: "directory", entry: "build", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			out := new(bytes.Buffer)
+
+			err := (&Restore{StdoutEntry: tC.entry}).stream(archive, out)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("stream returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if !tC.wantErr && out.String() != tC.want {
+				t.Errorf("stream wrote %q, want %q", out.String(), tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Restore_Exec_Stdout(t *testing.T) {
+	// setup types
+	t.Setenv("TMPDIR", t.TempDir())
+
+	store := newFakeBackend()
+
+	rebuild := &Rebuild{
+		Bucket:    "bucket",
+		Filename:  "archive.tgz",
+		Timeout:   10 * time.Minute,
+		Mount:     []string{"testdata/hello.txt"},
+		Namespace: "foo/bar/archive.tgz",
+	}
+
+	err := rebuild.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	want, err := os.ReadFile("testdata/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	stdout = out
+
+	t.Cleanup(func() { stdout = os.Stdout })
+
+	// restore into an empty working directory
+	chdir(t, t.TempDir())
+
+	r := &Restore{
+		Bucket:      "bucket",
+		Filename:    "archive.tgz",
+		Timeout:     10 * time.Minute,
+		Namespace:   "foo/bar/archive.tgz",
+		Stdout:      true,
+		StdoutEntry: "hello.txt",
+	}
+
+	err = r.Exec(context.Background(), store, new(Result))
+	if err != nil {
+		t.Fatalf("Exec returned err: %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("stdout is %q, want %q", out.Bytes(), want)
+	}
+
+	// verify nothing was extracted into the workspace
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("workspace has %d entries, want 0", len(entries))
+	}
+}
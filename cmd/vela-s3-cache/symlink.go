@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// symlinkPreserve represents the policy to archive
+	// and extract symlinks as symlinks.
+	symlinkPreserve = "preserve"
+
+	// symlinkSkip represents the policy to leave
+	// symlinks out of the archive and the extraction.
+	symlinkSkip = "skip"
+
+	// symlinkDereference represents the policy to archive and
+	// extract symlinks as copies of the files they point to.
+	symlinkDereference = "dereference"
+
+	// symlinkError represents the policy to fail
+	// on symlinks in the mounts or the archive.
+	symlinkError = "error"
+)
+
+// defaultSymlinkDepth represents the maximum number of links followed
+// in a chain of symlinks being dereferenced, matching the limit of Linux.
+const defaultSymlinkDepth = 40
+
+// symlinkPolicies represents the supported policies for symlinks.
+var symlinkPolicies = []string{symlinkPreserve, symlinkSkip, symlinkDereference, symlinkError}
+
+// validateSymlinkPolicy is a helper function to
+// verify the policy for symlinks is supported.
+func validateSymlinkPolicy(policy string) error {
+	if len(policy) > 0 && !slices.Contains(symlinkPolicies, policy) {
+		return fmt.Errorf("invalid symlinks policy %s: must be one of %s", policy, strings.Join(symlinkPolicies, ", "))
+	}
+
+	return nil
+}
+
+// followChain follows the chain of symlinks starting at the symlink being
+// archived, failing when it has more links than the symlink depth.
+func (p *packer) followChain(fpath string) error {
+	depth := p.symlinkDepth
+	if depth <= 0 {
+		depth = defaultSymlinkDepth
+	}
+
+	name := fpath
+
+	for count := 1; ; count++ {
+		target, err := os.Readlink(name)
+		if err != nil {
+			return err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+
+		info, err := os.Lstat(target)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// a missing target is reported when dereferencing it
+			return nil
+		}
+
+		if count == depth {
+			return fmt.Errorf("symlink chain is longer than %d links", depth)
+		}
+
+		name = target
+	}
+}
+
+// symlink applies the policy for symlinks to the symlink being archived,
+// returning the information of the entry to write or nil to skip it.
+func (p *packer) symlink(fpath string, info os.FileInfo) (os.FileInfo, error) {
+	switch p.symlinks {
+	case symlinkSkip:
+		logrus.Debugf("skipping symlink %s", fpath)
+
+		return nil, nil
+	case symlinkError:
+		return nil, fmt.Errorf("%s: symlinks are not allowed", fpath)
+	case symlinkDereference:
+		err := p.followChain(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: dereferencing symlink: %w", fpath, err)
+		}
+
+		target, err := os.Stat(fpath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: dereferencing symlink: %w", fpath, err)
+		}
+
+		return target, nil
+	default:
+		return info, nil
+	}
+}
+
+// enterDir records the directory being walked when dereferencing
+// symlinks, failing when a symlink loops back to a parent directory.
+func (p *packer) enterDir(fpath string, info os.FileInfo) (func(), error) {
+	if p.symlinks != symlinkDereference {
+		return func() {}, nil
+	}
+
+	for _, parent := range p.parents {
+		if os.SameFile(parent, info) {
+			return nil, fmt.Errorf("%s: symlink loops back to a parent directory", fpath)
+		}
+	}
+
+	p.parents = append(p.parents, info)
+
+	return func() { p.parents = p.parents[:len(p.parents)-1] }, nil
+}
+
+// deferredLink represents a symlink of the archive
+// to extract as a copy of its target at the end.
+type deferredLink struct {
+	name   string
+	target string
+}
+
+// symlink applies the policy for symlinks to the symlink entry being
+// extracted, reporting whether the entry is handled by the policy.
+func (e *extractor) symlink(name, target string) (bool, error) {
+	switch e.symlinks {
+	case symlinkSkip:
+		logrus.Debugf("skipping symlink %s", name)
+
+		return true, nil
+	case symlinkError:
+		return true, fmt.Errorf("%s: symlinks are not allowed", name)
+	case symlinkDereference:
+		// the target may be extracted after the link
+		e.links = append(e.links, deferredLink{name: name, target: target})
+
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// dereferenceLinks writes the deferred symlinks as copies of their targets
+// in the root, skipping the targets outside of the root or the archive.
+func (e *extractor) dereferenceLinks(root *os.Root) error {
+	// the symlinks are not extracted, so chains are followed through them
+	links := make(map[string]string, len(e.links))
+	for _, link := range e.links {
+		links[link.name] = link.target
+	}
+
+	for _, link := range e.links {
+		target, err := e.resolveLink(link, links)
+		if err != nil {
+			logrus.Warnf("skipping symlink %s: %v", link.name, err)
+
+			continue
+		}
+
+		info, err := root.Stat(target)
+		if err != nil {
+			logrus.Warnf("skipping symlink %s: %v", link.name, err)
+
+			continue
+		}
+
+		switch {
+		case info.Mode().IsRegular():
+			err = e.copyFile(root, target, link.name, info.Mode())
+		case info.IsDir():
+			// a copy of a parent directory would never end
+			if target == "." || strings.HasPrefix(link.name, target+string(filepath.Separator)) {
+				logrus.Warnf("skipping symlink %s: target %s is a parent directory", link.name, link.target)
+
+				continue
+			}
+
+			err = e.copyDir(root, target, link.name)
+		default:
+			logrus.Warnf("skipping symlink %s: target %s is not a file or directory", link.name, link.target)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: dereferencing symlink: %w", link.name, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveLink follows the chain of deferred symlinks starting at the link
+// to the path of the entry it points to, failing when the chain leaves the
+// root or has more links than the symlink depth.
+func (e *extractor) resolveLink(link deferredLink, links map[string]string) (string, error) {
+	depth := e.symlinkDepth
+	if depth <= 0 {
+		depth = defaultSymlinkDepth
+	}
+
+	name, target := link.name, link.target
+
+	for count := 1; ; count++ {
+		resolved := filepath.Join(filepath.Dir(name), target)
+
+		if filepath.IsAbs(target) || !filepath.IsLocal(resolved) {
+			return "", fmt.Errorf("target %s is outside of the destination", target)
+		}
+
+		next, ok := links[resolved]
+		if !ok {
+			return resolved, nil
+		}
+
+		if count == depth {
+			return "", fmt.Errorf("symlink chain is longer than %d links", depth)
+		}
+
+		name, target = resolved, next
+	}
+}
+
+// copyFile copies the file in the root to a new file
+// with the name, counting the bytes as extracted.
+func (e *extractor) copyFile(root *os.Root, src, name string, mode os.FileMode) error {
+	f, err := root.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return e.writeFile(root, name, &countingReader{reader: f, n: &e.extracted, check: e.checkRatio}, mode)
+}
+
+// copyDir copies the files and directories below
+// the directory in the root to the directory name.
+func (e *extractor) copyDir(root *os.Root, src, name string) error {
+	return fs.WalkDir(root.FS(), filepath.ToSlash(src), func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, filepath.FromSlash(fpath))
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(name, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return root.MkdirAll(dst, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return e.copyFile(root, filepath.FromSlash(fpath), dst, info.Mode())
+		default:
+			logrus.Warnf("skipping %s in copy of %s: not a file or directory", fpath, src)
+
+			return nil
+		}
+	})
+}
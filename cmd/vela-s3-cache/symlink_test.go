@@ -0,0 +1,317 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestS3Cache_packer_pack_Symlinks(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.MkdirAll("cache/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile("cache/dir/file.txt", []byte("file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for link, target := range map[string]string{"cache/file-link": "dir/file.txt", "cache/dir-link": "dir"} {
+		err = os.Symlink(target, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		policy  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:   "preserve",
+			policy: symlinkPreserve,
+			want:   []string{"cache/", "cache/dir-link", "cache/dir/", "cache/dir/file.txt", "cache/file-link"},
+		},
+		{
+			desc:   "skip",
+			policy: symlinkSkip,
+			want:   []string{"cache/", "cache/dir/", "cache/dir/file.txt"},
+		},
+		{
+			desc:   "dereference",
+			policy: symlinkDereference,
+			want: []string{
+				"cache/", "cache/dir-link/", "cache/dir-link/file.txt",
+				"cache/dir/", "cache/dir/file.txt", "cache/file-link",
+			},
+		},
+		{
+			desc:    "error",
+			policy:  symlinkError,
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+			err := (&packer{symlinks: tC.policy}).pack([]string{"cache"}, archive)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("pack returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			if got := archiveNames(t, archive); !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("archive entries are %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_packer_pack_SymlinkLoop(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.MkdirAll("cache/dir", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink("..", "cache/dir/parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = (&packer{symlinks: symlinkDereference}).pack([]string{"cache"}, filepath.Join(t.TempDir(), "archive.tgz"))
+	if err == nil {
+		t.Errorf("pack should have returned err")
+	}
+}
+
+func TestS3Cache_extractor_extract_Symlinks(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	// write the links before their targets
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "cache/file-link", Typeflag: tar.TypeSymlink, Linkname: "dir/file.txt"}},
+		{hdr: tar.Header{Name: "cache/dir-link", Typeflag: tar.TypeSymlink, Linkname: "dir"}},
+		{hdr: tar.Header{Name: "cache/outside", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"}},
+		{hdr: tar.Header{Name: "cache/dir/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "cache/dir/file.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "file"},
+	})
+
+	testCases := []struct {
+		desc    string
+		policy  string
+		want    map[string]os.FileMode
+		wantErr bool
+	}{
+		{
+			desc:   "preserve",
+			policy: symlinkPreserve,
+			want:   map[string]os.FileMode{"file-link": os.ModeSymlink, "dir-link": os.ModeSymlink, "outside": os.ModeSymlink},
+		},
+		{
+			desc:   "skip",
+			policy: symlinkSkip,
+			want:   map[string]os.FileMode{},
+		},
+		{
+			desc:   "dereference",
+			policy: symlinkDereference,
+			want:   map[string]os.FileMode{"file-link": 0, "dir-link": os.ModeDir},
+		},
+		{
+			desc:    "error",
+			policy:  symlinkError,
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "dest")
+
+			err := (&extractor{symlinks: tC.policy}).extract(archive, dir)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("extract returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr {
+				return
+			}
+
+			for _, name := range []string{"file-link", "dir-link", "outside"} {
+				info, err := os.Lstat(filepath.Join(dir, "cache", name))
+
+				want, ok := tC.want[name]
+				if !ok {
+					if err == nil {
+						t.Errorf("%s should not be extracted", name)
+					}
+
+					continue
+				}
+
+				if err != nil {
+					t.Errorf("%s is missing: %v", name, err)
+
+					continue
+				}
+
+				if got := info.Mode().Type(); got != want {
+					t.Errorf("%s type is %s, want %s", name, got, want)
+				}
+			}
+
+			// verify the copy of the directory has the contents of the target
+			if tC.policy == symlinkDereference {
+				body, err := os.ReadFile(filepath.Join(dir, "cache", "dir-link", "file.txt"))
+				if err != nil || string(body) != "file" {
+					t.Errorf("copied file is %q, want file: %v", body, err)
+				}
+			}
+		})
+	}
+}
+
+func TestS3Cache_packer_pack_SymlinkDepth(t *testing.T) {
+	// setup types
+	chdir(t, t.TempDir())
+
+	err := os.MkdirAll("cache", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile("cache/file.txt", []byte("file"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// link-3 -> link-2 -> link-1 -> file.txt
+	for i, target := range []string{"file.txt", "link-1", "link-2"} {
+		err = os.Symlink(target, fmt.Sprintf("cache/link-%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		depth   int
+		wantErr bool
+	}{
+		{
+			desc: "default",
+		},
+		{
+			desc:  "chain",
+			depth: 3,
+		},
+		{
+			desc:    "too deep",
+			depth:   2,
+			wantErr: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			pk := &packer{symlinks: symlinkDereference, symlinkDepth: tC.depth}
+
+			err := pk.pack([]string{"cache"}, filepath.Join(t.TempDir(), "archive.tgz"))
+			if (err != nil) != tC.wantErr {
+				t.Errorf("pack returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Cache_extractor_extract_SymlinkDepth(t *testing.T) {
+	// setup types
+	archive := filepath.Join(t.TempDir(), "archive.tgz")
+
+	// write the chain of links in an order needing every link resolved
+	writeArchive(t, archive, []testEntry{
+		{hdr: tar.Header{Name: "cache/link-3", Typeflag: tar.TypeSymlink, Linkname: "link-2"}},
+		{hdr: tar.Header{Name: "cache/link-2", Typeflag: tar.TypeSymlink, Linkname: "link-1"}},
+		{hdr: tar.Header{Name: "cache/link-1", Typeflag: tar.TypeSymlink, Linkname: "file.txt"}},
+		{hdr: tar.Header{Name: "cache/loop", Typeflag: tar.TypeSymlink, Linkname: "loop"}},
+		{hdr: tar.Header{Name: "cache/file.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "file"},
+	})
+
+	testCases := []struct {
+		desc  string
+		depth int
+		want  []string
+	}{
+		{
+			desc: "default",
+			want: []string{"link-1", "link-2", "link-3"},
+		},
+		{
+			desc:  "too deep",
+			depth: 2,
+			want:  []string{"link-1", "link-2"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "dest")
+
+			e := &extractor{symlinks: symlinkDereference, symlinkDepth: tC.depth}
+
+			err := e.extract(archive, dir)
+			if err != nil {
+				t.Fatalf("extract returned err: %v", err)
+			}
+
+			// verify the links within the depth are copies of the file
+			for _, name := range []string{"link-1", "link-2", "link-3", "loop"} {
+				body, err := os.ReadFile(filepath.Join(dir, "cache", name))
+
+				if !slices.Contains(tC.want, name) {
+					if err == nil {
+						t.Errorf("%s should not be extracted", name)
+					}
+
+					continue
+				}
+
+				if err != nil || string(body) != "file" {
+					t.Errorf("%s is %q, want file: %v", name, body, err)
+				}
+			}
+		})
+	}
+}
+
+func TestS3Cache_validateSymlinkPolicy(t *testing.T) {
+	// setup types
+	for _, policy := range append(symlinkPolicies, "") {
+		err := validateSymlinkPolicy(policy)
+		if err != nil {
+			t.Errorf("validateSymlinkPolicy returned err for %q: %v", policy, err)
+		}
+	}
+
+	err := validateSymlinkPolicy("follow")
+	if err == nil {
+		t.Errorf("validateSymlinkPolicy should have returned err")
+	}
+}
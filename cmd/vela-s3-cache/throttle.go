@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// limiter represents a token bucket limiting the bytes per second
+// shared by every reader of a transfer, allowing a burst of one second.
+type limiter struct {
+	mu sync.Mutex
+	// sets the number of bytes allowed per second
+	rate float64
+	// holds the number of bytes available to transfer
+	tokens float64
+	// holds the time the tokens were last refilled
+	last time.Time
+}
+
+// newLimiter creates a limiter for the bytes per
+// second, returning nil when the rate is unlimited.
+func newLimiter(rate uint64) *limiter {
+	if rate == 0 {
+		return nil
+	}
+
+	return &limiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// Reader wraps the provided reader to limit the bytes read
+// per second, returning the reader as is when unlimited.
+func (l *limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	tr := &throttledReader{ctx: ctx, limiter: l, reader: r}
+
+	// keep the reader seekable so the upload can be retried
+	if seeker, ok := r.(io.Seeker); ok {
+		return &throttledReadSeeker{throttledReader: tr, Seeker: seeker}
+	}
+
+	return tr
+}
+
+// wait takes the bytes from the bucket, blocking until the
+// bucket refills enough to cover them or the context is done.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+
+	now := time.Now()
+
+	// refill the tokens for the time passed, up to the burst
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// throttledReader is a reader that limits the
+// bytes read per second with a shared limiter.
+type throttledReader struct {
+	ctx     context.Context
+	limiter *limiter
+	reader  io.Reader
+}
+
+// Read reads from the underlying reader, waiting for the limiter to
+// allow the bytes read. Reads are capped at the burst of the limiter.
+func (r *throttledReader) Read(b []byte) (int, error) {
+	if burst := max(int(r.limiter.rate), 1); len(b) > burst {
+		b = b[:burst]
+	}
+
+	n, err := r.reader.Read(b)
+	if n > 0 {
+		wErr := r.limiter.wait(r.ctx, n)
+		if wErr != nil {
+			return n, wErr
+		}
+	}
+
+	return n, err
+}
+
+// throttledReadSeeker is a throttledReader
+// seeking the underlying reader.
+type throttledReadSeeker struct {
+	*throttledReader
+	io.Seeker
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_limiter_Reader(t *testing.T) {
+	// setup types
+	r := strings.NewReader("hello")
+
+	// an unlimited rate returns the reader as is
+	if got := newLimiter(0).Reader(context.Background(), r); got != r {
+		t.Errorf("Reader is %T, want the unthrottled reader", got)
+	}
+
+	lim := newLimiter(100 * 1000)
+
+	start := time.Now()
+
+	// the first second is a burst, so the remaining half takes half a second
+	n, err := io.Copy(io.Discard, lim.Reader(context.Background(), bytes.NewReader(make([]byte, 150*1000))))
+	if err != nil {
+		t.Fatalf("Read returned err: %v", err)
+	}
+
+	elapsed := time.Since(start)
+
+	if n != 150*1000 {
+		t.Errorf("Read %d bytes, want %d", n, 150*1000)
+	}
+
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Read took %s, want at least 400ms", elapsed)
+	}
+}
+
+func TestS3Cache_limiter_Reader_Canceled(t *testing.T) {
+	// setup types
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	lim := newLimiter(1000)
+
+	_, err := io.Copy(io.Discard, lim.Reader(ctx, bytes.NewReader(make([]byte, 10*1000))))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Read returned err: %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// gigabyte represents the number of bytes in a gigabyte.
+const gigabyte = 1000 * 1000 * 1000
+
+// transferTimeout is a helper function to extend the timeout
+// by the duration allowed per gigabyte of the object size.
+func transferTimeout(timeout, perGB time.Duration, size int64) time.Duration {
+	if perGB <= 0 || size <= 0 {
+		return timeout
+	}
+
+	return timeout + time.Duration(float64(perGB)*float64(size)/gigabyte)
+}
+
+// streamTimeout is a helper function to cancel the transfer of a stream
+// of unknown size once it exceeds the timeout, extended by the duration
+// allowed per gigabyte of the bytes transferred so far.
+func streamTimeout(ctx context.Context, timeout, perGB time.Duration, transferred func() int64) (context.Context, context.CancelFunc) {
+	if perGB <= 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	start := time.Now()
+
+	go func() {
+		for {
+			// the deadline moves with every byte transferred
+			wait := time.Until(start.Add(transferTimeout(timeout, perGB, transferred())))
+			if wait <= 0 {
+				cancel(context.DeadlineExceeded)
+
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_transferTimeout(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc  string
+		perGB time.Duration
+		size  int64
+		want  time.Duration
+	}{
+		{
+			desc: "disabled",
+			size: 20 * gigabyte,
+			want: 10 * time.Minute,
+		},
+		{
+			desc:  "size aware",
+			perGB: time.Minute,
+			size:  20 * gigabyte,
+			want:  30 * time.Minute,
+		},
+		{
+			desc:  "unknown size",
+			perGB: time.Minute,
+			want:  10 * time.Minute,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := transferTimeout(10*time.Minute, tC.perGB, tC.size); got != tC.want {
+				t.Errorf("transferTimeout is %s, want %s", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_streamTimeout(t *testing.T) {
+	// setup types
+	var transferred atomic.Int64
+
+	// verify the stream is canceled after the timeout without any bytes
+	ctx, cancel := streamTimeout(context.Background(), 50*time.Millisecond, time.Hour, transferred.Load)
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("streamTimeout did not cancel the stream")
+	}
+
+	if cause := context.Cause(ctx); !errors.Is(cause, context.DeadlineExceeded) {
+		t.Errorf("cause is %v, want %v", cause, context.DeadlineExceeded)
+	}
+
+	// verify the timeout is extended by the bytes transferred
+	transferred.Store(gigabyte)
+
+	ctx, cancel = streamTimeout(context.Background(), 50*time.Millisecond, time.Hour, transferred.Load)
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+		t.Errorf("streamTimeout canceled the stream: %v", context.Cause(ctx))
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tlsVersions represents the TLS versions the
+// connections to s3 can be restricted to.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion is a helper function to parse the
+// minimum TLS version for the connections to s3.
+func parseTLSVersion(version string) (uint16, error) {
+	if len(version) == 0 {
+		return 0, nil
+	}
+
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("version %s is not supported: must be 1.0, 1.1, 1.2 or 1.3", version)
+	}
+
+	return v, nil
+}
+
+// parseCipherSuites is a helper function to parse the names of the
+// cipher suites allowed for the connections to s3, refusing the
+// cipher suites with known security issues.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	suites := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		suites[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := suites[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("cipher suite %s is not supported or insecure", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// validateTLS verifies the cipher suites can be applied with the minimum
+// TLS version, as the cipher suites of TLS 1.3 are not configurable.
+func (c *Config) validateTLS() error {
+	if c.MinTLSVersion == tls.VersionTLS13 && len(c.CipherSuites) > 0 {
+		return fmt.Errorf("TLS cipher suites can not be restricted with minimum TLS version 1.3")
+	}
+
+	return nil
+}
+
+// applyTLS restricts the TLS versions and cipher suites
+// the transport negotiates with s3, if configured.
+func (c *Config) applyTLS(t *http.Transport) {
+	if c.MinTLSVersion == 0 && len(c.CipherSuites) == 0 {
+		return
+	}
+
+	// keep the root CAs and server name of the transport
+	cfg := &tls.Config{}
+	if t.TLSClientConfig != nil {
+		cfg = t.TLSClientConfig.Clone()
+	}
+
+	if c.MinTLSVersion > 0 {
+		cfg.MinVersion = c.MinTLSVersion
+	}
+
+	if len(c.CipherSuites) > 0 {
+		cfg.CipherSuites = c.CipherSuites
+	}
+
+	t.TLSClientConfig = cfg
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestS3Cache_parseTLSVersion(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc:    "1.2",
+			version: "1.2",
+			want:    tls.VersionTLS12,
+		},
+		{
+			desc:    "prefixed",
+			version: "TLS1.3",
+			want:    tls.VersionTLS13,
+		},
+		{
+			desc:    "invalid",
+			version: "1.4",
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseTLSVersion(tC.version)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("parseTLSVersion returned err: %v", err)
+			}
+
+			if got != tC.want {
+				t.Errorf("parseTLSVersion is %x, want %x", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_parseCipherSuites(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc    string
+		names   []string
+		want    []uint16
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc:  "secure",
+			names: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "tls_ecdhe_ecdsa_with_chacha20_poly1305_sha256"},
+			want: []uint16{
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			},
+		},
+		{
+			desc:    "insecure",
+			names:   []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown",
+			names:   []string{"TLS_FOO"},
+			wantErr: true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := parseCipherSuites(tC.names)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("parseCipherSuites returned err: %v", err)
+			}
+
+			if !tC.wantErr && !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("parseCipherSuites is %v, want %v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestS3Cache_Config_transport_TLS(t *testing.T) {
+	// setup types
+	c := &Config{
+		MinTLSVersion: tls.VersionTLS12,
+		CipherSuites:  []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+	}
+
+	rt := c.transport(&http.Transport{
+		TLSClientConfig: &tls.Config{ServerName: "s3.example.com"},
+	})
+
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport is %T, want *http.Transport", rt)
+	}
+
+	cfg := transport.TLSClientConfig
+
+	if cfg.MinVersion != c.MinTLSVersion {
+		t.Errorf("MinVersion is %x, want %x", cfg.MinVersion, c.MinTLSVersion)
+	}
+
+	if !reflect.DeepEqual(cfg.CipherSuites, c.CipherSuites) {
+		t.Errorf("CipherSuites is %v, want %v", cfg.CipherSuites, c.CipherSuites)
+	}
+
+	// verify the existing tls configuration is kept
+	if cfg.ServerName != "s3.example.com" {
+		t.Errorf("ServerName is %s, want s3.example.com", cfg.ServerName)
+	}
+
+	// verify the cipher suites of TLS 1.3 can not be restricted
+	c.MinTLSVersion = tls.VersionTLS13
+
+	err := c.validateTLS()
+	if err == nil {
+		t.Errorf("validateTLS should have returned err")
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// validateTmpDir is a helper function to verify the
+// directory for staging archives exists when provided.
+func validateTmpDir(dir string) error {
+	// use the default staging directory when none is provided
+	if len(dir) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("tmp dir: %s, make sure directory exists", dir)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("tmp dir: %s is not a directory", dir)
+	}
+
+	return nil
+}
+
+// createTemp is a helper function to create a staging file for the
+// archive with a random name only accessible by the current user, so
+// other containers sharing the directory can not pre-create it.
+func createTemp(dir, filename string) (string, error) {
+	f, err := os.CreateTemp(dir, "vela-s3-cache-*-"+filename)
+	if err != nil {
+		return "", fmt.Errorf("unable to create staging file in %s: %w", dir, err)
+	}
+
+	return f.Name(), f.Close()
+}
+
+// removeTemp is a helper function to delete the staging file for the archive.
+func removeTemp(path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("delete of archive file %s unsuccessful", path)
+
+		return
+	}
+
+	logrus.Debugf("cache archive %s successfully deleted", path)
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestS3Cache_validateTmpDir(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "file")
+
+	err := os.WriteFile(file, []byte("hello"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc    string
+		dir     string
+		wantErr bool
+	}{
+		{desc: "default", dir: "", wantErr: false},
+		{desc: "directory", dir: dir, wantErr: false},
+		{desc: "missing", dir: filepath.Join(dir, "missing"), wantErr: true},
+		{desc: "file", dir: file, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := validateTmpDir(tC.dir)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("validateTmpDir returned err: %v, want err: %v", err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3Cache_createTemp(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	first, err := createTemp(dir, "archive.tgz")
+	if err != nil {
+		t.Fatalf("createTemp returned err: %v", err)
+	}
+
+	second, err := createTemp(dir, "archive.tgz")
+	if err != nil {
+		t.Fatalf("createTemp returned err: %v", err)
+	}
+
+	if first == second {
+		t.Errorf("createTemp returned the same path %s twice", first)
+	}
+
+	if !strings.HasSuffix(first, ".tgz") {
+		t.Errorf("createTemp path %s is missing the archive extension", first)
+	}
+
+	info, err := os.Stat(first)
+	if err != nil {
+		t.Fatalf("staging file is missing: %v", err)
+	}
+
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Errorf("mode is %s, want %s", got, os.FileMode(0o600))
+	}
+
+	removeTemp(first)
+
+	_, err = os.Stat(first)
+	if !os.IsNotExist(err) {
+		t.Errorf("staging file should have been removed")
+	}
+}
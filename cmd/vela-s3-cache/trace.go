@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactedParams are the query parameters containing
+// credentials or signatures that must never be logged.
+var redactedParams = []string{
+	"X-Amz-Credential",
+	"X-Amz-Signature",
+	"X-Amz-Security-Token",
+	"AWSAccessKeyId",
+	"Signature",
+}
+
+// traceTransport is an http.RoundTripper that logs a
+// summary of every request made to the s3 server.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip executes the request and logs the method, redacted
+// URL, status, request ID and latency of the request.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	resp, err := t.next.RoundTrip(req)
+
+	latency := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		logrus.Infof("http %s %s failed after %s: %v", req.Method, redactURL(req.URL), latency, err)
+
+		return resp, err
+	}
+
+	logrus.Infof(
+		"http %s %s %d request_id=%s host_id=%s latency=%s",
+		req.Method,
+		redactURL(req.URL),
+		resp.StatusCode,
+		resp.Header.Get("X-Amz-Request-Id"),
+		resp.Header.Get("X-Amz-Id-2"),
+		latency,
+	)
+
+	return resp, nil
+}
+
+// requestIDTransport is an http.RoundTripper that logs the request
+// and host ID of every response from the s3 server.
+type requestIDTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip executes the request and logs the
+// method, status, request ID and host ID of the response.
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	logrus.Infof(
+		"http %s %d request_id=%s host_id=%s",
+		req.Method,
+		resp.StatusCode,
+		resp.Header.Get("X-Amz-Request-Id"),
+		resp.Header.Get("X-Amz-Id-2"),
+	)
+
+	return resp, nil
+}
+
+// redactURL is a helper function to create a string
+// from the URL with any credentials redacted.
+func redactURL(u *url.URL) string {
+	r := *u
+
+	// remove any user information from the url
+	if r.User != nil {
+		r.User = url.User("REDACTED")
+	}
+
+	query := r.Query()
+
+	for _, param := range redactedParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+		}
+	}
+
+	r.RawQuery = query.Encode()
+
+	return r.String()
+}
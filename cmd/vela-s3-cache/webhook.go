@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// webhookSignatureHeader represents the header holding the
+// HMAC-SHA256 signature of the payload sent to the webhook.
+const webhookSignatureHeader = "X-Vela-S3-Cache-Signature"
+
+// Webhook represents the plugin configuration for notifying a webhook.
+type Webhook struct {
+	// sets the URL to send the result of each action to
+	URL string
+	// sets the secret to sign the payload with
+	Secret string
+	// sets the timeout for sending the payload
+	Timeout time.Duration
+
+	// will hold the transport with the TLS settings of the plugin
+	transport http.RoundTripper
+}
+
+// webhookPayload represents the JSON payload sent to the webhook.
+type webhookPayload struct {
+	Org               string  `json:"org"`
+	Repo              string  `json:"repo"`
+	Action            string  `json:"action"`
+	Key               string  `json:"key"`
+	Success           bool    `json:"success"`
+	Hit               bool    `json:"hit"`
+	DryRun            bool    `json:"dry_run"`
+	Bytes             int64   `json:"bytes"`
+	UncompressedBytes int64   `json:"uncompressed_bytes"`
+	DurationSeconds   float64 `json:"duration_seconds"`
+}
+
+// Send posts the result of an action to the webhook as JSON.
+func (w *Webhook) Send(ctx context.Context, repo *Repo, res *Result) error {
+	if w == nil || len(w.URL) == 0 {
+		return nil
+	}
+
+	logrus.Trace("sending result of action to webhook")
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	body, err := json.Marshal(webhookPayload{
+		Org:               repo.Owner,
+		Repo:              repo.Name,
+		Action:            res.Action,
+		Key:               res.Key,
+		Success:           res.Success,
+		Hit:               res.Hit,
+		DryRun:            res.DryRun,
+		Bytes:             res.Size,
+		UncompressedBytes: res.UncompressedSize,
+		DurationSeconds:   res.Duration.Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	// sign the payload so the receiver can verify its origin
+	if len(w.Secret) > 0 {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{
+		Transport: w.transport,
+		// keep the signed payload from being sent to another host
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unable to send webhook: unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
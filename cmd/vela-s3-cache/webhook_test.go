@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestS3Cache_Webhook_Send(t *testing.T) {
+	// setup types
+	var (
+		body      []byte
+		signature string
+	)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	w := &Webhook{
+		URL:     s.URL,
+		Secret:  "secret",
+		Timeout: time.Second,
+	}
+
+	res := &Result{
+		Action:   restoreAction,
+		Key:      "foo/bar/archive.tgz",
+		Hit:      true,
+		Success:  true,
+		Size:     1024,
+		Duration: 2 * time.Second,
+	}
+
+	err := w.Send(context.Background(), &Repo{Owner: "foo", Name: "bar"}, res)
+	if err != nil {
+		t.Fatalf("Send returned err: %v", err)
+	}
+
+	got := webhookPayload{}
+
+	err = json.Unmarshal(body, &got)
+	if err != nil {
+		t.Fatalf("unable to parse payload: %v", err)
+	}
+
+	want := webhookPayload{
+		Org:             "foo",
+		Repo:            "bar",
+		Action:          restoreAction,
+		Key:             "foo/bar/archive.tgz",
+		Success:         true,
+		Hit:             true,
+		Bytes:           1024,
+		DurationSeconds: 2,
+	}
+
+	if got != want {
+		t.Errorf("payload is %+v, want %+v", got, want)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature is %s, want %s", signature, want)
+	}
+}
+
+func TestS3Cache_Webhook_Send_Failure(t *testing.T) {
+	// setup types
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	w := &Webhook{URL: s.URL, Timeout: time.Second}
+
+	err := w.Send(context.Background(), &Repo{}, &Result{})
+	if err == nil {
+		t.Errorf("Send should have returned err")
+	}
+
+	// an unset webhook is skipped
+	err = (*Webhook)(nil).Send(context.Background(), &Repo{}, &Result{})
+	if err != nil {
+		t.Errorf("Send returned err: %v", err)
+	}
+}
+
+func TestS3Cache_Webhook_Send_Redirect(t *testing.T) {
+	// setup types
+	redirected := false
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer s.Close()
+
+	w := &Webhook{URL: s.URL, Secret: "secret", Timeout: time.Second}
+
+	err := w.Send(context.Background(), &Repo{}, &Result{})
+	if err == nil {
+		t.Errorf("Send should have returned err")
+	}
+
+	// verify the signed payload is not sent to the redirect
+	if redirected {
+		t.Errorf("Send followed the redirect")
+	}
+}
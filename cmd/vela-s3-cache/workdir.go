@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// changeWorkdir is a helper function to change into the working
+// directory that relative mounts and restores are resolved against.
+func changeWorkdir(dir string) error {
+	// keep the current working directory when none is provided
+	if len(dir) == 0 {
+		return nil
+	}
+
+	logrus.Debugf("changing working directory to %s", dir)
+
+	err := os.Chdir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to change working directory to %s: %w", dir, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestS3Cache_changeWorkdir(t *testing.T) {
+	// setup types
+	dir := t.TempDir()
+
+	chdir(t, dir)
+
+	err := os.Mkdir("sub", 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run test
+	err = changeWorkdir("")
+	if err != nil {
+		t.Errorf("changeWorkdir returned err: %v", err)
+	}
+
+	err = changeWorkdir("sub")
+	if err != nil {
+		t.Errorf("changeWorkdir returned err: %v", err)
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := filepath.EvalSymlinks(filepath.Join(dir, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := filepath.EvalSymlinks(pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("working directory is %s, want %s", got, want)
+	}
+
+	err = changeWorkdir("missing")
+	if err == nil {
+		t.Errorf("changeWorkdir should have returned err")
+	}
+}
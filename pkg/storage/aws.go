@@ -0,0 +1,904 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// deleteBatchSize represents the maximum number
+	// of objects removed with a single bulk delete.
+	deleteBatchSize = 1000
+
+	// copyPartSize represents the size of the parts
+	// of objects copied with a multipart upload.
+	copyPartSize = 512 * 1024 * 1024
+)
+
+// AWS represents a Backend using the AWS SDK for Go v2.
+type AWS struct {
+	client     *s3.Client
+	uploader   *manager.Uploader
+	compat     Compat
+	encryption Encryption
+}
+
+// NewAWS creates a Backend from the AWS SDK s3 client, avoiding the
+// parts of the s3 api set in compat and uploading with the encryption.
+func NewAWS(client *s3.Client, compat Compat, encryption Encryption) *AWS {
+	return &AWS{
+		client:     client,
+		uploader:   manager.NewUploader(client),
+		compat:     compat,
+		encryption: encryption,
+	}
+}
+
+// serverSide returns the server-side encryption and
+// the KMS key id to upload the objects with.
+func (a *AWS) serverSide() (types.ServerSideEncryption, *string) {
+	switch a.encryption.Mode {
+	case SSES3:
+		return types.ServerSideEncryptionAes256, nil
+	case SSEKMS:
+		if len(a.encryption.KMSKeyID) > 0 {
+			return types.ServerSideEncryptionAwsKms, aws.String(a.encryption.KMSKeyID)
+		}
+
+		return types.ServerSideEncryptionAwsKms, nil
+	}
+
+	return "", nil
+}
+
+// customerKey returns the algorithm, the base64 encoded key and its
+// md5 sent with every request for SSE-C, or nils for the other modes.
+func (a *AWS) customerKey() (*string, *string, *string) {
+	if a.encryption.Mode != SSEC {
+		return nil, nil, nil
+	}
+
+	sum := md5.Sum(a.encryption.CustomerKey)
+
+	return aws.String("AES256"),
+		aws.String(base64.StdEncoding.EncodeToString(a.encryption.CustomerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// requestChecksum returns the algorithm of the checksum sent with the
+// requests s3 requires a checksum for, which the SDK defaults to MD5.
+func (a *AWS) requestChecksum() types.ChecksumAlgorithm {
+	if a.compat.NoMD5 {
+		return types.ChecksumAlgorithmCrc32c
+	}
+
+	return ""
+}
+
+// Put uploads the contents of the reader to the key in the bucket.
+// The parts of a reader of unknown size are sent with CRC32C checksums,
+// which the SDK sends as trailers over TLS.
+func (a *AWS) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (Object, error) {
+	body := &countingReader{reader: reader, progress: opts.Progress}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(opts.ContentType),
+		Metadata:    opts.UserMetadata,
+	}
+
+	input.Tagging = a.tagging(opts.UserTags)
+
+	input.ServerSideEncryption, input.SSEKMSKeyId = a.serverSide()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = a.customerKey()
+
+	if !opts.Expires.IsZero() {
+		input.Expires = aws.Time(opts.Expires)
+	}
+
+	// buckets with object lock require a checksum of the contents
+	if len(opts.RetentionMode) > 0 {
+		input.ObjectLockMode = types.ObjectLockMode(opts.RetentionMode)
+		input.ObjectLockRetainUntilDate = aws.Time(opts.RetainUntil)
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+
+	if opts.LegalHold {
+		input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+
+	// only create the object when the key is free
+	if opts.IfNoneMatch {
+		if size < 0 || size >= maxConditionalSize {
+			return Object{}, errConditionalSize
+		}
+
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	// have the store verify the checksum of every part of a stream
+	if size < 0 && len(input.ChecksumAlgorithm) == 0 {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32c
+	}
+
+	if a.compat.NoChecksums {
+		input.ChecksumAlgorithm = ""
+	}
+
+	out, err := a.uploader.Upload(ctx, input)
+	if err != nil {
+		return Object{}, wrapAWS(err)
+	}
+
+	return Object{
+		Key:       aws.ToString(out.Key),
+		Size:      body.n,
+		ETag:      aws.ToString(out.ETag),
+		VersionID: aws.ToString(out.VersionID),
+	}, nil
+}
+
+// tagging returns the url encoded tags to set on an object,
+// or nil when there are none or the store has no tagging.
+func (a *AWS) tagging(userTags map[string]string) *string {
+	if len(userTags) == 0 || a.compat.NoTags {
+		return nil
+	}
+
+	tags := url.Values{}
+	for k, v := range userTags {
+		tags.Set(k, v)
+	}
+
+	return aws.String(tags.Encode())
+}
+
+// Copy copies the source key to the destination key in the bucket on the
+// server, replacing the metadata, tags and retention with the options.
+// Sources too large for a single copy request are copied in parts.
+func (a *AWS) Copy(ctx context.Context, bucket, src, dst string, opts PutOptions) (Object, error) {
+	algorithm, key, keyMD5 := a.customerKey()
+
+	head, err := a.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(src),
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+		SSECustomerKeyMD5:    keyMD5,
+	})
+	if err != nil {
+		return Object{}, wrapAWS(err)
+	}
+
+	size := aws.ToInt64(head.ContentLength)
+
+	// only copy the source the size was read from
+	source := url.PathEscape(bucket + "/" + src)
+
+	if size > maxCopySize {
+		return a.copyMultipart(ctx, bucket, source, dst, size, aws.ToString(head.ETag), opts)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(dst),
+		CopySource:        aws.String(source),
+		CopySourceIfMatch: head.ETag,
+		MetadataDirective: types.MetadataDirectiveReplace,
+		Metadata:          opts.UserMetadata,
+		ContentType:       aws.String(opts.ContentType),
+		Tagging:           a.tagging(opts.UserTags),
+
+		SSECustomerAlgorithm:           algorithm,
+		SSECustomerKey:                 key,
+		SSECustomerKeyMD5:              keyMD5,
+		CopySourceSSECustomerAlgorithm: algorithm,
+		CopySourceSSECustomerKey:       key,
+		CopySourceSSECustomerKeyMD5:    keyMD5,
+	}
+
+	input.ServerSideEncryption, input.SSEKMSKeyId = a.serverSide()
+
+	if !a.compat.NoTags {
+		input.TaggingDirective = types.TaggingDirectiveReplace
+	}
+
+	if !opts.Expires.IsZero() {
+		input.Expires = aws.Time(opts.Expires)
+	}
+
+	if len(opts.RetentionMode) > 0 {
+		input.ObjectLockMode = types.ObjectLockMode(opts.RetentionMode)
+		input.ObjectLockRetainUntilDate = aws.Time(opts.RetainUntil)
+	}
+
+	if opts.LegalHold {
+		input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+	}
+
+	out, err := a.client.CopyObject(ctx, input)
+	if err != nil {
+		return Object{}, wrapAWS(err)
+	}
+
+	obj := Object{Key: dst, Size: size, VersionID: aws.ToString(out.VersionId)}
+
+	if out.CopyObjectResult != nil {
+		obj.ETag = aws.ToString(out.CopyObjectResult.ETag)
+		obj.LastModified = aws.ToTime(out.CopyObjectResult.LastModified)
+	}
+
+	return obj, nil
+}
+
+// copyMultipart copies the source to the destination key in the bucket
+// with a multipart upload of ranges of the source, aborting the upload
+// when a part fails so its parts are not left in the bucket.
+func (a *AWS) copyMultipart(ctx context.Context, bucket, source, dst string, size int64, etag string, opts PutOptions) (obj Object, err error) {
+	algorithm, key, keyMD5 := a.customerKey()
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(dst),
+		Metadata:    opts.UserMetadata,
+		ContentType: aws.String(opts.ContentType),
+		Tagging:     a.tagging(opts.UserTags),
+
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+		SSECustomerKeyMD5:    keyMD5,
+	}
+
+	input.ServerSideEncryption, input.SSEKMSKeyId = a.serverSide()
+
+	if !opts.Expires.IsZero() {
+		input.Expires = aws.Time(opts.Expires)
+	}
+
+	if len(opts.RetentionMode) > 0 {
+		input.ObjectLockMode = types.ObjectLockMode(opts.RetentionMode)
+		input.ObjectLockRetainUntilDate = aws.Time(opts.RetainUntil)
+	}
+
+	if opts.LegalHold {
+		input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+	}
+
+	upload, err := a.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return Object{}, wrapAWS(err)
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		// the upload context may be done, so abort with a context of its own
+		aCtx, cancel := context.WithTimeout(context.Background(), abortUploadTimeout)
+		defer cancel()
+
+		aErr := a.AbortUpload(aCtx, bucket, Upload{Key: dst, UploadID: aws.ToString(upload.UploadId)})
+		if aErr != nil {
+			err = errors.Join(err, fmt.Errorf("unable to abort upload: %w", aErr))
+		}
+	}()
+
+	parts := []types.CompletedPart{}
+
+	for offset := int64(0); offset < size; offset += copyPartSize {
+		number := aws.Int32(int32(len(parts) + 1))
+
+		out, err := a.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(dst),
+			UploadId:          upload.UploadId,
+			PartNumber:        number,
+			CopySource:        aws.String(source),
+			CopySourceIfMatch: aws.String(etag),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, min(offset+copyPartSize, size)-1)),
+
+			SSECustomerAlgorithm:           algorithm,
+			SSECustomerKey:                 key,
+			SSECustomerKeyMD5:              keyMD5,
+			CopySourceSSECustomerAlgorithm: algorithm,
+			CopySourceSSECustomerKey:       key,
+			CopySourceSSECustomerKeyMD5:    keyMD5,
+		})
+		if err != nil {
+			return Object{}, fmt.Errorf("unable to copy part %d: %w", len(parts)+1, wrapAWS(err))
+		}
+
+		if out.CopyPartResult == nil {
+			return Object{}, fmt.Errorf("unable to copy part %d: no entity tag returned", len(parts)+1)
+		}
+
+		parts = append(parts, types.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: number})
+	}
+
+	out, err := a.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(dst),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+
+		SSECustomerAlgorithm: algorithm,
+		SSECustomerKey:       key,
+		SSECustomerKeyMD5:    keyMD5,
+	})
+	if err != nil {
+		return Object{}, wrapAWS(err)
+	}
+
+	return Object{
+		Key:       dst,
+		Size:      size,
+		ETag:      aws.ToString(out.ETag),
+		VersionID: aws.ToString(out.VersionId),
+	}, nil
+}
+
+// Get retrieves the contents of the key in the bucket.
+func (a *AWS) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = a.customerKey()
+
+	out, err := a.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, wrapAWS(err)
+	}
+
+	return out.Body, nil
+}
+
+// GetRange retrieves a range of the contents of the key in the bucket.
+func (a *AWS) GetRange(ctx context.Context, bucket, key string, opts RangeOptions) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", opts.Offset, opts.Offset+opts.Length-1)),
+	}
+
+	if len(opts.ETag) > 0 {
+		input.IfMatch = aws.String(opts.ETag)
+	}
+
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = a.customerKey()
+
+	out, err := a.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, wrapAWS(err)
+	}
+
+	return out.Body, nil
+}
+
+// Stat retrieves the information and metadata for the key in the bucket.
+func (a *AWS) Stat(ctx context.Context, bucket, key string) (Object, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = a.customerKey()
+
+	out, err := a.client.HeadObject(ctx, input)
+	if err != nil {
+		return Object{}, wrapAWS(err)
+	}
+
+	return Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		LastModified: aws.ToTime(out.LastModified),
+		ETag:         aws.ToString(out.ETag),
+		VersionID:    aws.ToString(out.VersionId),
+		UserMetadata: out.Metadata,
+	}, nil
+}
+
+// GetTags retrieves the tags of the key in the bucket.
+func (a *AWS) GetTags(ctx context.Context, bucket, key string) (map[string]string, error) {
+	if a.compat.NoTags {
+		return map[string]string{}, nil
+	}
+
+	out, err := a.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapAWS(err)
+	}
+
+	tags := make(map[string]string, len(out.TagSet))
+	for _, tag := range out.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return tags, nil
+}
+
+// SetTags replaces the tags of the key in the bucket.
+func (a *AWS) SetTags(ctx context.Context, bucket, key string, tags map[string]string) error {
+	if a.compat.NoTags {
+		return fmt.Errorf("object tagging is not supported by the provider")
+	}
+
+	set := make([]types.Tag, 0, len(tags))
+	for k, v := range tags {
+		set = append(set, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	_, err := a.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		Tagging:           &types.Tagging{TagSet: set},
+		ChecksumAlgorithm: a.requestChecksum(),
+	})
+
+	return wrapAWS(err)
+}
+
+// List retrieves the objects in the bucket matching the options.
+func (a *AWS) List(ctx context.Context, bucket string, opts ListOptions) ([]Object, error) {
+	if opts.WithVersions {
+		return a.listVersions(ctx, bucket, opts)
+	}
+
+	if a.compat.ListV1 {
+		return a.listV1(ctx, bucket, opts)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(opts.Prefix),
+	}
+
+	// group the keys at the next level into common prefixes
+	if !opts.Recursive {
+		input.Delimiter = aws.String("/")
+	}
+
+	if opts.MaxKeys > 0 {
+		input.MaxKeys = aws.Int32(int32(opts.MaxKeys))
+	}
+
+	if len(opts.StartAfter) > 0 {
+		input.StartAfter = aws.String(opts.StartAfter)
+	}
+
+	objects := []Object{}
+
+	paginator := s3.NewListObjectsV2Paginator(a.client, input)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve objects %s: %w", opts.Prefix, wrapAWS(err))
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+				ETag:         aws.ToString(object.ETag),
+			})
+		}
+
+		for _, prefix := range page.CommonPrefixes {
+			objects = append(objects, Object{Key: aws.ToString(prefix.Prefix)})
+		}
+	}
+
+	return objects, nil
+}
+
+// listV1 retrieves the objects in the bucket matching the options with
+// the original ListObjects api, for stores with an incomplete ListObjectsV2.
+func (a *AWS) listV1(ctx context.Context, bucket string, opts ListOptions) ([]Object, error) {
+	input := &s3.ListObjectsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(opts.Prefix),
+	}
+
+	// group the keys at the next level into common prefixes
+	if !opts.Recursive {
+		input.Delimiter = aws.String("/")
+	}
+
+	if opts.MaxKeys > 0 {
+		input.MaxKeys = aws.Int32(int32(opts.MaxKeys))
+	}
+
+	if len(opts.StartAfter) > 0 {
+		input.Marker = aws.String(opts.StartAfter)
+	}
+
+	objects := []Object{}
+
+	for {
+		page, err := a.client.ListObjects(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve objects %s: %w", opts.Prefix, wrapAWS(err))
+		}
+
+		marker := ""
+
+		for _, object := range page.Contents {
+			marker = aws.ToString(object.Key)
+
+			objects = append(objects, Object{
+				Key:          marker,
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+				ETag:         aws.ToString(object.ETag),
+			})
+		}
+
+		for _, prefix := range page.CommonPrefixes {
+			objects = append(objects, Object{Key: aws.ToString(prefix.Prefix)})
+		}
+
+		if !aws.ToBool(page.IsTruncated) {
+			return objects, nil
+		}
+
+		// the next marker is only returned with a delimiter
+		if len(aws.ToString(page.NextMarker)) > 0 {
+			marker = aws.ToString(page.NextMarker)
+		}
+
+		if len(marker) == 0 {
+			return objects, nil
+		}
+
+		input.Marker = aws.String(marker)
+	}
+}
+
+// listVersions retrieves every version and delete
+// marker of the objects in the bucket matching the options.
+func (a *AWS) listVersions(ctx context.Context, bucket string, opts ListOptions) ([]Object, error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(opts.Prefix),
+	}
+
+	if opts.MaxKeys > 0 {
+		input.MaxKeys = aws.Int32(int32(opts.MaxKeys))
+	}
+
+	objects := []Object{}
+
+	for {
+		page, err := a.client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve object versions %s: %w", opts.Prefix, wrapAWS(err))
+		}
+
+		for _, version := range page.Versions {
+			objects = append(objects, Object{
+				Key:          aws.ToString(version.Key),
+				Size:         aws.ToInt64(version.Size),
+				LastModified: aws.ToTime(version.LastModified),
+				ETag:         aws.ToString(version.ETag),
+				VersionID:    aws.ToString(version.VersionId),
+				IsLatest:     aws.ToBool(version.IsLatest),
+			})
+		}
+
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, Object{
+				Key:            aws.ToString(marker.Key),
+				LastModified:   aws.ToTime(marker.LastModified),
+				VersionID:      aws.ToString(marker.VersionId),
+				IsLatest:       aws.ToBool(marker.IsLatest),
+				IsDeleteMarker: true,
+			})
+		}
+
+		if !aws.ToBool(page.IsTruncated) {
+			return objects, nil
+		}
+
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+}
+
+// Remove deletes the objects from the bucket, returning
+// an error for every object that could not be removed.
+func (a *AWS) Remove(ctx context.Context, bucket string, objects []Object) []RemoveError {
+	if a.compat.SingleDelete {
+		return a.removeEach(ctx, bucket, objects)
+	}
+
+	errs := []RemoveError{}
+
+	for start := 0; start < len(objects); start += deleteBatchSize {
+		batch := objects[start:min(start+deleteBatchSize, len(objects))]
+
+		// index the objects to report the failures against
+		index := make(map[[2]string]Object, len(batch))
+		ids := make([]types.ObjectIdentifier, 0, len(batch))
+
+		for _, object := range batch {
+			index[[2]string{object.Key, object.VersionID}] = object
+
+			id := types.ObjectIdentifier{Key: aws.String(object.Key)}
+			if len(object.VersionID) > 0 {
+				id.VersionId = aws.String(object.VersionID)
+			}
+
+			ids = append(ids, id)
+		}
+
+		out, err := a.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket:            aws.String(bucket),
+			Delete:            &types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+			ChecksumAlgorithm: a.requestChecksum(),
+		})
+		if err != nil {
+			err = wrapAWS(err)
+
+			for _, object := range batch {
+				errs = append(errs, RemoveError{Object: object, Err: err})
+			}
+
+			continue
+		}
+
+		for _, dErr := range out.Errors {
+			object, ok := index[[2]string{aws.ToString(dErr.Key), aws.ToString(dErr.VersionId)}]
+			if !ok {
+				object = Object{Key: aws.ToString(dErr.Key), VersionID: aws.ToString(dErr.VersionId)}
+			}
+
+			errs = append(errs, RemoveError{
+				Object: object,
+				Err:    errors.New(aws.ToString(dErr.Message)),
+			})
+		}
+	}
+
+	return errs
+}
+
+// removeEach deletes the objects from the bucket one at a
+// time, for stores without the multi-object delete api.
+func (a *AWS) removeEach(ctx context.Context, bucket string, objects []Object) []RemoveError {
+	errs := []RemoveError{}
+
+	for _, object := range objects {
+		input := &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(object.Key),
+		}
+
+		if len(object.VersionID) > 0 {
+			input.VersionId = aws.String(object.VersionID)
+		}
+
+		_, err := a.client.DeleteObject(ctx, input)
+		if err != nil {
+			errs = append(errs, RemoveError{Object: object, Err: wrapAWS(err)})
+		}
+	}
+
+	return errs
+}
+
+// Abort removes the parts of any incomplete uploads for the key in the bucket.
+func (a *AWS) Abort(ctx context.Context, bucket, key string) error {
+	paginator := s3.NewListMultipartUploadsPaginator(a.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(key),
+	})
+
+	errs := []error{}
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to list incomplete uploads %s: %w", key, wrapAWS(err))
+		}
+
+		for _, upload := range page.Uploads {
+			// the prefix may match other keys
+			if aws.ToString(upload.Key) != key {
+				continue
+			}
+
+			_, err = a.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				errs = append(errs, wrapAWS(err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ListUploads retrieves the incomplete multipart uploads
+// in the bucket for the keys beginning with the prefix.
+func (a *AWS) ListUploads(ctx context.Context, bucket, prefix string) ([]Upload, error) {
+	paginator := s3.NewListMultipartUploadsPaginator(a.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	uploads := []Upload{}
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list incomplete uploads %s: %w", prefix, wrapAWS(err))
+		}
+
+		for _, upload := range page.Uploads {
+			uploads = append(uploads, Upload{
+				Key:       aws.ToString(upload.Key),
+				UploadID:  aws.ToString(upload.UploadId),
+				Initiated: aws.ToTime(upload.Initiated),
+			})
+		}
+	}
+
+	return uploads, nil
+}
+
+// AbortUpload removes the parts of the incomplete upload in the bucket.
+func (a *AWS) AbortUpload(ctx context.Context, bucket string, upload Upload) error {
+	_, err := a.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(upload.Key),
+		UploadId: aws.String(upload.UploadID),
+	})
+
+	return wrapAWS(err)
+}
+
+// Presign creates a URL granting the method, GET or PUT, on
+// the key in the bucket without credentials until the expiry.
+func (a *AWS) Presign(ctx context.Context, bucket, key, method string, expiry time.Duration) (string, error) {
+	var (
+		req *v4.PresignedHTTPRequest
+		err error
+	)
+
+	client := s3.NewPresignClient(a.client, s3.WithPresignExpires(expiry))
+
+	switch method {
+	case http.MethodGet:
+		req, err = client.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+	case http.MethodPut:
+		req, err = client.PresignPutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+	default:
+		return "", fmt.Errorf("unsupported presign method %s", method)
+	}
+
+	if err != nil {
+		return "", wrapAWS(err)
+	}
+
+	return req.URL, nil
+}
+
+// SetLifecycle creates or replaces the rule with the same id in the
+// lifecycle configuration of the bucket, keeping any other rules.
+func (a *AWS) SetLifecycle(ctx context.Context, bucket string, rule LifecycleRule) error {
+	rules := []types.LifecycleRule{}
+
+	out, err := a.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+
+	// a bucket without any rules has no configuration
+	var api smithy.APIError
+
+	switch {
+	case err == nil:
+		rules = out.Rules
+	case errors.As(err, &api) && api.ErrorCode() == noLifecycleCode:
+	default:
+		return fmt.Errorf("unable to retrieve lifecycle configuration: %w", wrapAWS(err))
+	}
+
+	_, err = a.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: mergeAWSRule(rules, rule),
+		},
+		ChecksumAlgorithm: a.requestChecksum(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set lifecycle configuration: %w", wrapAWS(err))
+	}
+
+	return nil
+}
+
+// mergeAWSRule is a helper function to replace the rule with
+// the same id in the lifecycle rules or append the rule.
+func mergeAWSRule(rules []types.LifecycleRule, rule LifecycleRule) []types.LifecycleRule {
+	r := types.LifecycleRule{
+		ID:     aws.String(rule.ID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+	}
+
+	if rule.ExpireDays > 0 {
+		r.Expiration = &types.LifecycleExpiration{Days: aws.Int32(int32(rule.ExpireDays))}
+	}
+
+	if rule.AbortIncompleteDays > 0 {
+		r.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(int32(rule.AbortIncompleteDays)),
+		}
+	}
+
+	for i := range rules {
+		if aws.ToString(rules[i].ID) == rule.ID {
+			rules[i] = r
+
+			return rules
+		}
+	}
+
+	return append(rules, r)
+}
+
+// countingReader is a reader that counts the bytes read
+// and reports them to an optional progress reader.
+type countingReader struct {
+	reader   io.Reader
+	progress io.Reader
+	n        int64
+}
+
+// Read reads from the underlying reader and records the bytes read.
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.n += int64(n)
+
+	if r.progress != nil && n > 0 {
+		_, _ = r.progress.Read(b[:n])
+	}
+
+	return n, err
+}
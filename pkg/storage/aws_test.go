@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestStorage_countingReader(t *testing.T) {
+	// setup types
+	progress := new(progressCounter)
+
+	r := &countingReader{
+		reader:   strings.NewReader("hello world"),
+		progress: progress,
+	}
+
+	_, err := io.Copy(io.Discard, r)
+	if err != nil {
+		t.Errorf("Copy returned err: %v", err)
+	}
+
+	if r.n != 11 {
+		t.Errorf("n is %d, want 11", r.n)
+	}
+
+	if progress.n != 11 {
+		t.Errorf("progress is %d, want 11", progress.n)
+	}
+}
+
+// progressCounter is a progress reader counting the bytes reported.
+type progressCounter struct {
+	n int
+}
+
+func (p *progressCounter) Read(b []byte) (int, error) {
+	p.n += len(b)
+
+	return len(b), nil
+}
+
+func TestStorage_mergeAWSRule(t *testing.T) {
+	// setup types
+	rules := []types.LifecycleRule{
+		{ID: aws.String("other"), Status: types.ExpirationStatusEnabled},
+		{ID: aws.String("vela-s3-cache"), Status: types.ExpirationStatusDisabled},
+	}
+
+	rule := LifecycleRule{ID: "vela-s3-cache", Prefix: "cache/", ExpireDays: 14}
+
+	got := mergeAWSRule(rules, rule)
+
+	if len(got) != 2 {
+		t.Fatalf("mergeAWSRule returned %d rules, want 2", len(got))
+	}
+
+	if aws.ToString(got[0].ID) != "other" {
+		t.Errorf("mergeAWSRule replaced rule %s", aws.ToString(got[0].ID))
+	}
+
+	r := got[1]
+
+	if r.Status != types.ExpirationStatusEnabled || aws.ToString(r.Filter.Prefix) != "cache/" {
+		t.Errorf("mergeAWSRule status is %s and prefix is %s, want Enabled and cache/", r.Status, aws.ToString(r.Filter.Prefix))
+	}
+
+	if aws.ToInt32(r.Expiration.Days) != 14 || r.AbortIncompleteMultipartUpload != nil {
+		t.Errorf("mergeAWSRule expiration is %v and abort is %v", r.Expiration, r.AbortIncompleteMultipartUpload)
+	}
+
+	// verify a new rule is appended
+	got = mergeAWSRule(got, LifecycleRule{ID: "new", AbortIncompleteDays: 1})
+
+	if len(got) != 3 || aws.ToInt32(got[2].AbortIncompleteMultipartUpload.DaysAfterInitiation) != 1 {
+		t.Errorf("mergeAWSRule is %v, want the new rule appended", got)
+	}
+}
+
+func TestStorage_AWS_Remove_NoMD5(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc   string
+		compat Compat
+		md5    bool
+	}{
+		{
+			desc: "default",
+			md5:  true,
+		},
+		{
+			desc:   "no md5",
+			compat: Compat{NoMD5: true},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var header http.Header
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+
+				_, _ = io.Copy(io.Discard, r.Body)
+				_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`)
+			}))
+			defer srv.Close()
+
+			client := s3.New(s3.Options{
+				BaseEndpoint: aws.String(srv.URL),
+				UsePathStyle: true,
+				Region:       "us-east-1",
+				Credentials:  credentials.NewStaticCredentialsProvider("access", "secret", ""),
+			})
+
+			a := NewAWS(client, tC.compat, Encryption{})
+
+			errs := a.Remove(context.Background(), "bucket", []Object{{Key: "foo/bar/archive.tgz"}})
+			if len(errs) > 0 {
+				t.Fatalf("Remove returned errs: %v", errs)
+			}
+
+			if got := len(header.Get("Content-Md5")) > 0; got != tC.md5 {
+				t.Errorf("Content-Md5 sent is %v, want %v", got, tC.md5)
+			}
+
+			if got := len(header.Get(checksumCRC32CHeader)) > 0; got == tC.md5 {
+				t.Errorf("%s sent is %v, want %v", checksumCRC32CHeader, got, !tC.md5)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"encoding/base64"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+)
+
+const (
+	// checksumAlgorithmHeader represents the header starting a multipart
+	// upload with the algorithm of the checksums of its parts.
+	checksumAlgorithmHeader = "X-Amz-Checksum-Algorithm"
+
+	// checksumCRC32CHeader represents the header, or trailer,
+	// holding the CRC32C checksum of the contents of a request.
+	checksumCRC32CHeader = "X-Amz-Checksum-Crc32c"
+)
+
+// castagnoli represents the table of the CRC32C checksum.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumReader is a reader that computes the CRC32C checksum of the
+// bytes read and sets it in the trailer of the request once the reader
+// is drained, so the store verifies the contents without a checksum
+// being known before the request is sent.
+type checksumReader struct {
+	reader  io.Reader
+	hash    hash.Hash32
+	trailer http.Header
+}
+
+// newChecksumReader creates a reader setting the checksum of the contents
+// of the reader in the trailer, holding a placeholder of the same length
+// until the reader is drained as the length of the trailer is signed.
+func newChecksumReader(reader io.Reader) *checksumReader {
+	r := &checksumReader{
+		reader:  reader,
+		hash:    crc32.New(castagnoli),
+		trailer: http.Header{},
+	}
+
+	r.trailer.Set(checksumCRC32CHeader, r.Sum())
+
+	return r
+}
+
+// Read reads from the underlying reader and updates the checksum,
+// setting the final checksum in the trailer at the end of the reader.
+func (r *checksumReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.hash.Write(b[:n])
+
+	if err == io.EOF {
+		r.trailer.Set(checksumCRC32CHeader, r.Sum())
+	}
+
+	return n, err
+}
+
+// Sum returns the base64 encoded checksum of the bytes read.
+func (r *checksumReader) Sum() string {
+	return base64.StdEncoding.EncodeToString(r.hash.Sum(nil))
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/minio/minio-go/v7"
+)
+
+// ResponseError represents an error response from s3 with
+// the identifiers needed to file a support ticket.
+type ResponseError struct {
+	// HTTP status code of the response
+	StatusCode int
+	// s3 error code of the response (i.e. AccessDenied)
+	Code string
+	// value of the x-amz-request-id header
+	RequestID string
+	// value of the x-amz-id-2 header
+	HostID string
+	// underlying error returned by the client
+	Err error
+}
+
+// Error returns the underlying error with the status and identifiers.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%v (status: %d, request id: %s, host id: %s)", e.Err, e.StatusCode, e.RequestID, e.HostID)
+}
+
+// Unwrap returns the underlying error.
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// IsPreconditionFailed returns whether the error is the response to a
+// conditional request refused because the object already exists.
+func IsPreconditionFailed(err error) bool {
+	var resp *ResponseError
+	if !errors.As(err, &resp) {
+		return false
+	}
+
+	// s3 returns a conflict when a concurrent conditional request wins
+	return resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict
+}
+
+// IsNotFound returns whether the error is the
+// response to a request for a missing object.
+func IsNotFound(err error) bool {
+	var resp *ResponseError
+	if !errors.As(err, &resp) {
+		return false
+	}
+
+	return resp.StatusCode == http.StatusNotFound
+}
+
+// errConditionalSize is returned for a conditional upload
+// of an object too large to upload in a single request.
+var errConditionalSize = fmt.Errorf("conditional uploads require a known size below %d bytes", maxConditionalSize)
+
+// wrapMinio is a helper function to wrap an error
+// from the minio client with the response identifiers.
+func wrapMinio(err error) error {
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+
+	resp := minio.ToErrorResponse(err)
+
+	// the error did not come from an s3 response
+	if resp.StatusCode == 0 && len(resp.RequestID) == 0 {
+		return err
+	}
+
+	return &ResponseError{
+		StatusCode: resp.StatusCode,
+		Code:       resp.Code,
+		RequestID:  resp.RequestID,
+		HostID:     resp.HostID,
+		Err:        err,
+	}
+}
+
+// wrapAWS is a helper function to wrap an error from
+// the AWS SDK client with the response identifiers.
+func wrapAWS(err error) error {
+	var resp *awshttp.ResponseError
+
+	// the error did not come from an s3 response
+	if !errors.As(err, &resp) {
+		return err
+	}
+
+	e := &ResponseError{
+		StatusCode: resp.HTTPStatusCode(),
+		RequestID:  resp.ServiceRequestID(),
+		Err:        err,
+	}
+
+	// the s3 response error includes the host id
+	var host interface{ ServiceHostID() string }
+	if errors.As(err, &host) {
+		e.HostID = host.ServiceHostID()
+	}
+
+	// use the api error as the identifiers are already in the message
+	var api smithy.APIError
+	if errors.As(err, &api) {
+		e.Code = api.ErrorCode()
+		e.Err = api
+	}
+
+	return e
+}
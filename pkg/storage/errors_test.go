@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestStorage_wrapMinio(t *testing.T) {
+	// setup types
+	err := wrapMinio(minio.ErrorResponse{
+		Code:       "AccessDenied",
+		Message:    "Access Denied",
+		RequestID:  "123",
+		HostID:     "456",
+		StatusCode: http.StatusForbidden,
+	})
+
+	var rErr *ResponseError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("wrapMinio returned %T, want *ResponseError", err)
+	}
+
+	if rErr.StatusCode != http.StatusForbidden || rErr.Code != "AccessDenied" || rErr.RequestID != "123" || rErr.HostID != "456" {
+		t.Errorf("wrapMinio is %+v", rErr)
+	}
+
+	for _, want := range []string{"Access Denied", "status: 403", "request id: 123", "host id: 456"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error is %s, want it to contain %s", err, want)
+		}
+	}
+}
+
+func TestStorage_wrapMinio_NoResponse(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc string
+		err  error
+	}{
+		{desc: "nil", err: nil},
+		{desc: "eof", err: io.EOF},
+		{desc: "other", err: errors.New("connection refused")},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var rErr *ResponseError
+
+			got := wrapMinio(tC.err)
+			if !errors.Is(got, tC.err) || errors.As(got, &rErr) {
+				t.Errorf("wrapMinio is %v, want %v", got, tC.err)
+			}
+		})
+	}
+}
+
+func TestStorage_wrapAWS(t *testing.T) {
+	// setup types
+	err := wrapAWS(&smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "HeadObject",
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusForbidden}},
+				Err:      &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"},
+			},
+			RequestID: "123",
+		},
+	})
+
+	var rErr *ResponseError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("wrapAWS returned %T, want *ResponseError", err)
+	}
+
+	if rErr.StatusCode != http.StatusForbidden || rErr.Code != "AccessDenied" || rErr.RequestID != "123" {
+		t.Errorf("wrapAWS is %+v", rErr)
+	}
+
+	// verify errors without a response are returned unchanged
+	other := errors.New("connection refused")
+
+	got := wrapAWS(other)
+	if !errors.Is(got, other) || errors.As(got, &rErr) {
+		t.Errorf("wrapAWS is %v, want %v", got, other)
+	}
+}
+
+func TestStorage_IsNotFound(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "not found", err: &ResponseError{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}, want: true},
+		{desc: "forbidden", err: &ResponseError{StatusCode: http.StatusForbidden, Code: "AccessDenied"}},
+		{desc: "other", err: errors.New("connection refused")},
+		{desc: "nil"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got := IsNotFound(tC.err); got != tC.want {
+				t.Errorf("IsNotFound is %t, want %t", got, tC.want)
+			}
+		})
+	}
+}
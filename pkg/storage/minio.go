@@ -0,0 +1,663 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+const (
+	// multipartThreshold represents the size from which objects
+	// are uploaded in parts, matching the minimum part size.
+	multipartThreshold = 16 * 1024 * 1024
+
+	// maxUploadParts represents the maximum number
+	// of parts of a multipart upload in s3.
+	maxUploadParts = 10000
+
+	// maxCopySize represents the size of the largest
+	// object s3 copies with a single request.
+	maxCopySize = 5 * 1024 * 1024 * 1024
+
+	// partRetries represents the number of times a part
+	// is retried before the multipart upload is aborted.
+	partRetries = 3
+
+	// abortUploadTimeout represents the timeout to abort a
+	// failed multipart upload, as the upload context may be done.
+	abortUploadTimeout = 30 * time.Second
+)
+
+// partRetryDelay represents the delay before the first retry of a
+// part, doubled on each retry. It is a variable to be shortened in tests.
+var partRetryDelay = time.Second
+
+// Minio represents a Backend using the minio client.
+type Minio struct {
+	client     *minio.Client
+	core       *minio.Core
+	compat     Compat
+	encryption Encryption
+}
+
+// NewMinio creates a Backend from the minio client, avoiding the parts
+// of the s3 api set in compat and uploading with the encryption.
+func NewMinio(client *minio.Client, compat Compat, encryption Encryption) *Minio {
+	return &Minio{
+		client:     client,
+		core:       &minio.Core{Client: client},
+		compat:     compat,
+		encryption: encryption,
+	}
+}
+
+// sse returns the server-side encryption to upload the objects with.
+func (m *Minio) sse() (encrypt.ServerSide, error) {
+	switch m.encryption.Mode {
+	case "":
+		return nil, nil
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		return encrypt.NewSSEKMS(m.encryption.KMSKeyID, nil)
+	case SSEC:
+		return encrypt.NewSSEC(m.encryption.CustomerKey)
+	}
+
+	return nil, fmt.Errorf("unsupported server-side encryption %s", m.encryption.Mode)
+}
+
+// ssec returns the server-side encryption to read the objects
+// with, which is only sent for SSE-C as s3 rejects the others.
+func (m *Minio) ssec() encrypt.ServerSide {
+	sse, err := m.sse()
+	if err != nil || sse == nil || sse.Type() != encrypt.SSEC {
+		return nil
+	}
+
+	return sse
+}
+
+// Put uploads the contents of the reader to the key in the bucket.
+// Objects of unknown size or from the multipart threshold are
+// uploaded with the low-level multipart API.
+func (m *Minio) Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (Object, error) {
+	pOpts := minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.UserMetadata,
+		UserTags:     opts.UserTags,
+		Expires:      opts.Expires,
+		Progress:     opts.Progress,
+	}
+
+	if m.compat.NoTags {
+		pOpts.UserTags = nil
+	}
+
+	sse, err := m.sse()
+	if err != nil {
+		return Object{}, err
+	}
+
+	pOpts.ServerSideEncryption = sse
+
+	// buckets with object lock require the md5 of the contents
+	if len(opts.RetentionMode) > 0 {
+		pOpts.Mode = minio.RetentionMode(opts.RetentionMode)
+		pOpts.RetainUntilDate = opts.RetainUntil
+		pOpts.SendContentMd5 = true
+	}
+
+	if opts.LegalHold {
+		pOpts.LegalHold = minio.LegalHoldEnabled
+		pOpts.SendContentMd5 = true
+	}
+
+	// only create the object when the key is free
+	if opts.IfNoneMatch {
+		if size < 0 || size >= maxConditionalSize {
+			return Object{}, errConditionalSize
+		}
+
+		pOpts.SetMatchETagExcept("*")
+	}
+
+	if size < 0 || size >= multipartThreshold {
+		return m.putMultipart(ctx, bucket, key, reader, size, pOpts)
+	}
+
+	info, err := m.client.PutObject(ctx, bucket, key, reader, size, pOpts)
+	if err != nil {
+		return Object{}, wrapMinio(err)
+	}
+
+	return Object{
+		Key:          info.Key,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		ETag:         info.ETag,
+		VersionID:    info.VersionID,
+	}, nil
+}
+
+// putMultipart uploads the contents of the reader to the key in the bucket
+// one part at a time. A part that fails is retried on its own, resuming the
+// upload from that part rather than restarting it, and an upload that still
+// fails is aborted by its id so its parts are not left in the bucket. The
+// parts of a reader of unknown size are sent with trailing checksums.
+func (m *Minio) putMultipart(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts minio.PutObjectOptions) (obj Object, err error) {
+	// bound the buffered parts of a reader of unknown size
+	configured := uint64(0)
+	if size < 0 {
+		configured = multipartThreshold
+	}
+
+	_, partSize, _, err := minio.OptimalPartInfo(size, configured)
+	if err != nil {
+		return Object{}, err
+	}
+
+	progress := opts.Progress
+	opts.Progress = nil
+
+	// have the store verify the checksum of every part of a stream
+	checksum := size < 0 && !m.compat.NoChecksums
+	if checksum {
+		opts.UserMetadata = maps.Clone(opts.UserMetadata)
+		if opts.UserMetadata == nil {
+			opts.UserMetadata = map[string]string{}
+		}
+
+		opts.UserMetadata[checksumAlgorithmHeader] = "CRC32C"
+	}
+
+	uploadID, err := m.core.NewMultipartUpload(ctx, bucket, key, opts)
+	if err != nil {
+		return Object{}, fmt.Errorf("unable to start multipart upload: %w", wrapMinio(err))
+	}
+
+	defer func() {
+		if err != nil {
+			m.abortUpload(ctx, bucket, Upload{Key: key, UploadID: uploadID})
+		}
+	}()
+
+	buf := make([]byte, partSize)
+	parts := []minio.CompletePart{}
+	total := int64(0)
+
+	for number := 1; ; number++ {
+		n, rErr := io.ReadFull(reader, buf)
+
+		// an empty reader still needs a part
+		if errors.Is(rErr, io.EOF) && number > 1 {
+			break
+		}
+
+		if rErr != nil && !errors.Is(rErr, io.EOF) && !errors.Is(rErr, io.ErrUnexpectedEOF) {
+			return Object{}, rErr
+		}
+
+		if number > maxUploadParts {
+			return Object{}, fmt.Errorf("object exceeds the limit of %d parts of %d bytes", maxUploadParts, partSize)
+		}
+
+		part, err := m.putPart(ctx, bucket, key, uploadID, number, buf[:n], checksum)
+		if err != nil {
+			return Object{}, err
+		}
+
+		parts = append(parts, minio.CompletePart{PartNumber: number, ETag: part.ETag, ChecksumCRC32C: part.ChecksumCRC32C})
+		total += int64(n)
+
+		// report the progress once the part is uploaded
+		if progress != nil {
+			_, _ = progress.Read(buf[:n])
+		}
+
+		// a short read is the last part
+		if rErr != nil {
+			break
+		}
+	}
+
+	info, err := m.core.CompleteMultipartUpload(ctx, bucket, key, uploadID, parts, minio.PutObjectOptions{ServerSideEncryption: opts.ServerSideEncryption})
+	if err != nil {
+		return Object{}, fmt.Errorf("unable to complete multipart upload: %w", wrapMinio(err))
+	}
+
+	return Object{
+		Key:          key,
+		Size:         total,
+		LastModified: info.LastModified,
+		ETag:         info.ETag,
+		VersionID:    info.VersionID,
+	}, nil
+}
+
+// putPart uploads the data as the part with the number of the
+// multipart upload, retrying the part with an increasing delay.
+// With checksum, the CRC32C checksum of the part is sent as a trailer.
+func (m *Minio) putPart(ctx context.Context, bucket, key, uploadID string, number int, data []byte, checksum bool) (minio.ObjectPart, error) {
+	sum := md5.Sum(data)
+	delay := partRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		var body io.Reader = bytes.NewReader(data)
+
+		pOpts := minio.PutObjectPartOptions{Md5Base64: base64.StdEncoding.EncodeToString(sum[:]), SSE: m.ssec()}
+
+		// checksum the bytes sent by each attempt
+		var cr *checksumReader
+		if checksum {
+			cr = newChecksumReader(body)
+			body = cr
+			pOpts.Trailer = cr.trailer
+		}
+
+		part, err := m.core.PutObjectPart(ctx, bucket, key, uploadID, number, body, int64(len(data)), pOpts)
+		if err == nil {
+			// complete the upload with the checksum verified by the store
+			if cr != nil {
+				part.ChecksumCRC32C = cr.Sum()
+			}
+
+			return part, nil
+		}
+
+		if attempt >= partRetries || ctx.Err() != nil {
+			return minio.ObjectPart{}, fmt.Errorf("unable to upload part %d: %w", number, wrapMinio(err))
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return minio.ObjectPart{}, fmt.Errorf("unable to upload part %d: %w", number, ctx.Err())
+		}
+
+		delay *= 2
+	}
+}
+
+// abortUpload aborts the failed multipart upload with a new
+// context, as the context of the upload may be done.
+func (m *Minio) abortUpload(ctx context.Context, bucket string, upload Upload) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortUploadTimeout)
+	defer cancel()
+
+	_ = m.AbortUpload(ctx, bucket, upload)
+}
+
+// Copy copies the source key to the destination key in the bucket on the
+// server, replacing the metadata, tags and retention with the options.
+// Sources too large for a single copy request are copied in parts.
+func (m *Minio) Copy(ctx context.Context, bucket, src, dst string, opts PutOptions) (Object, error) {
+	meta := maps.Clone(opts.UserMetadata)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+
+	// the headers of the object are replaced along with the metadata
+	if len(opts.ContentType) > 0 {
+		meta["Content-Type"] = opts.ContentType
+	}
+
+	if !opts.Expires.IsZero() {
+		meta["Expires"] = opts.Expires.UTC().Format(http.TimeFormat)
+	}
+
+	dOpts := minio.CopyDestOptions{
+		Bucket:          bucket,
+		Object:          dst,
+		UserMetadata:    meta,
+		ReplaceMetadata: true,
+		UserTags:        opts.UserTags,
+		ReplaceTags:     !m.compat.NoTags,
+	}
+
+	if len(opts.RetentionMode) > 0 {
+		dOpts.Mode = minio.RetentionMode(opts.RetentionMode)
+		dOpts.RetainUntilDate = opts.RetainUntil
+	}
+
+	if opts.LegalHold {
+		dOpts.LegalHold = minio.LegalHoldEnabled
+	}
+
+	sse, err := m.sse()
+	if err != nil {
+		return Object{}, err
+	}
+
+	dOpts.Encryption = sse
+
+	stat, err := m.client.StatObject(ctx, bucket, src, minio.StatObjectOptions{ServerSideEncryption: m.ssec()})
+	if err != nil {
+		return Object{}, wrapMinio(err)
+	}
+
+	// only copy the source the size was read from
+	sOpts := minio.CopySrcOptions{Bucket: bucket, Object: src, MatchETag: stat.ETag, Encryption: m.ssec()}
+
+	var info minio.UploadInfo
+
+	if stat.Size > maxCopySize {
+		info, err = m.client.ComposeObject(ctx, dOpts, sOpts)
+	} else {
+		info, err = m.client.CopyObject(ctx, dOpts, sOpts)
+	}
+
+	if err != nil {
+		return Object{}, wrapMinio(err)
+	}
+
+	return Object{
+		Key:          dst,
+		Size:         stat.Size,
+		LastModified: info.LastModified,
+		ETag:         info.ETag,
+		VersionID:    info.VersionID,
+	}, nil
+}
+
+// Get retrieves the contents of the key in the bucket.
+func (m *Minio) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	obj, err := m.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{ServerSideEncryption: m.ssec()})
+	if err != nil {
+		return nil, wrapMinio(err)
+	}
+
+	return &minioObject{obj}, nil
+}
+
+// GetRange retrieves a range of the contents of the key in the bucket.
+func (m *Minio) GetRange(ctx context.Context, bucket, key string, opts RangeOptions) (io.ReadCloser, error) {
+	o := minio.GetObjectOptions{ServerSideEncryption: m.ssec()}
+
+	err := o.SetRange(opts.Offset, opts.Offset+opts.Length-1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.ETag) > 0 {
+		err = o.SetMatchETag(opts.ETag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	obj, err := m.client.GetObject(ctx, bucket, key, o)
+	if err != nil {
+		return nil, wrapMinio(err)
+	}
+
+	return &minioObject{obj}, nil
+}
+
+// Stat retrieves the information and metadata for the key in the bucket.
+func (m *Minio) Stat(ctx context.Context, bucket, key string) (Object, error) {
+	info, err := m.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{ServerSideEncryption: m.ssec()})
+	if err != nil {
+		return Object{}, wrapMinio(err)
+	}
+
+	return fromMinio(info), nil
+}
+
+// List retrieves the objects in the bucket matching the options.
+func (m *Minio) List(ctx context.Context, bucket string, opts ListOptions) ([]Object, error) {
+	objects := []Object{}
+
+	for info := range m.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:       opts.Prefix,
+		Recursive:    opts.Recursive,
+		WithVersions: opts.WithVersions,
+		MaxKeys:      opts.MaxKeys,
+		StartAfter:   opts.StartAfter,
+		UseV1:        m.compat.ListV1,
+	}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("unable to retrieve object %s: %w", info.Key, wrapMinio(info.Err))
+		}
+
+		objects = append(objects, fromMinio(info))
+	}
+
+	return objects, nil
+}
+
+// GetTags retrieves the tags of the key in the bucket.
+func (m *Minio) GetTags(ctx context.Context, bucket, key string) (map[string]string, error) {
+	if m.compat.NoTags {
+		return map[string]string{}, nil
+	}
+
+	t, err := m.client.GetObjectTagging(ctx, bucket, key, minio.GetObjectTaggingOptions{})
+	if err != nil {
+		return nil, wrapMinio(err)
+	}
+
+	return t.ToMap(), nil
+}
+
+// SetTags replaces the tags of the key in the bucket.
+func (m *Minio) SetTags(ctx context.Context, bucket, key string, userTags map[string]string) error {
+	if m.compat.NoTags {
+		return fmt.Errorf("object tagging is not supported by the provider")
+	}
+
+	t, err := tags.MapToObjectTags(userTags)
+	if err != nil {
+		return err
+	}
+
+	return wrapMinio(m.client.PutObjectTagging(ctx, bucket, key, t, minio.PutObjectTaggingOptions{}))
+}
+
+// Remove deletes the objects from the bucket, returning
+// an error for every object that could not be removed.
+func (m *Minio) Remove(ctx context.Context, bucket string, objects []Object) []RemoveError {
+	if m.compat.SingleDelete {
+		return m.removeEach(ctx, bucket, objects)
+	}
+
+	objectsCh := make(chan minio.ObjectInfo)
+
+	// index the objects to report the failures against
+	index := make(map[[2]string]Object, len(objects))
+
+	go func() {
+		defer close(objectsCh)
+
+		for _, object := range objects {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: object.Key, VersionID: object.VersionID}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for _, object := range objects {
+		index[[2]string{object.Key, object.VersionID}] = object
+	}
+
+	errs := []RemoveError{}
+
+	for rErr := range m.client.RemoveObjects(ctx, bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		object, ok := index[[2]string{rErr.ObjectName, rErr.VersionID}]
+		if !ok {
+			object = Object{Key: rErr.ObjectName, VersionID: rErr.VersionID}
+		}
+
+		errs = append(errs, RemoveError{Object: object, Err: wrapMinio(rErr.Err)})
+	}
+
+	return errs
+}
+
+// removeEach deletes the objects from the bucket one at a
+// time, for stores without the multi-object delete api.
+func (m *Minio) removeEach(ctx context.Context, bucket string, objects []Object) []RemoveError {
+	errs := []RemoveError{}
+
+	for _, object := range objects {
+		err := m.client.RemoveObject(ctx, bucket, object.Key, minio.RemoveObjectOptions{VersionID: object.VersionID})
+		if err != nil {
+			errs = append(errs, RemoveError{Object: object, Err: wrapMinio(err)})
+		}
+	}
+
+	return errs
+}
+
+// Abort removes the parts of any incomplete uploads for the key in the bucket.
+func (m *Minio) Abort(ctx context.Context, bucket, key string) error {
+	return wrapMinio(m.client.RemoveIncompleteUpload(ctx, bucket, key))
+}
+
+// ListUploads retrieves the incomplete multipart uploads
+// in the bucket for the keys beginning with the prefix.
+func (m *Minio) ListUploads(ctx context.Context, bucket, prefix string) ([]Upload, error) {
+	uploads := []Upload{}
+
+	keyMarker, uploadIDMarker := "", ""
+
+	for {
+		result, err := m.core.ListMultipartUploads(ctx, bucket, prefix, keyMarker, uploadIDMarker, "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list incomplete uploads %s: %w", prefix, wrapMinio(err))
+		}
+
+		for _, upload := range result.Uploads {
+			uploads = append(uploads, Upload{Key: upload.Key, UploadID: upload.UploadID, Initiated: upload.Initiated})
+		}
+
+		if !result.IsTruncated {
+			return uploads, nil
+		}
+
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// AbortUpload removes the parts of the incomplete upload in the bucket.
+func (m *Minio) AbortUpload(ctx context.Context, bucket string, upload Upload) error {
+	return wrapMinio(m.core.AbortMultipartUpload(ctx, bucket, upload.Key, upload.UploadID))
+}
+
+// Presign creates a URL granting the method, GET or PUT, on
+// the key in the bucket without credentials until the expiry.
+func (m *Minio) Presign(ctx context.Context, bucket, key, method string, expiry time.Duration) (string, error) {
+	var (
+		u   *url.URL
+		err error
+	)
+
+	switch method {
+	case http.MethodGet:
+		u, err = m.client.PresignedGetObject(ctx, bucket, key, expiry, nil)
+	case http.MethodPut:
+		u, err = m.client.PresignedPutObject(ctx, bucket, key, expiry)
+	default:
+		return "", fmt.Errorf("unsupported presign method %s", method)
+	}
+
+	if err != nil {
+		return "", wrapMinio(err)
+	}
+
+	return u.String(), nil
+}
+
+// SetLifecycle creates or replaces the rule with the same id in the
+// lifecycle configuration of the bucket, keeping any other rules.
+func (m *Minio) SetLifecycle(ctx context.Context, bucket string, rule LifecycleRule) error {
+	cfg, err := m.client.GetBucketLifecycle(ctx, bucket)
+	if err != nil {
+		// a bucket without any rules has no configuration
+		if minio.ToErrorResponse(err).Code != noLifecycleCode {
+			return fmt.Errorf("unable to retrieve lifecycle configuration: %w", wrapMinio(err))
+		}
+
+		cfg = lifecycle.NewConfiguration()
+	}
+
+	err = m.client.SetBucketLifecycle(ctx, bucket, mergeMinioRule(cfg, rule))
+	if err != nil {
+		return fmt.Errorf("unable to set lifecycle configuration: %w", wrapMinio(err))
+	}
+
+	return nil
+}
+
+// mergeMinioRule is a helper function to replace the rule with
+// the same id in the lifecycle configuration or append the rule.
+func mergeMinioRule(cfg *lifecycle.Configuration, rule LifecycleRule) *lifecycle.Configuration {
+	r := lifecycle.Rule{
+		ID:         rule.ID,
+		Status:     "Enabled",
+		RuleFilter: lifecycle.Filter{Prefix: rule.Prefix},
+		Expiration: lifecycle.Expiration{
+			Days: lifecycle.ExpirationDays(rule.ExpireDays),
+		},
+		AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: lifecycle.ExpirationDays(rule.AbortIncompleteDays),
+		},
+	}
+
+	for i := range cfg.Rules {
+		if cfg.Rules[i].ID == rule.ID {
+			cfg.Rules[i] = r
+
+			return cfg
+		}
+	}
+
+	cfg.Rules = append(cfg.Rules, r)
+
+	return cfg
+}
+
+// minioObject is an object from the minio client that
+// wraps the errors of the requests made while reading.
+type minioObject struct {
+	*minio.Object
+}
+
+// Read reads from the object, wrapping any error from s3.
+func (o *minioObject) Read(b []byte) (int, error) {
+	n, err := o.Object.Read(b)
+
+	return n, wrapMinio(err)
+}
+
+// fromMinio is a helper function to convert
+// the minio object information to an Object.
+func fromMinio(info minio.ObjectInfo) Object {
+	return Object{
+		Key:            info.Key,
+		Size:           info.Size,
+		LastModified:   info.LastModified,
+		ETag:           info.ETag,
+		VersionID:      info.VersionID,
+		IsLatest:       info.IsLatest,
+		IsDeleteMarker: info.IsDeleteMarker,
+		UserMetadata:   info.UserMetadata,
+	}
+}
@@ -0,0 +1,525 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+func TestStorage_fromMinio(t *testing.T) {
+	// setup types
+	now := time.Now()
+
+	info := minio.ObjectInfo{
+		Key:            "foo/bar/archive.tgz",
+		Size:           1024,
+		LastModified:   now,
+		ETag:           "abc123",
+		VersionID:      "v1",
+		IsLatest:       true,
+		IsDeleteMarker: false,
+		UserMetadata:   map[string]string{"Vela-Cache-Build-Number": "1"},
+	}
+
+	want := Object{
+		Key:          "foo/bar/archive.tgz",
+		Size:         1024,
+		LastModified: now,
+		ETag:         "abc123",
+		VersionID:    "v1",
+		IsLatest:     true,
+		UserMetadata: map[string]string{"Vela-Cache-Build-Number": "1"},
+	}
+
+	got := fromMinio(info)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fromMinio is %v, want %v", got, want)
+	}
+}
+
+func TestStorage_mergeMinioRule(t *testing.T) {
+	// setup types
+	cfg := lifecycle.NewConfiguration()
+	cfg.Rules = []lifecycle.Rule{
+		{ID: "other", Status: "Enabled"},
+		{ID: "vela-s3-cache", Status: "Disabled"},
+	}
+
+	got := mergeMinioRule(cfg, LifecycleRule{ID: "vela-s3-cache", Prefix: "cache/", ExpireDays: 14, AbortIncompleteDays: 1})
+
+	want := []lifecycle.Rule{
+		{ID: "other", Status: "Enabled"},
+		{
+			ID:         "vela-s3-cache",
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: "cache/"},
+			Expiration: lifecycle.Expiration{Days: 14},
+			AbortIncompleteMultipartUpload: lifecycle.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: 1,
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got.Rules, want) {
+		t.Errorf("mergeMinioRule is %v, want %v", got.Rules, want)
+	}
+
+	// verify a new rule is appended
+	got = mergeMinioRule(got, LifecycleRule{ID: "new"})
+
+	if len(got.Rules) != 3 || got.Rules[2].ID != "new" {
+		t.Errorf("mergeMinioRule is %v, want the new rule appended", got.Rules)
+	}
+}
+
+// fakeMultipartServer is a minimal s3 server for multipart uploads,
+// failing the uploads of the parts with the numbers in fail.
+type fakeMultipartServer struct {
+	mu        sync.Mutex
+	fail      map[string]int
+	parts     map[string][]byte
+	checksums map[string]string
+	algorithm string
+	objects   map[string][]byte
+	aborted   []string
+	copied    http.Header
+	put       http.Header
+	tagging   map[string][]byte
+}
+
+func (s *fakeMultipartServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodHead:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", `"source"`)
+		w.Header().Set("Last-Modified", "Tue, 02 Jan 2024 03:04:05 GMT")
+	case r.Method == http.MethodPut && len(r.Header.Get("X-Amz-Copy-Source")) > 0:
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+
+		s.objects[r.URL.Path] = s.objects["/"+strings.TrimPrefix(src, "/")]
+		s.copied = r.Header.Clone()
+
+		w.Header().Set("ETag", `"copy"`)
+
+		fmt.Fprint(w, `<CopyObjectResult><ETag>"copy"</ETag><LastModified>2024-01-02T03:04:05.000Z</LastModified></CopyObjectResult>`)
+	case r.Method == http.MethodPut && q.Has("tagging"):
+		s.tagging[r.URL.Path], _ = io.ReadAll(r.Body)
+	case r.Method == http.MethodGet && q.Has("tagging"):
+		body, ok := s.tagging[r.URL.Path]
+		if !ok {
+			body = []byte(`<Tagging><TagSet></TagSet></Tagging>`)
+		}
+
+		w.Write(body)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.algorithm = r.Header.Get(checksumAlgorithmHeader)
+
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		number := q.Get("partNumber")
+
+		if s.fail[number] > 0 {
+			s.fail[number]--
+
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Error><Code>BadDigest</Code><Message>failed</Message></Error>`)
+
+			return
+		}
+
+		body, trailer := readChunked(r)
+
+		s.parts[number] = body
+
+		if sum := trailer.Get(checksumCRC32CHeader); len(sum) > 0 {
+			s.checksums[number] = sum
+		}
+
+		w.Header().Set("ETag", `"etag-`+number+`"`)
+	case r.Method == http.MethodPut:
+		// refuse to replace an object with a conditional upload
+		if _, ok := s.objects[r.URL.Path]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+
+			return
+		}
+
+		s.objects[r.URL.Path], _ = readChunked(r)
+		s.put = r.Header.Clone()
+
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		data := []byte{}
+		for i := 1; i <= len(s.parts); i++ {
+			data = append(data, s.parts[strconv.Itoa(i)]...)
+		}
+
+		s.objects[r.URL.Path] = data
+
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		s.aborted = append(s.aborted, q.Get("uploadId"))
+
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && q.Has("uploads"):
+		fmt.Fprint(w, `<ListMultipartUploadsResult><IsTruncated>false</IsTruncated>`+
+			`<Upload><Key>foo/archive.tgz</Key><UploadId>upload-1</UploadId><Initiated>2024-01-02T03:04:05.000Z</Initiated></Upload>`+
+			`</ListMultipartUploadsResult>`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readChunked is a helper function to read the body and trailer
+// of the request, decoding the aws-chunked encoding.
+func readChunked(r *http.Request) ([]byte, http.Header) {
+	trailer := http.Header{}
+
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body, _ := io.ReadAll(r.Body)
+
+		return body, trailer
+	}
+
+	body := []byte{}
+	br := bufio.NewReader(r.Body)
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return body, trailer
+		}
+
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+		if err != nil {
+			return body, trailer
+		}
+
+		// the trailer follows the last chunk
+		if size == 0 {
+			for {
+				line, err := br.ReadString('\n')
+
+				if k, v, ok := strings.Cut(strings.TrimSpace(line), ":"); ok {
+					trailer.Set(k, v)
+				}
+
+				if err != nil {
+					return body, trailer
+				}
+			}
+		}
+
+		chunk := make([]byte, size+2)
+
+		_, err = io.ReadFull(br, chunk)
+		if err != nil {
+			return body, trailer
+		}
+
+		body = append(body, chunk[:size]...)
+	}
+}
+
+// newFakeMinio is a helper function to create a Backend using the server.
+func newFakeMinio(t *testing.T, s *fakeMultipartServer) *Minio {
+	t.Helper()
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client, err := minio.New(strings.TrimPrefix(srv.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewMinio(client, Compat{}, Encryption{})
+}
+
+func TestStorage_Minio_Put_Multipart(t *testing.T) {
+	// setup types
+	partRetryDelay = time.Millisecond
+
+	t.Cleanup(func() { partRetryDelay = time.Second })
+
+	testCases := []struct {
+		desc    string
+		fail    int
+		wantErr bool
+	}{
+		{desc: "retried part", fail: partRetries},
+		{desc: "failed part", fail: partRetries + 1, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := &fakeMultipartServer{
+				fail:      map[string]int{"2": tC.fail},
+				parts:     map[string][]byte{},
+				checksums: map[string]string{},
+				objects:   map[string][]byte{},
+			}
+
+			data := bytes.Repeat([]byte("a"), multipartThreshold+1)
+			progress := new(progressCounter)
+
+			obj, err := newFakeMinio(t, s).Put(context.Background(), "bucket", "foo/archive.tgz",
+				bytes.NewReader(data), int64(len(data)), PutOptions{Progress: progress})
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("Put returned err: %v, wantErr %v", err, tC.wantErr)
+			}
+
+			if tC.wantErr {
+				if !reflect.DeepEqual(s.aborted, []string{"upload-1"}) {
+					t.Errorf("aborted uploads are %v, want [upload-1]", s.aborted)
+				}
+
+				return
+			}
+
+			if obj.Size != int64(len(data)) || progress.n != len(data) {
+				t.Errorf("size is %d and progress is %d, want %d", obj.Size, progress.n, len(data))
+			}
+
+			if len(s.parts) != 2 || !bytes.Equal(s.objects["/bucket/foo/archive.tgz"], data) {
+				t.Errorf("object of %d parts does not match the data", len(s.parts))
+			}
+		})
+	}
+}
+
+func TestStorage_Minio_Put_TrailingChecksum(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc   string
+		compat Compat
+		want   bool
+	}{
+		{desc: "checksum", want: true},
+		{desc: "no checksums", compat: Compat{NoChecksums: true}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := &fakeMultipartServer{
+				parts:     map[string][]byte{},
+				checksums: map[string]string{},
+				objects:   map[string][]byte{},
+			}
+
+			m := newFakeMinio(t, s)
+			m.compat = tC.compat
+
+			data := bytes.Repeat([]byte("a"), multipartThreshold+1)
+
+			// hide the size of the reader like a stream
+			_, err := m.Put(context.Background(), "bucket", "foo/archive.tgz",
+				io.MultiReader(bytes.NewReader(data)), -1, PutOptions{})
+			if err != nil {
+				t.Fatalf("Put returned err: %v", err)
+			}
+
+			if !bytes.Equal(s.objects["/bucket/foo/archive.tgz"], data) {
+				t.Errorf("object of %d parts does not match the data", len(s.parts))
+			}
+
+			if got := s.algorithm == "CRC32C"; got != tC.want {
+				t.Errorf("checksum algorithm is %q, want CRC32C %v", s.algorithm, tC.want)
+			}
+
+			if !tC.want {
+				if len(s.checksums) > 0 {
+					t.Errorf("checksums are %v, want none", s.checksums)
+				}
+
+				return
+			}
+
+			for number, part := range s.parts {
+				cr := newChecksumReader(bytes.NewReader(part))
+
+				_, _ = io.Copy(io.Discard, cr)
+
+				if s.checksums[number] != cr.Sum() {
+					t.Errorf("checksum of part %s is %q, want %q", number, s.checksums[number], cr.Sum())
+				}
+			}
+		})
+	}
+}
+
+func TestStorage_Minio_ListUploads(t *testing.T) {
+	// setup types
+	m := newFakeMinio(t, &fakeMultipartServer{})
+
+	got, err := m.ListUploads(context.Background(), "bucket", "foo/")
+	if err != nil {
+		t.Fatalf("ListUploads returned err: %v", err)
+	}
+
+	want := []Upload{{Key: "foo/archive.tgz", UploadID: "upload-1", Initiated: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListUploads is %v, want %v", got, want)
+	}
+}
+
+func TestStorage_Minio_Copy(t *testing.T) {
+	// setup types
+	data := []byte("archive")
+
+	s := &fakeMultipartServer{
+		objects: map[string][]byte{"/bucket/foo/archive.tgz.tmp.1": data},
+	}
+
+	obj, err := newFakeMinio(t, s).Copy(context.Background(), "bucket", "foo/archive.tgz.tmp.1", "foo/archive.tgz", PutOptions{
+		ContentType:  "application/tar",
+		UserMetadata: map[string]string{"Vela-Cache-Sha256": "abc123"},
+		UserTags:     map[string]string{"ttl": "72h"},
+	})
+	if err != nil {
+		t.Fatalf("Copy returned err: %v", err)
+	}
+
+	if obj.Key != "foo/archive.tgz" || obj.ETag != "copy" {
+		t.Errorf("Copy is %v, want the copied object", obj)
+	}
+
+	if !bytes.Equal(s.objects["/bucket/foo/archive.tgz"], data) {
+		t.Errorf("copied object is %q, want %q", s.objects["/bucket/foo/archive.tgz"], data)
+	}
+
+	// verify the metadata and tags are replaced with the options
+	want := map[string]string{
+		"X-Amz-Metadata-Directive":     "REPLACE",
+		"X-Amz-Meta-Vela-Cache-Sha256": "abc123",
+		"Content-Type":                 "application/tar",
+		"X-Amz-Tagging-Directive":      "REPLACE",
+		"X-Amz-Tagging":                "ttl=72h",
+	}
+
+	for k, v := range want {
+		if got := s.copied.Get(k); got != v {
+			t.Errorf("copy header %s is %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestStorage_Minio_Put_IfNoneMatch(t *testing.T) {
+	// setup types
+	s := &fakeMultipartServer{
+		objects: map[string][]byte{},
+	}
+
+	m := newFakeMinio(t, s)
+
+	_, err := m.Put(context.Background(), "bucket", "foo/archive.tgz.lock", strings.NewReader("first"), 5, PutOptions{IfNoneMatch: true})
+	if err != nil {
+		t.Fatalf("Put returned err: %v", err)
+	}
+
+	// verify the existing object is not replaced
+	_, err = m.Put(context.Background(), "bucket", "foo/archive.tgz.lock", strings.NewReader("second"), 6, PutOptions{IfNoneMatch: true})
+	if !IsPreconditionFailed(err) {
+		t.Errorf("Put returned err: %v, want precondition failed", err)
+	}
+
+	if got := string(s.objects["/bucket/foo/archive.tgz.lock"]); got != "first" {
+		t.Errorf("object is %q, want %q", got, "first")
+	}
+
+	// verify the condition is refused for a stream
+	_, err = m.Put(context.Background(), "bucket", "foo/archive.tgz", strings.NewReader("stream"), -1, PutOptions{IfNoneMatch: true})
+	if err == nil {
+		t.Errorf("Put should have returned err")
+	}
+}
+
+func TestStorage_Minio_Tags(t *testing.T) {
+	// setup types
+	s := &fakeMultipartServer{
+		tagging: map[string][]byte{},
+	}
+
+	m := newFakeMinio(t, s)
+
+	got, err := m.GetTags(context.Background(), "bucket", "foo/archive.tgz")
+	if err != nil {
+		t.Fatalf("GetTags returned err: %v", err)
+	}
+
+	if len(got) != 0 {
+		t.Errorf("GetTags is %v, want no tags", got)
+	}
+
+	want := map[string]string{"vela-cache-pin": "true", "vela-cache-ttl": "24h0m0s"}
+
+	err = m.SetTags(context.Background(), "bucket", "foo/archive.tgz", want)
+	if err != nil {
+		t.Fatalf("SetTags returned err: %v", err)
+	}
+
+	got, err = m.GetTags(context.Background(), "bucket", "foo/archive.tgz")
+	if err != nil {
+		t.Fatalf("GetTags returned err: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTags is %v, want %v", got, want)
+	}
+}
+
+func TestStorage_Minio_Put_Encryption(t *testing.T) {
+	// setup types
+	s := &fakeMultipartServer{
+		objects: map[string][]byte{},
+	}
+
+	m := newFakeMinio(t, s)
+	m.encryption = Encryption{Mode: SSEKMS, KMSKeyID: "alias/cache"}
+
+	_, err := m.Put(context.Background(), "bucket", "foo/archive.tgz", strings.NewReader("hello"), 5, PutOptions{})
+	if err != nil {
+		t.Fatalf("Put returned err: %v", err)
+	}
+
+	if got := s.put.Get("X-Amz-Server-Side-Encryption"); got != "aws:kms" {
+		t.Errorf("server-side encryption is %q, want %q", got, "aws:kms")
+	}
+
+	if got := s.put.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"); got != "alias/cache" {
+		t.Errorf("kms key id is %q, want %q", got, "alias/cache")
+	}
+}
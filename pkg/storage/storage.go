@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: Apache-2.0
+
+// Package storage provides the object storage backends
+// used by the plugin to store and retrieve cache objects.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Backend represents the interface for an object
+// store capable of holding cache objects.
+type Backend interface {
+	// Put uploads the contents of the reader to the key in the bucket.
+	// A size of -1 indicates the size of the reader is unknown.
+	Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, opts PutOptions) (Object, error)
+	// Copy copies the source key to the destination key in the bucket on the
+	// server, replacing the metadata, tags and retention with the options.
+	Copy(ctx context.Context, bucket, src, dst string, opts PutOptions) (Object, error)
+	// Get retrieves the contents of the key in the bucket.
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	// GetRange retrieves a range of the contents of the key in the bucket.
+	GetRange(ctx context.Context, bucket, key string, opts RangeOptions) (io.ReadCloser, error)
+	// Stat retrieves the information and metadata for the key in the bucket.
+	Stat(ctx context.Context, bucket, key string) (Object, error)
+	// List retrieves the objects in the bucket matching the options.
+	List(ctx context.Context, bucket string, opts ListOptions) ([]Object, error)
+	// GetTags retrieves the tags of the key in the bucket.
+	GetTags(ctx context.Context, bucket, key string) (map[string]string, error)
+	// SetTags replaces the tags of the key in the bucket.
+	SetTags(ctx context.Context, bucket, key string, tags map[string]string) error
+	// Remove deletes the objects from the bucket, returning
+	// an error for every object that could not be removed.
+	Remove(ctx context.Context, bucket string, objects []Object) []RemoveError
+	// Abort removes the parts of any incomplete uploads for the key in the bucket.
+	Abort(ctx context.Context, bucket, key string) error
+	// ListUploads retrieves the incomplete multipart uploads
+	// in the bucket for the keys beginning with the prefix.
+	ListUploads(ctx context.Context, bucket, prefix string) ([]Upload, error)
+	// AbortUpload removes the parts of the incomplete upload in the bucket.
+	AbortUpload(ctx context.Context, bucket string, upload Upload) error
+	// SetLifecycle creates or replaces the rule with the same id in the
+	// lifecycle configuration of the bucket, keeping any other rules.
+	SetLifecycle(ctx context.Context, bucket string, rule LifecycleRule) error
+	// Presign creates a URL granting the method, GET or PUT, on
+	// the key in the bucket without credentials until the expiry.
+	Presign(ctx context.Context, bucket, key, method string, expiry time.Duration) (string, error)
+}
+
+// Object represents the information for an object in a bucket.
+type Object struct {
+	// the key of the object, ending in a slash for a common
+	// prefix returned by a non-recursive listing
+	Key string
+	// the size of the object in bytes
+	Size int64
+	// the time the object was last modified
+	LastModified time.Time
+	// the entity tag of the object
+	ETag string
+	// the version of the object in a versioned bucket
+	VersionID string
+	// whether this is the latest version of the object
+	IsLatest bool
+	// whether this version of the object is a delete marker
+	IsDeleteMarker bool
+	// the user metadata stored with the object
+	UserMetadata map[string]string
+}
+
+// Upload represents an incomplete multipart upload in a bucket.
+type Upload struct {
+	// the key of the object being uploaded
+	Key string
+	// the id of the multipart upload
+	UploadID string
+	// the time the upload was initiated
+	Initiated time.Time
+}
+
+// PutOptions represents the options for uploading an object.
+type PutOptions struct {
+	// the content type of the object
+	ContentType string
+	// the user metadata to store with the object
+	UserMetadata map[string]string
+	// the tags to set on the object
+	UserTags map[string]string
+	// the value of the Expires header for the object
+	Expires time.Time
+	// the object lock retention mode of the object, GOVERNANCE or COMPLIANCE
+	RetentionMode string
+	// the time until which the object lock retains the object
+	RetainUntil time.Time
+	// whether to place an object lock legal hold on the object
+	LegalHold bool
+	// whether to only create the object when no object exists at the
+	// key, which requires a known size below maxConditionalSize
+	IfNoneMatch bool
+	// a reader receiving the bytes uploaded to report progress
+	Progress io.Reader
+}
+
+// RangeOptions represents the options for retrieving a range of an object.
+type RangeOptions struct {
+	// the offset of the first byte to retrieve
+	Offset int64
+	// the number of bytes to retrieve
+	Length int64
+	// only retrieve the range while the object has the entity tag,
+	// so the ranges of an object replaced mid-download are refused
+	ETag string
+}
+
+// ListOptions represents the options for listing objects.
+type ListOptions struct {
+	// only list the objects with keys beginning with the prefix
+	Prefix string
+	// whether to list every object under the prefix rather
+	// than the objects and common prefixes at the next level
+	Recursive bool
+	// whether to list every version and delete marker of the objects
+	WithVersions bool
+	// the maximum number of keys returned per page, 0 uses the server default
+	MaxKeys int
+	// only list the objects with keys after the key,
+	// ignored when listing the versions of the objects
+	StartAfter string
+}
+
+// Compat represents the parts of the s3 api to avoid
+// with s3 compatible stores that do not implement them.
+type Compat struct {
+	// whether to list objects with the original ListObjects
+	// api, for stores with an incomplete ListObjectsV2
+	ListV1 bool
+	// whether to remove objects one at a time, for
+	// stores without the multi-object delete api
+	SingleDelete bool
+	// whether to omit the checksum headers of uploads
+	NoChecksums bool
+	// whether to omit the tags of uploads, for
+	// stores without object tagging
+	NoTags bool
+	// whether to send CRC32C checksums instead of the MD5
+	// digests required by some requests, for FIPS mode
+	NoMD5 bool
+}
+
+// server-side encryption modes of the objects uploaded.
+const (
+	// SSES3 encrypts the objects with keys managed by s3.
+	SSES3 = "sse-s3"
+	// SSEKMS encrypts the objects with a key managed by KMS.
+	SSEKMS = "sse-kms"
+	// SSEC encrypts the objects with a key sent with every request.
+	SSEC = "sse-c"
+)
+
+// Encryption represents the server-side encryption of the objects uploaded.
+type Encryption struct {
+	// the server-side encryption mode, the default of the bucket when empty
+	Mode string
+	// the id of the KMS key for SSE-KMS, the default key of the account when empty
+	KMSKeyID string
+	// the 256-bit key for SSE-C, which is required to read the objects again
+	CustomerKey []byte
+}
+
+// Validate verifies the encryption mode is supported with its key.
+func (e Encryption) Validate() error {
+	switch e.Mode {
+	case "", SSES3, SSEKMS:
+	case SSEC:
+		if len(e.CustomerKey) != 32 {
+			return fmt.Errorf("sse-c key must be 32 bytes, got %d", len(e.CustomerKey))
+		}
+	default:
+		return fmt.Errorf("unsupported server-side encryption %s (Valid modes: %s, %s, %s)", e.Mode, SSES3, SSEKMS, SSEC)
+	}
+
+	if len(e.KMSKeyID) > 0 && e.Mode != SSEKMS {
+		return fmt.Errorf("kms key id can only be used with %s", SSEKMS)
+	}
+
+	return nil
+}
+
+// LifecycleRule represents a rule in the lifecycle configuration of a bucket.
+type LifecycleRule struct {
+	// the unique identifier of the rule in the bucket
+	ID string
+	// only apply the rule to the objects with keys beginning with the prefix
+	Prefix string
+	// the number of days after creation to expire the objects, 0 disables expiry
+	ExpireDays int
+	// the number of days after initiation to abort incomplete
+	// multipart uploads, 0 keeps the incomplete uploads
+	AbortIncompleteDays int
+}
+
+// maxConditionalSize represents the size objects uploaded with a condition
+// must stay below, as the condition requires a single request.
+const maxConditionalSize = 5 * 1024 * 1024
+
+// noLifecycleCode represents the s3 error code returned
+// when a bucket has no lifecycle configuration.
+const noLifecycleCode = "NoSuchLifecycleConfiguration"
+
+// RemoveError represents a failure to remove an object.
+type RemoveError struct {
+	// the object that could not be removed
+	Object Object
+	// the error returned for the object
+	Err error
+}
+
+// Error implements the error interface.
+func (e RemoveError) Error() string {
+	return fmt.Sprintf("unable to remove object %s: %v", e.Object.Key, e.Err)
+}
+
+// Unwrap returns the error returned for the object.
+func (e RemoveError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStorage_RemoveError(t *testing.T) {
+	// setup types
+	errDenied := errors.New("access denied")
+
+	err := RemoveError{
+		Object: Object{Key: "foo/bar/archive.tgz"},
+		Err:    errDenied,
+	}
+
+	want := "unable to remove object foo/bar/archive.tgz: access denied"
+
+	if err.Error() != want {
+		t.Errorf("Error is %s, want %s", err.Error(), want)
+	}
+
+	if !errors.Is(err, errDenied) {
+		t.Errorf("Unwrap is %v, want %v", errors.Unwrap(err), errDenied)
+	}
+}
+
+func TestStorage_Encryption_Validate(t *testing.T) {
+	// setup types
+	testCases := []struct {
+		desc       string
+		encryption Encryption
+		wantErr    bool
+	}{
+		{
+			desc:       "none",
+			encryption: Encryption{},
+		},
+		{
+			desc:       "sse-kms",
+			encryption: Encryption{Mode: SSEKMS, KMSKeyID: "alias/cache"},
+		},
+		{
+			desc:       "sse-c",
+			encryption: Encryption{Mode: SSEC, CustomerKey: make([]byte, 32)},
+		},
+		{
+			desc:       "sse-c short key",
+			encryption: Encryption{Mode: SSEC, CustomerKey: make([]byte, 16)},
+			wantErr:    true,
+		},
+		{
+			desc:       "kms key without sse-kms",
+			encryption: Encryption{Mode: SSES3, KMSKeyID: "alias/cache"},
+			wantErr:    true,
+		},
+		{
+			desc:       "unsupported",
+			encryption: Encryption{Mode: "sse-foo"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.encryption.Validate()
+			if (err != nil) != tC.wantErr {
+				t.Errorf("Validate returned err: %v", err)
+			}
+		})
+	}
+}